@@ -1,10 +1,12 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"log"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
@@ -15,19 +17,93 @@ import (
 )
 
 func main() {
+	// imcs import-rdb / export-rdb — разовый перенос dump.rdb вместо запуска сервера
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "import-rdb":
+			importRDB(os.Args[2:])
+			return
+		case "export-rdb":
+			exportRDB(os.Args[2:])
+			return
+		}
+	}
+
 	port := flag.String("port", ":6380", "TCP port to listen on")
 	dir := flag.String("dir", "./cache-files", "Directory for AOF journal")
 	auth := flag.String("auth", "", "Password for AUTH (empty = no auth)")
+	luaTimeLimit := flag.Duration("lua-time-limit", 5*time.Second, "Script run time after which SCRIPT KILL is allowed")
+	appendFsync := flag.String("appendfsync", "everysec", "AOF fsync policy: always, everysec or no")
+	save := flag.String("save", "3600 1 300 100 60 10000", "Snapshot schedule: <seconds> <changes> pairs (empty = disabled)")
+	loadCorrupt := flag.String("aof-load-corrupt", "truncate", "Corrupt AOF records on startup: truncate, skip (quarantine them) or refuse")
+	maxMemory := flag.String("maxmemory", "0", "Memory limit for keys and values, e.g. 200mb (0 = no limit)")
+	maxMemoryPolicy := flag.String("maxmemory-policy", "noeviction", "Eviction policy over maxmemory: noeviction, allkeys-lru, volatile-lru, allkeys-lfu, volatile-lfu, allkeys-random or volatile-ttl")
+	maxMemorySamples := flag.Int("maxmemory-samples", 5, "Keys sampled per eviction candidate lookup: higher is closer to exact LRU/LFU but slower")
+	lfuLogFactor := flag.Int("lfu-log-factor", 10, "LFU counter growth: higher means more hits to reach the maximum")
+	lfuDecayTime := flag.Int("lfu-decay-time", 1, "Minutes without access after which the LFU counter is decremented (0 = never)")
+	coldIdleTime := flag.Duration("cold-idle-time", 5*time.Minute, "Idle time after which a string is moved to cold storage (0 = only under maxmemory)")
+	coldSamples := flag.Int("cold-samples", 16, "Keys per shard checked on each cold eviction pass")
+	coldInterval := flag.Duration("cold-interval", 10*time.Second, "How often idle keys are moved to cold storage")
+	coldFlushInterval := flag.Duration("cold-flush-interval", 30*time.Second, "How often cold storage is fsynced and compacted")
+	coldMaxSize := flag.String("cold-max-size", "0", "Cold storage size limit on disk, e.g. 10gb (0 = no limit)")
+	coldMinValueSize := flag.String("cold-min-value-size", "0", "Shorter values are never moved to cold storage")
+	coldAllow := flag.String("cold-allow", "", "Glob patterns of keys allowed into cold storage, space-separated (empty = all)")
+	coldDeny := flag.String("cold-deny", "", "Glob patterns of keys kept out of cold storage, space-separated")
 	flag.Parse()
 
+	fsyncPolicy, err := AOF.ParseFsyncPolicy(*appendFsync)
+	if err != nil {
+		log.Fatal(err)
+	}
+	saveRules, err := AOF.ParseSaveRules(*save)
+	if err != nil {
+		log.Fatal(err)
+	}
+	corruptPolicy, err := AOF.ParseCorruptPolicy(*loadCorrupt)
+	if err != nil {
+		log.Fatal(err)
+	}
+	memoryLimit, err := server.ParseMemory(*maxMemory)
+	if err != nil {
+		log.Fatal("maxmemory: ", err)
+	}
+	evictionPolicy, err := storage.ParseEvictionPolicy(*maxMemoryPolicy)
+	if err != nil {
+		log.Fatal(err)
+	}
+	coldLimit, err := server.ParseMemory(*coldMaxSize)
+	if err != nil {
+		log.Fatal("cold-max-size: ", err)
+	}
+	coldMinValue, err := server.ParseMemory(*coldMinValueSize)
+	if err != nil {
+		log.Fatal("cold-min-value-size: ", err)
+	}
+
 	// Создаём AOF-персистер
 	persister, err := AOF.NewPersister(*dir)
 	if err != nil {
 		log.Fatal("cannot open AOF:", err)
 	}
+	persister.SetFsyncPolicy(fsyncPolicy)
+	persister.SetSaveRules(saveRules)
+	persister.SetCorruptPolicy(corruptPolicy)
 
 	// Создаём шардированный кеш
 	cache := storage.New(persister)
+	cache.SetMaxMemory(memoryLimit, evictionPolicy)
+	cache.SetEvictionSamples(*maxMemorySamples)
+	cache.SetLFU(*lfuLogFactor, *lfuDecayTime)
+	cache.SetColdPolicy(storage.ColdPolicy{
+		IdleTime:      *coldIdleTime,
+		Samples:       *coldSamples,
+		MaxSize:       coldLimit,
+		MinValueSize:  int(coldMinValue),
+		Allow:         strings.Fields(*coldAllow),
+		Deny:          strings.Fields(*coldDeny),
+		Interval:      *coldInterval,
+		FlushInterval: *coldFlushInterval,
+	})
 
 	// Инициализируем cold storage
 	if err := cache.InitColdStorage(*dir); err != nil {
@@ -38,35 +114,33 @@ func main() {
 	j := janitor.New(cache)
 	j.Start()
 
-	// Восстанавливаем данные из AOF с CRC64 проверкой
-	result, err := persister.Read(func(cmd, key, value string, expire int64) {
-		switch cmd {
-		case "SET":
-			if expire > 0 && expire < time.Now().UnixNano() {
-				return
-			}
-			var ttl time.Duration
-			if expire > 0 {
-				ttl = time.Duration(expire-time.Now().UnixNano()) * time.Nanosecond
-			}
-			cache.Set(key, value, ttl, false)
-		case "DEL":
-			cache.Delete(key)
-		}
-	})
-	if err != nil {
+	// Восстанавливаем данные: снимок и хвост AOF с CRC64 проверкой
+	result, err := persister.Read(cache.Replay)
+	if errors.Is(err, AOF.ErrCorrupt) {
+		log.Fatalf("%v: repair it with imcs-check-aof -fix %s or start with -aof-load-corrupt skip", err, *dir)
+	} else if err != nil {
 		log.Println("warning: AOF restore error:", err)
 	}
 	if result != nil {
+		if result.SnapshotKeys > 0 {
+			log.Printf("snapshot: loaded %d keys", result.SnapshotKeys)
+		}
 		log.Printf("AOF: loaded %d entries", result.ValidEntries)
 		if result.Truncated {
 			log.Printf("AOF: truncated at offset %d (%d corrupt entries discarded)",
 				result.TruncatedAt, result.CorruptEntries)
 		}
+		if result.Skipped > 0 {
+			log.Printf("AOF: skipped %d corrupt entries (%d bytes moved to quarantine)",
+				result.CorruptEntries, result.Skipped)
+		}
 	}
 
+	// Auto-rewrite журнала по порогам auto-aof-rewrite-* и снимки по save
+	persister.SetSnapshot(cache.Snapshot)
+
 	// Создаём сервер с опциональным AUTH
-	var opts []server.Option
+	opts := []server.Option{server.WithScriptTimeLimit(*luaTimeLimit), server.WithAOF(persister)}
 	if *auth != "" {
 		opts = append(opts, server.WithAuth(*auth))
 	}
@@ -1,3 +1,5 @@
 module imcs
 
 go 1.25.6
+
+require github.com/yuin/gopher-lua v1.1.2
@@ -19,19 +19,45 @@
 package imcs
 
 import (
+	"context"
+	"errors"
+	"io"
+	"iter"
 	"time"
 
 	"imcs/internal/persistence/AOF"
+	"imcs/internal/persistence/RDB"
+	"imcs/internal/pubsub"
 	"imcs/internal/server"
 	"imcs/internal/storage/cache"
 	"imcs/internal/storage/janitor"
 )
 
+var (
+	// ErrWrongType — операция над ключом другого типа (например, HSET по строке).
+	ErrWrongType = storage.ErrWrongType
+
+	// ErrTxReadOnly — запись внутри View.
+	ErrTxReadOnly = storage.ErrTxReadOnly
+
+	// ErrCorruptAOF — журнал повреждён, а Options.AOFLoadCorrupt не
+	// позволяет его обойти (CorruptRefuse или повреждён не последний файл).
+	ErrCorruptAOF = AOF.ErrCorrupt
+
+	// ErrOOM — запись не помещается в Options.MaxMemory, а политика
+	// вытеснения не позволяет освободить место.
+	ErrOOM = storage.ErrOOM
+
+	// ErrOddPairs — нечётное число аргументов там, где ожидаются пары.
+	ErrOddPairs = errors.New("imcs: odd number of arguments, expected pairs")
+)
+
 // DB — встраиваемый кеш. Создаётся через Open().
 type DB struct {
 	cache     *storage.Cache
 	persister *AOF.AOFPersister
 	janitor   *janitor.Janitor
+	bus       *pubsub.Bus
 	srv       *server.Server
 }
 
@@ -47,13 +73,134 @@ func Open(dir string) (*DB, error) {
 // Options содержит опциональные настройки.
 type Options struct {
 	// MaxKeys — максимальное кол-во ключей (0 = без лимита).
-	// При превышении лимита включается LRU eviction.
+	// При превышении лимита ключи вытесняются по EvictionPolicy
+	// (по умолчанию — LRU), в фоне; пока вытеснение догоняет записи,
+	// ключей может быть до 1/32 больше лимита.
 	MaxKeys int64
 
+	// MaxMemory — лимит памяти под ключи и значения в байтах (0 = без
+	// лимита). Учёт приблизительный: размер данных плюс накладные расходы
+	// структур, без памяти рантайма Go и журнала.
+	MaxMemory int64
+
+	// EvictionPolicy — кого вытеснять при превышении MaxMemory и MaxKeys.
+	// По умолчанию NoEviction: сверх MaxMemory записи отклоняются с ErrOOM,
+	// а MaxKeys вытесняет по LRU. AllKeysLFU бережёт часто
+	// читаемые ключи, даже если к ним давно не обращались.
+	EvictionPolicy EvictionPolicy
+
+	// EvictionSamples — сколько ключей смотрит одна выборка кандидатов
+	// на вытеснение (maxmemory-samples, 0 = 5). Больше — ближе к точному
+	// LRU/LFU, но дороже каждое вытеснение.
+	EvictionSamples int
+
+	// LFULogFactor — насколько медленно растёт LFU-счётчик (lfu-log-factor
+	// в Redis): при 10 до максимума 255 он доходит примерно за миллион
+	// обращений (0 = 10, отрицательное — счётчик растёт на каждом).
+	LFULogFactor int
+
+	// LFUDecayTime — за сколько времени без обращений LFU-счётчик
+	// уменьшается на 1 (lfu-decay-time, с точностью до минуты; 0 = 1
+	// минута, отрицательное — не уменьшается).
+	LFUDecayTime time.Duration
+
+	// ColdIdleTime — через сколько времени без обращений строка
+	// выгружается в cold storage на диск (0 = 5 минут, отрицательное —
+	// только при вытеснении по MaxMemory).
+	ColdIdleTime time.Duration
+
+	// ColdSamples — сколько ключей каждого шарда смотрит один проход
+	// выгрузки (0 = 16).
+	ColdSamples int
+
+	// ColdInterval — как часто идёт выгрузка (0 = 10 секунд), а
+	// ColdFlushInterval — fsync и компактизация cold storage (0 = 30 секунд).
+	ColdInterval      time.Duration
+	ColdFlushInterval time.Duration
+
+	// ColdMaxSize — лимит cold storage на диске в байтах (0 = без лимита).
+	// Сверх него строки не выгружаются, а вытесняемые по MaxMemory
+	// удаляются.
+	ColdMaxSize int64
+
+	// ColdMinValueSize — значения короче не выгружаются: для них индекс
+	// в RAM почти не меньше самого ключа.
+	ColdMinValueSize int
+
+	// ColdAllow и ColdDeny — glob-шаблоны ключей (как в KEYS): в cold
+	// storage уходят только ключи, подходящие под один из ColdAllow
+	// (пустой — любые) и ни под один из ColdDeny.
+	ColdAllow []string
+	ColdDeny  []string
+
 	// Password — пароль для TCP-сервера (пустой = без AUTH).
 	Password string
+
+	// AppendFsync — когда журнал сбрасывается на диск (по умолчанию
+	// FsyncEverySec). FsyncAlways: каждая запись durable к возврату из
+	// метода, конкурентные записи делят один fsync. Сбой записи журнала
+	// методы с error и Update возвращают как *WriteError.
+	AppendFsync FsyncPolicy
+
+	// AOFRewritePercentage — auto-rewrite журнала, когда он вырос на столько
+	// процентов с последнего rewrite (0 = 100%, отрицательное — выключить).
+	AOFRewritePercentage int64
+
+	// AOFRewriteMinSize — журнал меньше этого размера не переписывается
+	// автоматически (0 = 64MB).
+	AOFRewriteMinSize int64
+
+	// SaveRules — расписание снимков (save в redis.conf). nil — по
+	// умолчанию "3600 1 300 100 60 10000", пустой срез — выключить.
+	SaveRules []SaveRule
+
+	// AOFLoadCorrupt — что делать с повреждёнными записями журнала при
+	// открытии: CorruptTruncate (по умолчанию) обрезает журнал на первой,
+	// CorruptSkip переносит их в карантин и загружает остальное,
+	// CorruptRefuse — Open возвращает ErrCorruptAOF.
+	AOFLoadCorrupt CorruptPolicy
 }
 
+// SaveRule — снимок по расписанию: прошло Seconds секунд и было не меньше
+// Changes изменений.
+type SaveRule = AOF.SaveRule
+
+// FsyncPolicy — политика fsync журнала (appendfsync в Redis).
+type FsyncPolicy = AOF.FsyncPolicy
+
+const (
+	FsyncEverySec = AOF.FsyncEverySec
+	FsyncAlways   = AOF.FsyncAlways
+	FsyncNo       = AOF.FsyncNo
+)
+
+// WriteError — журнал не удалось записать на диск: изменение уже
+// применено в памяти, но может не пережить рестарт.
+type WriteError = AOF.WriteError
+
+// EvictionPolicy — политика вытеснения при превышении MaxMemory
+// (maxmemory-policy в Redis).
+type EvictionPolicy = storage.EvictionPolicy
+
+const (
+	NoEviction    = storage.NoEviction
+	AllKeysLRU    = storage.AllKeysLRU
+	VolatileLRU   = storage.VolatileLRU
+	AllKeysLFU    = storage.AllKeysLFU
+	VolatileLFU   = storage.VolatileLFU
+	AllKeysRandom = storage.AllKeysRandom
+	VolatileTTL   = storage.VolatileTTL
+)
+
+// CorruptPolicy — что делать с повреждённым журналом при открытии.
+type CorruptPolicy = AOF.CorruptPolicy
+
+const (
+	CorruptTruncate = AOF.CorruptTruncate
+	CorruptSkip     = AOF.CorruptSkip
+	CorruptRefuse   = AOF.CorruptRefuse
+)
+
 // OpenWithOptions создаёт кеш с дополнительными настройками.
 func OpenWithOptions(dir string, opts Options) (*DB, error) {
 	persister, err := AOF.NewPersister(dir)
@@ -61,28 +208,68 @@ func OpenWithOptions(dir string, opts Options) (*DB, error) {
 		return nil, err
 	}
 
+	persister.SetFsyncPolicy(opts.AppendFsync)
+	persister.SetCorruptPolicy(opts.AOFLoadCorrupt)
+	percentage, minSize := persister.AutoRewrite()
+	if opts.AOFRewritePercentage != 0 {
+		percentage = max(opts.AOFRewritePercentage, 0)
+	}
+	if opts.AOFRewriteMinSize > 0 {
+		minSize = opts.AOFRewriteMinSize
+	}
+	persister.SetAutoRewrite(percentage, minSize)
+	if opts.SaveRules != nil {
+		persister.SetSaveRules(opts.SaveRules)
+	}
+
 	cache := storage.NewWithMaxKeys(persister, opts.MaxKeys)
+	cache.SetMaxMemory(opts.MaxMemory, opts.EvictionPolicy)
+	if opts.EvictionSamples > 0 {
+		cache.SetEvictionSamples(opts.EvictionSamples)
+	}
+	logFactor, decayTime := cache.LFU()
+	if opts.LFULogFactor != 0 {
+		logFactor = max(opts.LFULogFactor, 0)
+	}
+	if opts.LFUDecayTime > 0 {
+		decayTime = max(int(opts.LFUDecayTime/time.Minute), 1)
+	} else if opts.LFUDecayTime < 0 {
+		decayTime = 0
+	}
+	cache.SetLFU(logFactor, decayTime)
+
+	coldPolicy := cache.ColdPolicy()
+	if opts.ColdIdleTime > 0 {
+		coldPolicy.IdleTime = opts.ColdIdleTime
+	} else if opts.ColdIdleTime < 0 {
+		coldPolicy.IdleTime = 0
+	}
+	if opts.ColdSamples > 0 {
+		coldPolicy.Samples = opts.ColdSamples
+	}
+	if opts.ColdInterval > 0 {
+		coldPolicy.Interval = opts.ColdInterval
+	}
+	if opts.ColdFlushInterval > 0 {
+		coldPolicy.FlushInterval = opts.ColdFlushInterval
+	}
+	coldPolicy.MaxSize = opts.ColdMaxSize
+	coldPolicy.MinValueSize = opts.ColdMinValueSize
+	coldPolicy.Allow = opts.ColdAllow
+	coldPolicy.Deny = opts.ColdDeny
+	cache.SetColdPolicy(coldPolicy)
 
 	if err := cache.InitColdStorage(dir); err != nil {
 		// Cold storage не критичен — продолжаем без него
 	}
 
-	// Восстанавливаем данные из AOF
-	persister.Read(func(cmd, key, value string, expire int64) {
-		switch cmd {
-		case "SET":
-			if expire > 0 && expire < time.Now().UnixNano() {
-				return
-			}
-			var ttl time.Duration
-			if expire > 0 {
-				ttl = time.Duration(expire-time.Now().UnixNano()) * time.Nanosecond
-			}
-			cache.Set(key, value, ttl, false)
-		case "DEL":
-			cache.Delete(key)
-		}
-	})
+	// Восстанавливаем данные: снимок (если есть) и хвост AOF
+	if _, err := persister.Read(cache.Replay); errors.Is(err, AOF.ErrCorrupt) {
+		cache.Close()
+		persister.Close()
+		return nil, err
+	}
+	persister.SetSnapshot(cache.Snapshot)
 
 	j := janitor.New(cache)
 	j.Start()
@@ -91,6 +278,7 @@ func OpenWithOptions(dir string, opts Options) (*DB, error) {
 		cache:     cache,
 		persister: persister,
 		janitor:   j,
+		bus:       pubsub.New(),
 	}, nil
 }
 
@@ -98,11 +286,12 @@ func OpenWithOptions(dir string, opts Options) (*DB, error) {
 
 // Set устанавливает значение с опциональным TTL.
 // TTL = 0 означает без ограничения по времени.
+// Ошибка — ErrOOM (запись не поместилась в MaxMemory) или *WriteError.
 //
 //	db.Set("session:abc", "token", 30*time.Minute)
 //	db.Set("config", "value", 0)  // вечный ключ
-func (db *DB) Set(key, value string, ttl time.Duration) {
-	db.cache.Set(key, value, ttl, false)
+func (db *DB) Set(key, value string, ttl time.Duration) error {
+	return db.cache.Set(key, value, ttl, false)
 }
 
 // SetNX устанавливает значение только если ключ НЕ существует.
@@ -110,7 +299,11 @@ func (db *DB) Set(key, value string, ttl time.Duration) {
 //
 //	ok := db.SetNX("lock:resource", "owner", 10*time.Second)
 func (db *DB) SetNX(key, value string, ttl time.Duration) bool {
-	return db.cache.Set(key, value, ttl, true) == nil
+	switch db.cache.Set(key, value, ttl, true) {
+	case storage.ErrKeyExist, storage.ErrOOM:
+		return false
+	}
+	return true
 }
 
 // Get возвращает значение по ключу.
@@ -163,12 +356,14 @@ func (db *DB) Exists(keys ...string) int64 {
 //
 //	db.Expire("session", 30*time.Minute)
 func (db *DB) Expire(key string, ttl time.Duration) bool {
-	return db.cache.Expire(key, ttl)
+	ok, _ := db.cache.Expire(key, ttl)
+	return ok
 }
 
 // Persist убирает TTL — делает ключ вечным.
 func (db *DB) Persist(key string) bool {
-	return db.cache.Persist(key)
+	ok, _ := db.cache.Persist(key)
+	return ok
 }
 
 // TTL возвращает оставшееся время жизни.
@@ -185,9 +380,43 @@ func (db *DB) Keys(pattern string) []string {
 	return db.cache.Keys(pattern)
 }
 
+// scanBatch — сколько слотов Scan просматривает за один захват шарда.
+const scanBatch = 256
+
+// Scan перебирает ключи по glob-паттерну порциями, не блокируя кеш
+// целиком и не собирая все ключи в память. Ключ, живший весь обход,
+// встретится хотя бы раз (возможно, дважды). Обход прекращается
+// при отмене ctx.
+//
+//	for key := range db.Scan(ctx, "user:*") {
+//	    fmt.Println(key)
+//	}
+func (db *DB) Scan(ctx context.Context, pattern string) iter.Seq[string] {
+	return func(yield func(string) bool) {
+		opts := storage.ScanOptions{Match: pattern, Count: scanBatch}
+		var cursor uint64
+		for {
+			if ctx.Err() != nil {
+				return
+			}
+			var keys []string
+			cursor, keys = db.cache.Scan(cursor, opts)
+			for _, key := range keys {
+				if !yield(key) {
+					return
+				}
+			}
+			if cursor == 0 {
+				return
+			}
+		}
+	}
+}
+
 // Rename переименовывает ключ.
 func (db *DB) Rename(oldKey, newKey string) bool {
-	return db.cache.Rename(oldKey, newKey)
+	ok, _ := db.cache.Rename(oldKey, newKey)
+	return ok
 }
 
 // Len возвращает количество ключей в кеше.
@@ -197,11 +426,15 @@ func (db *DB) Len() int64 {
 
 // ─── Batch Operations ───────────────────────────────────────────────
 
-// MSet массовая установка пар ключ-значение.
+// MSet массовая установка пар ключ-значение. На ErrOOM останавливается:
+// пары до неё уже записаны, остальные — нет.
 //
 //	db.MSet("k1", "v1", "k2", "v2", "k3", "v3")
-func (db *DB) MSet(pairs ...string) {
-	db.cache.MSet(pairs...)
+func (db *DB) MSet(pairs ...string) error {
+	if len(pairs)%2 != 0 {
+		return ErrOddPairs
+	}
+	return db.cache.MSet(pairs...)
 }
 
 // MGet массовое чтение ключей.
@@ -220,15 +453,550 @@ func (db *DB) MGet(keys ...string) []struct {
 // ─── String Operations ──────────────────────────────────────────────
 
 // Append дописывает к значению ключа. Возвращает новую длину.
-func (db *DB) Append(key, value string) int {
+// Для ключа другого типа — ErrWrongType.
+func (db *DB) Append(key, value string) (int, error) {
 	return db.cache.Append(key, value)
 }
 
-// Strlen возвращает длину строки.
-func (db *DB) Strlen(key string) int {
+// Strlen возвращает длину строки. Для ключа другого типа — ErrWrongType.
+func (db *DB) Strlen(key string) (int, error) {
 	return db.cache.Strlen(key)
 }
 
+// ─── Hashes ─────────────────────────────────────────────────────────
+
+// HSet записывает пары поле-значение в хеш. Возвращает число новых полей.
+//
+//	db.HSet("user:1", "name", "John", "age", "30")
+func (db *DB) HSet(key string, pairs ...string) (int, error) {
+	if len(pairs)%2 != 0 {
+		return 0, ErrOddPairs
+	}
+	return db.cache.HSet(key, pairs...)
+}
+
+// HSetNX записывает поле, только если его ещё нет.
+func (db *DB) HSetNX(key, field, value string) (bool, error) {
+	return db.cache.HSetNX(key, field, value)
+}
+
+// HGet возвращает значение поля хеша.
+//
+//	name, ok := db.HGet("user:1", "name")
+func (db *DB) HGet(key, field string) (string, bool) {
+	val, found, _ := db.cache.HGet(key, field)
+	return val, found
+}
+
+// HMGet возвращает значения нескольких полей хеша.
+func (db *DB) HMGet(key string, fields ...string) []struct {
+	Value string
+	Found bool
+} {
+	results, err := db.cache.HMGet(key, fields...)
+	if err != nil {
+		return make([]struct {
+			Value string
+			Found bool
+		}, len(fields))
+	}
+	return results
+}
+
+// HGetAll возвращает копию всего хеша (пустую map, если ключа нет).
+func (db *DB) HGetAll(key string) map[string]string {
+	hash, err := db.cache.HGetAll(key)
+	if err != nil {
+		return map[string]string{}
+	}
+	return hash
+}
+
+// HDel удаляет поля хеша. Возвращает число удалённых.
+func (db *DB) HDel(key string, fields ...string) int {
+	n, _ := db.cache.HDel(key, fields...)
+	return n
+}
+
+// HExists проверяет наличие поля в хеше.
+func (db *DB) HExists(key, field string) bool {
+	found, _ := db.cache.HExists(key, field)
+	return found
+}
+
+// HLen возвращает количество полей хеша.
+func (db *DB) HLen(key string) int {
+	n, _ := db.cache.HLen(key)
+	return n
+}
+
+// HKeys возвращает все поля хеша.
+func (db *DB) HKeys(key string) []string {
+	fields, _ := db.cache.HKeys(key)
+	return fields
+}
+
+// HVals возвращает все значения хеша.
+func (db *DB) HVals(key string) []string {
+	values, _ := db.cache.HVals(key)
+	return values
+}
+
+// HIncrBy атомарно прибавляет delta к числовому полю хеша.
+//
+//	visits, _ := db.HIncrBy("stats:page", "visits", 1)
+func (db *DB) HIncrBy(key, field string, delta int64) (int64, error) {
+	return db.cache.HIncrBy(key, field, delta)
+}
+
+// ─── Lists ──────────────────────────────────────────────────────────
+
+// LPush добавляет элементы в начало списка. Возвращает новую длину.
+func (db *DB) LPush(key string, values ...string) (int, error) {
+	return db.cache.LPush(key, values...)
+}
+
+// RPush добавляет элементы в конец списка. Возвращает новую длину.
+//
+//	db.RPush("jobs", "job:1", "job:2")
+func (db *DB) RPush(key string, values ...string) (int, error) {
+	return db.cache.RPush(key, values...)
+}
+
+// LPop извлекает первый элемент списка.
+func (db *DB) LPop(key string) (string, bool) {
+	values, _ := db.cache.LPop(key, 1)
+	if len(values) == 0 {
+		return "", false
+	}
+	return values[0], true
+}
+
+// RPop извлекает последний элемент списка.
+func (db *DB) RPop(key string) (string, bool) {
+	values, _ := db.cache.RPop(key, 1)
+	if len(values) == 0 {
+		return "", false
+	}
+	return values[0], true
+}
+
+// LRange возвращает элементы в диапазоне [start, stop].
+// Отрицательные индексы считаются с конца: LRange(key, 0, -1) — весь список.
+func (db *DB) LRange(key string, start, stop int) []string {
+	values, _ := db.cache.LRange(key, start, stop)
+	return values
+}
+
+// LLen возвращает длину списка.
+func (db *DB) LLen(key string) int {
+	n, _ := db.cache.LLen(key)
+	return n
+}
+
+// LIndex возвращает элемент по индексу.
+func (db *DB) LIndex(key string, index int) (string, bool) {
+	value, found, _ := db.cache.LIndex(key, index)
+	return value, found
+}
+
+// LSet заменяет элемент по индексу.
+func (db *DB) LSet(key string, index int, value string) error {
+	return db.cache.LSet(key, index, value)
+}
+
+// LRem удаляет count вхождений value (count < 0 — с конца, 0 — все).
+func (db *DB) LRem(key string, count int, value string) int {
+	n, _ := db.cache.LRem(key, count, value)
+	return n
+}
+
+// LTrim оставляет в списке только диапазон [start, stop].
+func (db *DB) LTrim(key string, start, stop int) error {
+	return db.cache.LTrim(key, start, stop)
+}
+
+// LMove атомарно перекладывает элемент из src в dst.
+// fromLeft/toLeft — брать из начала src и класть в начало dst.
+//
+//	job, ok := db.LMove("jobs", "jobs:processing", true, false)
+func (db *DB) LMove(src, dst string, fromLeft, toLeft bool) (value string, moved bool) {
+	// Под Shared: группа MULTI/EXEC не попадёт внутрь чужого EXEC
+	db.cache.Shared(func() {
+		value, moved, _ = db.cache.LMove(src, dst, fromLeft, toLeft)
+	})
+	return value, moved
+}
+
+// BLPop ждёт элемент в начале первого непустого списка из keys.
+// timeout = 0 — ждать, пока не отменят ctx.
+//
+//	key, job, ok := db.BLPop(ctx, 5*time.Second, "jobs")
+func (db *DB) BLPop(ctx context.Context, timeout time.Duration, keys ...string) (key, value string, ok bool) {
+	key, value, ok, _ = db.cache.BPop(ctx, keys, true, timeout)
+	return key, value, ok
+}
+
+// BRPop — как BLPop, но берёт элемент с конца списка.
+func (db *DB) BRPop(ctx context.Context, timeout time.Duration, keys ...string) (key, value string, ok bool) {
+	key, value, ok, _ = db.cache.BPop(ctx, keys, false, timeout)
+	return key, value, ok
+}
+
+// BLMove — блокирующий LMove: ждёт появления элемента в src.
+func (db *DB) BLMove(ctx context.Context, src, dst string, fromLeft, toLeft bool, timeout time.Duration) (string, bool) {
+	value, moved, _ := db.cache.BLMove(ctx, src, dst, fromLeft, toLeft, timeout)
+	return value, moved
+}
+
+// ─── Sets ───────────────────────────────────────────────────────────
+
+// SAdd добавляет элементы во множество. Возвращает число новых.
+//
+//	db.SAdd("tags:post:1", "go", "redis")
+func (db *DB) SAdd(key string, members ...string) (int, error) {
+	return db.cache.SAdd(key, members...)
+}
+
+// SRem удаляет элементы из множества. Возвращает число удалённых.
+func (db *DB) SRem(key string, members ...string) int {
+	n, _ := db.cache.SRem(key, members...)
+	return n
+}
+
+// SIsMember проверяет принадлежность элемента множеству.
+func (db *DB) SIsMember(key, member string) bool {
+	ok, _ := db.cache.SIsMember(key, member)
+	return ok
+}
+
+// SMembers возвращает все элементы множества (порядок не определён).
+func (db *DB) SMembers(key string) []string {
+	members, _ := db.cache.SMembers(key)
+	return members
+}
+
+// SCard возвращает мощность множества.
+func (db *DB) SCard(key string) int {
+	n, _ := db.cache.SCard(key)
+	return n
+}
+
+// SPop извлекает случайный элемент множества.
+func (db *DB) SPop(key string) (string, bool) {
+	members, _ := db.cache.SPop(key, 1)
+	if len(members) == 0 {
+		return "", false
+	}
+	return members[0], true
+}
+
+// SRandMember возвращает до count случайных элементов, не удаляя их.
+// Отрицательный count допускает повторы.
+func (db *DB) SRandMember(key string, count int) []string {
+	members, _ := db.cache.SRandMember(key, count)
+	return members
+}
+
+// SInter возвращает пересечение множеств.
+//
+//	common, _ := db.SInter("tags:post:1", "tags:post:2")
+func (db *DB) SInter(keys ...string) ([]string, error) {
+	return db.cache.SInter(keys...)
+}
+
+// SUnion возвращает объединение множеств.
+func (db *DB) SUnion(keys ...string) ([]string, error) {
+	return db.cache.SUnion(keys...)
+}
+
+// SDiff возвращает элементы первого множества, которых нет в остальных.
+func (db *DB) SDiff(keys ...string) ([]string, error) {
+	return db.cache.SDiff(keys...)
+}
+
+// SInterStore сохраняет пересечение в dst. Возвращает мощность результата.
+func (db *DB) SInterStore(dst string, keys ...string) (int, error) {
+	return db.cache.SInterStore(dst, keys...)
+}
+
+// SUnionStore сохраняет объединение в dst.
+func (db *DB) SUnionStore(dst string, keys ...string) (int, error) {
+	return db.cache.SUnionStore(dst, keys...)
+}
+
+// SDiffStore сохраняет разность в dst.
+func (db *DB) SDiffStore(dst string, keys ...string) (int, error) {
+	return db.cache.SDiffStore(dst, keys...)
+}
+
+// ─── Sorted Sets ────────────────────────────────────────────────────
+
+// ZMember — элемент sorted set: member и его score.
+type ZMember = storage.ZMember
+
+// ZAddOptions — флаги ZAdd (NX, XX, GT, LT, CH), как у Redis ZADD.
+type ZAddOptions = storage.ZAddOptions
+
+// ScoreRange — диапазон по score для ZRangeByScore/ZCount/ZRemRangeByScore.
+// Бесконечные границы задаются math.Inf.
+type ScoreRange = storage.ScoreRange
+
+// LexRange — лексикографический диапазон для ZRangeByLex.
+type LexRange = storage.LexRange
+
+// ZAdd добавляет элементы или обновляет их score. Возвращает число новых.
+//
+//	db.ZAdd("leaderboard", imcs.ZMember{Member: "alice", Score: 1200})
+func (db *DB) ZAdd(key string, members ...ZMember) (int, error) {
+	return db.cache.ZAdd(key, ZAddOptions{}, members...)
+}
+
+// ZAddWithOptions — ZAdd с флагами NX/XX/GT/LT/CH.
+//
+//	// рекорд обновляется, только если он лучше прежнего
+//	db.ZAddWithOptions("best", imcs.ZAddOptions{GT: true}, imcs.ZMember{Member: "bob", Score: 90})
+func (db *DB) ZAddWithOptions(key string, opts ZAddOptions, members ...ZMember) (int, error) {
+	return db.cache.ZAdd(key, opts, members...)
+}
+
+// ZIncrBy прибавляет incr к score элемента. Возвращает новый score.
+func (db *DB) ZIncrBy(key, member string, incr float64) (float64, error) {
+	score, _, err := db.cache.ZIncrBy(key, ZAddOptions{}, member, incr)
+	return score, err
+}
+
+// ZRem удаляет элементы. Возвращает число удалённых.
+func (db *DB) ZRem(key string, members ...string) int {
+	n, _ := db.cache.ZRem(key, members...)
+	return n
+}
+
+// ZScore возвращает score элемента.
+func (db *DB) ZScore(key, member string) (float64, bool) {
+	score, found, _ := db.cache.ZScore(key, member)
+	return score, found
+}
+
+// ZCard возвращает число элементов sorted set.
+func (db *DB) ZCard(key string) int {
+	n, _ := db.cache.ZCard(key)
+	return n
+}
+
+// ZRank возвращает позицию элемента по возрастанию score (с нуля).
+func (db *DB) ZRank(key, member string) (int, bool) {
+	rank, _, found, _ := db.cache.ZRank(key, member, false)
+	return rank, found
+}
+
+// ZRevRank возвращает позицию элемента по убыванию score.
+//
+//	place, _ := db.ZRevRank("leaderboard", "alice") // 0 — первое место
+func (db *DB) ZRevRank(key, member string) (int, bool) {
+	rank, _, found, _ := db.cache.ZRank(key, member, true)
+	return rank, found
+}
+
+// ZRange возвращает элементы с позиций [start, stop] по возрастанию score.
+// Отрицательные индексы считаются с конца.
+func (db *DB) ZRange(key string, start, stop int) []ZMember {
+	members, _ := db.cache.ZRange(key, start, stop, false)
+	return members
+}
+
+// ZRevRange — как ZRange, но по убыванию score.
+//
+//	top10 := db.ZRevRange("leaderboard", 0, 9)
+func (db *DB) ZRevRange(key string, start, stop int) []ZMember {
+	members, _ := db.cache.ZRange(key, start, stop, true)
+	return members
+}
+
+// ZRangeByScore возвращает элементы с score из r по возрастанию:
+// пропускает offset и берёт не больше count (count < 0 — все).
+//
+//	recent := db.ZRangeByScore("events", imcs.ScoreRange{Min: from, Max: math.Inf(1)}, 0, -1)
+func (db *DB) ZRangeByScore(key string, r ScoreRange, offset, count int) []ZMember {
+	members, _ := db.cache.ZRangeByScore(key, r, false, offset, count)
+	return members
+}
+
+// ZRevRangeByScore — как ZRangeByScore, но по убыванию score.
+func (db *DB) ZRevRangeByScore(key string, r ScoreRange, offset, count int) []ZMember {
+	members, _ := db.cache.ZRangeByScore(key, r, true, offset, count)
+	return members
+}
+
+// ZRangeByLex возвращает элементы из лексикографического диапазона r
+// (для элементов с одинаковым score).
+func (db *DB) ZRangeByLex(key string, r LexRange, offset, count int) []ZMember {
+	members, _ := db.cache.ZRangeByLex(key, r, false, offset, count)
+	return members
+}
+
+// ZCount возвращает число элементов с score из r.
+func (db *DB) ZCount(key string, r ScoreRange) int {
+	n, _ := db.cache.ZCount(key, r)
+	return n
+}
+
+// ZRemRangeByScore удаляет элементы с score из r. Возвращает число удалённых.
+//
+//	// скользящее окно: выбрасываем события старше минуты
+//	db.ZRemRangeByScore("hits:ip", imcs.ScoreRange{Min: math.Inf(-1), Max: cutoff})
+func (db *DB) ZRemRangeByScore(key string, r ScoreRange) int {
+	n, _ := db.cache.ZRemRangeByScore(key, r)
+	return n
+}
+
+// ZPopMin извлекает до count элементов с наименьшим score.
+func (db *DB) ZPopMin(key string, count int) []ZMember {
+	members, _ := db.cache.ZPopMin(key, count)
+	return members
+}
+
+// ZPopMax извлекает до count элементов с наибольшим score.
+func (db *DB) ZPopMax(key string, count int) []ZMember {
+	members, _ := db.cache.ZPopMax(key, count)
+	return members
+}
+
+// ZUnionStore сохраняет в dst объединение sorted sets, складывая score.
+// Возвращает число элементов результата.
+func (db *DB) ZUnionStore(dst string, keys ...string) (int, error) {
+	return db.cache.ZUnionStore(dst, keys, nil, storage.AggregateSum)
+}
+
+// ZInterStore сохраняет в dst пересечение sorted sets, складывая score.
+func (db *DB) ZInterStore(dst string, keys ...string) (int, error) {
+	return db.cache.ZInterStore(dst, keys, nil, storage.AggregateSum)
+}
+
+// ─── Pub/Sub ────────────────────────────────────────────────────────
+
+// Message — сообщение pub/sub. Pattern заполнен для подписок по шаблону.
+type Message = pubsub.Message
+
+// subscribeBuffer — буфер встроенного подписчика. Кто не успевает читать
+// и переполняет его, отключается: канал закрывается раньше отмены ctx.
+const subscribeBuffer = 1024
+
+// Subscribe подписывается на каналы. Шина общая с TCP-клиентами:
+// сюда приходят и PUBLISH по сети. Канал закрывается при отмене ctx.
+//
+//	msgs := db.Subscribe(ctx, "news")
+//	for msg := range msgs {
+//	    fmt.Println(msg.Channel, msg.Payload)
+//	}
+func (db *DB) Subscribe(ctx context.Context, channels ...string) <-chan Message {
+	sub := db.bus.NewSubscriber(subscribeBuffer)
+	sub.Subscribe(channels...)
+	return db.watch(ctx, sub)
+}
+
+// PSubscribe подписывается на каналы по glob-шаблонам ("news.*").
+func (db *DB) PSubscribe(ctx context.Context, patterns ...string) <-chan Message {
+	sub := db.bus.NewSubscriber(subscribeBuffer)
+	sub.PSubscribe(patterns...)
+	return db.watch(ctx, sub)
+}
+
+// watch снимает подписки, когда ctx отменён.
+func (db *DB) watch(ctx context.Context, sub *pubsub.Subscriber) <-chan Message {
+	go func() {
+		<-ctx.Done()
+		sub.Close()
+	}()
+	return sub.C()
+}
+
+// Publish отправляет сообщение в канал. Возвращает число получателей.
+//
+//	db.Publish("news", "hello")
+func (db *DB) Publish(channel, message string) int {
+	return db.bus.Publish(channel, message)
+}
+
+// ─── Transactions ───────────────────────────────────────────────────
+
+// Tx — транзакция Update/View. Действительна только внутри fn.
+type Tx = storage.Tx
+
+// Update выполняет fn атомарно: либо применяются все записи (одной
+// группой в AOF), либо — если fn вернула ошибку — ни одной. При конфликте
+// с параллельной записью fn перезапускается, поэтому побочные эффекты
+// вне tx в ней недопустимы.
+//
+//	err := db.Update(func(tx *imcs.Tx) error {
+//	    n, err := tx.IncrBy("balance", -30)
+//	    if err != nil {
+//	        return err
+//	    }
+//	    if n < 0 {
+//	        return errNoFunds // откат
+//	    }
+//	    return tx.Set("order:1", "paid", time.Hour)
+//	})
+func (db *DB) Update(fn func(tx *Tx) error) error {
+	return db.cache.Update(fn)
+}
+
+// View выполняет fn над согласованным снимком ключей, прочитанных в ней.
+// Записи внутри View возвращают ErrTxReadOnly.
+func (db *DB) View(fn func(tx *Tx) error) error {
+	return db.cache.View(fn)
+}
+
+// ─── Persistence ────────────────────────────────────────────────────
+
+// RewriteAOF компактит журнал: переписывает его по текущему состоянию.
+// Запись в кеш во время rewrite не останавливается (кроме короткой паузы
+// на старте снимка). Auto-rewrite делает то же по порогам из Options.
+func (db *DB) RewriteAOF() error {
+	return db.persister.Rewrite(db.cache.Snapshot)
+}
+
+// Save пишет снимок состояния (dump.imcs). При следующем Open снимок
+// загружается, а журнал проигрывается только после него.
+func (db *DB) Save() error {
+	return db.persister.Save(db.cache.Snapshot)
+}
+
+// LastSave возвращает время последнего успешного снимка (или открытия DB).
+func (db *DB) LastSave() time.Time {
+	return db.persister.SaveStats().LastSave
+}
+
+// ImportResult — итог ImportRDB: число загруженных ключей, пропущенных
+// из-за истёкшего TTL и ключей неподдерживаемых типов (stream, модули).
+type ImportResult = RDB.Result
+
+// UnsupportedKey — ключ из RDB, тип которого IMCS не хранит.
+type UnsupportedKey = RDB.UnsupportedKey
+
+// ImportRDB загружает ключи из снимка Redis (dump.rdb, RDB 9–11) и пишет
+// их в журнал. Существующие ключи с теми же именами заменяются. Все базы
+// RDB (SELECT) попадают в единственную базу IMCS. Ключи неподдерживаемых
+// типов не прерывают импорт — они перечислены в ImportResult.Unsupported.
+//
+//	f, _ := os.Open("dump.rdb")
+//	result, err := db.ImportRDB(f)
+func (db *DB) ImportRDB(r io.Reader) (*ImportResult, error) {
+	return RDB.Load(r, func(e *RDB.Entry) error {
+		return db.cache.Restore(e.Key, e.Value, e.ExpireAt, true)
+	})
+}
+
+// ExportRDB пишет в w снимок всех живых ключей в формате RDB (версия 9 —
+// загружается Redis 5.0 и новее). Возвращает число записанных ключей.
+//
+//	f, _ := os.Create("dump.rdb")
+//	n, err := db.ExportRDB(f)
+func (db *DB) ExportRDB(w io.Writer) (int, error) {
+	return RDB.Export(w, db.cache.Export)
+}
+
 // ─── Flush ──────────────────────────────────────────────────────────
 
 // FlushAll удаляет все данные из кеша и cold storage.
@@ -243,7 +1011,7 @@ func (db *DB) FlushAll() {
 //
 //	go db.ListenAndServe(":6380")
 func (db *DB) ListenAndServe(addr string) error {
-	var opts []server.Option
+	opts := []server.Option{server.WithPubSub(db.bus), server.WithAOF(db.persister)}
 	srv := server.New(addr, db.cache, opts...)
 	db.srv = srv
 	return srv.Listen()
@@ -0,0 +1,271 @@
+package AOF
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc64"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+/*
+
+	Повреждённые записи: проверка, пропуск и карантин.
+
+	Запись можно пропустить, не теряя всё после неё: после битой записи
+	ищется ближайшая позиция, с которой читается целая запись с верным
+	CRC64 (resync). Байты между ними — повреждённый участок.
+
+	Транзакция, задетая повреждением, отбрасывается целиком — от MULTI
+	до EXEC: иначе после удаления дыры её остаток выглядел бы целым.
+
+	Карантин — файл <журнал>.quarantine рядом с журналом. Каждый участок:
+	[смещение в журнале u64][длина u32][байты участка].
+
+*/
+
+// CorruptPolicy — что делать при загрузке с повреждённой записью.
+type CorruptPolicy int32
+
+const (
+	// CorruptTruncate — обрезать последний файл журнала на первой битой
+	// записи (всё после неё теряется). Политика по умолчанию.
+	CorruptTruncate CorruptPolicy = iota
+	// CorruptSkip — пропустить битые участки, перенести их в карантин
+	// и продолжить загрузку.
+	CorruptSkip
+	// CorruptRefuse — не запускаться: Read возвращает ErrCorrupt.
+	CorruptRefuse
+)
+
+const (
+	resyncChunk    = 1 << 20 // окно поиска следующей записи
+	minPayloadSize = 4       // четыре пустых поля payload
+	maxCmdLen      = 32      // команды в журнале короче
+)
+
+// ErrCorrupt — в журнале есть повреждённые записи, а политика не
+// позволяет их обойти.
+var ErrCorrupt = errors.New("AOF: corrupt journal")
+
+// CorruptRegion — повреждённый участок файла журнала.
+type CorruptRegion struct {
+	Offset int64
+	Length int64
+	Reason string
+}
+
+// CheckResult — результат проверки одного файла журнала.
+type CheckResult struct {
+	Path         string
+	Size         int64
+	ValidEntries int
+	Regions      []CorruptRegion
+}
+
+// ParseCorruptPolicy разбирает значение aof-load-corrupt: truncate, skip, refuse.
+func ParseCorruptPolicy(s string) (CorruptPolicy, error) {
+	switch s {
+	case "truncate":
+		return CorruptTruncate, nil
+	case "skip":
+		return CorruptSkip, nil
+	case "refuse":
+		return CorruptRefuse, nil
+	}
+	return 0, fmt.Errorf("invalid aof-load-corrupt %q (want truncate, skip or refuse)", s)
+}
+
+func (p CorruptPolicy) String() string {
+	switch p {
+	case CorruptSkip:
+		return "skip"
+	case CorruptRefuse:
+		return "refuse"
+	default:
+		return "truncate"
+	}
+}
+
+// SetCorruptPolicy задаёт политику для следующего Read.
+func (a *AOF) SetCorruptPolicy(p CorruptPolicy) {
+	a.corrupt.Store(int32(p))
+}
+
+// CorruptPolicy возвращает текущую политику.
+func (a *AOF) CorruptPolicy() CorruptPolicy {
+	return CorruptPolicy(a.corrupt.Load())
+}
+
+// JournalFiles возвращает файлы журнала в dir в порядке replay: по
+// манифесту или единственный journal.aof прежней раскладки.
+func JournalFiles(dir string) ([]string, error) {
+	m, err := loadManifest(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		path := filepath.Join(dir, journalName)
+		if _, err := os.Stat(path); err != nil {
+			return nil, err
+		}
+		return []string{path}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for _, file := range m.files() {
+		paths = append(paths, filepath.Join(dir, file.name))
+	}
+	return paths, nil
+}
+
+// Check находит все повреждённые участки файла журнала v2, ничего не меняя.
+func Check(path string) (*CheckResult, error) {
+	f, err := openSealed(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scan, err := scanFile(f, int64(headerSize), true, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &CheckResult{
+		Path:         path,
+		Size:         scan.size,
+		ValidEntries: scan.valid,
+		Regions:      scan.regions,
+	}, nil
+}
+
+// Repair переносит повреждённые участки файла в карантин (path+".quarantine")
+// и оставляет в журнале только целые записи. Журнал не должен быть открыт
+// на запись.
+func Repair(path string) (*CheckResult, error) {
+	result, err := Check(path)
+	if err != nil || len(result.Regions) == 0 {
+		return result, err
+	}
+	return result, quarantine(path, result.Regions)
+}
+
+// quarantine вырезает regions из файла: байты участков дописываются в
+// path+".quarantine", остальное атомарно заменяет файл.
+func quarantine(path string, regions []CorruptRegion) (err error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	q, err := os.OpenFile(path+".quarantine", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+
+	tmpPath := path + ".repair"
+	dst, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			dst.Close()
+			os.Remove(tmpPath)
+		}
+	}()
+
+	var pos int64
+	for _, r := range regions {
+		if _, err := io.Copy(dst, io.NewSectionReader(src, pos, r.Offset-pos)); err != nil {
+			return err
+		}
+		var hdr [12]byte
+		binary.BigEndian.PutUint64(hdr[:8], uint64(r.Offset))
+		binary.BigEndian.PutUint32(hdr[8:], uint32(r.Length))
+		if _, err := q.Write(hdr[:]); err != nil {
+			return err
+		}
+		if _, err := io.Copy(q, io.NewSectionReader(src, r.Offset, r.Length)); err != nil {
+			return err
+		}
+		pos = r.Offset + r.Length
+	}
+	if _, err := io.Copy(dst, io.NewSectionReader(src, pos, info.Size()-pos)); err != nil {
+		return err
+	}
+
+	// Карантин — на диск раньше, чем участки исчезнут из журнала
+	if err := q.Sync(); err != nil {
+		return err
+	}
+	if err := dst.Sync(); err != nil {
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+// resync ищет после pos ближайшую позицию, с которой читается целая
+// запись с верным CRC64. Если такой нет — возвращает size.
+func resync(f *os.File, pos, size int64) (int64, error) {
+	buf := make([]byte, resyncChunk+recordHeaderSize+1+maxCmdLen)
+	for base := pos + 1; base+recordHeaderSize <= size; base += resyncChunk {
+		n, err := f.ReadAt(buf, base)
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		chunk := buf[:n]
+
+		for i := 0; i < resyncChunk && i+recordHeaderSize <= n; i++ {
+			off := base + int64(i)
+			length := int64(binary.BigEndian.Uint32(chunk[i:]))
+			if length < minPayloadSize || length > size-off-recordHeaderSize {
+				continue
+			}
+			// Дешёвый фильтр до CRC: длина команды — первый байт payload
+			if p := chunk[i+recordHeaderSize:]; len(p) > 0 && (p[0] == 0 || p[0] > maxCmdLen) {
+				continue
+			}
+			ok, err := validRecordAt(f, off, length, chunk[i:])
+			if err != nil {
+				return 0, err
+			}
+			if ok {
+				return off, nil
+			}
+		}
+	}
+	return size, nil
+}
+
+// validRecordAt проверяет CRC64 и разбор записи по смещению off. buf —
+// уже прочитанные байты с off (payload может в них не помещаться).
+func validRecordAt(f *os.File, off, length int64, buf []byte) (bool, error) {
+	var payload []byte
+	if int64(len(buf)) >= recordHeaderSize+length {
+		payload = buf[recordHeaderSize : recordHeaderSize+length]
+	} else {
+		payload = make([]byte, length)
+		if _, err := f.ReadAt(payload, off+recordHeaderSize); err != nil {
+			return false, err
+		}
+	}
+	if crc64.Checksum(payload, crcTable) != binary.BigEndian.Uint64(buf[4:recordHeaderSize]) {
+		return false, nil
+	}
+	_, _, _, _, err := decodePayload(payload)
+	return err == nil, nil
+}
@@ -0,0 +1,132 @@
+package AOF
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// writeCorrupted пишет 100 SET и портит запись 30 (CRC) и 60 (длина).
+func writeCorrupted(t *testing.T, dir string) string {
+	t.Helper()
+	a, err := NewAOF(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		a.Write(WriteInput{Cmd: "SET", Key: "k" + strconv.Itoa(i), Value: "v"})
+	}
+	a.Close()
+
+	path := filepath.Join(dir, incrFileName(1))
+	data, _ := os.ReadFile(path)
+	offsets := recordOffsets(data)
+	data[offsets[30]+recordHeaderSize] ^= 0xFF
+	copy(data[offsets[60]:], []byte{0xFF, 0xFF, 0xFF, 0xFF})
+	os.WriteFile(path, data, 0644)
+	return path
+}
+
+// TestCorruptSkip — битые записи пропускаются, а не обрезают журнал;
+// их байты уходят в карантин, журнал после этого чистый.
+func TestCorruptSkip(t *testing.T) {
+	dir := t.TempDir()
+	path := writeCorrupted(t, dir)
+
+	check, err := Check(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(check.Regions) != 2 || check.ValidEntries != 98 {
+		t.Fatalf("Check = %+v", check)
+	}
+
+	a, err := NewAOF(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.SetCorruptPolicy(CorruptSkip)
+	keys := 0
+	result, err := a.Read(func(cmd, key, value string, expire int64) { keys++ })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys != 98 || result.Truncated || result.CorruptEntries != 2 || result.Skipped == 0 {
+		t.Fatalf("replayed %d keys, result %+v", keys, result)
+	}
+	a.Write(WriteInput{Cmd: "SET", Key: "after", Value: "v"})
+	a.Close()
+
+	if q, err := os.ReadFile(path + ".quarantine"); err != nil || int64(len(q)) != result.Skipped+2*12 {
+		t.Fatalf("quarantine: %d bytes, %v", len(q), err)
+	}
+	got, result := readAll(t, dir)
+	if len(got) != 99 || result.CorruptEntries != 0 || got[98].key != "after" {
+		t.Fatalf("after repair replayed %d records, result %+v", len(got), result)
+	}
+}
+
+// TestCorruptRefuse — CorruptRefuse не трогает журнал и возвращает ErrCorrupt.
+func TestCorruptRefuse(t *testing.T) {
+	dir := t.TempDir()
+	path := writeCorrupted(t, dir)
+	before, _ := os.ReadFile(path)
+
+	a, err := NewAOF(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.SetCorruptPolicy(CorruptRefuse)
+	if _, err := a.Read(func(cmd, key, value string, expire int64) {}); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("Read err = %v, want ErrCorrupt", err)
+	}
+	a.Close()
+
+	if after, _ := os.ReadFile(path); string(after) != string(before) {
+		t.Fatal("journal modified")
+	}
+}
+
+// TestRepairDamagedTransaction — транзакция с битой записью внутри уходит
+// в карантин целиком: после ремонта её остаток не выглядит целым.
+func TestRepairDamagedTransaction(t *testing.T) {
+	dir := t.TempDir()
+	a, err := NewAOF(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, in := range []WriteInput{
+		{Cmd: "SET", Key: "a", Value: "1"},
+		{Cmd: "MULTI"},
+		{Cmd: "SET", Key: "b", Value: "2"},
+		{Cmd: "SET", Key: "c", Value: "3"},
+		{Cmd: "EXEC"},
+		{Cmd: "SET", Key: "d", Value: "4"},
+	} {
+		a.Write(in)
+	}
+	a.Close()
+
+	path := filepath.Join(dir, incrFileName(1))
+	data, _ := os.ReadFile(path)
+	offsets := recordOffsets(data)
+	data[offsets[3]+recordHeaderSize] ^= 0xFF // SET c
+	os.WriteFile(path, data, 0644)
+
+	result, err := Repair(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Regions) != 1 || result.Regions[0].Offset != int64(offsets[1]) ||
+		result.Regions[0].Length != int64(offsets[5]-offsets[1]) {
+		t.Fatalf("regions = %+v", result.Regions)
+	}
+
+	got, _ := readAll(t, dir)
+	if fmt.Sprint(got) != "[{SET a 1 0} {SET d 4 0}]" {
+		t.Fatalf("after repair replayed %v", got)
+	}
+}
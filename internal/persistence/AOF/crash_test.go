@@ -2,13 +2,18 @@ package AOF
 
 import (
 	"crypto/rand"
+	"encoding/binary"
 	"encoding/hex"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
+
+	storage "imcs/internal/storage/cache"
 )
 
 // generateMBValue генерирует случайную строку заданного размера в байтах.
@@ -18,6 +23,34 @@ func generateMBValue(sizeBytes int) string {
 	return hex.EncodeToString(b)
 }
 
+// recordOffsets возвращает смещения записей v2 в содержимом журнала.
+func recordOffsets(data []byte) []int {
+	var offsets []int
+	for pos := headerSize; pos+recordHeaderSize <= len(data); {
+		offsets = append(offsets, pos)
+		pos += recordHeaderSize + int(binary.BigEndian.Uint32(data[pos:]))
+	}
+	return offsets
+}
+
+// journalSize — суммарный размер файлов журнала из манифеста.
+func journalSize(t *testing.T, dir string) int64 {
+	t.Helper()
+	m, err := loadManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var size int64
+	for _, file := range m.files() {
+		stat, err := os.Stat(filepath.Join(dir, file.name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		size += stat.Size()
+	}
+	return size
+}
+
 // TestCrashRecoveryMB — тест имитации краша с MB-записями + CRC64.
 func TestCrashRecoveryMB(t *testing.T) {
 	dir, err := os.MkdirTemp("", "crash-test-*")
@@ -73,7 +106,7 @@ func TestCrashRecoveryMB(t *testing.T) {
 	aof1.file.Sync()
 	aof1.mu.Unlock()
 
-	stat, _ := os.Stat(filepath.Join(dir, "journal.aof"))
+	stat, _ := os.Stat(filepath.Join(dir, incrFileName(1)))
 	fileSizeMB := float64(stat.Size()) / (1024 * 1024)
 	fmt.Printf("║  AOF file size:   %6.1fMB                       ║\n", fileSizeMB)
 	fmt.Println("╠══════════════════════════════════════════════════╣")
@@ -169,7 +202,7 @@ func TestCorruptedAOFTruncate(t *testing.T) {
 	}
 	aof1.Close()
 
-	aofPath := filepath.Join(dir, "journal.aof")
+	aofPath := filepath.Join(dir, incrFileName(1))
 	stat, _ := os.Stat(aofPath)
 	originalSize := stat.Size()
 	fmt.Printf("║  Written: %d keys, AOF: %.1fKB                   ║\n", numKeys, float64(originalSize)/1024)
@@ -253,19 +286,10 @@ func TestCorruptedAOFTruncate(t *testing.T) {
 	// Восстанавливаем оригинал и портим CRC на строке 50
 	os.WriteFile(aofPath, data, 0644)
 
-	// Меняем первый байт (CRC hex) на 'X' в строке ~50
+	// Инвертируем байт CRC64 в 51-й записи
 	modified := make([]byte, len(data))
 	copy(modified, data)
-	lineNum := 0
-	for i := 0; i < len(modified); i++ {
-		if modified[i] == '\n' {
-			lineNum++
-			if lineNum == 50 && i+1 < len(modified) {
-				modified[i+1] = 'X' // Ломаем CRC hex
-				break
-			}
-		}
-	}
+	modified[recordOffsets(data)[50]+4] ^= 0xff
 	os.WriteFile(aofPath, modified, 0644)
 
 	aof4, err := NewAOF(dir)
@@ -334,9 +358,7 @@ func TestAOFRewrite(t *testing.T) {
 
 	aof.Close() // записываем всё
 
-	aofPath := filepath.Join(dir, "journal.aof")
-	stat, _ := os.Stat(aofPath)
-	sizeBefore := stat.Size()
+	sizeBefore := journalSize(t, dir)
 
 	fmt.Printf("║  Before rewrite: %6.1fKB (%d ops)               ║\n",
 		float64(sizeBefore)/1024, 1000+500+200)
@@ -356,7 +378,8 @@ func TestAOFRewrite(t *testing.T) {
 	fmt.Printf("║  Live keys: %6d (out of 1000 original)        ║\n", len(finalState))
 
 	// REWRITE: создаём snapshot и компактим
-	err = aofRead.Rewrite(func(fn func(cmd, key, value string, expireAt int64)) {
+	err = aofRead.Rewrite(func(mark func(), fn func(cmd, key, value string, expireAt int64)) {
+		mark()
 		for key, value := range finalState {
 			fn("SET", key, value, 0)
 		}
@@ -366,8 +389,7 @@ func TestAOFRewrite(t *testing.T) {
 	}
 	aofRead.Close()
 
-	stat, _ = os.Stat(aofPath)
-	sizeAfter := stat.Size()
+	sizeAfter := journalSize(t, dir)
 	reduction := float64(sizeBefore-sizeAfter) / float64(sizeBefore) * 100
 
 	fmt.Printf("║  After rewrite:  %6.1fKB                        ║\n", float64(sizeAfter)/1024)
@@ -530,7 +552,7 @@ func TestHeavyLoadThenCrash(t *testing.T) {
 	aof1.Close()
 	aof1 = nil
 
-	stat, _ := os.Stat(filepath.Join(dir, "journal.aof"))
+	stat, _ := os.Stat(filepath.Join(dir, incrFileName(1)))
 	fileMB := float64(stat.Size()) / (1024 * 1024)
 
 	fmt.Printf("║  Written: %d SET + %d updates + %d DEL             ║\n", numKeys, numKeys/2, deletedKeys)
@@ -578,3 +600,210 @@ func TestHeavyLoadThenCrash(t *testing.T) {
 
 	fmt.Println("╚══════════════════════════════════════════════════╝")
 }
+
+// TestIncompleteTransaction — транзакция, оборванная сбоем, не применяется
+// даже частично, а файл обрезается до её начала.
+func TestIncompleteTransaction(t *testing.T) {
+	dir := t.TempDir()
+
+	aof1, err := NewAOF(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, in := range []WriteInput{
+		{Cmd: "SET", Key: "a", Value: "1"},
+		{Cmd: "MULTI"},
+		{Cmd: "SET", Key: "b", Value: "2"},
+		{Cmd: "SET", Key: "c", Value: "3"},
+		{Cmd: "EXEC"},
+		{Cmd: "MULTI"},
+		{Cmd: "SET", Key: "d", Value: "4"},
+		{Cmd: "SET", Key: "e", Value: "5"},
+		{Cmd: "EXEC"},
+	} {
+		aof1.Write(in)
+	}
+	aof1.Close()
+
+	// Сбой посреди второй транзакции: теряем её последнюю запись и EXEC
+	aofPath := filepath.Join(dir, incrFileName(1))
+	data, _ := os.ReadFile(aofPath)
+	offsets := recordOffsets(data)
+	os.WriteFile(aofPath, data[:offsets[len(offsets)-2]], 0644)
+
+	aof2, err := NewAOF(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	result, err := aof2.Read(func(cmd, key, value string, expire int64) {
+		keys = append(keys, key)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(keys) != "[a b c]" {
+		t.Fatalf("replayed %v, want [a b c]", keys)
+	}
+	if !result.Truncated {
+		t.Fatal("incomplete transaction must truncate the file")
+	}
+
+	// Новая запись после обрезки не склеивается с обрывком транзакции
+	aof2.Write(WriteInput{Cmd: "EXEC"})
+	aof2.Write(WriteInput{Cmd: "SET", Key: "f", Value: "6"})
+	aof2.Close()
+
+	aof3, err := NewAOF(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer aof3.Close()
+	keys = nil
+	aof3.Read(func(cmd, key, value string, expire int64) {
+		keys = append(keys, key)
+	})
+	if fmt.Sprint(keys) != "[a b c f]" {
+		t.Fatalf("after restart replayed %v, want [a b c f]", keys)
+	}
+}
+
+// TestCrashTTLAndFlush — EXPIRE, PERSIST, RENAME с TTL и FLUSHDB
+// переживают краш: после replay TTL и очистка те же, что до него.
+func TestCrashTTLAndFlush(t *testing.T) {
+	dir := t.TempDir()
+
+	p1, err := NewPersister(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c1 := storage.New(p1)
+
+	c1.Set("flushed:1", "v", 0, false)
+	c1.Set("flushed:2", "v", time.Hour, false)
+	c1.FlushDB()
+
+	c1.Set("expiring", "v", 0, false)
+	c1.Expire("expiring", time.Hour)
+	c1.Set("persisted", "v", time.Hour, false)
+	c1.Persist("persisted")
+	c1.Set("short", "v", 0, false)
+	c1.Expire("short", 50*time.Millisecond)
+	c1.RPush("list", "a", "b")
+	c1.Expire("list", time.Hour)
+	c1.Rename("list", "renamed")
+
+	// Краш: журнал дописан, но ни Close, ни rewrite не было
+	close(p1.aof.stopCh)
+	<-p1.aof.done
+	p1.aof.file.Close()
+	c1.Close()
+
+	time.Sleep(100 * time.Millisecond)
+
+	p2, err := NewPersister(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p2.Close()
+	c2 := storage.New(p2)
+	defer c2.Close()
+	if _, err := p2.Read(c2.Replay); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := c2.Exists("flushed:1", "flushed:2", "short", "list"); n != 0 {
+		t.Fatalf("%d deleted keys resurrected", n)
+	}
+	for key, want := range map[string]int64{"expiring": 3600, "renamed": 3600, "persisted": -1} {
+		if got := c2.GetTTL(key); got < want-5 || got > want {
+			t.Errorf("TTL(%s) = %d, want %d", key, got, want)
+		}
+	}
+	if got := c2.CountKeys(); got != 3 {
+		t.Fatalf("CountKeys = %d, want 3", got)
+	}
+}
+
+// TestAutoRewrite — журнал, выросший сверх порогов, переписывается сам.
+func TestAutoRewrite(t *testing.T) {
+	dir := t.TempDir()
+	a, err := NewAOF(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	a.SetAutoRewrite(100, 64*1024)
+	a.SetSnapshot(func(mark func(), fn func(cmd, key, value string, expireAt int64)) {
+		mark()
+		fn("SET", "k", "final", 0)
+	})
+
+	value := strings.Repeat("x", 1024)
+	for i := 0; i < 200; i++ {
+		a.Write(WriteInput{Cmd: "SET", Key: "k", Value: value})
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for a.RewriteStats().LastDuration < 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("auto-rewrite did not run: %+v", a.RewriteStats())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if st := a.RewriteStats(); st.LastErr != nil || st.BaseSize >= 64*1024 {
+		t.Fatalf("stats after rewrite: %+v", st)
+	}
+	if err := a.BackgroundRewrite(); err != nil && err != ErrRewriteInProgress {
+		t.Fatal(err)
+	}
+}
+
+// TestRewriteConcurrentWrites — записи, идущие во время rewrite, не
+// теряются и не применяются дважды (RPUSH не идемпотентен).
+func TestRewriteConcurrentWrites(t *testing.T) {
+	dir := t.TempDir()
+	p1, err := NewPersister(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c1 := storage.New(p1)
+	p1.SetSnapshot(c1.Snapshot)
+
+	const writers, perWriter = 8, 2000
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			key := "list:" + strconv.Itoa(w)
+			for i := 0; i < perWriter; i++ {
+				c1.RPush(key, strconv.Itoa(i))
+			}
+		}()
+	}
+	for i := 0; i < 5; i++ {
+		if err := p1.Rewrite(c1.Snapshot); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+	p1.Close()
+	c1.Close()
+
+	p2, err := NewPersister(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p2.Close()
+	c2 := storage.New(p2)
+	defer c2.Close()
+	p2.Read(c2.Replay)
+
+	for w := 0; w < writers; w++ {
+		if n, _ := c2.LLen("list:" + strconv.Itoa(w)); n != perWriter {
+			t.Fatalf("list:%d has %d elements after replay, want %d", w, n, perWriter)
+		}
+	}
+}
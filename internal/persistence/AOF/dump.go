@@ -0,0 +1,200 @@
+package AOF
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc64"
+	"io"
+	"os"
+)
+
+/*
+
+	Снимок (SAVE/BGSAVE) — компактная копия состояния на момент маркера
+	в журнале. Загружается при старте вместо проигрывания всего AOF:
+	после снимка читается только хвост журнала за маркером SNAPSHOT.
+
+	Файл:     "IMCSRDB" + байт версии (1)
+	          uvarint len(id) id | varint savedAt (нс)
+	Записи:   uvarint len(payload) payload — payload как в AOF v2
+	Трейлер:  [incr с маркером u64][смещение маркера u64]
+	          [число записей u64][crc64 u64]
+
+	CRC64 — по всему файлу до него: снимок проверяется целиком до того,
+	как из него что-то применится, поэтому битый снимок не смешивается
+	с полным replay журнала.
+
+*/
+
+const (
+	dumpMagic       = "IMCSRDB"
+	dumpVersion     = 1
+	dumpTrailerSize = 8 + 8 + 8 + 8
+
+	// snapshotCmd — запись-маркер снимка в журнале (key = id снимка).
+	// Replay её пропускает.
+	snapshotCmd = "SNAPSHOT"
+)
+
+var errBadDump = errors.New("AOF: corrupt snapshot file")
+
+// dumpInfo — заголовок и трейлер проверенного снимка.
+type dumpInfo struct {
+	id      string
+	savedAt int64
+	seq     int64 // incr-файл с записью SNAPSHOT
+	offset  int64 // смещение записи SNAPSHOT в нём
+	count   uint64
+}
+
+// dumpWriter пишет снимок, считая CRC64 на лету.
+type dumpWriter struct {
+	w     *bufio.Writer
+	crc   uint64
+	count uint64
+	buf   []byte
+}
+
+func newDumpWriter(w io.Writer, id string, savedAt int64) *dumpWriter {
+	d := &dumpWriter{w: bufio.NewWriterSize(w, writeBufSize)}
+	hdr := append([]byte(dumpMagic), dumpVersion)
+	hdr = binary.AppendUvarint(hdr, uint64(len(id)))
+	hdr = append(hdr, id...)
+	hdr = binary.AppendVarint(hdr, savedAt)
+	d.write(hdr)
+	return d
+}
+
+func (d *dumpWriter) write(p []byte) {
+	d.crc = crc64.Update(d.crc, crcTable, p)
+	d.w.Write(p)
+}
+
+// record дописывает запись ключа.
+func (d *dumpWriter) record(cmd, key, value string, expireAt int64) {
+	payload := appendPayload(d.buf[:0], cmd, key, value, expireAt)
+	var n [binary.MaxVarintLen64]byte
+	d.write(n[:binary.PutUvarint(n[:], uint64(len(payload)))])
+	d.write(payload)
+	d.buf = payload
+	d.count++
+}
+
+// finish дописывает трейлер и сбрасывает буфер.
+func (d *dumpWriter) finish(seq, offset int64) error {
+	var t [dumpTrailerSize]byte
+	binary.BigEndian.PutUint64(t[0:], uint64(seq))
+	binary.BigEndian.PutUint64(t[8:], uint64(offset))
+	binary.BigEndian.PutUint64(t[16:], d.count)
+	d.write(t[:24])
+	binary.BigEndian.PutUint64(t[24:], d.crc)
+	d.w.Write(t[24:])
+	return d.w.Flush()
+}
+
+// checkDump проверяет CRC64 снимка и читает его заголовок и трейлер.
+func checkDump(f *os.File) (*dumpInfo, error) {
+	st, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := st.Size()
+	if size < int64(len(dumpMagic))+1+dumpTrailerSize {
+		return nil, errBadDump
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	h := crc64.New(crcTable)
+	if _, err := io.CopyN(h, f, size-8); err != nil {
+		return nil, err
+	}
+	var t [dumpTrailerSize]byte
+	if _, err := f.ReadAt(t[:], size-dumpTrailerSize); err != nil {
+		return nil, err
+	}
+	if h.Sum64() != binary.BigEndian.Uint64(t[24:]) {
+		return nil, errBadDump
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	r := bufio.NewReader(io.LimitReader(f, size-dumpTrailerSize))
+	magic := make([]byte, len(dumpMagic)+1)
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic[:len(dumpMagic)]) != dumpMagic {
+		return nil, errBadDump
+	}
+	if v := magic[len(dumpMagic)]; v != dumpVersion {
+		return nil, fmt.Errorf("AOF: unsupported snapshot version %d", v)
+	}
+	idLen, err := binary.ReadUvarint(r)
+	if err != nil || idLen > 64 {
+		return nil, errBadDump
+	}
+	id := make([]byte, idLen)
+	if _, err := io.ReadFull(r, id); err != nil {
+		return nil, errBadDump
+	}
+	savedAt, err := binary.ReadVarint(r)
+	if err != nil {
+		return nil, errBadDump
+	}
+
+	return &dumpInfo{
+		id:      string(id),
+		savedAt: savedAt,
+		seq:     int64(binary.BigEndian.Uint64(t[0:])),
+		offset:  int64(binary.BigEndian.Uint64(t[8:])),
+		count:   binary.BigEndian.Uint64(t[16:]),
+	}, nil
+}
+
+// loadDump применяет записи проверенного снимка (после checkDump).
+func loadDump(f *os.File, info *dumpInfo, rf func(cmd, key, value string, expire int64)) error {
+	st, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	hdrLen := int64(len(dumpMagic)) + 1 +
+		int64(uvarintLen(uint64(len(info.id)))) + int64(len(info.id)) +
+		int64(varintLen(info.savedAt))
+	if _, err := f.Seek(hdrLen, io.SeekStart); err != nil {
+		return err
+	}
+
+	r := bufio.NewReaderSize(io.LimitReader(f, st.Size()-dumpTrailerSize-hdrLen), readBufSize)
+	var payload []byte
+	for i := uint64(0); i < info.count; i++ {
+		n, err := binary.ReadUvarint(r)
+		if err != nil {
+			return errBadDump
+		}
+		if uint64(cap(payload)) < n {
+			payload = make([]byte, n)
+		}
+		payload = payload[:n]
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return errBadDump
+		}
+		cmd, key, value, expire, err := decodePayload(payload)
+		if err != nil {
+			return errBadDump
+		}
+		rf(cmd, key, value, expire)
+	}
+	return nil
+}
+
+func uvarintLen(x uint64) int {
+	var b [binary.MaxVarintLen64]byte
+	return binary.PutUvarint(b[:], x)
+}
+
+func varintLen(x int64) int {
+	var b [binary.MaxVarintLen64]byte
+	return binary.PutVarint(b[:], x)
+}
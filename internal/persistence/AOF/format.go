@@ -0,0 +1,91 @@
+package AOF
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc64"
+)
+
+/*
+
+	Формат AOF v2 — бинарно-безопасный: ключи и значения могут содержать
+	'|', '\n' и любые байты (значения — protobuf).
+
+	Файл:    "IMCSAOF" + байт версии (2)
+	Запись:  [len u32 BE][crc64 u64 BE][payload (len байт)]
+	Payload: uvarint len(cmd) cmd | uvarint len(key) key | varint expire |
+	         uvarint len(value) value
+
+	CRC64 считается по payload. Длина проверяется по размеру файла до
+	аллокации, поэтому мусор на месте заголовка записи не приводит к
+	чтению гигабайт.
+
+	Старый текстовый формат (crc64hex|cmd|key|expire|value\n) читается
+	при открытии и сразу конвертируется в v2 — см. migrateLegacy.
+
+*/
+
+const (
+	aofMagic   = "IMCSAOF"
+	aofVersion = 2
+
+	headerSize       = len(aofMagic) + 1
+	recordHeaderSize = 4 + 8 // длина + CRC64
+)
+
+// fileHeader — заголовок файла AOF v2.
+var fileHeader = append([]byte(aofMagic), aofVersion)
+
+var errMalformedPayload = errors.New("malformed payload")
+
+// appendRecord дописывает в dst запись v2.
+func appendRecord(dst []byte, cmd, key, value string, expire int64) []byte {
+	start := len(dst)
+	dst = append(dst, make([]byte, recordHeaderSize)...)
+	dst = appendPayload(dst, cmd, key, value, expire)
+
+	payload := dst[start+recordHeaderSize:]
+	binary.BigEndian.PutUint32(dst[start:], uint32(len(payload)))
+	binary.BigEndian.PutUint64(dst[start+4:], crc64.Checksum(payload, crcTable))
+	return dst
+}
+
+// appendPayload дописывает в dst payload записи (он же — запись снимка).
+func appendPayload(dst []byte, cmd, key, value string, expire int64) []byte {
+	dst = binary.AppendUvarint(dst, uint64(len(cmd)))
+	dst = append(dst, cmd...)
+	dst = binary.AppendUvarint(dst, uint64(len(key)))
+	dst = append(dst, key...)
+	dst = binary.AppendVarint(dst, expire)
+	dst = binary.AppendUvarint(dst, uint64(len(value)))
+	return append(dst, value...)
+}
+
+// decodePayload разбирает payload записи v2.
+func decodePayload(p []byte) (cmd, key, value string, expire int64, err error) {
+	var ok bool
+	if cmd, p, ok = readField(p); !ok {
+		return "", "", "", 0, errMalformedPayload
+	}
+	if key, p, ok = readField(p); !ok {
+		return "", "", "", 0, errMalformedPayload
+	}
+	expire, n := binary.Varint(p)
+	if n <= 0 {
+		return "", "", "", 0, errMalformedPayload
+	}
+	if value, p, ok = readField(p[n:]); !ok || len(p) != 0 {
+		return "", "", "", 0, errMalformedPayload
+	}
+	return cmd, key, value, expire, nil
+}
+
+// readField читает поле с uvarint-длиной.
+func readField(p []byte) (string, []byte, bool) {
+	n, w := binary.Uvarint(p)
+	if w <= 0 || n > uint64(len(p)-w) {
+		return "", nil, false
+	}
+	p = p[w:]
+	return string(p[:n]), p[n:], true
+}
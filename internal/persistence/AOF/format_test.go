@@ -0,0 +1,156 @@
+package AOF
+
+import (
+	"fmt"
+	"hash/crc64"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type replayed struct {
+	cmd, key, value string
+	expire          int64
+}
+
+func readAll(t *testing.T, dir string) ([]replayed, *ReadResult) {
+	t.Helper()
+	a, err := NewAOF(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	var got []replayed
+	result, err := a.Read(func(cmd, key, value string, expire int64) {
+		got = append(got, replayed{cmd, key, value, expire})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return got, result
+}
+
+// TestBinarySafeRecords — ключи и значения с '|', '\n', нулевыми байтами
+// и значение больше прежнего лимита строки (16MB) переживают перезапуск
+// и rewrite.
+func TestBinarySafeRecords(t *testing.T) {
+	dir := t.TempDir()
+	big := strings.Repeat("x\n|", 6*1024*1024) // 18MB
+
+	want := []replayed{
+		{"SET", "a|b", "line1\nline2", 0},
+		{"SET", "k\n", "\x00\x01|\xff\n", 0},
+		{"SET", "", "", 0},
+		{"SET", "big", big, 0},
+	}
+
+	a, err := NewAOF(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range want {
+		a.Write(WriteInput{Cmd: r.cmd, Key: r.key, Value: r.value})
+	}
+	a.Close()
+
+	got, result := readAll(t, dir)
+	if result.Truncated || result.ValidEntries != len(want) {
+		t.Fatalf("result = %+v", result)
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatal("replayed records differ from written")
+	}
+
+	a, err = NewAOF(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = a.Rewrite(func(mark func(), fn func(cmd, key, value string, expireAt int64)) {
+		mark()
+		for _, r := range want {
+			fn(r.cmd, r.key, r.value, 42)
+		}
+	})
+	a.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, _ = readAll(t, dir)
+	for i := range want {
+		want[i].expire = 42
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatal("records differ after rewrite")
+	}
+}
+
+// TestLegacyMigration — текстовый журнал читается и при открытии
+// конвертируется в v2, новые записи дописываются уже в v2.
+func TestLegacyMigration(t *testing.T) {
+	dir := t.TempDir()
+
+	legacyLine := func(cmd, key, expire, value string) string {
+		payload := cmd + "|" + key + "|" + expire + "|" + value
+		return strconv.FormatUint(crc64.Checksum([]byte(payload), crcTable), 16) + "|" + payload + "\n"
+	}
+	legacy := legacyLine("SET", "a", "0", "1|with|pipes") +
+		"SET|b|0|no-crc\n" +
+		legacyLine("MULTI", "", "0", "") +
+		legacyLine("SET", "c", "0", "3") +
+		legacyLine("EXEC", "", "0", "") +
+		legacyLine("SET", "d", "0", "4")
+	legacy = legacy[:len(legacy)-3] // оборванная последняя строка
+	os.WriteFile(filepath.Join(dir, "journal.aof"), []byte(legacy), 0644)
+
+	a, err := NewAOF(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	result, err := a.Read(func(cmd, key, value string, expire int64) {
+		keys = append(keys, key+"="+value)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(keys) != "[a=1|with|pipes b=no-crc c=3]" {
+		t.Fatalf("replayed %v", keys)
+	}
+	if !result.Truncated || result.CorruptEntries != 1 {
+		t.Fatalf("result = %+v, want truncated torn tail", result)
+	}
+	a.Write(WriteInput{Cmd: "SET", Key: "e\n", Value: "5"})
+	a.Close()
+
+	data, _ := os.ReadFile(filepath.Join(dir, "journal.aof"))
+	if !strings.HasPrefix(string(data), aofMagic) {
+		t.Fatal("journal was not converted to v2")
+	}
+	got, _ := readAll(t, dir)
+	if len(got) != 4 || got[3].key != "e\n" {
+		t.Fatalf("after migration replayed %v", got)
+	}
+}
+
+// TestUnknownFormat — файл, не похожий ни на v2, ни на текстовый журнал,
+// не затирается.
+func TestUnknownFormat(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "journal.aof")
+	os.WriteFile(path, []byte("\x00\x01garbage\n"), 0644)
+
+	if _, err := NewAOF(dir); err == nil {
+		t.Fatal("NewAOF accepted unknown format")
+	}
+	if data, _ := os.ReadFile(path); string(data) != "\x00\x01garbage\n" {
+		t.Fatal("unknown journal was modified")
+	}
+
+	os.WriteFile(path, append([]byte(aofMagic), 9), 0644)
+	if _, err := NewAOF(dir); err == nil {
+		t.Fatal("NewAOF accepted unsupported version")
+	}
+}
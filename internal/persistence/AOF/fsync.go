@@ -0,0 +1,112 @@
+package AOF
+
+import (
+	"errors"
+	"fmt"
+	"log"
+)
+
+// FsyncPolicy — когда журнал сбрасывается на диск (appendfsync в Redis).
+type FsyncPolicy int32
+
+const (
+	// FsyncEverySec — fsync раз в секунду; при сбое теряется до секунды
+	// записей. Политика по умолчанию.
+	FsyncEverySec FsyncPolicy = iota
+	// FsyncAlways — Write возвращается только после fsync записи.
+	// Записи, пришедшие за время одного fsync, делят следующий (group commit).
+	FsyncAlways
+	// FsyncNo — данные отдаются ОС после каждой пачки, fsync решает ОС.
+	FsyncNo
+)
+
+// ErrClosed — AOF закрыт раньше, чем запись стала durable (FsyncAlways).
+var ErrClosed = errors.New("AOF: closed")
+
+// WriteError — журнал не удалось записать или сбросить на диск (EIO,
+// ENOSPC). Ошибка «залипает» до перезапуска: bufio.Writer после сбоя
+// не пишет, а после неудачного fsync ОС могла выбросить грязные
+// страницы, и следующий успешный fsync ничего не гарантирует. Пока
+// журнал сломан, Write возвращает WriteError при любой политике.
+type WriteError struct {
+	Err error
+}
+
+func (e *WriteError) Error() string {
+	return "Errors writing to the AOF file: " + e.Err.Error()
+}
+
+func (e *WriteError) Unwrap() error {
+	return e.Err
+}
+
+// ParseFsyncPolicy разбирает значение appendfsync: always, everysec, no.
+func ParseFsyncPolicy(s string) (FsyncPolicy, error) {
+	switch s {
+	case "always":
+		return FsyncAlways, nil
+	case "everysec":
+		return FsyncEverySec, nil
+	case "no":
+		return FsyncNo, nil
+	}
+	return 0, fmt.Errorf("invalid appendfsync %q (want always, everysec or no)", s)
+}
+
+func (p FsyncPolicy) String() string {
+	switch p {
+	case FsyncAlways:
+		return "always"
+	case FsyncNo:
+		return "no"
+	default:
+		return "everysec"
+	}
+}
+
+// SetFsyncPolicy меняет политику на лету (CONFIG SET appendfsync).
+func (a *AOF) SetFsyncPolicy(p FsyncPolicy) {
+	a.fsync.Store(int32(p))
+}
+
+// FsyncPolicy возвращает текущую политику.
+func (a *AOF) FsyncPolicy() FsyncPolicy {
+	return FsyncPolicy(a.fsync.Load())
+}
+
+// WriteErr возвращает ошибку записи журнала (*WriteError) или nil.
+func (a *AOF) WriteErr() error {
+	if e := a.writeErr.Load(); e != nil {
+		return e
+	}
+	return nil
+}
+
+// failWrite отмечает журнал сломанным (см. WriteError). В лог пишется
+// только первая ошибка.
+func (a *AOF) failWrite(err error) {
+	if err == nil {
+		return
+	}
+	if a.writeErr.CompareAndSwap(nil, &WriteError{Err: err}) {
+		log.Printf("AOF write failed, journal is not durable until restart: %v", err)
+	}
+}
+
+// commitLocked сбрасывает пачку записей по текущей политике (под mu).
+// wait — в пачке есть ждущие Write: они появляются, только если пачка
+// писалась в режиме always, поэтому смена политики на лету не оставляет
+// их без fsync.
+func (a *AOF) commitLocked(wait bool) error {
+	switch {
+	case wait || a.FsyncPolicy() == FsyncAlways:
+		if err := a.writer.Flush(); err != nil {
+			return err
+		}
+		return a.file.Sync()
+
+	case a.FsyncPolicy() == FsyncNo:
+		return a.writer.Flush()
+	}
+	return nil
+}
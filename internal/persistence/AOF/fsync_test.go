@@ -0,0 +1,135 @@
+package AOF
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// TestFsyncAlways — в режиме always запись на диске к моменту возврата
+// Write, в том числе при конкурентных писателях (group commit).
+func TestFsyncAlways(t *testing.T) {
+	dir := t.TempDir()
+	a, err := NewAOF(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.SetFsyncPolicy(FsyncAlways)
+
+	const writers, perWriter = 32, 50
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				if err := a.Write(WriteInput{Cmd: "SET", Key: "k" + strconv.Itoa(w) + ":" + strconv.Itoa(i), Value: "v"}); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Без Close: всё подтверждённое уже в файле
+	data, err := os.ReadFile(filepath.Join(dir, incrFileName(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(recordOffsets(data)); n != writers*perWriter {
+		t.Fatalf("%d records on disk, want %d", n, writers*perWriter)
+	}
+
+	// Смена политики на лету
+	a.SetFsyncPolicy(FsyncNo)
+	if err := a.Write(WriteInput{Cmd: "DEL", Key: "k"}); err != nil {
+		t.Fatal(err)
+	}
+	a.Close()
+	if err := a.Write(WriteInput{Cmd: "DEL", Key: "k"}); err != nil {
+		t.Fatalf("Write after Close: %v", err)
+	}
+}
+
+// TestFsyncAlwaysAppend — Append не ждёт fsync, а ожидание последней
+// записи покрывает все предыдущие.
+func TestFsyncAlwaysAppend(t *testing.T) {
+	dir := t.TempDir()
+	a, err := NewAOF(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	a.SetFsyncPolicy(FsyncAlways)
+
+	const records = 100
+	var wait func() error
+	for i := 0; i < records; i++ {
+		wait = a.Append(WriteInput{Cmd: "SET", Key: "k" + strconv.Itoa(i), Value: "v"})
+	}
+	if wait == nil {
+		t.Fatal("Append in always mode must return wait")
+	}
+	if err := wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, incrFileName(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(recordOffsets(data)); n != records {
+		t.Fatalf("%d records on disk, want %d", n, records)
+	}
+
+	a.SetFsyncPolicy(FsyncEverySec)
+	if wait := a.Append(WriteInput{Cmd: "DEL", Key: "k0"}); wait != nil {
+		t.Fatal("Append in everysec mode has nothing to wait for")
+	}
+}
+
+// TestFsyncAlwaysError — сбой записи возвращается из Write и «залипает»:
+// следующие записи тоже получают ошибку при любой политике.
+func TestFsyncAlwaysError(t *testing.T) {
+	a, err := NewAOF(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	a.SetFsyncPolicy(FsyncAlways)
+	if err := a.Write(WriteInput{Cmd: "SET", Key: "k", Value: "v"}); err != nil || a.WriteErr() != nil {
+		t.Fatalf("Write = %v, WriteErr = %v", err, a.WriteErr())
+	}
+
+	a.mu.Lock()
+	a.file.Close() // дальнейшие flush и fsync завершаются ошибкой
+	a.mu.Unlock()
+
+	var writeErr *WriteError
+	if err := a.Write(WriteInput{Cmd: "SET", Key: "k", Value: "v2"}); !errors.As(err, &writeErr) {
+		t.Fatalf("Write after failure = %v", err)
+	}
+	a.SetFsyncPolicy(FsyncEverySec)
+	if err := a.Write(WriteInput{Cmd: "DEL", Key: "k"}); !errors.As(err, &writeErr) {
+		t.Fatalf("everysec Write after failure = %v", err)
+	}
+	if !errors.As(a.WriteErr(), &writeErr) {
+		t.Fatalf("WriteErr = %v", a.WriteErr())
+	}
+}
+
+func TestParseFsyncPolicy(t *testing.T) {
+	for _, name := range []string{"always", "everysec", "no"} {
+		p, err := ParseFsyncPolicy(name)
+		if err != nil || p.String() != name {
+			t.Fatalf("ParseFsyncPolicy(%q) = %v, %v", name, p, err)
+		}
+	}
+	if _, err := ParseFsyncPolicy("sometimes"); err == nil {
+		t.Fatal("invalid policy accepted")
+	}
+}
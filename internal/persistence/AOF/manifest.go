@@ -0,0 +1,257 @@
+package AOF
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+/*
+
+	Multi-part AOF (как в Redis 7): журнал — base-файл и инкрементальные
+	файлы, список которых хранит манифест journal.aof.manifest:
+
+	  file journal.aof.3.base.aof seq 3 type b
+	  file journal.aof.7.incr.aof seq 7 type i
+	  file journal.aof.8.incr.aof seq 8 type i
+
+	Base — снимок состояния от rewrite, incr — записи после него по порядку.
+	Запись идёт в последний incr. Rewrite не буферизует записи: в точке
+	снимка writer переключается на новый incr, а после записи base
+	манифест заменяется на «новый base + incr начиная с этого». Сбой
+	посреди rewrite оставляет старый манифест — старый base, старые incr
+	и новый incr, который он уже перечисляет.
+
+	Все файлы — формат v2 (format.go). Манифест меняется только атомарным
+	rename, поэтому он всегда перечисляет полный набор файлов.
+
+*/
+
+const (
+	journalName  = "journal.aof"
+	manifestName = journalName + ".manifest"
+)
+
+var errBadManifest = errors.New("AOF: malformed manifest")
+
+// aofFile — файл из манифеста.
+type aofFile struct {
+	name string
+	seq  int64
+	base bool
+}
+
+// manifest — состав журнала: base (может не быть) и incr по порядку.
+type manifest struct {
+	base  *aofFile
+	incrs []aofFile
+}
+
+func baseFileName(seq int64) string {
+	return journalName + "." + strconv.FormatInt(seq, 10) + ".base.aof"
+}
+
+func incrFileName(seq int64) string {
+	return journalName + "." + strconv.FormatInt(seq, 10) + ".incr.aof"
+}
+
+// files — файлы журнала в порядке replay.
+func (m *manifest) files() []aofFile {
+	files := make([]aofFile, 0, len(m.incrs)+1)
+	if m.base != nil {
+		files = append(files, *m.base)
+	}
+	return append(files, m.incrs...)
+}
+
+// last — текущий incr, в который идёт запись.
+func (m *manifest) last() aofFile {
+	return m.incrs[len(m.incrs)-1]
+}
+
+// nextIncrSeq / nextBaseSeq — номера для новых файлов.
+func (m *manifest) nextIncrSeq() int64 {
+	if len(m.incrs) == 0 {
+		return 1
+	}
+	return m.last().seq + 1
+}
+
+func (m *manifest) nextBaseSeq() int64 {
+	if m.base == nil {
+		return 1
+	}
+	return m.base.seq + 1
+}
+
+// withIncr — копия манифеста с ещё одним incr.
+func (m *manifest) withIncr(f aofFile) *manifest {
+	next := &manifest{base: m.base, incrs: make([]aofFile, 0, len(m.incrs)+1)}
+	next.incrs = append(append(next.incrs, m.incrs...), f)
+	return next
+}
+
+func (m *manifest) marshal() []byte {
+	var b strings.Builder
+	for _, f := range m.files() {
+		typ := "i"
+		if f.base {
+			typ = "b"
+		}
+		fmt.Fprintf(&b, "file %s seq %d type %s\n", f.name, f.seq, typ)
+	}
+	return []byte(b.String())
+}
+
+// loadManifest читает манифест. os.ErrNotExist — манифеста ещё нет.
+func loadManifest(dir string) (*manifest, error) {
+	f, err := os.Open(filepath.Join(dir, manifestName))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	m := &manifest{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 6 || fields[0] != "file" || fields[2] != "seq" || fields[4] != "type" {
+			return nil, fmt.Errorf("%w: %q", errBadManifest, line)
+		}
+		seq, err := strconv.ParseInt(fields[3], 10, 64)
+		if err != nil || seq <= 0 || strings.ContainsAny(fields[1], `/\`) {
+			return nil, fmt.Errorf("%w: %q", errBadManifest, line)
+		}
+		file := aofFile{name: fields[1], seq: seq}
+		switch fields[5] {
+		case "b":
+			if m.base != nil || len(m.incrs) > 0 {
+				return nil, fmt.Errorf("%w: unexpected base %q", errBadManifest, file.name)
+			}
+			file.base = true
+			m.base = &file
+		case "i":
+			if len(m.incrs) > 0 && seq <= m.last().seq {
+				return nil, fmt.Errorf("%w: incr %q out of order", errBadManifest, file.name)
+			}
+			m.incrs = append(m.incrs, file)
+		default:
+			return nil, fmt.Errorf("%w: %q", errBadManifest, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(m.incrs) == 0 {
+		return nil, fmt.Errorf("%w: no incr files", errBadManifest)
+	}
+	return m, nil
+}
+
+// writeManifest атомарно заменяет манифест.
+func writeManifest(dir string, m *manifest) error {
+	path := filepath.Join(dir, manifestName)
+	tmpPath := path + ".tmp"
+
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(m.marshal())
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return syncDir(dir)
+}
+
+// createIncr создаёт пустой incr-файл с заголовком v2 (fsync).
+func createIncr(dir string, seq int64) (*os.File, error) {
+	f, err := os.OpenFile(filepath.Join(dir, incrFileName(seq)), os.O_APPEND|os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Write(fileHeader); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// openManifest открывает журнал по манифесту. Без манифеста создаёт его:
+// журнал старого формата (один файл journal.aof) становится base, как
+// есть, под тем же именем. Возвращает манифест и открытый последний incr.
+func openManifest(dir string) (*manifest, *os.File, *ReadResult, error) {
+	m, err := loadManifest(dir)
+	if err == nil {
+		for _, file := range m.files() {
+			if _, err := os.Stat(filepath.Join(dir, file.name)); err != nil {
+				return nil, nil, nil, fmt.Errorf("AOF: file from manifest: %w", err)
+			}
+		}
+		f, _, err := openJournal(filepath.Join(dir, m.last().name))
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return m, f, nil, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, nil, nil, err
+	}
+
+	m = &manifest{}
+	var migrated *ReadResult
+	legacyPath := filepath.Join(dir, journalName)
+	if _, err := os.Stat(legacyPath); err == nil {
+		lf, res, err := openJournal(legacyPath)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		lf.Close()
+		migrated = res
+		m.base = &aofFile{name: journalName, seq: 1, base: true}
+	}
+
+	// Сбой до записи манифеста — при следующем старте всё повторится
+	m.incrs = []aofFile{{name: incrFileName(1), seq: 1}}
+	f, err := createIncr(dir, 1)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if err := writeManifest(dir, m); err != nil {
+		f.Close()
+		return nil, nil, nil, err
+	}
+	return m, f, migrated, nil
+}
+
+// syncDir делает durable rename и создание файлов в dir.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
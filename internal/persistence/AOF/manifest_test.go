@@ -0,0 +1,135 @@
+package AOF
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// rotate переключает writer на новый incr, как маркер rewrite.
+func rotate(t *testing.T, a *AOF) int64 {
+	t.Helper()
+	marker := writeEntry{rotate: &rotateMark{}, done: make(chan error, 1)}
+	a.enqueue(marker)
+	if err := a.await(marker); err != nil {
+		t.Fatal(err)
+	}
+	if marker.rotate.err != nil {
+		t.Fatal(marker.rotate.err)
+	}
+	return marker.rotate.seq
+}
+
+// TestMultiPartReplay — сбой посреди rewrite (incr уже переключён, base
+// не записан): журнал читается как старые файлы + новый incr по порядку.
+func TestMultiPartReplay(t *testing.T) {
+	dir := t.TempDir()
+	a, err := NewAOF(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		a.Write(WriteInput{Cmd: "RPUSH", Key: "list", Value: strconv.Itoa(i)})
+		if seq := rotate(t, a); seq != int64(i+2) {
+			t.Fatalf("rotated to incr %d, want %d", seq, i+2)
+		}
+	}
+	a.Write(WriteInput{Cmd: "RPUSH", Key: "list", Value: "3"})
+	a.Close()
+
+	m, err := loadManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.base != nil || len(m.incrs) != 4 {
+		t.Fatalf("manifest = %s", m.marshal())
+	}
+
+	got, _ := readAll(t, dir)
+	if fmt.Sprint(got) != "[{RPUSH list 0 0} {RPUSH list 1 0} {RPUSH list 2 0} {RPUSH list 3 0}]" {
+		t.Fatalf("replayed %v", got)
+	}
+
+	// Повреждение не последнего файла не лечится обрезкой
+	path := filepath.Join(dir, incrFileName(2))
+	data, _ := os.ReadFile(path)
+	data[len(data)-1] ^= 0xFF
+	os.WriteFile(path, data, 0644)
+
+	a, err = NewAOF(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	if _, err := a.Read(func(cmd, key, value string, expire int64) {}); err == nil {
+		t.Fatal("corrupt sealed incr accepted")
+	}
+}
+
+// TestRewriteRotates — rewrite оставляет новый base и incr, открытый на
+// маркере; старые файлы удаляются, записи после маркера не теряются.
+func TestRewriteRotates(t *testing.T) {
+	dir := t.TempDir()
+	a, err := NewAOF(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		a.Write(WriteInput{Cmd: "SET", Key: "k", Value: strconv.Itoa(i)})
+	}
+	err = a.Rewrite(func(mark func(), fn func(cmd, key, value string, expireAt int64)) {
+		mark()
+		// Запись после маркера — уже в новом incr
+		a.Write(WriteInput{Cmd: "SET", Key: "after", Value: "1"})
+		fn("SET", "k", "99", 0)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Write(WriteInput{Cmd: "SET", Key: "after", Value: "2"})
+	a.Close()
+
+	m, err := loadManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(m.marshal()) != "file journal.aof.1.base.aof seq 1 type b\nfile journal.aof.2.incr.aof seq 2 type i\n" {
+		t.Fatalf("manifest = %q", m.marshal())
+	}
+	if _, err := os.Stat(filepath.Join(dir, incrFileName(1))); !os.IsNotExist(err) {
+		t.Fatal("old incr was not removed")
+	}
+
+	got, _ := readAll(t, dir)
+	if fmt.Sprint(got) != "[{SET k 99 0} {SET after 1 0} {SET after 2 0}]" {
+		t.Fatalf("replayed %v", got)
+	}
+}
+
+// TestLegacyJournalAdopted — журнал старой раскладки (один journal.aof)
+// становится base под тем же именем, запись идёт в новый incr.
+func TestLegacyJournalAdopted(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, journalName), appendRecord(append([]byte(nil), fileHeader...), "SET", "old", "1", 0), 0644)
+
+	a, err := NewAOF(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Write(WriteInput{Cmd: "SET", Key: "new", Value: "2"})
+	a.Close()
+
+	m, err := loadManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.base == nil || m.base.name != journalName || m.last().name != incrFileName(1) {
+		t.Fatalf("manifest = %q", m.marshal())
+	}
+	got, _ := readAll(t, dir)
+	if fmt.Sprint(got) != "[{SET old 1 0} {SET new 2 0}]" {
+		t.Fatalf("replayed %v", got)
+	}
+}
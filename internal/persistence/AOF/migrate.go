@@ -0,0 +1,208 @@
+package AOF
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"hash/crc64"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const maxScanSize = 16 * 1024 * 1024 // 16MB макс размер строки текстового формата
+
+var errUnknownFormat = errors.New("AOF: unrecognized journal format")
+
+// openJournal открывает журнал для дописывания. Пустой файл (или заголовок,
+// оборванный сбоем) получает заголовок v2, текстовый журнал конвертируется.
+// Возвращает результат миграции, если она была.
+func openJournal(path string) (*os.File, *ReadResult, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	head := make([]byte, headerSize)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		f.Close()
+		return nil, nil, err
+	}
+
+	switch {
+	case n == headerSize && string(head[:len(aofMagic)]) == aofMagic:
+		if v := head[len(aofMagic)]; v != aofVersion {
+			f.Close()
+			return nil, nil, fmt.Errorf("AOF: unsupported format version %d", v)
+		}
+		return f, nil, nil
+
+	case bytes.HasPrefix(fileHeader, head[:n]):
+		if err := f.Truncate(0); err != nil {
+			f.Close()
+			return nil, nil, err
+		}
+		if _, err := f.Write(fileHeader); err != nil {
+			f.Close()
+			return nil, nil, err
+		}
+		return f, nil, f.Sync()
+	}
+
+	f.Close()
+	migrated, err := migrateLegacy(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	f, err = os.OpenFile(path, os.O_APPEND|os.O_RDWR, 0644)
+	return f, migrated, err
+}
+
+// migrateLegacy конвертирует текстовый журнал в v2: записи (включая маркеры
+// MULTI/EXEC) переписываются по порядку, битый хвост отбрасывается, как при
+// обычном восстановлении. Файл подменяется атомарным rename.
+func migrateLegacy(path string) (*ReadResult, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	tmpPath := path + ".migrate"
+	dst, err := os.Create(tmpPath)
+	if err != nil {
+		return nil, err
+	}
+
+	w := bufio.NewWriterSize(dst, writeBufSize)
+	w.Write(fileHeader)
+
+	var rec []byte
+	result, err := readLegacy(src, func(cmd, key, value string, expire int64) {
+		rec = appendRecord(rec[:0], cmd, key, value, expire)
+		w.Write(rec)
+	})
+	// Ни одной валидной строки — это не текстовый журнал (например, v2 с
+	// повреждённым заголовком). Не затираем файл пустым
+	if err == nil && result.ValidEntries == 0 && result.CorruptEntries > 0 {
+		err = errUnknownFormat
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = dst.Sync()
+	}
+	dst.Close()
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return nil, err
+	}
+
+	log.Printf("AOF: migrated %d entries from text format to v2 (discarded %d)",
+		result.ValidEntries, result.CorruptEntries)
+	return result, nil
+}
+
+// readLegacy читает текстовый журнал: crc64hex|cmd|key|expire|value\n
+// (и ещё более старые строки без CRC: cmd|key|expire|value).
+// Останавливается на первой битой строке. Маркеры MULTI/EXEC передаются
+// в rf как есть — группировку делает Read при чтении v2.
+func readLegacy(r io.Reader, rf func(cmd, key, value string, expire int64)) (*ReadResult, error) {
+	result := &ReadResult{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxScanSize)
+
+	var lastValidPos int64
+
+	corrupt := func(reason string) {
+		log.Printf("AOF: %s at offset %d", reason, lastValidPos)
+		result.CorruptEntries++
+		result.Truncated = true
+		result.TruncatedAt = lastValidPos
+	}
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		lineLen := int64(len(scanner.Bytes())) + 1 // +1 для \n
+
+		// Первый | отделяет CRC от payload
+		sepIdx := strings.IndexByte(line, '|')
+		if sepIdx < 1 {
+			corrupt("corrupt entry (no CRC separator)")
+			break
+		}
+
+		crcHex := line[:sepIdx]
+		payload := line[sepIdx+1:]
+
+		storedCRC, err := strconv.ParseUint(crcHex, 16, 64)
+		if err != nil {
+			// CRC не парсится — может быть формат без CRC
+			if parseLegacy(line, rf) {
+				result.ValidEntries++
+				lastValidPos += lineLen
+				continue
+			}
+			corrupt("corrupt CRC")
+			break
+		}
+
+		if computedCRC := crc64.Checksum([]byte(payload), crcTable); storedCRC != computedCRC {
+			log.Printf("AOF: CRC mismatch at offset %d (stored=%x computed=%x)",
+				lastValidPos, storedCRC, computedCRC)
+			result.CorruptEntries++
+			result.Truncated = true
+			result.TruncatedAt = lastValidPos
+			break
+		}
+
+		// CRC OK — парсим payload: cmd|key|expire|value
+		parts := strings.SplitN(payload, "|", 4)
+		if len(parts) < 4 {
+			corrupt("malformed payload")
+			break
+		}
+
+		expire, err := strconv.ParseInt(parts[2], 10, 64)
+		if err != nil {
+			corrupt("bad expire")
+			break
+		}
+
+		result.ValidEntries++
+		lastValidPos += lineLen
+		rf(parts[0], parts[1], parts[3], expire)
+	}
+
+	return result, scanner.Err()
+}
+
+// parseLegacy пытается прочитать запись в формате без CRC: cmd|key|expire|value
+func parseLegacy(line string, rf func(cmd, key, value string, expire int64)) bool {
+	parts := strings.SplitN(line, "|", 4)
+	if len(parts) < 4 {
+		return false
+	}
+
+	// Проверяем что первая часть — валидная команда (SET, DEL, GET)
+	cmd := parts[0]
+	if cmd != "SET" && cmd != "DEL" && cmd != "GET" {
+		return false
+	}
+
+	expire, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return false
+	}
+
+	rf(cmd, parts[1], parts[3], expire)
+	return true
+}
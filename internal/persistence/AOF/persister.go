@@ -16,9 +16,9 @@ func NewPersister(dir string) (*AOFPersister, error) {
 	return &AOFPersister{aof: a}, nil
 }
 
-// Write записывает команду через AOF.
-func (p *AOFPersister) Write(cmd, key, value string, duration time.Duration) error {
-	return p.aof.Write(WriteInput{
+// Write ставит команду в очередь AOF (см. AOF.Append).
+func (p *AOFPersister) Write(cmd, key, value string, duration time.Duration) func() error {
+	return p.aof.Append(WriteInput{
 		Cmd:   cmd,
 		Key:   key,
 		Value: value,
@@ -26,6 +26,21 @@ func (p *AOFPersister) Write(cmd, key, value string, duration time.Duration) err
 	})
 }
 
+// WriteAt записывает команду с абсолютным временем истечения (нс).
+func (p *AOFPersister) WriteAt(cmd, key, value string, expireAt int64) func() error {
+	return p.aof.Append(WriteInput{
+		Cmd:      cmd,
+		Key:      key,
+		Value:    value,
+		ExpireAt: expireAt,
+	})
+}
+
+// WriteErr возвращает ошибку записи журнала (*WriteError) или nil.
+func (p *AOFPersister) WriteErr() error {
+	return p.aof.WriteErr()
+}
+
 // Read делегирует чтение AOF с CRC64 проверкой и truncate recovery.
 func (p *AOFPersister) Read(rf func(cmd, key, value string, expire int64)) (*ReadResult, error) {
 	return p.aof.Read(rf)
@@ -37,6 +52,76 @@ func (p *AOFPersister) Close() error {
 }
 
 // Rewrite выполняет компактность AOF — оставляет только последнее состояние.
-func (p *AOFPersister) Rewrite(snapshot func(fn func(cmd, key, value string, expireAt int64))) error {
+func (p *AOFPersister) Rewrite(snapshot Snapshot) error {
 	return p.aof.Rewrite(snapshot)
 }
+
+// SetSnapshot задаёт источник данных для фонового и auto-rewrite.
+func (p *AOFPersister) SetSnapshot(snapshot Snapshot) {
+	p.aof.SetSnapshot(snapshot)
+}
+
+// BackgroundRewrite запускает rewrite в фоне (BGREWRITEAOF).
+func (p *AOFPersister) BackgroundRewrite() error {
+	return p.aof.BackgroundRewrite()
+}
+
+// SetAutoRewrite задаёт пороги auto-rewrite (percentage = 0 — выключить).
+func (p *AOFPersister) SetAutoRewrite(percentage, minSize int64) {
+	p.aof.SetAutoRewrite(percentage, minSize)
+}
+
+// AutoRewrite возвращает пороги auto-rewrite.
+func (p *AOFPersister) AutoRewrite() (percentage, minSize int64) {
+	return p.aof.AutoRewrite()
+}
+
+// RewriteStats возвращает состояние rewrite для INFO.
+func (p *AOFPersister) RewriteStats() RewriteStats {
+	return p.aof.RewriteStats()
+}
+
+// SetFsyncPolicy меняет политику fsync журнала.
+func (p *AOFPersister) SetFsyncPolicy(policy FsyncPolicy) {
+	p.aof.SetFsyncPolicy(policy)
+}
+
+// FsyncPolicy возвращает текущую политику fsync.
+func (p *AOFPersister) FsyncPolicy() FsyncPolicy {
+	return p.aof.FsyncPolicy()
+}
+
+// Save пишет снимок состояния синхронно (SAVE).
+func (p *AOFPersister) Save(snapshot Snapshot) error {
+	return p.aof.Save(snapshot)
+}
+
+// BackgroundSave пишет снимок в фоне (BGSAVE).
+func (p *AOFPersister) BackgroundSave() error {
+	return p.aof.BackgroundSave()
+}
+
+// SetSaveRules задаёт расписание снимков (пустое — выключить).
+func (p *AOFPersister) SetSaveRules(rules []SaveRule) {
+	p.aof.SetSaveRules(rules)
+}
+
+// SaveRules возвращает расписание снимков.
+func (p *AOFPersister) SaveRules() []SaveRule {
+	return p.aof.SaveRules()
+}
+
+// SaveStats возвращает состояние снимков для INFO и LASTSAVE.
+func (p *AOFPersister) SaveStats() SaveStats {
+	return p.aof.SaveStats()
+}
+
+// SetCorruptPolicy задаёт, что делать с повреждёнными записями при Read.
+func (p *AOFPersister) SetCorruptPolicy(policy CorruptPolicy) {
+	p.aof.SetCorruptPolicy(policy)
+}
+
+// CorruptPolicy возвращает политику загрузки повреждённого журнала.
+func (p *AOFPersister) CorruptPolicy() CorruptPolicy {
+	return p.aof.CorruptPolicy()
+}
@@ -2,141 +2,320 @@ package AOF
 
 import (
 	"bufio"
+	"encoding/binary"
+	"fmt"
 	"hash/crc64"
 	"io"
 	"log"
-	"strconv"
-	"strings"
+	"os"
+	"path/filepath"
 )
 
-const maxScanSize = 16 * 1024 * 1024 // 16MB макс размер строки
+const readBufSize = 64 * 1024 // 64KB буфер bufio.Reader
 
-// Read считывает все команды из AOF, проверяя CRC64.
-// Формат строки: crc64hex|cmd|key|expire|value
-// При обнаружении битой записи — обрезает файл до последней валидной.
+// Read считывает все команды журнала — base и incr-файлы по порядку
+// манифеста, — проверяя CRC64 каждой записи.
+// При обнаружении битой или недописанной записи в последнем файле —
+// обрезает его до последней валидной. Остальные файлы сбрасывались на
+// диск целиком до переключения, поэтому повреждение в них — ошибка.
+// Записи между маркерами MULTI и EXEC применяются только вместе:
+// незавершённая транзакция отбрасывается, файл обрезается до её начала.
+// Если есть снимок (dump.imcs) с маркером в журнале, сначала применяется
+// он, а журнал читается только после маркера.
 // Возвращает ReadResult с информацией о восстановлении.
 func (a *AOF) Read(rf func(cmd, key, value string, expire int64)) (*ReadResult, error) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
-	if _, err := a.file.Seek(0, 0); err != nil {
+	result := &ReadResult{}
+
+	// Хвост текстового журнала, отброшенный при миграции, — тоже обрезка
+	if m := a.migrated; m != nil && m.Truncated {
+		result.CorruptEntries = m.CorruptEntries
+		result.Truncated = true
+		result.TruncatedAt = m.TruncatedAt
+	}
+	a.migrated = nil
+
+	// Снимок, если есть и сходится с журналом, заменяет журнал до маркера
+	files := a.manifest.files()
+	start, pos, keys, err := a.loadSnapshotLocked(files, rf)
+	if err != nil {
 		return nil, err
 	}
+	result.SnapshotKeys = keys
 
-	result := &ReadResult{}
-	scanner := bufio.NewScanner(a.file)
-	scanner.Buffer(make([]byte, 64*1024), maxScanSize)
-
-	var lastValidPos int64
-
-	for scanner.Scan() {
-		line := scanner.Text()
-		lineLen := int64(len(scanner.Bytes())) + 1 // +1 для \n
-
-		// Парсим: crc64hex|cmd|key|expire|value
-		// Первый | отделяет CRC от payload
-		sepIdx := strings.IndexByte(line, '|')
-		if sepIdx < 1 {
-			// Формат не соответствует — считаем corrupt, обрезаем
-			log.Printf("AOF: corrupt entry at offset %d (no CRC separator)", lastValidPos)
-			result.CorruptEntries++
-			result.Truncated = true
-			result.TruncatedAt = lastValidPos
-			break
+	policy := a.CorruptPolicy()
+	for i := start; i < len(files); i++ {
+		from := int64(headerSize)
+		if i == start {
+			from = pos
 		}
+		last := i == len(files)-1
+		name := files[i].name
 
-		crcHex := line[:sepIdx]
-		payload := line[sepIdx+1:]
-
-		// Проверяем CRC64
-		storedCRC, err := strconv.ParseUint(crcHex, 16, 64)
-		if err != nil {
-			// CRC не парсится — может быть старый формат без CRC
-			// Попробуем прочитать как legacy формат: cmd|key|expire|value
-			if parseLegacy(line, rf) {
-				result.ValidEntries++
-				lastValidPos += lineLen
-				continue
+		f := a.file
+		if !last {
+			if f, err = openSealed(filepath.Join(a.dir, name)); err != nil {
+				return result, err
 			}
-			log.Printf("AOF: corrupt CRC at offset %d", lastValidPos)
-			result.CorruptEntries++
-			result.Truncated = true
-			result.TruncatedAt = lastValidPos
-			break
 		}
-
-		computedCRC := crc64.Checksum([]byte(payload), crcTable)
-		if storedCRC != computedCRC {
-			log.Printf("AOF: CRC mismatch at offset %d (stored=%x computed=%x)",
-				lastValidPos, storedCRC, computedCRC)
-			result.CorruptEntries++
-			result.Truncated = true
-			result.TruncatedAt = lastValidPos
-			break
+		scan, err := scanFile(f, from, policy == CorruptSkip, rf)
+		if !last {
+			f.Close()
 		}
-
-		// CRC OK — парсим payload: cmd|key|expire|value
-		parts := strings.SplitN(payload, "|", 4)
-		if len(parts) < 4 {
-			log.Printf("AOF: malformed payload at offset %d", lastValidPos)
-			result.CorruptEntries++
-			result.Truncated = true
-			result.TruncatedAt = lastValidPos
-			break
+		if err != nil {
+			return result, err
 		}
+		result.ValidEntries += scan.valid
+		if len(scan.regions) == 0 {
+			continue
+		}
+		first := scan.regions[0]
 
-		expire, err := strconv.ParseInt(parts[2], 10, 64)
-		if err != nil {
-			log.Printf("AOF: bad expire at offset %d", lastValidPos)
-			result.CorruptEntries++
+		switch {
+		case policy == CorruptRefuse:
+			return result, fmt.Errorf("%w: %s at offset %d (%s)", ErrCorrupt, name, first.Offset, first.Reason)
+
+		case policy == CorruptSkip:
+			var skipped int64
+			for _, r := range scan.regions {
+				skipped += r.Length
+			}
+			log.Printf("AOF: moving %d corrupt regions (%d bytes) of %s to quarantine",
+				len(scan.regions), skipped, name)
+			if err := quarantine(filepath.Join(a.dir, name), scan.regions); err != nil {
+				return result, err
+			}
+			result.CorruptEntries += scan.corrupt
+			result.Skipped += skipped
+			a.size.Add(-skipped)
+			a.baseSize.Store(a.size.Load())
+			if last {
+				if err := a.reopenLocked(); err != nil {
+					return result, err
+				}
+			}
+
+		case !last:
+			// Не последний файл: повреждение не лечится обрезкой — записи
+			// следующих файлов легли бы поверх дыры
+			return result, fmt.Errorf("%w: %s at offset %d (%s)", ErrCorrupt, name, first.Offset, first.Reason)
+
+		default:
+			// Обрезаем последний файл если нашли corruption
+			result.CorruptEntries += scan.corrupt
 			result.Truncated = true
-			result.TruncatedAt = lastValidPos
-			break
+			result.TruncatedAt = first.Offset
+			log.Printf("AOF: truncating %s at offset %d (recovered %d entries, discarded %d)",
+				name, result.TruncatedAt, result.ValidEntries, result.CorruptEntries)
+			if err := a.file.Truncate(result.TruncatedAt); err != nil {
+				return result, err
+			}
+			a.size.Add(result.TruncatedAt - a.fileSize)
+			a.baseSize.Store(a.size.Load())
+			a.fileSize = result.TruncatedAt
+			// Перемещаем seek на конец для дальнейшей записи
+			if _, err := a.file.Seek(0, io.SeekEnd); err != nil {
+				return result, err
+			}
 		}
+	}
+
+	return result, nil
+}
 
-		result.ValidEntries++
-		lastValidPos += lineLen
-		rf(parts[0], parts[1], parts[3], expire)
+// openSealed открывает на чтение файл журнала, в который больше не пишут,
+// и проверяет заголовок v2.
+func openSealed(path string) (*os.File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	head := make([]byte, headerSize)
+	if _, err := io.ReadFull(f, head); err != nil || string(head) != string(fileHeader) {
+		f.Close()
+		return nil, fmt.Errorf("AOF: %s: %w", filepath.Base(path), errUnknownFormat)
 	}
+	return f, nil
+}
 
-	if err := scanner.Err(); err != nil {
-		return result, err
+// reopenLocked переоткрывает текущий incr после того, как файл подменили
+// (карантин при CorruptSkip).
+func (a *AOF) reopenLocked() error {
+	f, err := os.OpenFile(filepath.Join(a.dir, a.manifest.last().name), os.O_APPEND|os.O_RDWR, 0644)
+	if err != nil {
+		return err
 	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	a.file.Close()
+	a.file = f
+	a.writer = bufio.NewWriterSize(f, writeBufSize)
+	a.fileSize = info.Size()
+	return nil
+}
 
-	// Обрезаем файл если нашли corruption
-	if result.Truncated {
-		log.Printf("AOF: truncating file at offset %d (recovered %d entries, discarded %d)",
-			result.TruncatedAt, result.ValidEntries, result.CorruptEntries)
-		if err := a.file.Truncate(result.TruncatedAt); err != nil {
-			return result, err
-		}
-		// Перемещаем seek на конец для дальнейшей записи
-		if _, err := a.file.Seek(0, io.SeekEnd); err != nil {
-			return result, err
+// fileScan — результат прохода по одному файлу журнала.
+type fileScan struct {
+	size    int64
+	valid   int // целых записей (без отброшенных транзакций)
+	corrupt int // битых записей
+	regions []CorruptRegion
+}
+
+// add добавляет участок, сливая его с пересекающимися и смежными.
+// Транзакция накрывает битые участки внутри себя.
+func (s *fileScan) add(r CorruptRegion) {
+	for n := len(s.regions); n > 0; n = len(s.regions) {
+		last := s.regions[n-1]
+		if last.Offset+last.Length < r.Offset {
+			break
 		}
+		end := max(last.Offset+last.Length, r.Offset+r.Length)
+		r.Offset = min(last.Offset, r.Offset)
+		r.Length = end - r.Offset
+		s.regions = s.regions[:n-1]
 	}
-
-	return result, nil
+	s.regions = append(s.regions, r)
 }
 
-// parseLegacy пытается прочитать запись в старом формате (без CRC): cmd|key|expire|value
-func parseLegacy(line string, rf func(cmd, key, value string, expire int64)) bool {
-	parts := strings.SplitN(line, "|", 4)
-	if len(parts) < 4 {
-		return false
+// scanFile проигрывает записи одного файла журнала с позиции pos (rf может
+// быть nil — только проверка). skip = false: на первой битой записи проход
+// останавливается, участок — до конца файла. skip = true: проход
+// продолжается с ближайшей целой записи (resync).
+// Незавершённая транзакция в конце файла — тоже участок: обрезка
+// обязательна, иначе следующий EXEC в файле «завершит» её.
+func scanFile(f *os.File, pos int64, skip bool, rf func(cmd, key, value string, expire int64)) (*fileScan, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
 	}
+	scan := &fileScan{size: info.Size()}
+	size := scan.size
 
-	// Проверяем что первая часть — валидная команда (SET, DEL, GET)
-	cmd := parts[0]
-	if cmd != "SET" && cmd != "DEL" && cmd != "GET" {
-		return false
+	if _, err := f.Seek(pos, io.SeekStart); err != nil {
+		return nil, err
 	}
+	r := bufio.NewReaderSize(f, readBufSize)
 
-	expire, err := strconv.ParseInt(parts[2], 10, 64)
-	if err != nil {
-		return false
+	var (
+		hdr     [recordHeaderSize]byte
+		payload []byte
+	)
+
+	// Открытая транзакция: записи ждут маркера EXEC. damaged — внутри
+	// был пропущен битый участок, транзакция отбрасывается целиком
+	var (
+		inTx    bool
+		damaged bool
+		txStart int64
+		txQueue []txEntry
+	)
+	dropTx := func(end int64, records int, reason string) {
+		log.Printf("AOF: %s at offset %d discarded (%d entries)", reason, txStart, len(txQueue))
+		scan.valid -= records
+		scan.add(CorruptRegion{Offset: txStart, Length: end - txStart, Reason: reason})
+	}
+
+	for {
+		var (
+			reason string
+			length int64
+		)
+		if _, err := io.ReadFull(r, hdr[:]); err == io.EOF {
+			break
+		} else if err == io.ErrUnexpectedEOF {
+			reason = "incomplete record header"
+		} else if err != nil {
+			return nil, err
+		}
+
+		// Длину сверяем с размером файла до аллокации: мусор вместо
+		// заголовка не должен превращаться в многогигабайтный буфер
+		if reason == "" {
+			length = int64(binary.BigEndian.Uint32(hdr[:4]))
+			if length > size-pos-recordHeaderSize {
+				reason = "incomplete record"
+			}
+		}
+		var cmd, key, value string
+		var expire int64
+		if reason == "" {
+			if int64(cap(payload)) < length {
+				payload = make([]byte, length)
+			}
+			payload = payload[:length]
+			if _, err := io.ReadFull(r, payload); err != nil {
+				return nil, err
+			}
+
+			storedCRC := binary.BigEndian.Uint64(hdr[4:])
+			if computedCRC := crc64.Checksum(payload, crcTable); storedCRC != computedCRC {
+				reason = fmt.Sprintf("CRC mismatch (stored=%x computed=%x)", storedCRC, computedCRC)
+			} else if cmd, key, value, expire, err = decodePayload(payload); err != nil {
+				reason = "malformed payload"
+			}
+		}
+
+		if reason != "" {
+			log.Printf("AOF: %s at offset %d", reason, pos)
+			scan.corrupt++
+			next := size
+			if skip {
+				if next, err = resync(f, pos, size); err != nil {
+					return nil, err
+				}
+			}
+			scan.add(CorruptRegion{Offset: pos, Length: next - pos, Reason: reason})
+			damaged = damaged || inTx
+			if !skip || next == size {
+				break
+			}
+			pos = next
+			if _, err := f.Seek(pos, io.SeekStart); err != nil {
+				return nil, err
+			}
+			r.Reset(f)
+			continue
+		}
+
+		scan.valid++
+		end := pos + recordHeaderSize + length
+
+		switch {
+		case cmd == snapshotCmd:
+			// Маркер снимка — для loadSnapshotLocked, не команда
+		case cmd == "MULTI":
+			// MULTI внутри транзакции — EXEC прежней попал в битый участок
+			if inTx && skip {
+				dropTx(pos, len(txQueue)+1, "incomplete transaction")
+			}
+			inTx, damaged, txStart, txQueue = true, false, pos, txQueue[:0]
+		case cmd == "EXEC" && inTx:
+			if damaged {
+				dropTx(end, len(txQueue)+2, "damaged transaction")
+			} else if rf != nil {
+				for _, e := range txQueue {
+					rf(e.cmd, e.key, e.value, e.expire)
+				}
+			}
+			inTx = false
+		case inTx:
+			txQueue = append(txQueue, txEntry{cmd, key, value, expire})
+		case cmd != "EXEC" && rf != nil:
+			rf(cmd, key, value, expire)
+		}
+
+		pos = end
 	}
 
-	rf(cmd, parts[1], parts[3], expire)
-	return true
+	// Транзакция без EXEC (сбой посреди записи) — отбрасываем целиком
+	if inTx {
+		dropTx(size, len(txQueue)+1, "incomplete transaction")
+	}
+	return scan, nil
 }
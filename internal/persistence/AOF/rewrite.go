@@ -2,118 +2,249 @@ package AOF
 
 import (
 	"bufio"
-	"hash/crc64"
+	"errors"
 	"log"
 	"os"
 	"path/filepath"
-	"strconv"
+	"time"
 )
 
-// Rewrite компактит AOF с буфером докатки (как Redis).
+const (
+	DefaultRewritePercentage = 100              // auto-aof-rewrite-percentage
+	DefaultRewriteMinSize    = 64 * 1024 * 1024 // auto-aof-rewrite-min-size: 64MB
+
+	// rewriteRetryDelay — пауза auto-rewrite после неудачи (например,
+	// кончился диск), чтобы не повторять его на каждой пачке записей.
+	rewriteRetryDelay = 30 * time.Second
+)
+
+var (
+	// ErrRewriteInProgress — rewrite уже идёт.
+	ErrRewriteInProgress = errors.New("AOF: rewrite already in progress")
+	// ErrNoSnapshot — для фонового rewrite не задан источник (SetSnapshot).
+	ErrNoSnapshot = errors.New("AOF: no snapshot source for rewrite")
+)
+
+// Rewrite компактит AOF: пишет новый base по снимку и отбрасывает старые
+// base и incr (как multi-part AOF в Redis 7).
 //
 // Алгоритм:
-//  1. Включаем rewriting flag → backgroundWriter начинает дублировать записи в rewriteBuf
-//  2. Делаем Snapshot через callback — пишем живые ключи в новый файл
-//  3. Останавливаем backgroundWriter на мьютексе
-//  4. Дописываем rewriteBuf (записи, пришедшие во время snapshot) в новый файл
-//  5. Atomic rename нового файла → старый
-//  6. Переоткрываем файл для дальнейших записей
-//  7. Выключаем rewriting flag
+//  1. Snapshot останавливает запись в кеш и вызывает mark: маркер
+//     встаёт в очередь writer'а, на нём writer переключается на новый
+//     incr (манифест уже перечисляет его — сбой дальше ничего не теряет)
+//  2. Snapshot пишет живые ключи во временный base
+//  3. Ждём, пока writer дойдёт до маркера — записи до него уже в снимке
+//  4. fsync и rename нового base
+//  5. Манифест: новый base + incr начиная с открытого на маркере
+//  6. Удаляем старые base и incr
 //
-// Новые записи НЕ теряются — они в rewriteBuf.
-func (a *AOF) Rewrite(snapshot func(fn func(cmd, key, value string, expireAt int64))) error {
-	tmpPath := filepath.Join(a.dir, "journal.aof.rewrite")
+// Записи во время rewrite идут прямо в новый incr — в памяти ничего не
+// копится. Маркер — единственная граница между снимком и incr, поэтому
+// запись не теряется и не применяется дважды.
+func (a *AOF) Rewrite(snapshot Snapshot) error {
+	if !a.rewriteRunning.CompareAndSwap(false, true) {
+		return ErrRewriteInProgress
+	}
+	a.rewriteWG.Add(1)
+	return a.runRewrite(snapshot)
+}
+
+// BackgroundRewrite запускает Rewrite источника из SetSnapshot в фоне
+// (BGREWRITEAOF, auto-rewrite).
+func (a *AOF) BackgroundRewrite() error {
+	a.mu.Lock()
+	snapshot := a.snapshot
+	a.mu.Unlock()
+	if snapshot == nil {
+		return ErrNoSnapshot
+	}
+	if !a.rewriteRunning.CompareAndSwap(false, true) {
+		return ErrRewriteInProgress
+	}
+	a.rewriteWG.Add(1)
+	go a.runRewrite(snapshot)
+	return nil
+}
+
+// SetSnapshot задаёт источник данных для фонового rewrite.
+func (a *AOF) SetSnapshot(snapshot Snapshot) {
+	a.mu.Lock()
+	a.snapshot = snapshot
+	a.mu.Unlock()
+}
+
+// SetAutoRewrite задаёт пороги auto-rewrite: журнал переписывается, когда
+// он не меньше minSize байт и вырос на percentage% с последнего rewrite.
+// percentage = 0 выключает auto-rewrite.
+func (a *AOF) SetAutoRewrite(percentage, minSize int64) {
+	a.rewritePercentage.Store(percentage)
+	a.rewriteMinSize.Store(minSize)
+}
+
+// AutoRewrite возвращает пороги auto-rewrite.
+func (a *AOF) AutoRewrite() (percentage, minSize int64) {
+	return a.rewritePercentage.Load(), a.rewriteMinSize.Load()
+}
+
+// RewriteStats возвращает состояние rewrite.
+func (a *AOF) RewriteStats() RewriteStats {
+	a.statsMu.Lock()
+	defer a.statsMu.Unlock()
+
+	st := RewriteStats{
+		InProgress:   a.rewriteRunning.Load(),
+		LastDuration: a.lastRewrite,
+		LastErr:      a.lastRewriteErr,
+		CurrentSize:  a.size.Load(),
+		BaseSize:     a.baseSize.Load(),
+	}
+	if st.InProgress && !a.rewriteStarted.IsZero() {
+		st.CurrentTime = time.Since(a.rewriteStarted)
+	}
+	return st
+}
+
+// rewriteDueLocked — пора ли запускать auto-rewrite (под mu).
+func (a *AOF) rewriteDueLocked() bool {
+	percentage := a.rewritePercentage.Load()
+	if percentage <= 0 || a.snapshot == nil || a.rewriteRunning.Load() {
+		return false
+	}
+	size := a.size.Load()
+	if size < a.rewriteMinSize.Load() {
+		return false
+	}
+	base := max(a.baseSize.Load(), 1)
+	if (size-base)*100/base < percentage {
+		return false
+	}
+
+	a.statsMu.Lock()
+	defer a.statsMu.Unlock()
+	return a.lastRewriteErr == nil || time.Since(a.lastRewriteEnd) >= rewriteRetryDelay
+}
+
+// runRewrite выполняет rewrite и запоминает результат для RewriteStats.
+func (a *AOF) runRewrite(snapshot Snapshot) error {
+	defer a.rewriteWG.Done()
+
+	start := time.Now()
+	a.statsMu.Lock()
+	a.rewriteStarted = start
+	a.statsMu.Unlock()
+
+	err := a.rewrite(snapshot)
+
+	a.statsMu.Lock()
+	a.rewriteStarted = time.Time{}
+	a.lastRewrite = time.Since(start)
+	a.lastRewriteEnd = time.Now()
+	a.lastRewriteErr = err
+	a.statsMu.Unlock()
+	a.rewriteRunning.Store(false)
+
+	if err != nil {
+		log.Printf("AOF rewrite failed: %v", err)
+	}
+	return err
+}
+
+func (a *AOF) rewrite(snapshot Snapshot) (err error) {
+	tmpPath := filepath.Join(a.dir, journalName+".rewrite")
 
 	tmpFile, err := os.Create(tmpPath)
 	if err != nil {
 		return err
 	}
-
+	defer func() {
+		if err != nil {
+			tmpFile.Close()
+			os.Remove(tmpPath)
+		}
+	}()
+
+	// Rewrite всегда пишет формат v2
 	writer := bufio.NewWriterSize(tmpFile, writeBufSize)
+	writer.Write(fileHeader)
 	written := 0
 
-	// === Шаг 1: Включаем буфер докатки ===
-	a.rewriteMu.Lock()
-	a.rewriteBuf = a.rewriteBuf[:0] // очищаем
-	a.rewriteMu.Unlock()
-	a.rewriting.Store(true)
-
-	// === Шаг 2: Snapshot — пишем живые ключи ===
-	snapshot(func(cmd, key, value string, expireAt int64) {
-		payload := make([]byte, 0, len(cmd)+len(key)+len(value)+32)
-		payload = append(payload, cmd...)
-		payload = append(payload, '|')
-		payload = append(payload, key...)
-		payload = append(payload, '|')
-		payload = strconv.AppendInt(payload, expireAt, 10)
-		payload = append(payload, '|')
-		payload = append(payload, value...)
-
-		checksum := crc64.Checksum(payload, crcTable)
-		crcHex := strconv.FormatUint(checksum, 16)
-
-		entry := make([]byte, 0, len(crcHex)+1+len(payload)+1)
-		entry = append(entry, crcHex...)
-		entry = append(entry, '|')
-		entry = append(entry, payload...)
-		entry = append(entry, '\n')
+	// === Шаг 1-2: маркер и живые ключи ===
+	marker := writeEntry{rotate: &rotateMark{}, done: make(chan error, 1)}
+	marked, stopped := false, false
+	mark := func() {
+		if !marked {
+			marked, stopped = true, !a.enqueue(marker)
+		}
+	}
 
+	var entry []byte
+	snapshot(mark, func(cmd, key, value string, expireAt int64) {
+		entry = appendRecord(entry[:0], cmd, key, value, expireAt)
 		writer.Write(entry)
 		written++
 	})
+	mark()
 
-	// === Шаг 3-4: Забираем записи из буфера докатки ===
-	// Останавливаем rewriting ПОСЛЕ забора буфера
-	a.rewriteMu.Lock()
-	buffered := make([][]byte, len(a.rewriteBuf))
-	copy(buffered, a.rewriteBuf)
-	a.rewriteBuf = a.rewriteBuf[:0]
-	a.rewriting.Store(false) // новые записи больше не дублируются
-	a.rewriteMu.Unlock()
-
-	// Дописываем буфер докатки в новый файл
-	for _, entry := range buffered {
-		writer.Write(entry)
-		written++
+	// === Шаг 3: writer переключился на новый incr ===
+	if stopped {
+		return ErrClosed
+	}
+	if err := a.await(marker); err != nil {
+		return err
+	}
+	if marker.rotate.err != nil {
+		return marker.rotate.err
 	}
 
+	// === Шаг 4: новый base на диске ===
 	if err := writer.Flush(); err != nil {
-		tmpFile.Close()
-		os.Remove(tmpPath)
 		return err
 	}
 	if err := tmpFile.Sync(); err != nil {
-		tmpFile.Close()
-		os.Remove(tmpPath)
 		return err
 	}
-	tmpFile.Close()
+	info, err := tmpFile.Stat()
+	if err != nil {
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
 
-	// === Шаг 5-6: Atomic rename ===
+	// === Шаг 5: манифест — под mu, writer стоит между пачками ===
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
-	a.writer.Flush()
-	a.file.Sync()
-	a.file.Close()
-
-	origPath := filepath.Join(a.dir, "journal.aof")
-
-	if err := os.Rename(tmpPath, origPath); err != nil {
-		// Восстанавливаем старый файл
-		f, _ := os.OpenFile(origPath, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0644)
-		a.file = f
-		a.writer = bufio.NewWriterSize(f, writeBufSize)
+	old := a.manifest
+	seq := old.nextBaseSeq()
+	base := aofFile{name: baseFileName(seq), seq: seq, base: true}
+	if err := os.Rename(tmpPath, filepath.Join(a.dir, base.name)); err != nil {
 		return err
 	}
-
-	f, err := os.OpenFile(origPath, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0644)
-	if err != nil {
+	next := &manifest{base: &base}
+	for _, f := range old.incrs {
+		if f.seq >= marker.rotate.seq {
+			next.incrs = append(next.incrs, f)
+		}
+	}
+	if err := writeManifest(a.dir, next); err != nil {
+		os.Remove(filepath.Join(a.dir, base.name))
 		return err
 	}
-	a.file = f
-	a.writer = bufio.NewWriterSize(f, writeBufSize)
+	a.manifest = next
+
+	// === Шаг 6: старые файлы больше не нужны ===
+	for _, f := range old.files() {
+		if f.base || f.seq < marker.rotate.seq {
+			os.Remove(filepath.Join(a.dir, f.name))
+		}
+	}
+
+	// Incr после маркера один — текущий
+	size := info.Size() + a.fileSize
+	a.size.Store(size)
+	a.baseSize.Store(size)
 
-	log.Printf("AOF rewrite: %d entries (incl %d buffered during rewrite)", written, len(buffered))
+	log.Printf("AOF rewrite: %d entries in %s", written, base.name)
 	return nil
 }
@@ -0,0 +1,330 @@
+package AOF
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc64"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	dumpFile = "dump.imcs"
+
+	// saveRetryDelay — пауза между попытками save по расписанию после
+	// неудачи (как CONFIG_BGSAVE_RETRY_DELAY в Redis).
+	saveRetryDelay = 5 * time.Second
+)
+
+// DefaultSaveRules — расписание по умолчанию, как в redis.conf.
+var DefaultSaveRules = []SaveRule{{3600, 1}, {300, 100}, {60, 10000}}
+
+// ErrSaveInProgress — снимок уже пишется.
+var ErrSaveInProgress = errors.New("AOF: background save already in progress")
+
+// saveMark — позиция маркера снимка в журнале. Заполняет writer.
+type saveMark struct {
+	seq    int64 // incr-файл с записью SNAPSHOT
+	offset int64 // смещение записи SNAPSHOT в нём
+	dirty  int64 // изменений до маркера — они уже в снимке
+}
+
+// ParseSaveRules разбирает расписание вида "3600 1 300 100".
+// Пустая строка — снимки по расписанию выключены.
+func ParseSaveRules(s string) ([]SaveRule, error) {
+	fields := strings.Fields(s)
+	if len(fields)%2 != 0 {
+		return nil, fmt.Errorf("invalid save %q (want <seconds> <changes> pairs)", s)
+	}
+	rules := make([]SaveRule, 0, len(fields)/2)
+	for i := 0; i < len(fields); i += 2 {
+		seconds, err1 := strconv.ParseInt(fields[i], 10, 64)
+		changes, err2 := strconv.ParseInt(fields[i+1], 10, 64)
+		if err1 != nil || err2 != nil || seconds <= 0 || changes < 0 {
+			return nil, fmt.Errorf("invalid save %q (want <seconds> <changes> pairs)", s)
+		}
+		rules = append(rules, SaveRule{Seconds: seconds, Changes: changes})
+	}
+	return rules, nil
+}
+
+// FormatSaveRules — обратное к ParseSaveRules.
+func FormatSaveRules(rules []SaveRule) string {
+	parts := make([]string, 0, len(rules)*2)
+	for _, r := range rules {
+		parts = append(parts, strconv.FormatInt(r.Seconds, 10), strconv.FormatInt(r.Changes, 10))
+	}
+	return strings.Join(parts, " ")
+}
+
+// Save пишет снимок состояния (SAVE).
+//
+// Алгоритм — как у Rewrite, но журнал не трогается:
+//  1. Snapshot останавливает запись в кеш и вызывает mark: в очередь
+//     writer'а встаёт запись SNAPSHOT <id>
+//  2. Живые ключи пишутся во временный файл снимка
+//  3. Writer дошёл до маркера и сделал fsync — известно его смещение
+//  4. Трейлер со смещением, fsync, atomic rename в dump.imcs
+//
+// При старте снимок загружается, если запись по этому смещению в том же
+// incr — тот же SNAPSHOT <id>, и журнал читается только после неё.
+func (a *AOF) Save(snapshot Snapshot) error {
+	if !a.saveRunning.CompareAndSwap(false, true) {
+		return ErrSaveInProgress
+	}
+	a.saveWG.Add(1)
+	return a.runSave(snapshot)
+}
+
+// BackgroundSave запускает Save источника из SetSnapshot в фоне
+// (BGSAVE, расписание save).
+func (a *AOF) BackgroundSave() error {
+	a.mu.Lock()
+	snapshot := a.snapshot
+	a.mu.Unlock()
+	if snapshot == nil {
+		return ErrNoSnapshot
+	}
+	if !a.saveRunning.CompareAndSwap(false, true) {
+		return ErrSaveInProgress
+	}
+	a.saveWG.Add(1)
+	go a.runSave(snapshot)
+	return nil
+}
+
+// SetSaveRules задаёт расписание снимков; пустое — выключено.
+func (a *AOF) SetSaveRules(rules []SaveRule) {
+	a.statsMu.Lock()
+	a.saveRules = append([]SaveRule(nil), rules...)
+	a.statsMu.Unlock()
+}
+
+// SaveRules возвращает расписание снимков.
+func (a *AOF) SaveRules() []SaveRule {
+	a.statsMu.Lock()
+	defer a.statsMu.Unlock()
+	return append([]SaveRule(nil), a.saveRules...)
+}
+
+// SaveStats возвращает состояние снимков.
+func (a *AOF) SaveStats() SaveStats {
+	a.statsMu.Lock()
+	defer a.statsMu.Unlock()
+
+	st := SaveStats{
+		InProgress:   a.saveRunning.Load(),
+		LastSave:     a.lastSave,
+		LastDuration: a.lastSaveDuration,
+		LastErr:      a.lastSaveErr,
+		Changes:      a.dirty.Load(),
+	}
+	if st.InProgress && !a.saveStarted.IsZero() {
+		st.CurrentTime = time.Since(a.saveStarted)
+	}
+	return st
+}
+
+// saveDue — пора ли делать снимок по расписанию.
+func (a *AOF) saveDue() bool {
+	if a.saveRunning.Load() {
+		return false
+	}
+	dirty := a.dirty.Load()
+	if dirty == 0 {
+		return false
+	}
+
+	a.statsMu.Lock()
+	defer a.statsMu.Unlock()
+	if a.lastSaveErr != nil && time.Since(a.lastSaveTry) < saveRetryDelay {
+		return false
+	}
+	since := time.Since(a.lastSave)
+	for _, r := range a.saveRules {
+		if dirty >= r.Changes && since >= time.Duration(r.Seconds)*time.Second {
+			return true
+		}
+	}
+	return false
+}
+
+// runSave выполняет save и запоминает результат для SaveStats.
+func (a *AOF) runSave(snapshot Snapshot) error {
+	defer a.saveWG.Done()
+
+	start := time.Now()
+	a.statsMu.Lock()
+	a.saveStarted = start
+	a.statsMu.Unlock()
+
+	err := a.save(snapshot)
+
+	a.statsMu.Lock()
+	a.saveStarted = time.Time{}
+	a.lastSaveDuration = time.Since(start)
+	a.lastSaveTry = time.Now()
+	a.lastSaveErr = err
+	if err == nil {
+		a.lastSave = start
+	}
+	a.statsMu.Unlock()
+	a.saveRunning.Store(false)
+
+	if err != nil {
+		log.Printf("AOF save failed: %v", err)
+	}
+	return err
+}
+
+func (a *AOF) save(snapshot Snapshot) (err error) {
+	path := filepath.Join(a.dir, dumpFile)
+	tmpPath := path + ".tmp"
+
+	tmpFile, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tmpFile.Close()
+			os.Remove(tmpPath)
+		}
+	}()
+
+	id := newSnapshotID()
+	d := newDumpWriter(tmpFile, id, time.Now().UnixNano())
+
+	// === Шаг 1-2: маркер и живые ключи ===
+	marker := writeEntry{
+		data: appendRecord(nil, snapshotCmd, id, "", 0),
+		done: make(chan error, 1),
+		snap: &saveMark{},
+	}
+	marked, stopped := false, false
+	mark := func() {
+		if !marked {
+			marked, stopped = true, !a.enqueue(marker)
+		}
+	}
+	snapshot(mark, d.record)
+	mark()
+
+	// === Шаг 3: маркер в журнале и на диске ===
+	if stopped {
+		return ErrClosed
+	}
+	if err := a.await(marker); err != nil {
+		return err
+	}
+
+	// === Шаг 4: трейлер и rename ===
+	if err := d.finish(marker.snap.seq, marker.snap.offset); err != nil {
+		return err
+	}
+	if err := tmpFile.Sync(); err != nil {
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+
+	a.dirty.Add(-marker.snap.dirty)
+	log.Printf("AOF save: %d keys", d.count)
+	return nil
+}
+
+// loadSnapshotLocked загружает снимок, если он сходится с журналом, и
+// возвращает, с какого файла из files и смещения читать журнал (под mu).
+// Снимок без своего маркера в журнале (журнал переписан, обрезан, снимок
+// от другого журнала или битый) пропускается — журнал читается целиком.
+func (a *AOF) loadSnapshotLocked(files []aofFile, rf func(cmd, key, value string, expire int64)) (start int, pos int64, keys int, err error) {
+	pos = int64(headerSize)
+
+	f, err := os.Open(filepath.Join(a.dir, dumpFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, pos, 0, nil
+	} else if err != nil {
+		return 0, pos, 0, err
+	}
+	defer f.Close()
+
+	info, err := checkDump(f)
+	if err != nil {
+		log.Printf("AOF: snapshot ignored: %v", err)
+		return 0, pos, 0, nil
+	}
+	start = slices.IndexFunc(files, func(file aofFile) bool {
+		return !file.base && file.seq == info.seq
+	})
+	next, ok := int64(0), start >= 0
+	if ok {
+		next, ok = a.snapshotMarker(files[start], info)
+	}
+	if !ok {
+		log.Printf("AOF: snapshot %s does not match the journal, replaying it in full", info.id)
+		return 0, pos, 0, nil
+	}
+
+	if err := loadDump(f, info, rf); err != nil {
+		return 0, pos, 0, err
+	}
+	return start, next, int(info.count), nil
+}
+
+// snapshotMarker проверяет, что по смещению из снимка в incr-файле лежит
+// его запись SNAPSHOT, и возвращает смещение следующей записи.
+func (a *AOF) snapshotMarker(file aofFile, info *dumpInfo) (int64, bool) {
+	f, err := os.Open(filepath.Join(a.dir, file.name))
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return 0, false
+	}
+	size := st.Size()
+
+	if info.offset < int64(headerSize) || info.offset > size-recordHeaderSize {
+		return 0, false
+	}
+	var hdr [recordHeaderSize]byte
+	if _, err := f.ReadAt(hdr[:], info.offset); err != nil {
+		return 0, false
+	}
+	length := int64(binary.BigEndian.Uint32(hdr[:4]))
+	if length > size-info.offset-recordHeaderSize {
+		return 0, false
+	}
+	payload := make([]byte, length)
+	if _, err := f.ReadAt(payload, info.offset+recordHeaderSize); err != nil {
+		return 0, false
+	}
+	if crc64.Checksum(payload, crcTable) != binary.BigEndian.Uint64(hdr[4:]) {
+		return 0, false
+	}
+	cmd, key, _, _, err := decodePayload(payload)
+	if err != nil || cmd != snapshotCmd || key != info.id {
+		return 0, false
+	}
+	return info.offset + recordHeaderSize + length, true
+}
+
+// newSnapshotID — случайный id, связывающий снимок с маркером в журнале.
+func newSnapshotID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,181 @@
+package AOF
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	storage "imcs/internal/storage/cache"
+)
+
+// TestSaveConcurrentWrites — снимок плюс хвост журнала дают то же
+// состояние, что полный replay: записи во время save не теряются и не
+// применяются дважды (RPUSH не идемпотентен).
+func TestSaveConcurrentWrites(t *testing.T) {
+	dir := t.TempDir()
+	p1, err := NewPersister(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c1 := storage.New(p1)
+
+	c1.Set("ttl", "v", time.Hour, false)
+
+	const writers, perWriter = 8, 2000
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			key := "list:" + strconv.Itoa(w)
+			for i := 0; i < perWriter; i++ {
+				c1.RPush(key, strconv.Itoa(i))
+			}
+		}()
+	}
+	for i := 0; i < 3; i++ {
+		if err := p1.Save(c1.Snapshot); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+	c1.RPush("tail", "x")
+
+	// Краш: без Close
+	close(p1.aof.stopCh)
+	<-p1.aof.done
+	p1.aof.file.Close()
+	c1.Close()
+
+	check := func(t *testing.T) *ReadResult {
+		p2, err := NewPersister(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer p2.Close()
+		c2 := storage.New(p2)
+		defer c2.Close()
+		result, err := p2.Read(c2.Replay)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for w := 0; w < writers; w++ {
+			if n, _ := c2.LLen("list:" + strconv.Itoa(w)); n != perWriter {
+				t.Fatalf("list:%d has %d elements after load, want %d", w, n, perWriter)
+			}
+		}
+		if n, _ := c2.LLen("tail"); n != 1 {
+			t.Fatalf("tail has %d elements, want 1", n)
+		}
+		if ttl := c2.GetTTL("ttl"); ttl < 3595 {
+			t.Fatalf("TTL(ttl) = %d after load", ttl)
+		}
+		return result
+	}
+
+	result := check(t)
+	if result.SnapshotKeys == 0 {
+		t.Fatal("snapshot was not loaded")
+	}
+
+	// Битый снимок — журнал проигрывается целиком
+	dump := filepath.Join(dir, dumpFile)
+	data, err := os.ReadFile(dump)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)/2] ^= 0xFF
+	if err := os.WriteFile(dump, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if result := check(t); result.SnapshotKeys != 0 {
+		t.Fatalf("corrupt snapshot loaded %d keys", result.SnapshotKeys)
+	}
+}
+
+// TestSaveAfterRewrite — после rewrite маркера снимка в журнале нет:
+// снимок пропускается, журнал проигрывается целиком.
+func TestSaveAfterRewrite(t *testing.T) {
+	dir := t.TempDir()
+	p1, err := NewPersister(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c1 := storage.New(p1)
+
+	c1.RPush("list", "a")
+	if err := p1.Save(c1.Snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if st := p1.SaveStats(); st.Changes != 0 || st.LastErr != nil || st.LastDuration < 0 {
+		t.Fatalf("stats after save: %+v", st)
+	}
+	c1.RPush("list", "b")
+	if err := p1.Rewrite(c1.Snapshot); err != nil {
+		t.Fatal(err)
+	}
+	c1.RPush("list", "c")
+	p1.Close()
+	c1.Close()
+
+	p2, err := NewPersister(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p2.Close()
+	c2 := storage.New(p2)
+	defer c2.Close()
+	result, err := p2.Read(c2.Replay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.SnapshotKeys != 0 {
+		t.Fatalf("stale snapshot loaded %d keys", result.SnapshotKeys)
+	}
+	if got, _ := c2.LRange("list", 0, -1); len(got) != 3 {
+		t.Fatalf("list = %v, want [a b c]", got)
+	}
+}
+
+// TestSaveRules — снимок по расписанию, когда набралось изменений.
+func TestSaveRules(t *testing.T) {
+	rules, err := ParseSaveRules("3600 1 1 5")
+	if err != nil || FormatSaveRules(rules) != "3600 1 1 5" {
+		t.Fatalf("ParseSaveRules = %v, %v", rules, err)
+	}
+	for _, bad := range []string{"60", "0 1", "60 x", "60 -1"} {
+		if _, err := ParseSaveRules(bad); err == nil {
+			t.Errorf("ParseSaveRules(%q) accepted", bad)
+		}
+	}
+
+	a, err := NewAOF(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	a.SetSaveRules(rules)
+	a.SetSnapshot(func(mark func(), fn func(cmd, key, value string, expireAt int64)) {
+		mark()
+		fn("SET", "k", "v", 0)
+	})
+
+	for i := 0; i < 5; i++ {
+		a.Write(WriteInput{Cmd: "SET", Key: "k", Value: "v"})
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for a.SaveStats().LastDuration < 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("scheduled save did not run: %+v", a.SaveStats())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, err := os.Stat(filepath.Join(a.dir, dumpFile)); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -16,23 +16,94 @@ import (
 */
 
 type AOF struct {
-	file    *os.File
-	dir     string
-	writer  *bufio.Writer
-	mu      sync.Mutex
-	writeCh chan writeEntry // буфер записей
-	stopCh  chan struct{}
-	done    chan struct{}
+	file     *os.File // текущий incr-файл
+	dir      string
+	writer   *bufio.Writer
+	mu       sync.Mutex
+	writeCh  chan writeEntry // буфер записей
+	stopCh   chan struct{}
+	done     chan struct{}
+	fsync    atomic.Int32 // FsyncPolicy
+	corrupt  atomic.Int32 // CorruptPolicy
+	manifest *manifest    // состав журнала (под mu)
+	fileSize int64        // размер текущего incr (под mu)
 
-	// Rewrite buffer: пока идёт rewrite, новые записи дублируются сюда
-	rewriting  atomic.Bool
-	rewriteMu  sync.Mutex
-	rewriteBuf [][]byte // буфер записей, пришедших во время rewrite
+	writeErr atomic.Pointer[WriteError] // != nil — журнал сломан (см. WriteError)
+
+	// Auto-rewrite: размер журнала (все файлы) сейчас и после последнего rewrite
+	size              atomic.Int64
+	baseSize          atomic.Int64
+	rewritePercentage atomic.Int64 // auto-aof-rewrite-percentage, 0 = выкл
+	rewriteMinSize    atomic.Int64 // auto-aof-rewrite-min-size
+	snapshot          Snapshot     // источник для фонового rewrite (под mu)
+
+	rewriteRunning atomic.Bool
+	rewriteWG      sync.WaitGroup
+	statsMu        sync.Mutex
+	rewriteStarted time.Time
+	lastRewrite    time.Duration // -1 — rewrite ещё не было
+	lastRewriteEnd time.Time
+	lastRewriteErr error
+
+	// Снимки (SAVE/BGSAVE): dirty — записей журнала с последнего снимка.
+	// Остальное — под statsMu
+	dirty            atomic.Int64
+	saveRunning      atomic.Bool
+	saveWG           sync.WaitGroup
+	saveRules        []SaveRule
+	saveStarted      time.Time
+	lastSave         time.Time // время последнего успешного снимка (LASTSAVE)
+	lastSaveTry      time.Time
+	lastSaveDuration time.Duration // -1 — снимка ещё не было
+	lastSaveErr      error
+
+	migrated *ReadResult // результат конвертации текстового журнала, отдаётся в Read
 }
 
 // writeEntry — запись в очередь AOF.
 type writeEntry struct {
-	data []byte
+	data   []byte
+	done   chan error  // != nil — Write ждёт fsync (FsyncAlways)
+	rotate *rotateMark // маркер rewrite: переключение на новый incr
+	snap   *saveMark   // маркер снимка: запись SNAPSHOT, её смещение узнаёт save
+}
+
+// rotateMark — результат переключения на новый incr. Заполняет writer.
+type rotateMark struct {
+	seq int64 // номер нового incr: он и следующие остаются после rewrite
+	err error
+}
+
+// Snapshot выдаёт состояние кеша для Rewrite и Save. mark вызывается ровно
+// один раз, пока запись в кеш остановлена: записи журнала до mark уже
+// отражены в снимке, после — нет.
+type Snapshot func(mark func(), fn func(cmd, key, value string, expireAt int64))
+
+// RewriteStats — состояние rewrite для INFO persistence.
+type RewriteStats struct {
+	InProgress   bool
+	CurrentTime  time.Duration // длительность идущего rewrite
+	LastDuration time.Duration // -1 — rewrite ещё не было
+	LastErr      error
+	CurrentSize  int64
+	BaseSize     int64
+}
+
+// SaveRule — условие снимка по расписанию: прошло не меньше Seconds
+// секунд и было не меньше Changes изменений (save в redis.conf).
+type SaveRule struct {
+	Seconds int64
+	Changes int64
+}
+
+// SaveStats — состояние снимков для INFO persistence и LASTSAVE.
+type SaveStats struct {
+	InProgress   bool
+	CurrentTime  time.Duration // длительность идущего save
+	LastDuration time.Duration // -1 — снимка ещё не было
+	LastErr      error
+	LastSave     time.Time // последний успешный снимок (или старт)
+	Changes      int64     // изменений с последнего снимка
 }
 
 // WriteInput — входные данные для записи в AOF.
@@ -41,6 +112,16 @@ type WriteInput struct {
 	Key   string
 	Value string
 	TTL   time.Duration
+
+	// ExpireAt — абсолютное время истечения в наносекундах; если задано,
+	// TTL не используется (EXPIREAT, перенос TTL при RENAME).
+	ExpireAt int64
+}
+
+// txEntry — запись AOF внутри MULTI/EXEC, ждущая конца транзакции.
+type txEntry struct {
+	cmd, key, value string
+	expire          int64
 }
 
 // ReadResult — результат чтения AOF.
@@ -49,4 +130,6 @@ type ReadResult struct {
 	CorruptEntries int   // число записей с битым CRC
 	Truncated      bool  // был ли файл обрезан
 	TruncatedAt    int64 // позиция обрезки (байт)
+	SnapshotKeys   int   // ключей загружено из снимка (0 — журнал целиком)
+	Skipped        int64 // байт перенесено в карантин (CorruptSkip)
 }
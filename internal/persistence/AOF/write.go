@@ -5,14 +5,13 @@ import (
 	"hash/crc64"
 	"os"
 	"path/filepath"
-	"strconv"
 	"time"
 )
 
 const (
 	writeBufSize  = 64 * 1024   // 64KB буфер bufio.Writer
 	channelSize   = 4096        // размер канала записей
-	flushInterval = time.Second // fsync каждую секунду
+	flushInterval = time.Second // fsync каждую секунду (FsyncEverySec) и проверка save
 )
 
 // CRC64 таблица — ECMA стандарт.
@@ -24,21 +23,43 @@ func NewAOF(dir string) (*AOF, error) {
 		return nil, err
 	}
 
-	filename := filepath.Join(dir, "journal.aof")
-
-	f, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0644)
+	m, f, migrated, err := openManifest(dir)
 	if err != nil {
 		return nil, err
 	}
 
+	// Размер журнала — все файлы манифеста
+	var size, fileSize int64
+	for _, file := range m.files() {
+		info, err := os.Stat(filepath.Join(dir, file.name))
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		size += info.Size()
+		fileSize = info.Size()
+	}
+
 	a := &AOF{
-		file:    f,
-		dir:     dir,
-		writer:  bufio.NewWriterSize(f, writeBufSize),
-		writeCh: make(chan writeEntry, channelSize),
-		stopCh:  make(chan struct{}),
-		done:    make(chan struct{}),
+		file:        f,
+		dir:         dir,
+		manifest:    m,
+		fileSize:    fileSize,
+		migrated:    migrated,
+		writer:      bufio.NewWriterSize(f, writeBufSize),
+		writeCh:     make(chan writeEntry, channelSize),
+		stopCh:      make(chan struct{}),
+		done:        make(chan struct{}),
+		lastRewrite: -1,
+
+		lastSave:         time.Now(),
+		lastSaveDuration: -1,
+		saveRules:        DefaultSaveRules,
 	}
+	a.size.Store(size)
+	a.baseSize.Store(size)
+	a.rewritePercentage.Store(DefaultRewritePercentage)
+	a.rewriteMinSize.Store(DefaultRewriteMinSize)
 
 	go a.backgroundWriter()
 
@@ -49,101 +70,208 @@ func NewAOF(dir string) (*AOF, error) {
 func (a *AOF) Close() error {
 	close(a.stopCh)
 	<-a.done
+	// Фоновые rewrite и save без writer не завершатся успешно — ждём,
+	// пока они откатятся, и только потом закрываем файл
+	a.rewriteWG.Wait()
+	a.saveWG.Wait()
 	return a.file.Close()
 }
 
-// buildEntry собирает запись с CRC64.
-// Формат: crc64hex|cmd|key|expire|value\n
+// buildEntry собирает запись v2 с CRC64 (формат — см. format.go).
 func buildEntry(input WriteInput) []byte {
-	var expire int64
-	if input.TTL > 0 {
+	expire := input.ExpireAt
+	if expire == 0 && input.TTL > 0 {
 		expire = time.Now().Add(input.TTL).UnixNano()
 	}
 
-	payload := make([]byte, 0, len(input.Cmd)+len(input.Key)+len(input.Value)+32)
-	payload = append(payload, input.Cmd...)
-	payload = append(payload, '|')
-	payload = append(payload, input.Key...)
-	payload = append(payload, '|')
-	payload = strconv.AppendInt(payload, expire, 10)
-	payload = append(payload, '|')
-	payload = append(payload, input.Value...)
-
-	checksum := crc64.Checksum(payload, crcTable)
-	crcHex := strconv.FormatUint(checksum, 16)
-
-	entry := make([]byte, 0, len(crcHex)+1+len(payload)+1)
-	entry = append(entry, crcHex...)
-	entry = append(entry, '|')
-	entry = append(entry, payload...)
-	entry = append(entry, '\n')
-
-	return entry
+	entry := make([]byte, 0, recordHeaderSize+len(input.Cmd)+len(input.Key)+len(input.Value)+32)
+	return appendRecord(entry, input.Cmd, input.Key, input.Value, expire)
 }
 
 // Write формирует запись с CRC64 и отправляет в канал.
+// В режиме FsyncAlways блокируется до fsync записи. Ошибка — *WriteError
+// (журнал сломан, см. WriteError) или ErrClosed.
 func (a *AOF) Write(input WriteInput) error {
-	entry := buildEntry(input)
+	if wait := a.Append(input); wait != nil {
+		return wait()
+	}
+	return nil
+}
 
-	select {
-	case a.writeCh <- writeEntry{data: entry}:
+// Append ставит запись в очередь и не ждёт fsync: wait блокируется до
+// fsync (FsyncAlways) и возвращает ошибку, как Write. nil — ждать нечего.
+// Ждать можно не каждую запись: writer пишет их по порядку, а ошибка
+// липкая, поэтому wait последней записи покрывает все предыдущие.
+func (a *AOF) Append(input WriteInput) (wait func() error) {
+	entry := writeEntry{data: buildEntry(input)}
+	if a.FsyncPolicy() == FsyncAlways {
+		entry.done = make(chan error, 1)
+	}
+
+	if !a.enqueue(entry) || entry.done == nil {
+		if err := a.WriteErr(); err != nil {
+			return func() error { return err }
+		}
 		return nil
+	}
+	return func() error { return a.await(entry) }
+}
+
+// enqueue ставит запись в очередь writer'а; false — AOF закрывается.
+func (a *AOF) enqueue(e writeEntry) bool {
+	select {
+	case a.writeCh <- e:
+		return true
 	case <-a.stopCh:
-		return nil
+		return false
+	}
+}
+
+// await ждёт, пока writer запишет пачку с e (e.done != nil).
+func (a *AOF) await(e writeEntry) error {
+	select {
+	case err := <-e.done:
+		return err
+	case <-a.done:
+		// Writer завершился: запись могла успеть попасть в последнюю пачку
+		select {
+		case err := <-e.done:
+			return err
+		default:
+			return ErrClosed
+		}
+	}
+}
+
+// processEntry пишет запись в текущий incr (под mu). Маркер rewrite
+// в файл не пишется — он переключает запись на новый incr.
+// Возвращает waiters, дополненный каналом ожидания записи.
+func (a *AOF) processEntry(e writeEntry, waiters []chan error) []chan error {
+	if e.rotate != nil {
+		e.rotate.seq, e.rotate.err = a.rotateLocked()
+	} else {
+		if e.snap != nil {
+			e.snap.seq = a.manifest.last().seq
+			e.snap.offset = a.fileSize
+			e.snap.dirty = a.dirty.Load()
+		} else {
+			a.dirty.Add(1)
+		}
+		a.writer.Write(e.data)
+		a.fileSize += int64(len(e.data))
+		a.size.Add(int64(len(e.data)))
+	}
+
+	if e.done != nil {
+		waiters = append(waiters, e.done)
 	}
+	return waiters
 }
 
-// processEntry пишет запись в основной файл и дублирует в rewrite buffer.
-func (a *AOF) processEntry(data []byte) {
-	a.writer.Write(data)
+// rotateLocked переключает запись на новый incr (под mu): старый
+// сбрасывается на диск целиком — обрываться может только последний файл.
+// Возвращает номер нового incr.
+func (a *AOF) rotateLocked() (int64, error) {
+	if err := a.writer.Flush(); err != nil {
+		return 0, err
+	}
+	if err := a.file.Sync(); err != nil {
+		return 0, err
+	}
 
-	// Если идёт rewrite — дублируем в буфер докатки
-	if a.rewriting.Load() {
-		a.rewriteMu.Lock()
-		cp := make([]byte, len(data))
-		copy(cp, data)
-		a.rewriteBuf = append(a.rewriteBuf, cp)
-		a.rewriteMu.Unlock()
+	seq := a.manifest.nextIncrSeq()
+	f, err := createIncr(a.dir, seq)
+	if err != nil {
+		return 0, err
+	}
+	next := a.manifest.withIncr(aofFile{name: incrFileName(seq), seq: seq})
+	if err := writeManifest(a.dir, next); err != nil {
+		f.Close()
+		os.Remove(filepath.Join(a.dir, incrFileName(seq)))
+		return 0, err
 	}
+
+	a.file.Close()
+	a.file = f
+	a.writer = bufio.NewWriterSize(f, writeBufSize)
+	a.manifest = next
+	a.fileSize = int64(headerSize)
+	a.size.Add(int64(headerSize))
+	return seq, nil
 }
 
 // backgroundWriter — единственная горутина, пишет в файл.
+// Пачка — всё, что накопилось в канале: один flush (и fsync) на пачку.
+// Пачка обрабатывается под mu, поэтому Rewrite может подменить файл
+// только между пачками.
 func (a *AOF) backgroundWriter() {
 	defer close(a.done)
 
 	ticker := time.NewTicker(flushInterval)
 	defer ticker.Stop()
 
+	var waiters []chan error
+
 	for {
 		select {
 		case entry := <-a.writeCh:
-			a.processEntry(entry.data)
+			a.mu.Lock()
+			waiters = a.processEntry(entry, waiters[:0])
 
 			// Drain
 			drained := true
 			for drained {
 				select {
 				case e := <-a.writeCh:
-					a.processEntry(e.data)
+					waiters = a.processEntry(e, waiters)
 				default:
 					drained = false
 				}
 			}
+			a.failWrite(a.commitLocked(len(waiters) > 0))
+			err := a.WriteErr()
+			due := a.rewriteDueLocked()
+			a.mu.Unlock()
+
+			for _, w := range waiters {
+				w <- err
+			}
+			if due {
+				a.BackgroundRewrite()
+			}
 
 		case <-ticker.C:
-			a.mu.Lock()
-			a.writer.Flush()
-			a.file.Sync()
-			a.mu.Unlock()
+			if a.FsyncPolicy() == FsyncEverySec {
+				a.mu.Lock()
+				if err := a.writer.Flush(); err != nil {
+					a.failWrite(err)
+				} else {
+					a.failWrite(a.file.Sync())
+				}
+				a.mu.Unlock()
+			}
+			if a.saveDue() {
+				a.BackgroundSave()
+			}
 
 		case <-a.stopCh:
+			a.mu.Lock()
+			waiters = waiters[:0]
 			for {
 				select {
 				case e := <-a.writeCh:
-					a.processEntry(e.data)
+					waiters = a.processEntry(e, waiters)
 				default:
-					a.writer.Flush()
-					a.file.Sync()
+					if err := a.writer.Flush(); err != nil {
+						a.failWrite(err)
+					} else {
+						a.failWrite(a.file.Sync())
+					}
+					err := a.WriteErr()
+					a.mu.Unlock()
+					for _, w := range waiters {
+						w <- err
+					}
 					return
 				}
 			}
@@ -0,0 +1,13 @@
+package RDB
+
+import "hash/crc64"
+
+// crcTable — CRC-64/Jones, как crc64.c в Redis (отражённый полином,
+// начальное значение 0, без финального XOR).
+var crcTable = crc64.MakeTable(0x95AC9329AC4BC9B5)
+
+// crcUpdate продолжает CRC Redis по p. crc64.Update инвертирует значение
+// на входе и выходе — инвертируем обратно.
+func crcUpdate(crc uint64, p []byte) uint64 {
+	return ^crc64.Update(^crc, crcTable, p)
+}
@@ -0,0 +1,362 @@
+package RDB
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+)
+
+/*
+
+	Компактные кодировки Redis, которые RDB хранит строкой как есть:
+	ziplist (до 7.0), listpack (7.0+), intset, zipmap (до 2.6) и
+	LZF-сжатие строк. Все разбираются в плоский список элементов.
+
+*/
+
+// blob — курсор по буферу с проверкой границ.
+type blob struct {
+	b   []byte
+	pos int
+}
+
+func (c *blob) take(n int) ([]byte, error) {
+	if n < 0 || len(c.b)-c.pos < n {
+		return nil, fmt.Errorf("%w: truncated encoded value", ErrFormat)
+	}
+	p := c.b[c.pos : c.pos+n]
+	c.pos += n
+	return p, nil
+}
+
+func (c *blob) byte() (byte, error) {
+	p, err := c.take(1)
+	if err != nil {
+		return 0, err
+	}
+	return p[0], nil
+}
+
+// signed читает целое со знаком из n байт little-endian.
+func (c *blob) signed(n int) (int64, error) {
+	p, err := c.take(n)
+	if err != nil {
+		return 0, err
+	}
+	var u uint64
+	for i := n - 1; i >= 0; i-- {
+		u = u<<8 | uint64(p[i])
+	}
+	shift := 64 - 8*n
+	return int64(u<<shift) >> shift, nil
+}
+
+// lzfMaxRatio — предел степени сжатия LZF: повтор 264 байт занимает
+// 3 байта (~1:88). Длина сверх него — повреждённый или подложный файл.
+const lzfMaxRatio = 100
+
+// lzfDecompress распаковывает строку, сжатую lzf_compress. size —
+// заявленная в файле длина: проверяется до выделения памяти под результат.
+func lzfDecompress(in []byte, size int) ([]byte, error) {
+	if size < 0 || size > lzfMaxRatio*len(in)+64 {
+		return nil, fmt.Errorf("%w: LZF length %d for %d compressed bytes", ErrFormat, size, len(in))
+	}
+	out := make([]byte, 0, size)
+	for i := 0; i < len(in); {
+		ctrl := int(in[i])
+		i++
+
+		// 000LLLLL — литерал из L+1 байт
+		if ctrl < 1<<5 {
+			n := ctrl + 1
+			if i+n > len(in) || len(out)+n > size {
+				return nil, fmt.Errorf("%w: bad LZF literal", ErrFormat)
+			}
+			out = append(out, in[i:i+n]...)
+			i += n
+			continue
+		}
+
+		// LLLooooo [LLLLLLLL] oooooooo — повтор L+2 байт со смещением o+1 назад
+		n := ctrl >> 5
+		if n == 7 {
+			if i >= len(in) {
+				return nil, fmt.Errorf("%w: bad LZF reference", ErrFormat)
+			}
+			n += int(in[i])
+			i++
+		}
+		if i >= len(in) {
+			return nil, fmt.Errorf("%w: bad LZF reference", ErrFormat)
+		}
+		ref := len(out) - (ctrl&0x1F)<<8 - int(in[i]) - 1
+		i++
+		n += 2
+		if ref < 0 || len(out)+n > size {
+			return nil, fmt.Errorf("%w: bad LZF reference", ErrFormat)
+		}
+		// Побайтно: участки могут перекрываться
+		for j := 0; j < n; j++ {
+			out = append(out, out[ref+j])
+		}
+	}
+	if len(out) != size {
+		return nil, fmt.Errorf("%w: LZF length %d, want %d", ErrFormat, len(out), size)
+	}
+	return out, nil
+}
+
+// ziplistEntries разбирает ziplist:
+// [zlbytes u32][zltail u32][zllen u16] записи 0xFF,
+// запись — [prevlen 1|5 байт][кодировка][данные].
+func ziplistEntries(b []byte) ([]string, error) {
+	c := &blob{b: b}
+	if _, err := c.take(10); err != nil {
+		return nil, err
+	}
+
+	var items []string
+	for {
+		prev, err := c.byte()
+		if err != nil {
+			return nil, err
+		}
+		if prev == 0xFF {
+			return items, nil
+		}
+		if prev == 0xFE {
+			if _, err := c.take(4); err != nil {
+				return nil, err
+			}
+		}
+
+		enc, err := c.byte()
+		if err != nil {
+			return nil, err
+		}
+		var n int
+		switch enc >> 6 {
+		case 0:
+			n = int(enc & 0x3F)
+		case 1:
+			lo, err := c.byte()
+			if err != nil {
+				return nil, err
+			}
+			n = int(enc&0x3F)<<8 | int(lo)
+		case 2:
+			p, err := c.take(4)
+			if err != nil {
+				return nil, err
+			}
+			n = int(binary.BigEndian.Uint32(p))
+		default:
+			v, err := ziplistInt(c, enc)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, strconv.FormatInt(v, 10))
+			continue
+		}
+
+		p, err := c.take(n)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, string(p))
+	}
+}
+
+// ziplistInt читает целое по кодировке 11xxxxxx.
+func ziplistInt(c *blob, enc byte) (int64, error) {
+	switch enc {
+	case 0xC0:
+		return c.signed(2)
+	case 0xD0:
+		return c.signed(4)
+	case 0xE0:
+		return c.signed(8)
+	case 0xF0:
+		return c.signed(3)
+	case 0xFE:
+		return c.signed(1)
+	}
+	// 1111xxxx — число 0..12 прямо в кодировке (xxxx = 1..13)
+	if enc >= 0xF1 && enc <= 0xFD {
+		return int64(enc&0x0F) - 1, nil
+	}
+	return 0, fmt.Errorf("%w: bad ziplist encoding %#x", ErrFormat, enc)
+}
+
+// listpackEntries разбирает listpack:
+// [total u32][count u16] записи 0xFF,
+// запись — [кодировка][данные][backlen 1..5 байт].
+func listpackEntries(b []byte) ([]string, error) {
+	c := &blob{b: b}
+	if _, err := c.take(6); err != nil {
+		return nil, err
+	}
+
+	var items []string
+	for {
+		start := c.pos
+		enc, err := c.byte()
+		if err != nil {
+			return nil, err
+		}
+		if enc == 0xFF {
+			return items, nil
+		}
+
+		var (
+			item  string
+			v     int64
+			isInt = true
+		)
+		switch {
+		case enc&0x80 == 0: // 0xxxxxxx — 7-битное число
+			v = int64(enc)
+		case enc&0xC0 == 0x80: // 10xxxxxx — строка до 63 байт
+			item, err = lpString(c, int(enc&0x3F))
+			isInt = false
+		case enc&0xE0 == 0xC0: // 110xxxxx — 13-битное число со знаком
+			lo, err := c.byte()
+			if err != nil {
+				return nil, err
+			}
+			v = int64(enc&0x1F)<<8 | int64(lo)
+			if v >= 1<<12 {
+				v -= 1 << 13
+			}
+		case enc&0xF0 == 0xE0: // 1110xxxx — строка до 4095 байт
+			var lo byte
+			if lo, err = c.byte(); err == nil {
+				item, err = lpString(c, int(enc&0x0F)<<8|int(lo))
+			}
+			isInt = false
+		case enc == 0xF0: // строка с длиной u32
+			var p []byte
+			if p, err = c.take(4); err == nil {
+				item, err = lpString(c, int(binary.LittleEndian.Uint32(p)))
+			}
+			isInt = false
+		case enc >= 0xF1 && enc <= 0xF4: // 16/24/32/64-битное число
+			v, err = c.signed([]int{2, 3, 4, 8}[enc-0xF1])
+		default:
+			return nil, fmt.Errorf("%w: bad listpack encoding %#x", ErrFormat, enc)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if isInt {
+			item = strconv.FormatInt(v, 10)
+		}
+		items = append(items, item)
+
+		if _, err := c.take(backlenSize(c.pos - start)); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func lpString(c *blob, n int) (string, error) {
+	p, err := c.take(n)
+	return string(p), err
+}
+
+// backlenSize — размер поля backlen для записи listpack длины n.
+func backlenSize(n int) int {
+	switch {
+	case n <= 127:
+		return 1
+	case n < 16383:
+		return 2
+	case n < 2097151:
+		return 3
+	case n < 268435455:
+		return 4
+	}
+	return 5
+}
+
+// intsetEntries разбирает intset: [размер числа u32][count u32] числа LE.
+func intsetEntries(b []byte) ([]string, error) {
+	c := &blob{b: b}
+	head, err := c.take(8)
+	if err != nil {
+		return nil, err
+	}
+	width := int(binary.LittleEndian.Uint32(head))
+	count := int(binary.LittleEndian.Uint32(head[4:]))
+	if width != 2 && width != 4 && width != 8 || count*width != len(b)-8 {
+		return nil, fmt.Errorf("%w: bad intset", ErrFormat)
+	}
+
+	items := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		v, err := c.signed(width)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, strconv.FormatInt(v, 10))
+	}
+	return items, nil
+}
+
+// zipmapEntries разбирает zipmap (хеши RDB до Redis 2.6):
+// [count u8] ([len]поле [len][free]значение [free байт])... 0xFF,
+// len — байт < 254 или 254 + u32 LE.
+func zipmapEntries(b []byte) ([]string, error) {
+	c := &blob{b: b}
+	if _, err := c.byte(); err != nil {
+		return nil, err
+	}
+
+	length := func() (int, bool, error) {
+		n, err := c.byte()
+		switch {
+		case err != nil:
+			return 0, false, err
+		case n == 0xFF:
+			return 0, true, nil
+		case n == 0xFE:
+			p, err := c.take(4)
+			if err != nil {
+				return 0, false, err
+			}
+			return int(binary.LittleEndian.Uint32(p)), false, nil
+		}
+		return int(n), false, nil
+	}
+
+	var items []string
+	for {
+		n, end, err := length()
+		if err != nil {
+			return nil, err
+		}
+		if end {
+			return items, nil
+		}
+		field, err := c.take(n)
+		if err != nil {
+			return nil, err
+		}
+
+		if n, end, err = length(); err != nil || end {
+			return nil, fmt.Errorf("%w: bad zipmap", ErrFormat)
+		}
+		free, err := c.byte()
+		if err != nil {
+			return nil, err
+		}
+		value, err := c.take(n)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := c.take(int(free)); err != nil {
+			return nil, err
+		}
+		items = append(items, string(field), string(value))
+	}
+}
@@ -0,0 +1,645 @@
+package RDB
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+
+	"imcs/internal/storage/cache"
+)
+
+const readChunk = 1 << 20 // длинные строки читаются кусками: длина из файла не аллокируется сразу
+
+// decoder читает RDB, попутно считая CRC64 прочитанного.
+type decoder struct {
+	r   *bufio.Reader
+	crc uint64
+}
+
+// Load читает RDB из r и вызывает fn для каждого ключа поддерживаемого
+// типа. Ключи с истёкшим TTL пропускаются (как при загрузке RDB в Redis),
+// ключи stream и модулей — тоже, они перечислены в Result.Unsupported.
+// Номер базы (SELECT) сохраняется в Entry.DB: IMCS хранит одну базу,
+// решать, что делать с остальными, — вызывающему.
+func Load(r io.Reader, fn func(e *Entry) error) (*Result, error) {
+	d := &decoder{r: bufio.NewReaderSize(r, 64*1024)}
+	result := &Result{}
+
+	head, err := d.read(9)
+	if err != nil {
+		return nil, err
+	}
+	if string(head[:5]) != "REDIS" {
+		return nil, fmt.Errorf("%w: not an RDB file", ErrFormat)
+	}
+	version, err := strconv.Atoi(string(head[5:]))
+	if err != nil {
+		return nil, fmt.Errorf("%w: bad version %q", ErrFormat, head[5:])
+	}
+	if version < minVersion || version > maxVersion {
+		return nil, fmt.Errorf("RDB: unsupported version %d (supported %d-%d)", version, minVersion, maxVersion)
+	}
+	result.Version = version
+
+	var (
+		db       int
+		expireAt int64
+	)
+	now := time.Now().UnixNano()
+	for {
+		op, err := d.byte()
+		if err != nil {
+			return result, err
+		}
+
+		switch op {
+		case opEOF:
+			return result, d.checksum()
+
+		case opSelectDB:
+			n, err := d.length()
+			if err != nil {
+				return result, err
+			}
+			db = int(n)
+			continue
+
+		case opResizeDB:
+			if _, err := d.length(); err != nil {
+				return result, err
+			}
+			if _, err := d.length(); err != nil {
+				return result, err
+			}
+			continue
+
+		case opAux:
+			if err := d.skipString(); err != nil {
+				return result, err
+			}
+			if err := d.skipString(); err != nil {
+				return result, err
+			}
+			continue
+
+		case opModuleAux:
+			if _, err := d.length(); err != nil { // id модуля
+				return result, err
+			}
+			if err := d.skipModuleValue(); err != nil {
+				return result, err
+			}
+			continue
+
+		case opFunction2:
+			// Библиотека функций (FUNCTION LOAD) — IMCS их не поддерживает
+			if err := d.skipString(); err != nil {
+				return result, err
+			}
+			continue
+
+		case opFunctionPre:
+			return result, fmt.Errorf("%w: pre-GA function records are not supported", ErrFormat)
+
+		case opExpireTime:
+			p, err := d.read(4)
+			if err != nil {
+				return result, err
+			}
+			expireAt = int64(binary.LittleEndian.Uint32(p)) * int64(time.Second)
+			continue
+
+		case opExpireTimeMs:
+			p, err := d.read(8)
+			if err != nil {
+				return result, err
+			}
+			expireAt = int64(binary.LittleEndian.Uint64(p)) * int64(time.Millisecond)
+			continue
+
+		case opIdle:
+			if _, err := d.length(); err != nil {
+				return result, err
+			}
+			continue
+
+		case opFreq:
+			if _, err := d.byte(); err != nil {
+				return result, err
+			}
+			continue
+		}
+
+		// Остальное — тип значения: ключ и само значение. EXPIRETIME,
+		// IDLE и FREQ выше относятся к этому ключу
+		key, err := d.string()
+		if err != nil {
+			return result, err
+		}
+		v, typ, err := d.value(op)
+		if err != nil {
+			return result, fmt.Errorf("key %q: %w", key, err)
+		}
+		exp := expireAt
+		expireAt = 0
+
+		switch {
+		case typ != "":
+			result.Unsupported = append(result.Unsupported, UnsupportedKey{DB: db, Key: key, Type: typ})
+		case exp > 0 && exp <= now:
+			result.Expired++
+		default:
+			if err := fn(&Entry{DB: db, Key: key, Value: v, ExpireAt: exp}); err != nil {
+				return result, err
+			}
+			result.Keys++
+		}
+	}
+}
+
+// value читает значение типа typ. Для типов, которых нет в IMCS, значение
+// пропускается и возвращается имя типа.
+func (d *decoder) value(typ byte) (v storage.Value, unsupported string, err error) {
+	switch typ {
+	case typeString:
+		v.Kind = storage.KindString
+		v.String, err = d.string()
+
+	case typeList, typeSet:
+		v.Kind = storage.KindList
+		if typ == typeSet {
+			v.Kind = storage.KindSet
+		}
+		v.Items, err = d.strings(1)
+
+	case typeHash:
+		v.Kind = storage.KindHash
+		v.Items, err = d.strings(2)
+
+	case typeZSet, typeZSet2:
+		v.Kind = storage.KindZSet
+		v.ZSet, err = d.zset(typ == typeZSet2)
+
+	case typeListQuicklist, typeListQuicklist2:
+		v.Kind = storage.KindList
+		v.Items, err = d.quicklist(typ == typeListQuicklist2)
+
+	case typeHashZipmap, typeListZiplist, typeSetIntset, typeZSetZiplist,
+		typeHashZiplist, typeHashListpack, typeZSetListpack, typeSetListpack:
+		v, err = d.encoded(typ)
+
+	case typeStreamListpacks, typeStreamListpacks2, typeStreamListpacks3:
+		return v, "stream", d.skipStream(typ)
+
+	case typeModule2:
+		if _, err := d.length(); err != nil { // id модуля
+			return v, "", err
+		}
+		return v, "module", d.skipModuleValue()
+
+	case typeModule:
+		// Значение модуля v1 без самого модуля не пропустить
+		return v, "", fmt.Errorf("%w: module values of RDB type 6 cannot be skipped", ErrFormat)
+
+	default:
+		return v, "", fmt.Errorf("%w: unknown value type %d", ErrFormat, typ)
+	}
+	return v, "", err
+}
+
+// encoded читает значение, хранящееся одной строкой в компактной кодировке.
+func (d *decoder) encoded(typ byte) (storage.Value, error) {
+	var v storage.Value
+	raw, err := d.string()
+	if err != nil {
+		return v, err
+	}
+	b := []byte(raw)
+
+	switch typ {
+	case typeHashZipmap:
+		v.Kind = storage.KindHash
+		v.Items, err = zipmapEntries(b)
+	case typeListZiplist:
+		v.Kind = storage.KindList
+		v.Items, err = ziplistEntries(b)
+	case typeSetIntset:
+		v.Kind = storage.KindSet
+		v.Items, err = intsetEntries(b)
+	case typeSetListpack:
+		v.Kind = storage.KindSet
+		v.Items, err = listpackEntries(b)
+	case typeHashZiplist, typeHashListpack:
+		v.Kind = storage.KindHash
+		if typ == typeHashZiplist {
+			v.Items, err = ziplistEntries(b)
+		} else {
+			v.Items, err = listpackEntries(b)
+		}
+		if err == nil && len(v.Items)%2 != 0 {
+			err = fmt.Errorf("%w: odd hash entries", ErrFormat)
+		}
+	case typeZSetZiplist, typeZSetListpack:
+		v.Kind = storage.KindZSet
+		var items []string
+		if typ == typeZSetZiplist {
+			items, err = ziplistEntries(b)
+		} else {
+			items, err = listpackEntries(b)
+		}
+		if err == nil {
+			v.ZSet, err = zsetPairs(items)
+		}
+	}
+	return v, err
+}
+
+// zsetPairs собирает sorted set из пар member, score.
+func zsetPairs(items []string) ([]storage.ZMember, error) {
+	if len(items)%2 != 0 {
+		return nil, fmt.Errorf("%w: odd zset entries", ErrFormat)
+	}
+	members := make([]storage.ZMember, 0, len(items)/2)
+	for i := 0; i < len(items); i += 2 {
+		score, err := storage.ParseScore(items[i+1])
+		if err != nil {
+			return nil, fmt.Errorf("%w: bad zset score %q", ErrFormat, items[i+1])
+		}
+		members = append(members, storage.ZMember{Member: items[i], Score: score})
+	}
+	return members, nil
+}
+
+// strings читает count*per строк, где count — length в начале.
+func (d *decoder) strings(per int) ([]string, error) {
+	n, err := d.length()
+	if err != nil {
+		return nil, err
+	}
+	items := make([]string, 0, min(n*uint64(per), readChunk))
+	for i := uint64(0); i < n*uint64(per); i++ {
+		s, err := d.string()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, s)
+	}
+	return items, nil
+}
+
+// zset читает sorted set: score строкой (ZSET) или float64 LE (ZSET_2).
+func (d *decoder) zset(binaryScore bool) ([]storage.ZMember, error) {
+	n, err := d.length()
+	if err != nil {
+		return nil, err
+	}
+	members := make([]storage.ZMember, 0, min(n, readChunk))
+	for i := uint64(0); i < n; i++ {
+		member, err := d.string()
+		if err != nil {
+			return nil, err
+		}
+		var score float64
+		if binaryScore {
+			p, err := d.read(8)
+			if err != nil {
+				return nil, err
+			}
+			score = math.Float64frombits(binary.LittleEndian.Uint64(p))
+		} else if score, err = d.textScore(); err != nil {
+			return nil, err
+		}
+		if math.IsNaN(score) {
+			return nil, fmt.Errorf("%w: NaN zset score", ErrFormat)
+		}
+		members = append(members, storage.ZMember{Member: member, Score: score})
+	}
+	return members, nil
+}
+
+// textScore читает score типа ZSET: байт длины, 253 — nan, 254 — +inf,
+// 255 — -inf.
+func (d *decoder) textScore() (float64, error) {
+	n, err := d.byte()
+	if err != nil {
+		return 0, err
+	}
+	switch n {
+	case 253:
+		return math.NaN(), nil
+	case 254:
+		return math.Inf(1), nil
+	case 255:
+		return math.Inf(-1), nil
+	}
+	p, err := d.read(uint64(n))
+	if err != nil {
+		return 0, err
+	}
+	score, err := strconv.ParseFloat(string(p), 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: bad zset score %q", ErrFormat, p)
+	}
+	return score, nil
+}
+
+// quicklist читает список из узлов: ziplist (QUICKLIST) или
+// [container][строка] (QUICKLIST_2): 1 — один элемент, 2 — listpack.
+func (d *decoder) quicklist(v2 bool) ([]string, error) {
+	nodes, err := d.length()
+	if err != nil {
+		return nil, err
+	}
+	var items []string
+	for i := uint64(0); i < nodes; i++ {
+		container := uint64(2)
+		if v2 {
+			if container, err = d.length(); err != nil {
+				return nil, err
+			}
+		}
+		node, err := d.string()
+		if err != nil {
+			return nil, err
+		}
+
+		var entries []string
+		switch {
+		case !v2:
+			entries, err = ziplistEntries([]byte(node))
+		case container == 1:
+			entries = []string{node}
+		case container == 2:
+			entries, err = listpackEntries([]byte(node))
+		default:
+			err = fmt.Errorf("%w: bad quicklist container %d", ErrFormat, container)
+		}
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, entries...)
+	}
+	return items, nil
+}
+
+// skipStream пропускает значение stream: узлы listpack, метаданные,
+// группы потребителей с их PEL.
+func (d *decoder) skipStream(typ byte) error {
+	nodes, err := d.length()
+	if err != nil {
+		return err
+	}
+	for i := uint64(0); i < nodes; i++ {
+		if err := d.skipString(); err != nil { // master ID
+			return err
+		}
+		if err := d.skipString(); err != nil { // listpack
+			return err
+		}
+	}
+
+	// length, last ID; с LISTPACKS_2 — first ID, max deleted ID, entries added
+	lengths := 3
+	if typ >= typeStreamListpacks2 {
+		lengths += 5
+	}
+	if err := d.skipLengths(lengths); err != nil {
+		return err
+	}
+
+	groups, err := d.length()
+	if err != nil {
+		return err
+	}
+	for i := uint64(0); i < groups; i++ {
+		if err := d.skipString(); err != nil { // имя группы
+			return err
+		}
+		lengths := 2 // last ID
+		if typ >= typeStreamListpacks2 {
+			lengths++ // entries read
+		}
+		if err := d.skipLengths(lengths); err != nil {
+			return err
+		}
+
+		// PEL группы: [ID 16 байт][delivery time 8 байт][delivery count]
+		pending, err := d.length()
+		if err != nil {
+			return err
+		}
+		for j := uint64(0); j < pending; j++ {
+			if _, err := d.read(16 + 8); err != nil {
+				return err
+			}
+			if _, err := d.length(); err != nil {
+				return err
+			}
+		}
+
+		consumers, err := d.length()
+		if err != nil {
+			return err
+		}
+		for j := uint64(0); j < consumers; j++ {
+			if err := d.skipString(); err != nil { // имя
+				return err
+			}
+			// seen time; с LISTPACKS_3 — ещё active time
+			times := 8
+			if typ >= typeStreamListpacks3 {
+				times += 8
+			}
+			if _, err := d.read(uint64(times)); err != nil {
+				return err
+			}
+			// PEL потребителя — только ID
+			pending, err := d.length()
+			if err != nil {
+				return err
+			}
+			if _, err := d.read(16 * pending); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// skipModuleValue пропускает значение модуля в формате MODULE_2:
+// последовательность [опкод][данные] до опкода EOF (0).
+func (d *decoder) skipModuleValue() error {
+	for {
+		op, err := d.length()
+		if err != nil {
+			return err
+		}
+		switch op {
+		case 0: // EOF
+			return nil
+		case 1, 2: // SINT, UINT
+			_, err = d.length()
+		case 3: // FLOAT
+			_, err = d.read(4)
+		case 4: // DOUBLE
+			_, err = d.read(8)
+		case 5: // STRING
+			err = d.skipString()
+		default:
+			return fmt.Errorf("%w: bad module opcode %d", ErrFormat, op)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (d *decoder) skipLengths(n int) error {
+	for i := 0; i < n; i++ {
+		if _, err := d.length(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lengthEnc читает length encoding. encoded = true — 11xxxxxx,
+// специальная кодировка строки, n — её номер.
+func (d *decoder) lengthEnc() (n uint64, encoded bool, err error) {
+	b, err := d.byte()
+	if err != nil {
+		return 0, false, err
+	}
+	switch b >> 6 {
+	case 0:
+		return uint64(b & 0x3F), false, nil
+	case 1:
+		lo, err := d.byte()
+		if err != nil {
+			return 0, false, err
+		}
+		return uint64(b&0x3F)<<8 | uint64(lo), false, nil
+	case 2:
+		switch b {
+		case 0x80:
+			p, err := d.read(4)
+			if err != nil {
+				return 0, false, err
+			}
+			return uint64(binary.BigEndian.Uint32(p)), false, nil
+		case 0x81:
+			p, err := d.read(8)
+			if err != nil {
+				return 0, false, err
+			}
+			return binary.BigEndian.Uint64(p), false, nil
+		}
+		return 0, false, fmt.Errorf("%w: bad length encoding %#x", ErrFormat, b)
+	}
+	return uint64(b & 0x3F), true, nil
+}
+
+// length читает длину (специальная кодировка здесь — ошибка).
+func (d *decoder) length() (uint64, error) {
+	n, encoded, err := d.lengthEnc()
+	if err == nil && encoded {
+		err = fmt.Errorf("%w: unexpected string encoding", ErrFormat)
+	}
+	return n, err
+}
+
+// string читает строку: обычную, целое в int8/16/32 или LZF.
+func (d *decoder) string() (string, error) {
+	n, encoded, err := d.lengthEnc()
+	if err != nil {
+		return "", err
+	}
+	if !encoded {
+		p, err := d.read(n)
+		return string(p), err
+	}
+
+	switch n {
+	case encInt8, encInt16, encInt32:
+		p, err := d.read(1 << n)
+		if err != nil {
+			return "", err
+		}
+		v, _ := (&blob{b: p}).signed(len(p))
+		return strconv.FormatInt(v, 10), nil
+
+	case encLZF:
+		clen, err := d.length()
+		if err != nil {
+			return "", err
+		}
+		size, err := d.length()
+		if err != nil {
+			return "", err
+		}
+		p, err := d.read(clen)
+		if err != nil {
+			return "", err
+		}
+		if size > math.MaxInt32 {
+			return "", fmt.Errorf("%w: LZF length %d", ErrFormat, size)
+		}
+		out, err := lzfDecompress(p, int(size))
+		return string(out), err
+	}
+	return "", fmt.Errorf("%w: unknown string encoding %d", ErrFormat, n)
+}
+
+func (d *decoder) skipString() error {
+	_, err := d.string()
+	return err
+}
+
+// read читает n байт и добавляет их к CRC.
+func (d *decoder) read(n uint64) ([]byte, error) {
+	p := make([]byte, 0, min(n, readChunk))
+	for uint64(len(p)) < n {
+		chunk := min(n-uint64(len(p)), readChunk)
+		start := len(p)
+		p = append(p, make([]byte, chunk)...)
+		if _, err := io.ReadFull(d.r, p[start:]); err != nil {
+			return nil, unexpected(err)
+		}
+	}
+	d.crc = crcUpdate(d.crc, p)
+	return p, nil
+}
+
+func (d *decoder) byte() (byte, error) {
+	b, err := d.r.ReadByte()
+	if err != nil {
+		return 0, unexpected(err)
+	}
+	d.crc = crcUpdate(d.crc, []byte{b})
+	return b, nil
+}
+
+// checksum сверяет CRC64 после опкода EOF (0 — Redis писал без CRC).
+func (d *decoder) checksum() error {
+	want := d.crc
+	var p [8]byte
+	if _, err := io.ReadFull(d.r, p[:]); err != nil {
+		return unexpected(err)
+	}
+	if got := binary.LittleEndian.Uint64(p[:]); got != 0 && got != want {
+		return fmt.Errorf("%w: stored %016x, computed %016x", ErrChecksum, got, want)
+	}
+	return nil
+}
+
+// unexpected: конец файла посреди RDB — повреждение, а не io.EOF.
+func unexpected(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return fmt.Errorf("%w: unexpected end of file", ErrFormat)
+	}
+	return err
+}
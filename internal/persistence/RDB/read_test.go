@@ -0,0 +1,281 @@
+package RDB
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"imcs/internal/storage/cache"
+)
+
+// rdbWriter собирает RDB-файл для тестов.
+type rdbWriter struct{ b []byte }
+
+func newRDB(version int) *rdbWriter {
+	return &rdbWriter{b: []byte(fmt.Sprintf("REDIS%04d", version))}
+}
+
+func (w *rdbWriter) raw(p ...byte) *rdbWriter { w.b = append(w.b, p...); return w }
+
+func (w *rdbWriter) length(n int) *rdbWriter {
+	switch {
+	case n < 1<<6:
+		return w.raw(byte(n))
+	case n < 1<<14:
+		return w.raw(0x40|byte(n>>8), byte(n))
+	}
+	w.raw(0x80)
+	w.b = binary.BigEndian.AppendUint32(w.b, uint32(n))
+	return w
+}
+
+func (w *rdbWriter) str(s string) *rdbWriter {
+	w.length(len(s))
+	w.b = append(w.b, s...)
+	return w
+}
+
+func (w *rdbWriter) key(typ byte, key string) *rdbWriter { return w.raw(typ).str(key) }
+
+func (w *rdbWriter) finish() []byte {
+	w.raw(opEOF)
+	return binary.LittleEndian.AppendUint64(w.b, crcUpdate(0, w.b))
+}
+
+// ziplist: строки до 63 байт, числа — int8 или int16.
+func ziplist(items ...any) string {
+	b := make([]byte, 10)
+	for _, it := range items {
+		b = append(b, 0) // prevlen
+		switch v := it.(type) {
+		case string:
+			b = append(append(b, byte(len(v))), v...)
+		case int:
+			if v >= -128 && v < 128 {
+				b = append(b, 0xFE, byte(int8(v)))
+			} else {
+				b = binary.LittleEndian.AppendUint16(append(b, 0xC0), uint16(int16(v)))
+			}
+		}
+	}
+	return string(append(b, 0xFF))
+}
+
+// listpack: строки до 63 байт, числа — 7 или 13 бит.
+func listpack(items ...any) string {
+	b := make([]byte, 6)
+	for _, it := range items {
+		var e []byte
+		switch v := it.(type) {
+		case string:
+			e = append([]byte{0x80 | byte(len(v))}, v...)
+		case int:
+			if v >= 0 && v < 128 {
+				e = []byte{byte(v)}
+			} else {
+				u := uint16(v) & 0x1FFF
+				e = []byte{0xC0 | byte(u>>8), byte(u)}
+			}
+		}
+		b = append(append(b, e...), byte(len(e)))
+	}
+	return string(append(b, 0xFF))
+}
+
+// load читает RDB и возвращает значения ключей строками.
+func load(t *testing.T, data []byte) (map[string]string, *Result) {
+	t.Helper()
+	got := map[string]string{}
+	result, err := Load(bytes.NewReader(data), func(e *Entry) error {
+		v := e.Value
+		s := fmt.Sprintf("%v %q %q %v", v.Kind, v.String, v.Items, v.ZSet)
+		if e.ExpireAt > 0 {
+			s += " ttl"
+		}
+		got[fmt.Sprintf("%d:%s", e.DB, e.Key)] = s
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return got, result
+}
+
+// TestCRC — CRC64 Jones как в Redis: контрольное значение и DUMP
+// из документации Redis (DUMP mykey при mykey = 10).
+func TestCRC(t *testing.T) {
+	if crc := crcUpdate(0, []byte("123456789")); crc != 0xe9c6d914c4b8d9ca {
+		t.Fatalf("crc = %x", crc)
+	}
+	dump := []byte("\x00\xc0\n\t\x00\xbem\x06\x89Z(\x00\n")
+	if crcUpdate(0, dump[:5]) != binary.LittleEndian.Uint64(dump[5:]) {
+		t.Fatal("DUMP checksum mismatch")
+	}
+}
+
+// TestLoadTypes — все кодировки поддерживаемых типов, TTL и SELECT.
+func TestLoadTypes(t *testing.T) {
+	future := uint64(time.Now().Add(time.Hour).UnixMilli())
+	w := newRDB(11).
+		raw(opAux).str("redis-ver").str("7.2.4").
+		raw(opSelectDB).length(0).
+		raw(opResizeDB).length(10).length(1).
+		key(typeString, "plain").str("hello").
+		key(typeString, "int8").raw(0xC0, 0xF6).     // -10
+		key(typeString, "int16").raw(0xC1, 0xE8, 3). // 1000
+		key(typeString, "int32").raw(0xC2, 0x40, 0x42, 0x0F, 0).
+		// LZF: литерал "abc" и повтор 6 байт со смещением 3
+		key(typeString, "lzf").raw(0xC3).length(6).length(9).raw(2, 'a', 'b', 'c', 0x80, 2).
+		raw(opExpireTimeMs)
+	w.b = binary.LittleEndian.AppendUint64(w.b, future)
+	w.raw(opFreq, 5).
+		key(typeListQuicklist2, "list").length(2).
+		length(2).str(listpack("a", 7, -100)).
+		length(1).str("plain node").
+		key(typeListQuicklist, "oldlist").length(1).str(ziplist("x", 300, -5)).
+		key(typeSetIntset, "ints").str("\x02\x00\x00\x00\x03\x00\x00\x00\x01\x00\xfe\xff\x2c\x01").
+		key(typeSetListpack, "set").str(listpack("m1", "m2")).
+		key(typeSet, "rawset").length(1).str("only").
+		key(typeHashZiplist, "hzip").str(ziplist("f", "v", "n", 1)).
+		key(typeHashListpack, "hlp").str(listpack("f", "v")).
+		key(typeHash, "hraw").length(1).str("f").str("v").
+		key(typeZSetListpack, "zlp").str(listpack("a", 1, "b", "1.5")).
+		key(typeZSetZiplist, "zzip").str(ziplist("a", -2)).
+		key(typeZSet, "zold").length(2).str("a").raw(3, '2', '.', '5').str("b").raw(255)
+	w.key(typeZSet2, "z2").length(1).str("a")
+	w.b = binary.LittleEndian.AppendUint64(w.b, math.Float64bits(0.25))
+	w.raw(opSelectDB).length(3).
+		key(typeHashZipmap, "zipmap").str("\x01\x01f\x01\x00v\xff")
+
+	got, result := load(t, w.finish())
+	want := map[string]string{
+		"0:plain":   `string "hello" [] []`,
+		"0:int8":    `string "-10" [] []`,
+		"0:int16":   `string "1000" [] []`,
+		"0:int32":   `string "1000000" [] []`,
+		"0:lzf":     `string "abcabcabc" [] []`,
+		"0:list":    `list "" ["a" "7" "-100" "plain node"] [] ttl`,
+		"0:oldlist": `list "" ["x" "300" "-5"] []`,
+		"0:ints":    `set "" ["1" "-2" "300"] []`,
+		"0:set":     `set "" ["m1" "m2"] []`,
+		"0:rawset":  `set "" ["only"] []`,
+		"0:hzip":    `hash "" ["f" "v" "n" "1"] []`,
+		"0:hlp":     `hash "" ["f" "v"] []`,
+		"0:hraw":    `hash "" ["f" "v"] []`,
+		"0:zlp":     `zset "" [] [{a 1} {b 1.5}]`,
+		"0:zzip":    `zset "" [] [{a -2}]`,
+		"0:zold":    `zset "" [] [{a 2.5} {b -Inf}]`,
+		"0:z2":      `zset "" [] [{a 0.25}]`,
+		"3:zipmap":  `hash "" ["f" "v"] []`,
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %s, want %s", k, got[k], v)
+		}
+	}
+	if len(got) != len(want) || result.Keys != len(want) || result.Version != 11 {
+		t.Fatalf("loaded %d keys, result %+v", len(got), result)
+	}
+}
+
+// TestLoadUnsupported — stream и значение модуля пропускаются и
+// перечисляются, истёкший ключ не загружается, остальное — загружается.
+func TestLoadUnsupported(t *testing.T) {
+	w := newRDB(10).
+		raw(opModuleAux).length(12345).length(2).length(1).length(5).str("aux").length(0).
+		raw(opFunction2).str("#!lua name=lib\nredis.register_function('f', function() return 1 end)").
+		key(typeStreamListpacks2, "stream").
+		length(1).str(strings.Repeat("\x00", 16)).str(listpack("x")).
+		length(1).length(1).length(0).                        // length, last ID
+		length(1).length(0).length(0).length(0).length(1).    // first ID, max deleted ID, entries added
+		length(1).str("group").length(1).length(0).length(1). // группа: last ID, entries read
+		length(1).raw(make([]byte, 16+8)...).length(1).       // PEL группы
+		length(1).str("consumer").raw(make([]byte, 8)...).length(1).raw(make([]byte, 16)...).
+		key(typeModule2, "mod").length(99).length(2).length(7).length(4).raw(make([]byte, 8)...).length(0).
+		raw(opExpireTime, 1, 0, 0, 0). // 1970 год
+		key(typeString, "expired").str("x").
+		key(typeString, "after").str("ok")
+
+	got, result := load(t, w.finish())
+	if len(got) != 1 || got["0:after"] == "" || result.Expired != 1 {
+		t.Fatalf("loaded %v, result %+v", got, result)
+	}
+	if fmt.Sprint(result.Unsupported) != "[{0 stream stream} {0 mod module}]" {
+		t.Fatalf("unsupported = %v", result.Unsupported)
+	}
+}
+
+// TestLoadBroken — неверная контрольная сумма, неподдерживаемая версия и
+// обрыв файла.
+func TestLoadBroken(t *testing.T) {
+	data := newRDB(9).key(typeString, "k").str("value").finish()
+	nop := func(*Entry) error { return nil }
+
+	bad := bytes.Clone(data)
+	bad[len(bad)-12] ^= 0xFF
+	if _, err := Load(bytes.NewReader(bad), nop); !errors.Is(err, ErrChecksum) {
+		t.Fatalf("flipped byte: err = %v", err)
+	}
+
+	// Нулевая контрольная сумма — Redis с rdbchecksum no
+	unchecked := append(bytes.Clone(data[:len(data)-8]), make([]byte, 8)...)
+	if _, err := Load(bytes.NewReader(unchecked), nop); err != nil {
+		t.Fatalf("zero checksum: %v", err)
+	}
+
+	if _, err := Load(bytes.NewReader(newRDB(12).finish()), nop); err == nil {
+		t.Fatal("RDB 12 accepted")
+	}
+	if _, err := Load(bytes.NewReader(data[:len(data)-10]), nop); !errors.Is(err, ErrFormat) {
+		t.Fatalf("truncated: err = %v", err)
+	}
+
+	// LZF с заявленной длиной в 4 ГБ на 5 сжатых байт — без выделения памяти
+	huge := newRDB(9).key(typeString, "lzf").raw(0xC3).length(5).length(1<<32-1).
+		raw(2, 'a', 'b', 'c', 0x80).finish()
+	if _, err := Load(bytes.NewReader(huge), nop); !errors.Is(err, ErrFormat) {
+		t.Fatalf("huge LZF length: err = %v", err)
+	}
+	for _, size := range []int{-1, lzfMaxRatio*5 + 65} {
+		if _, err := lzfDecompress([]byte{2, 'a', 'b', 'c', 0x80}, size); !errors.Is(err, ErrFormat) {
+			t.Fatalf("lzfDecompress(size %d): err = %v", size, err)
+		}
+	}
+}
+
+// TestLoadIntoCache — Entry применяется через Cache.Restore: TTL и тип
+// сохраняются, существующий ключ заменяется.
+func TestLoadIntoCache(t *testing.T) {
+	c := storage.New(nopPersistence{})
+	defer c.Close()
+	c.Set("list", "old string", 0, false)
+
+	w := newRDB(11).
+		key(typeListQuicklist2, "list").length(1).length(2).str(listpack("a", "b")).
+		raw(opExpireTimeMs)
+	w.b = binary.LittleEndian.AppendUint64(w.b, uint64(time.Now().Add(time.Hour).UnixMilli()))
+	w.key(typeString, "str").str("v")
+
+	if _, err := Load(bytes.NewReader(w.finish()), func(e *Entry) error {
+		return c.Restore(e.Key, e.Value, e.ExpireAt, true)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if items, _ := c.LRange("list", 0, -1); fmt.Sprint(items) != "[a b]" {
+		t.Fatalf("list = %v", items)
+	}
+	if ttl := c.GetTTL("str"); ttl < 3500 || ttl > 3600 {
+		t.Fatalf("TTL = %d", ttl)
+	}
+}
+
+type nopPersistence struct{}
+
+func (nopPersistence) Write(cmd, key, value string, d time.Duration) func() error { return nil }
+func (nopPersistence) WriteAt(cmd, key, value string, e int64) func() error       { return nil }
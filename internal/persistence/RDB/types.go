@@ -0,0 +1,110 @@
+package RDB
+
+import (
+	"errors"
+
+	"imcs/internal/storage/cache"
+)
+
+/*
+
+	RDB — формат снимков Redis (dump.rdb), версии 9–11 (Redis 5.0–7.2).
+	Нужен для переезда между Redis и IMCS без репликации. При импорте
+	файл читается целиком, ключи поддерживаемых типов попадают в кеш,
+	остальные (stream, модули) пропускаются и перечисляются в Result.
+	Экспорт и DUMP — см. write.go.
+
+	Файл:    "REDIS" + 4 цифры версии
+	         [опкоды AUX/SELECTDB/RESIZEDB/EXPIRETIME/...]
+	         [тип значения][ключ][значение] ...
+	         0xFF + crc64 (Jones, little-endian; 0 — не считался)
+
+	Длины и целые — length encoding Redis: 6/14/32/64 бита или
+	«специальная» кодировка строки (int8/16/32, LZF).
+
+*/
+
+// Версии RDB, которые умеет читать Load.
+const (
+	minVersion = 9
+	maxVersion = 11
+)
+
+// Опкоды (rdb.h).
+const (
+	opFunction2    = 0xF5
+	opFunctionPre  = 0xF6
+	opModuleAux    = 0xF7
+	opIdle         = 0xF8
+	opFreq         = 0xF9
+	opAux          = 0xFA
+	opResizeDB     = 0xFB
+	opExpireTimeMs = 0xFC
+	opExpireTime   = 0xFD
+	opSelectDB     = 0xFE
+	opEOF          = 0xFF
+)
+
+// Типы значений (rdb.h).
+const (
+	typeString           = 0
+	typeList             = 1
+	typeSet              = 2
+	typeZSet             = 3
+	typeHash             = 4
+	typeZSet2            = 5
+	typeModule           = 6
+	typeModule2          = 7
+	typeHashZipmap       = 9
+	typeListZiplist      = 10
+	typeSetIntset        = 11
+	typeZSetZiplist      = 12
+	typeHashZiplist      = 13
+	typeListQuicklist    = 14
+	typeStreamListpacks  = 15
+	typeHashListpack     = 16
+	typeZSetListpack     = 17
+	typeListQuicklist2   = 18
+	typeStreamListpacks2 = 19
+	typeSetListpack      = 20
+	typeStreamListpacks3 = 21
+)
+
+// Специальные кодировки строки (length encoding 11xxxxxx).
+const (
+	encInt8  = 0
+	encInt16 = 1
+	encInt32 = 2
+	encLZF   = 3
+)
+
+var (
+	// ErrFormat — файл не RDB или повреждён.
+	ErrFormat = errors.New("RDB: malformed file")
+
+	// ErrChecksum — CRC64 в конце файла не сходится.
+	ErrChecksum = errors.New("RDB: checksum mismatch")
+)
+
+// Entry — один ключ из RDB.
+type Entry struct {
+	DB       int
+	Key      string
+	Value    storage.Value
+	ExpireAt int64 // нс, 0 — без TTL
+}
+
+// UnsupportedKey — ключ типа, которого нет в IMCS; он пропущен.
+type UnsupportedKey struct {
+	DB   int
+	Key  string
+	Type string // stream, module
+}
+
+// Result — итог загрузки RDB.
+type Result struct {
+	Version     int
+	Keys        int // передано в fn
+	Expired     int // пропущено: TTL истёк до загрузки
+	Unsupported []UnsupportedKey
+}
@@ -0,0 +1,220 @@
+package RDB
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+
+	"imcs/internal/storage/cache"
+)
+
+/*
+
+	Запись RDB и DUMP-payload.
+
+	IMCS пишет RDB версии 9 в простых кодировках: строка, список
+	(RDB_TYPE_LIST), множество, хеш и ZSET_2 с float64-score. Такой файл
+	и такой payload читают Redis 5.0 и новее — компактные кодировки Redis
+	строит сам при загрузке.
+
+	DUMP-payload: [тип][значение][версия RDB u16][crc64 u64] — CRC по
+	всему, что до неё, оба числа little-endian.
+
+*/
+
+// writeVersion — версия RDB файлов и DUMP-payload, которые пишет IMCS.
+const writeVersion = 9
+
+// ErrDumpPayload — у RESTORE-payload неверная версия или контрольная сумма.
+var ErrDumpPayload = errors.New("DUMP payload version or checksum are wrong")
+
+// Writer пишет RDB-файл: заголовок в NewWriter, ключи — Write, EOF и
+// CRC64 — Close.
+type Writer struct {
+	w    *bufio.Writer
+	crc  uint64
+	buf  []byte
+	keys int
+}
+
+// NewWriter начинает RDB-файл в w: заголовок, AUX-поля и база 0.
+func NewWriter(w io.Writer) (*Writer, error) {
+	rw := &Writer{w: bufio.NewWriterSize(w, 64*1024)}
+	b := fmt.Appendf(nil, "REDIS%04d", writeVersion)
+	b = appendAux(b, "redis-bits", "64")
+	b = appendAux(b, "ctime", strconv.FormatInt(time.Now().Unix(), 10))
+	b = append(b, opSelectDB)
+	b = appendLength(b, 0)
+	return rw, rw.write(b)
+}
+
+// Write дописывает ключ с TTL (expireAt, нс, 0 — без TTL).
+func (w *Writer) Write(key string, v storage.Value, expireAt int64) error {
+	b := w.buf[:0]
+	if expireAt > 0 {
+		b = append(b, opExpireTimeMs)
+		b = binary.LittleEndian.AppendUint64(b, uint64(expireAt/int64(time.Millisecond)))
+	}
+	b = append(b, valueType(v.Kind))
+	b = appendString(b, key)
+	b = appendValue(b, v)
+	w.buf = b
+	w.keys++
+	return w.write(b)
+}
+
+// Keys — число записанных ключей.
+func (w *Writer) Keys() int {
+	return w.keys
+}
+
+// Close дописывает EOF и CRC64 и сбрасывает буфер. Сам w не закрывается.
+func (w *Writer) Close() error {
+	if err := w.write([]byte{opEOF}); err != nil {
+		return err
+	}
+	var sum [8]byte
+	binary.LittleEndian.PutUint64(sum[:], w.crc)
+	if _, err := w.w.Write(sum[:]); err != nil {
+		return err
+	}
+	return w.w.Flush()
+}
+
+func (w *Writer) write(b []byte) error {
+	w.crc = crcUpdate(w.crc, b)
+	_, err := w.w.Write(b)
+	return err
+}
+
+// Export пишет в w RDB со всеми живыми ключами, которые отдаёт snapshot
+// (Cache.Export или ExportShared). Возвращает число ключей.
+func Export(w io.Writer, snapshot func(mark func(), fn func(cmd, key, value string, expireAt int64))) (int, error) {
+	rw, err := NewWriter(w)
+	if err != nil {
+		return 0, err
+	}
+	snapshot(func() {}, func(cmd, key, value string, expireAt int64) {
+		if err != nil {
+			return
+		}
+		v, ok := storage.RecordValue(cmd, value)
+		if !ok {
+			err = fmt.Errorf("RDB: unexpected snapshot record %s for key %q", cmd, key)
+			return
+		}
+		err = rw.Write(key, v, expireAt)
+	})
+	if err != nil {
+		return rw.Keys(), err
+	}
+	return rw.Keys(), rw.Close()
+}
+
+// Dump сериализует значение в DUMP-payload.
+func Dump(v storage.Value) []byte {
+	b := []byte{valueType(v.Kind)}
+	b = appendValue(b, v)
+	b = binary.LittleEndian.AppendUint16(b, writeVersion)
+	return binary.LittleEndian.AppendUint64(b, crcUpdate(0, b))
+}
+
+// Undump разбирает DUMP-payload (в том числе от Redis до RDB 11).
+func Undump(payload []byte) (storage.Value, error) {
+	if len(payload) < 1+2+8 {
+		return storage.Value{}, ErrDumpPayload
+	}
+	footer := len(payload) - 10
+	version := binary.LittleEndian.Uint16(payload[footer:])
+	crc := binary.LittleEndian.Uint64(payload[footer+2:])
+	if version > maxVersion || crc != crcUpdate(0, payload[:footer+2]) {
+		return storage.Value{}, ErrDumpPayload
+	}
+
+	body := bytes.NewReader(payload[:footer])
+	d := &decoder{r: bufio.NewReader(body)}
+	typ, err := d.byte()
+	if err != nil {
+		return storage.Value{}, err
+	}
+	v, unsupported, err := d.value(typ)
+	switch {
+	case err != nil:
+		return v, err
+	case unsupported != "":
+		return v, fmt.Errorf("%w: %s values are not supported", ErrFormat, unsupported)
+	case d.r.Buffered() > 0 || body.Len() > 0:
+		return v, fmt.Errorf("%w: trailing bytes in payload", ErrFormat)
+	}
+	return v, nil
+}
+
+// valueType — тип RDB, которым пишется значение.
+func valueType(kind storage.Kind) byte {
+	switch kind {
+	case storage.KindHash:
+		return typeHash
+	case storage.KindList:
+		return typeList
+	case storage.KindSet:
+		return typeSet
+	case storage.KindZSet:
+		return typeZSet2
+	}
+	return typeString
+}
+
+// appendValue дописывает значение в кодировке valueType.
+func appendValue(b []byte, v storage.Value) []byte {
+	switch v.Kind {
+	case storage.KindHash:
+		b = appendLength(b, uint64(len(v.Items)/2))
+		for _, s := range v.Items {
+			b = appendString(b, s)
+		}
+	case storage.KindList, storage.KindSet:
+		b = appendLength(b, uint64(len(v.Items)))
+		for _, s := range v.Items {
+			b = appendString(b, s)
+		}
+	case storage.KindZSet:
+		b = appendLength(b, uint64(len(v.ZSet)))
+		for _, m := range v.ZSet {
+			b = appendString(b, m.Member)
+			b = binary.LittleEndian.AppendUint64(b, math.Float64bits(m.Score))
+		}
+	default:
+		b = appendString(b, v.String)
+	}
+	return b
+}
+
+func appendAux(b []byte, key, value string) []byte {
+	b = append(b, opAux)
+	b = appendString(b, key)
+	return appendString(b, value)
+}
+
+func appendString(b []byte, s string) []byte {
+	b = appendLength(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+// appendLength — length encoding: 6, 14, 32 или 64 бита.
+func appendLength(b []byte, n uint64) []byte {
+	switch {
+	case n < 1<<6:
+		return append(b, byte(n))
+	case n < 1<<14:
+		return append(b, 0x40|byte(n>>8), byte(n))
+	case n <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(b, 0x80), uint32(n))
+	}
+	return binary.BigEndian.AppendUint64(append(b, 0x81), n)
+}
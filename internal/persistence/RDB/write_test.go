@@ -0,0 +1,127 @@
+package RDB
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"imcs/internal/storage/cache"
+)
+
+// values — по значению каждого типа; хеш и множество из одного
+// элемента, чтобы порядок был однозначным.
+var values = map[string]storage.Value{
+	"str":  {Kind: storage.KindString, String: strings.Repeat("x", 20000)},
+	"list": {Kind: storage.KindList, Items: []string{"a", "", "c"}},
+	"set":  {Kind: storage.KindSet, Items: []string{"m"}},
+	"hash": {Kind: storage.KindHash, Items: []string{"f", "v"}},
+	"zset": {Kind: storage.KindZSet, ZSet: []storage.ZMember{{Member: "a", Score: math.Inf(-1)}, {Member: "b", Score: 0.1}}},
+}
+
+// TestExportRoundTrip — то, что пишет Export, читает Load: типы, значения, TTL.
+func TestExportRoundTrip(t *testing.T) {
+	c := storage.New(nopPersistence{})
+	defer c.Close()
+	expireAt := time.Now().Add(time.Hour).UnixNano()
+	for key, v := range values {
+		c.Restore(key, v, expireAt, false)
+	}
+	c.Set("forever", "1", 0, false)
+
+	var buf bytes.Buffer
+	n, err := Export(&buf, c.Snapshot)
+	if err != nil || n != len(values)+1 {
+		t.Fatalf("Export = %d, %v", n, err)
+	}
+
+	got := map[string]*Entry{}
+	result, err := Load(&buf, func(e *Entry) error {
+		got[e.Key] = e
+		return nil
+	})
+	if err != nil || result.Keys != n || result.Version != writeVersion {
+		t.Fatalf("Load = %+v, %v", result, err)
+	}
+	for key, v := range values {
+		e := got[key]
+		if e == nil || fmt.Sprint(e.Value) != fmt.Sprint(v) {
+			t.Errorf("%s = %+v, want %+v", key, e, v)
+		}
+		if e != nil && e.ExpireAt/int64(time.Millisecond) != expireAt/int64(time.Millisecond) {
+			t.Errorf("%s ExpireAt = %d, want %d", key, e.ExpireAt, expireAt)
+		}
+	}
+	if e := got["forever"]; e == nil || e.ExpireAt != 0 {
+		t.Fatalf("forever = %+v", e)
+	}
+}
+
+// TestExportColdKeys — ключи, выгруженные в cold storage, попадают в RDB
+// со своим TTL и загружаются обратно.
+func TestExportColdKeys(t *testing.T) {
+	c := storage.New(nopPersistence{})
+	defer c.Close()
+	if err := c.InitColdStorage(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	expireAt := time.Now().Add(time.Hour).UnixNano()
+	c.Restore("k", storage.Value{Kind: storage.KindString, String: "cold"}, expireAt, false)
+	c.SetColdPolicy(storage.ColdPolicy{IdleTime: time.Nanosecond})
+	time.Sleep(10 * time.Millisecond)
+	c.EvictCold()
+	if stats := c.ColdStats(); stats.Keys != 1 || c.CountKeys() != 0 {
+		t.Fatalf("k not demoted: %+v", stats)
+	}
+	c.Set("hot", "1", 0, false)
+
+	var buf bytes.Buffer
+	n, err := Export(&buf, c.Export)
+	if err != nil || n != 2 {
+		t.Fatalf("Export = %d, %v", n, err)
+	}
+
+	loaded := storage.New(nopPersistence{})
+	defer loaded.Close()
+	if _, err := Load(&buf, func(e *Entry) error {
+		loaded.Restore(e.Key, e.Value, e.ExpireAt, false)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := loaded.Get("k"); !ok || v != "cold" {
+		t.Fatalf("k = %q, %v", v, ok)
+	}
+	if ms := loaded.GetPTTL("k"); ms <= 0 || ms > int64(time.Hour/time.Millisecond) {
+		t.Fatalf("PTTL k = %d", ms)
+	}
+	if v, ok := loaded.Get("hot"); !ok || v != "1" {
+		t.Fatalf("hot = %q, %v", v, ok)
+	}
+}
+
+// TestDumpPayload — Dump/Undump обратимы; payload Redis читается, битый —
+// отвергается.
+func TestDumpPayload(t *testing.T) {
+	for key, v := range values {
+		got, err := Undump(Dump(v))
+		if err != nil || fmt.Sprint(got) != fmt.Sprint(v) {
+			t.Errorf("%s: Undump = %+v, %v", key, got, err)
+		}
+	}
+
+	// DUMP mykey из документации Redis (mykey = 10, RDB 9)
+	v, err := Undump([]byte("\x00\xc0\n\t\x00\xbem\x06\x89Z(\x00\n"))
+	if err != nil || v.Kind != storage.KindString || v.String != "10" {
+		t.Fatalf("Redis payload: %+v, %v", v, err)
+	}
+
+	payload := Dump(values["list"])
+	payload[2] ^= 0xFF
+	if _, err := Undump(payload); !errors.Is(err, ErrDumpPayload) {
+		t.Fatalf("corrupt payload: err = %v", err)
+	}
+}
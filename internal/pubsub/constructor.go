@@ -0,0 +1,20 @@
+package pubsub
+
+// New создаёт пустую шину.
+func New() *Bus {
+	return &Bus{
+		channels: make(map[string]map[*Subscriber]struct{}),
+		patterns: make(map[string]map[*Subscriber]struct{}),
+	}
+}
+
+// NewSubscriber создаёт подписчика с буфером на buffer сообщений.
+// Пока у него нет подписок, сообщения ему не доставляются.
+func (b *Bus) NewSubscriber(buffer int) *Subscriber {
+	return &Subscriber{
+		bus:      b,
+		ch:       make(chan Message, buffer),
+		channels: make(map[string]struct{}),
+		patterns: make(map[string]struct{}),
+	}
+}
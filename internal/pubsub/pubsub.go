@@ -0,0 +1,225 @@
+package pubsub
+
+import (
+	"sort"
+
+	storage "imcs/internal/storage/cache"
+)
+
+/*
+	Pub/Sub в духе Redis: подписки на каналы и на glob-шаблоны.
+
+	Publish не блокируется: сообщение кладётся в буфер подписчика.
+	Подписчик, который не успевает читать и переполнил буфер, закрывается —
+	так Redis отключает медленных клиентов (client-output-buffer-limit pubsub).
+
+	Порядок блокировок: Bus.mu → Subscriber.mu.
+*/
+
+// C возвращает канал входящих сообщений.
+// Закрывается после Close или переполнения буфера.
+func (sub *Subscriber) C() <-chan Message {
+	return sub.ch
+}
+
+// Subscribe подписывает на каналы. Возвращает число подписок
+// (каналы + шаблоны) после каждого из них — для ответов SUBSCRIBE.
+func (sub *Subscriber) Subscribe(channels ...string) []int {
+	return sub.bus.subscribe(sub, channels, false)
+}
+
+// PSubscribe подписывает на glob-шаблоны каналов.
+func (sub *Subscriber) PSubscribe(patterns ...string) []int {
+	return sub.bus.subscribe(sub, patterns, true)
+}
+
+// Unsubscribe отписывает от каналов; без аргументов — от всех.
+// Возвращает каналы, от которых отписал, и число подписок после каждого.
+func (sub *Subscriber) Unsubscribe(channels ...string) ([]string, []int) {
+	return sub.bus.unsubscribe(sub, channels, false)
+}
+
+// PUnsubscribe отписывает от шаблонов; без аргументов — от всех.
+func (sub *Subscriber) PUnsubscribe(patterns ...string) ([]string, []int) {
+	return sub.bus.unsubscribe(sub, patterns, true)
+}
+
+// Count возвращает текущее число подписок (каналы + шаблоны).
+func (sub *Subscriber) Count() int {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	return len(sub.channels) + len(sub.patterns)
+}
+
+// Close снимает все подписки и закрывает канал сообщений.
+func (sub *Subscriber) Close() {
+	b := sub.bus
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+
+	for name := range sub.channels {
+		b.remove(b.channels, name, sub)
+	}
+	for name := range sub.patterns {
+		b.remove(b.patterns, name, sub)
+	}
+	sub.channels = make(map[string]struct{})
+	sub.patterns = make(map[string]struct{})
+
+	if !sub.closed {
+		sub.closed = true
+		close(sub.ch)
+	}
+}
+
+// deliver кладёт сообщение в буфер. Вызывается под Bus.mu (read).
+func (sub *Subscriber) deliver(msg Message) bool {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+
+	if sub.closed {
+		return false
+	}
+	select {
+	case sub.ch <- msg:
+		return true
+	default:
+		// Буфер полон — отключаем медленного подписчика, из шины его
+		// уберёт Close владельца
+		sub.closed = true
+		close(sub.ch)
+		return false
+	}
+}
+
+// Publish отправляет сообщение в канал. Возвращает число получателей
+// (подписка на канал и каждый совпавший шаблон считаются отдельно).
+func (b *Bus) Publish(channel, payload string) int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	received := 0
+	for sub := range b.channels[channel] {
+		if sub.deliver(Message{Channel: channel, Payload: payload}) {
+			received++
+		}
+	}
+	for pattern, subs := range b.patterns {
+		if !match(pattern, channel) {
+			continue
+		}
+		for sub := range subs {
+			if sub.deliver(Message{Channel: channel, Pattern: pattern, Payload: payload}) {
+				received++
+			}
+		}
+	}
+	return received
+}
+
+// Channels возвращает активные каналы, подходящие под pattern ("" — все).
+func (b *Bus) Channels(pattern string) []string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	result := []string{}
+	for channel := range b.channels {
+		if pattern == "" || match(pattern, channel) {
+			result = append(result, channel)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// NumSub возвращает число подписчиков каждого канала (без учёта шаблонов).
+func (b *Bus) NumSub(channels ...string) []int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	counts := make([]int, len(channels))
+	for i, channel := range channels {
+		counts[i] = len(b.channels[channel])
+	}
+	return counts
+}
+
+// NumPat возвращает число различных шаблонов, на которые есть подписки.
+func (b *Bus) NumPat() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.patterns)
+}
+
+func (b *Bus) subscribe(sub *Subscriber, names []string, pattern bool) []int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+
+	index, own := b.channels, sub.channels
+	if pattern {
+		index, own = b.patterns, sub.patterns
+	}
+
+	counts := make([]int, len(names))
+	for i, name := range names {
+		if _, ok := own[name]; !ok && !sub.closed {
+			own[name] = struct{}{}
+			set := index[name]
+			if set == nil {
+				set = make(map[*Subscriber]struct{})
+				index[name] = set
+			}
+			set[sub] = struct{}{}
+		}
+		counts[i] = len(sub.channels) + len(sub.patterns)
+	}
+	return counts
+}
+
+func (b *Bus) unsubscribe(sub *Subscriber, names []string, pattern bool) ([]string, []int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+
+	index, own := b.channels, sub.channels
+	if pattern {
+		index, own = b.patterns, sub.patterns
+	}
+
+	if len(names) == 0 {
+		for name := range own {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+
+	counts := make([]int, len(names))
+	for i, name := range names {
+		if _, ok := own[name]; ok {
+			delete(own, name)
+			b.remove(index, name, sub)
+		}
+		counts[i] = len(sub.channels) + len(sub.patterns)
+	}
+	return names, counts
+}
+
+// remove снимает подписчика с имени в индексе (под Bus.mu).
+func (b *Bus) remove(index map[string]map[*Subscriber]struct{}, name string, sub *Subscriber) {
+	if set := index[name]; set != nil {
+		delete(set, sub)
+		if len(set) == 0 {
+			delete(index, name)
+		}
+	}
+}
+
+// match проверяет канал по glob-шаблону (тот же синтаксис, что у KEYS).
+func match(pattern, channel string) bool {
+	return storage.StringMatch(pattern, channel)
+}
@@ -0,0 +1,107 @@
+package pubsub
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPublishSubscribe(t *testing.T) {
+	bus := New()
+
+	a := bus.NewSubscriber(8)
+	defer a.Close()
+	b := bus.NewSubscriber(8)
+	defer b.Close()
+
+	if counts := a.Subscribe("news", "sport", "news"); !reflect.DeepEqual(counts, []int{1, 2, 2}) {
+		t.Fatalf("Subscribe counts = %v", counts)
+	}
+	b.PSubscribe("news.*", "*")
+
+	if n := bus.Publish("news", "hello"); n != 2 {
+		t.Fatalf("Publish(news) = %d, want 2", n)
+	}
+	if msg := <-a.C(); msg != (Message{Channel: "news", Payload: "hello"}) {
+		t.Fatalf("a got %+v", msg)
+	}
+	if msg := <-b.C(); msg != (Message{Channel: "news", Pattern: "*", Payload: "hello"}) {
+		t.Fatalf("b got %+v", msg)
+	}
+
+	// Каждый совпавший шаблон — отдельное сообщение
+	if n := bus.Publish("news.tech", "go"); n != 2 {
+		t.Fatalf("Publish(news.tech) = %d, want 2", n)
+	}
+
+	if got := bus.Channels(""); !reflect.DeepEqual(got, []string{"news", "sport"}) {
+		t.Fatalf("Channels = %v", got)
+	}
+	if got := bus.NumSub("news", "none"); !reflect.DeepEqual(got, []int{1, 0}) {
+		t.Fatalf("NumSub = %v", got)
+	}
+	if n := bus.NumPat(); n != 2 {
+		t.Fatalf("NumPat = %d, want 2", n)
+	}
+
+	names, counts := a.Unsubscribe()
+	if !reflect.DeepEqual(names, []string{"news", "sport"}) || !reflect.DeepEqual(counts, []int{1, 0}) {
+		t.Fatalf("Unsubscribe = %v %v", names, counts)
+	}
+	if n := bus.Publish("sport", "x"); n != 1 {
+		t.Fatalf("Publish after unsubscribe = %d, want 1 (pattern)", n)
+	}
+
+	b.Close()
+	if _, ok := <-b.C(); !ok {
+		t.Fatal("buffered messages must survive Close")
+	}
+	if n := bus.NumPat(); n != 0 {
+		t.Fatalf("NumPat after Close = %d, want 0", n)
+	}
+}
+
+// TestSlowSubscriber — переполненный буфер закрывает канал подписчика,
+// остальные получатели не страдают.
+func TestSlowSubscriber(t *testing.T) {
+	bus := New()
+
+	slow := bus.NewSubscriber(1)
+	defer slow.Close()
+	fast := bus.NewSubscriber(8)
+	defer fast.Close()
+
+	slow.Subscribe("ch")
+	fast.Subscribe("ch")
+
+	bus.Publish("ch", "1")
+	if n := bus.Publish("ch", "2"); n != 1 {
+		t.Fatalf("Publish with full buffer = %d, want 1", n)
+	}
+
+	<-slow.C()
+	if _, ok := <-slow.C(); ok {
+		t.Fatal("slow subscriber channel must be closed")
+	}
+	if len(fast.C()) != 2 {
+		t.Fatalf("fast subscriber got %d messages, want 2", len(fast.C()))
+	}
+}
+
+// TestPatternGlob — шаблоны подписки в семантике Redis: '/' — обычный
+// символ, '\' экранирует спецсимволы.
+func TestPatternGlob(t *testing.T) {
+	bus := New()
+	sub := bus.NewSubscriber(8)
+	defer sub.Close()
+
+	sub.PSubscribe("events/*", "literal\\*")
+	if n := bus.Publish("events/user/42", "x"); n != 1 {
+		t.Fatalf("Publish(events/user/42) = %d, want 1", n)
+	}
+	if n := bus.Publish("literal*", "x"); n != 1 {
+		t.Fatalf("Publish(literal*) = %d, want 1", n)
+	}
+	if n := bus.Publish("literalX", "x"); n != 0 {
+		t.Fatalf("Publish(literalX) = %d, want 0", n)
+	}
+}
@@ -0,0 +1,28 @@
+package pubsub
+
+import "sync"
+
+// Message — сообщение, доставленное подписчику.
+type Message struct {
+	Channel string
+	Pattern string // шаблон PSUBSCRIBE, по которому пришло сообщение (иначе пусто)
+	Payload string
+}
+
+// Bus — шина pub/sub. Общая для TCP-клиентов и встроенных подписчиков.
+type Bus struct {
+	mu       sync.RWMutex
+	channels map[string]map[*Subscriber]struct{}
+	patterns map[string]map[*Subscriber]struct{}
+}
+
+// Subscriber — набор подписок одного получателя с собственным буфером.
+type Subscriber struct {
+	bus *Bus
+	ch  chan Message
+
+	mu       sync.Mutex
+	channels map[string]struct{}
+	patterns map[string]struct{}
+	closed   bool
+}
@@ -2,9 +2,13 @@ package server
 
 import (
 	"bufio"
+	"context"
 	"net"
 	"time"
 	"strings"
+	"sync"
+
+	storage "imcs/internal/storage/cache"
 )
 
 // handleConnection обрабатывает одно клиентское соединение (RESP).
@@ -14,11 +18,43 @@ func (s *Server) handleConnection(conn net.Conn) {
 	reader := bufio.NewReaderSize(conn, 64*1024)
 	writer := bufio.NewWriterSize(conn, 64*1024)
 
+	// Контекст соединения: отменяется при закрытии соединения или Shutdown,
+	// будит заблокированные BLPOP/BRPOP/BLMOVE
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-s.stopCh:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
 	authenticated := s.password == "" // если пароля нет — сразу авторизован
 
+	// Ответы пишутся под mu: в режиме подписки в тот же writer
+	// пишет горутина доставки сообщений
+	var mu sync.Mutex
+	reply := func(resp []byte) {
+		mu.Lock()
+		writer.Write(resp)
+		writer.Flush()
+		mu.Unlock()
+	}
+
+	ps := &subscription{bus: s.bus, conn: conn, writer: writer, mu: &mu}
+	defer ps.close()
+
+	tx := &transaction{}
+	defer s.resetTransaction(tx)
+
 	for {
-		// Idle timeout: 300 секунд
-		conn.SetReadDeadline(time.Now().Add(300 * time.Second))
+		// Idle timeout: 300 секунд. Подписчик может молчать сколько угодно
+		if ps.active() {
+			conn.SetReadDeadline(time.Time{})
+		} else {
+			conn.SetReadDeadline(time.Now().Add(300 * time.Second))
+		}
 
 		args, err := readRESPCommand(reader)
 		if err != nil {
@@ -35,34 +71,110 @@ func (s *Server) handleConnection(conn net.Conn) {
 		// AUTH и QUIT доступны до авторизации
 		if cmd == "AUTH" {
 			if s.password == "" {
-				writer.Write(respErrorMsg("Client sent AUTH, but no password is set"))
+				reply(respErrorMsg("Client sent AUTH, but no password is set"))
 			} else if len(cmdArgs) != 1 {
-				writer.Write(respErrorMsg("wrong number of arguments for 'auth' command"))
+				reply(respErrorMsg("wrong number of arguments for 'auth' command"))
 			} else if cmdArgs[0] == s.password {
 				authenticated = true
-				writer.Write(respOK())
+				reply(respOK())
 			} else {
-				writer.Write(respErrorMsg("WRONGPASS invalid password"))
+				reply(respErrorMsg("WRONGPASS invalid password"))
 			}
-			writer.Flush()
 			continue
 		}
 
 		if cmd == "QUIT" {
-			writer.Write(respOK())
-			writer.Flush()
+			reply(respOK())
 			return
 		}
 
 		// Проверяем авторизацию
 		if !authenticated {
-			writer.Write(respErrorMsg("NOAUTH Authentication required"))
+			reply(respErrorMsg("NOAUTH Authentication required"))
+			continue
+		}
+
+		// В режиме подписки доступны только команды pub/sub
+		if ps.active() && !subscriberCommands[cmd] {
+			reply(respErrorMsg("Can't execute '" + strings.ToLower(cmd) +
+				"': only (P|S)SUBSCRIBE / (P|S)UNSUBSCRIBE / PING / QUIT / RESET are allowed in this context"))
+			continue
+		}
+
+		// Скрипт выполняется дольше лимита: его можно только прервать
+		if cmd == "SCRIPT" && len(cmdArgs) == 1 && strings.EqualFold(cmdArgs[0], "KILL") {
+			reply(s.scripts.kill())
+			continue
+		}
+		if s.scripts.busy() {
+			reply(busyReply)
+			continue
+		}
+
+		// MULTI ... EXEC: команды копятся в очереди соединения
+		if cmd == "RESET" {
+			s.resetTransaction(tx)
+		}
+		if transactionCommands[cmd] {
+			reply(s.executeTransaction(tx, cmd, cmdArgs))
+			continue
+		}
+		if tx.active && cmd != "RESET" {
+			reply(tx.enqueue(cmd, cmdArgs))
+			continue
+		}
+
+		if subscriptionCommands[cmd] || cmd == "PING" && ps.active() {
+			// Ответ пишется под тем же mu, что и выполнение: сообщения
+			// не обгонят подтверждение подписки
+			mu.Lock()
+			writer.Write(ps.execute(cmd, cmdArgs))
 			writer.Flush()
+			mu.Unlock()
 			continue
 		}
 
-		resp := s.executeCommand(cmd, cmdArgs)
-		writer.Write(resp)
-		writer.Flush()
+		var resp []byte
+		if blockingCommands[cmd] {
+			// Блокируется только эта горутина; пока ждём — следим,
+			// не закрыл ли клиент соединение
+			stopWatch := watchDisconnect(conn, reader, cancel)
+			resp = s.executeBlocking(ctx, cmd, cmdArgs)
+			stopWatch()
+			if ctx.Err() != nil {
+				return
+			}
+		} else if scriptCommands[cmd] {
+			// Скрипт выполняется целиком, пока остальные клиенты ждут
+			// Сбой AOF, как у EXEC, — в логе и INFO, ответ скрипта не теряется
+			s.cache.Exec(nil, func(c *storage.Cache) { resp = s.withCache(c).executeCommand(cmd, cmdArgs) })
+		} else {
+			// Под Shared: не выполняется одновременно с чужим EXEC
+			s.cache.Shared(func() { resp = s.executeCommand(cmd, cmdArgs) })
+		}
+		reply(resp)
+	}
+}
+
+// watchDisconnect отменяет ctx, если клиент закрыл соединение, пока команда
+// заблокирована. stop останавливает наблюдение и возвращает reader в цикл.
+func watchDisconnect(conn net.Conn, reader *bufio.Reader, cancel context.CancelFunc) (stop func()) {
+	conn.SetReadDeadline(time.Time{})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// Peek не потребляет данные: конвейерные команды останутся в буфере
+		if _, err := reader.Peek(1); err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				return // разбудили через stop
+			}
+			cancel()
+		}
+	}()
+
+	return func() {
+		conn.SetReadDeadline(time.Now()) // прерываем Peek
+		<-done
 	}
 }
@@ -1,6 +1,9 @@
 package server
 
-import storage "imcs/internal/storage/cache"
+import (
+	"imcs/internal/pubsub"
+	storage "imcs/internal/storage/cache"
+)
 
 
 
@@ -9,12 +12,18 @@ import storage "imcs/internal/storage/cache"
 
 func New(addr string, cache *storage.Cache, opts ...Option) *Server {
 	s := &Server{
-		addr:   addr,
-		cache:  cache,
-		stopCh: make(chan struct{}),
+		addr:    addr,
+		cache:   cache,
+		scripts: newScriptEngine(defaultScriptTimeLimit),
+		stopCh:  make(chan struct{}),
 	}
+	s.memoryConfig()
+	s.coldConfig()
 	for _, opt := range opts {
 		opt(s)
 	}
+	if s.bus == nil {
+		s.bus = pubsub.New()
+	}
 	return s
 }
\ No newline at end of file
@@ -38,6 +38,100 @@ func (s *Server) executeCommand(cmd string, args []string) []byte {
 	case "STRLEN":
 		return s.cmdSTRLEN(args)
 
+	// === Hash Commands ===
+	case "HSET", "HMSET":
+		return s.cmdHSET(cmd, args)
+	case "HSETNX":
+		return s.cmdHSETNX(args)
+	case "HGET":
+		return s.cmdHGET(args)
+	case "HMGET":
+		return s.cmdHMGET(args)
+	case "HGETALL":
+		return s.cmdHGETALL(args)
+	case "HDEL":
+		return s.cmdHDEL(args)
+	case "HEXISTS":
+		return s.cmdHEXISTS(args)
+	case "HLEN":
+		return s.cmdHLEN(args)
+	case "HKEYS":
+		return s.cmdHKEYS(args, false)
+	case "HVALS":
+		return s.cmdHKEYS(args, true)
+	case "HINCRBY":
+		return s.cmdHINCRBY(args)
+
+	// === List Commands ===
+	case "LPUSH":
+		return s.cmdPUSH(args, true)
+	case "RPUSH":
+		return s.cmdPUSH(args, false)
+	case "LPOP":
+		return s.cmdPOP(args, true)
+	case "RPOP":
+		return s.cmdPOP(args, false)
+	case "LRANGE":
+		return s.cmdLRANGE(args)
+	case "LLEN":
+		return s.cmdLLEN(args)
+	case "LINDEX":
+		return s.cmdLINDEX(args)
+	case "LSET":
+		return s.cmdLSET(args)
+	case "LREM":
+		return s.cmdLREM(args)
+	case "LTRIM":
+		return s.cmdLTRIM(args)
+	case "LMOVE":
+		return s.cmdLMOVE(args)
+	case "BLPOP", "BRPOP", "BLMOVE":
+		return s.executeBlocking(noWait, cmd, args)
+
+	// === Set Commands ===
+	case "SADD":
+		return s.cmdSADD(args, true)
+	case "SREM":
+		return s.cmdSADD(args, false)
+	case "SISMEMBER":
+		return s.cmdSISMEMBER(args)
+	case "SMISMEMBER":
+		return s.cmdSMISMEMBER(args)
+	case "SMEMBERS":
+		return s.cmdSMEMBERS(args)
+	case "SCARD":
+		return s.cmdSCARD(args)
+	case "SPOP":
+		return s.cmdSPOP(args)
+	case "SRANDMEMBER":
+		return s.cmdSRANDMEMBER(args)
+	case "SINTER", "SUNION", "SDIFF":
+		return s.cmdSETOP(cmd, args)
+	case "SINTERSTORE", "SUNIONSTORE", "SDIFFSTORE":
+		return s.cmdSETOPSTORE(cmd, args)
+
+	// === Sorted Set Commands ===
+	case "ZADD":
+		return s.cmdZADD(args)
+	case "ZINCRBY":
+		return s.cmdZINCRBY(args)
+	case "ZREM":
+		return s.cmdZREM(args)
+	case "ZSCORE":
+		return s.cmdZSCORE(args)
+	case "ZCARD":
+		return s.cmdZCARD(args)
+	case "ZRANK", "ZREVRANK":
+		return s.cmdZRANK(cmd, args)
+	case "ZRANGE", "ZREVRANGE", "ZRANGEBYSCORE", "ZREVRANGEBYSCORE", "ZRANGEBYLEX", "ZREVRANGEBYLEX":
+		return s.cmdZRANGE(cmd, args)
+	case "ZCOUNT", "ZREMRANGEBYSCORE":
+		return s.cmdZCOUNT(cmd, args)
+	case "ZPOPMIN", "ZPOPMAX":
+		return s.cmdZPOP(cmd, args)
+	case "ZUNIONSTORE", "ZINTERSTORE":
+		return s.cmdZSTORE(cmd, args)
+
 	// === Key Commands ===
 	case "EXISTS":
 		return s.cmdEXISTS(args)
@@ -57,6 +151,28 @@ func (s *Server) executeCommand(cmd string, args []string) []byte {
 		return s.cmdRENAME(args)
 	case "KEYS":
 		return s.cmdKEYS(args)
+	case "DUMP":
+		return s.cmdDUMP(args)
+	case "RESTORE":
+		return s.cmdRESTORE(args)
+	case "OBJECT":
+		return s.cmdOBJECT(args)
+	case "SCAN":
+		return s.cmdSCAN(args)
+	case "HSCAN", "SSCAN", "ZSCAN":
+		return s.cmdXSCAN(cmd, args)
+
+	// === Pub/Sub Commands ===
+	case "PUBLISH":
+		return s.cmdPUBLISH(args)
+	case "PUBSUB":
+		return s.cmdPUBSUB(args)
+
+	// === Scripting Commands ===
+	case "EVAL", "EVALSHA":
+		return s.cmdEVAL(cmd, args)
+	case "SCRIPT":
+		return s.cmdSCRIPT(args)
 
 	// === Server Commands ===
 	case "PING":
@@ -66,7 +182,9 @@ func (s *Server) executeCommand(cmd string, args []string) []byte {
 	case "DBSIZE":
 		return respInt(s.cache.CountKeys())
 	case "FLUSHDB", "FLUSHALL":
-		s.cache.FlushDB()
+		if err := s.cache.FlushDB(); err != nil {
+			return respErr(err)
+		}
 		return respOK()
 	case "INFO":
 		return s.cmdINFO()
@@ -76,8 +194,20 @@ func (s *Server) executeCommand(cmd string, args []string) []byte {
 		return respOK()
 	case "CONFIG":
 		return s.cmdCONFIG(args)
+	case "BGREWRITEAOF":
+		return s.cmdBGREWRITEAOF()
+	case "SAVE":
+		return s.cmdSAVE()
+	case "BGSAVE":
+		return s.cmdBGSAVE()
+	case "LASTSAVE":
+		return s.cmdLASTSAVE()
 	case "CLIENT":
 		return respOK()
+	case "SYNC":
+		return s.cmdSYNC()
+	case "REPLCONF":
+		return respOK() // redis-cli --rdb шлёт REPLCONF rdb-only перед SYNC
 
 	default:
 		return respErrorMsg("unknown command '" + cmd + "'")
@@ -135,12 +265,10 @@ func (s *Server) cmdSET(args []string) []byte {
 		}
 	}
 
-	if nx {
-		if err := s.cache.Set(key, value, ttl, true); err == storage.ErrKeyExist {
-			return respNilBulk()
-		}
-	} else {
-		s.cache.Set(key, value, ttl, false)
+	if err := s.cache.Set(key, value, ttl, nx); err == storage.ErrKeyExist {
+		return respNilBulk()
+	} else if err != nil {
+		return respErr(err)
 	}
 
 	return respOK()
@@ -153,6 +281,9 @@ func (s *Server) cmdGET(args []string) []byte {
 
 	value, found := s.cache.Get(args[0])
 	if !found {
+		if s.cache.Type(args[0]) != "none" {
+			return respErr(storage.ErrWrongType)
+		}
 		return respNilBulk()
 	}
 
@@ -165,12 +296,18 @@ func (s *Server) cmdDEL(args []string) []byte {
 	}
 
 	deleted := 0
+	var werr error
 	for _, key := range args {
 		if s.cache.Exists(key) > 0 {
-			s.cache.Delete(key)
+			if err := s.cache.Delete(key); err != nil {
+				werr = err
+			}
 			deleted++
 		}
 	}
+	if werr != nil {
+		return respErr(werr)
+	}
 
 	return respInt(int64(deleted))
 }
@@ -181,6 +318,8 @@ func (s *Server) cmdSETNX(args []string) []byte {
 	}
 	if err := s.cache.Set(args[0], args[1], 0, true); err == storage.ErrKeyExist {
 		return respInt(0)
+	} else if err != nil {
+		return respErr(err)
 	}
 	return respInt(1)
 }
@@ -193,7 +332,9 @@ func (s *Server) cmdSETEX(args []string) []byte {
 	if err != nil || secs <= 0 {
 		return respErrorMsg("invalid expire time in 'setex' command")
 	}
-	s.cache.Set(args[0], args[2], time.Duration(secs)*time.Second, false)
+	if err := s.cache.Set(args[0], args[2], time.Duration(secs)*time.Second, false); err != nil {
+		return respErr(err)
+	}
 	return respOK()
 }
 
@@ -209,7 +350,9 @@ func (s *Server) cmdMSET(args []string) []byte {
 	if len(args) < 2 || len(args)%2 != 0 {
 		return respErrorMsg("wrong number of arguments for 'mset' command")
 	}
-	s.cache.MSet(args...)
+	if err := s.cache.MSet(args...); err != nil {
+		return respErr(err)
+	}
 	return respOK()
 }
 
@@ -217,11 +360,7 @@ func (s *Server) cmdINCR(args []string, delta int64) []byte {
 	if len(args) != 1 {
 		return respErrorMsg("wrong number of arguments for 'incr' command")
 	}
-	result, err := s.cache.IncrBy(args[0], delta)
-	if err != nil {
-		return respErrorMsg("value is not an integer or out of range")
-	}
-	return respInt(result)
+	return incrReply(s.cache.IncrBy(args[0], delta))
 }
 
 func (s *Server) cmdINCRBY(args []string, negate bool) []byte {
@@ -235,7 +374,15 @@ func (s *Server) cmdINCRBY(args []string, negate bool) []byte {
 	if negate {
 		delta = -delta
 	}
-	result, err := s.cache.IncrBy(args[0], delta)
+	return incrReply(s.cache.IncrBy(args[0], delta))
+}
+
+// incrReply — ответ INCR/INCRBY: ошибки значения — «not an integer»,
+// остальные (WRONGTYPE, OOM, сбой AOF) — как есть.
+func incrReply(result int64, err error) []byte {
+	if err == storage.ErrWrongType || err == storage.ErrOOM || isWriteError(err) {
+		return respErr(err)
+	}
 	if err != nil {
 		return respErrorMsg("value is not an integer or out of range")
 	}
@@ -246,7 +393,10 @@ func (s *Server) cmdAPPEND(args []string) []byte {
 	if len(args) != 2 {
 		return respErrorMsg("wrong number of arguments for 'append' command")
 	}
-	length := s.cache.Append(args[0], args[1])
+	length, err := s.cache.Append(args[0], args[1])
+	if err != nil {
+		return respErr(err)
+	}
 	return respInt(int64(length))
 }
 
@@ -254,7 +404,11 @@ func (s *Server) cmdSTRLEN(args []string) []byte {
 	if len(args) != 1 {
 		return respErrorMsg("wrong number of arguments for 'strlen' command")
 	}
-	return respInt(int64(s.cache.Strlen(args[0])))
+	length, err := s.cache.Strlen(args[0])
+	if err != nil {
+		return respErr(err)
+	}
+	return respInt(int64(length))
 }
 
 // === Key Commands ===
@@ -280,7 +434,9 @@ func (s *Server) cmdEXPIRE(args []string, isMs bool) []byte {
 	} else {
 		ttl = time.Duration(n) * time.Second
 	}
-	if s.cache.Expire(args[0], ttl) {
+	if ok, err := s.cache.Expire(args[0], ttl); err != nil {
+		return respErr(err)
+	} else if ok {
 		return respInt(1)
 	}
 	return respInt(0)
@@ -290,7 +446,9 @@ func (s *Server) cmdPERSIST(args []string) []byte {
 	if len(args) != 1 {
 		return respErrorMsg("wrong number of arguments for 'persist' command")
 	}
-	if s.cache.Persist(args[0]) {
+	if ok, err := s.cache.Persist(args[0]); err != nil {
+		return respErr(err)
+	} else if ok {
 		return respInt(1)
 	}
 	return respInt(0)
@@ -307,7 +465,9 @@ func (s *Server) cmdRENAME(args []string) []byte {
 	if len(args) != 2 {
 		return respErrorMsg("wrong number of arguments for 'rename' command")
 	}
-	if !s.cache.Rename(args[0], args[1]) {
+	if ok, err := s.cache.Rename(args[0], args[1]); err != nil {
+		return respErr(err)
+	} else if !ok {
 		return respErrorMsg("no such key")
 	}
 	return respOK()
@@ -344,15 +504,11 @@ func (s *Server) cmdINFO() []byte {
 		"resp_protocol:2\r\n" +
 		"tcp_port:" + strings.TrimPrefix(s.addr, ":") + "\r\n" +
 		"# Clients\r\n" +
+		s.infoMemory() +
+		s.infoPersistence() +
+		s.infoStats() +
+		s.infoCold() +
 		"# Keyspace\r\n" +
 		"db0:keys=" + strconv.FormatInt(keys, 10) + ",expires=0\r\n"
 	return respBulk(info)
 }
-
-func (s *Server) cmdCONFIG(args []string) []byte {
-	if len(args) >= 1 && strings.ToUpper(args[0]) == "SET" {
-		return respOK()
-	}
-	// CONFIG GET — вернём пустой array
-	return respArrayStrings(nil)
-}
@@ -0,0 +1,131 @@
+package server
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	storage "imcs/internal/storage/cache"
+)
+
+// === Cold Storage ===
+
+// coldConfig регистрирует параметры CONFIG политики cold storage:
+// cold-idle-time, cold-interval, cold-flush-interval (секунды),
+// cold-samples, cold-max-size, cold-min-value-size (байты, как maxmemory)
+// и cold-allow, cold-deny (glob-шаблоны через пробел).
+func (s *Server) coldConfig() {
+	s.coldParam("cold-idle-time", func(p storage.ColdPolicy) string {
+		return formatSeconds(p.IdleTime)
+	}, func(p *storage.ColdPolicy, value string) error {
+		d, err := parseSeconds(value, 0)
+		p.IdleTime = d
+		return err
+	})
+
+	s.coldParam("cold-interval", func(p storage.ColdPolicy) string {
+		return formatSeconds(p.Interval)
+	}, func(p *storage.ColdPolicy, value string) error {
+		d, err := parseSeconds(value, 1)
+		p.Interval = d
+		return err
+	})
+
+	s.coldParam("cold-flush-interval", func(p storage.ColdPolicy) string {
+		return formatSeconds(p.FlushInterval)
+	}, func(p *storage.ColdPolicy, value string) error {
+		d, err := parseSeconds(value, 1)
+		p.FlushInterval = d
+		return err
+	})
+
+	s.coldParam("cold-samples", func(p storage.ColdPolicy) string {
+		return strconv.Itoa(p.Samples)
+	}, func(p *storage.ColdPolicy, value string) error {
+		samples, err := strconv.Atoi(value)
+		if err != nil || samples <= 0 {
+			return errors.New("argument must be a positive integer")
+		}
+		p.Samples = samples
+		return nil
+	})
+
+	s.coldParam("cold-max-size", func(p storage.ColdPolicy) string {
+		return strconv.FormatInt(p.MaxSize, 10)
+	}, func(p *storage.ColdPolicy, value string) error {
+		size, err := ParseMemory(value)
+		p.MaxSize = size
+		return err
+	})
+
+	s.coldParam("cold-min-value-size", func(p storage.ColdPolicy) string {
+		return strconv.Itoa(p.MinValueSize)
+	}, func(p *storage.ColdPolicy, value string) error {
+		size, err := ParseMemory(value)
+		if err == nil && size > math.MaxInt32 {
+			err = errors.New("argument must be a memory value")
+		}
+		p.MinValueSize = int(size)
+		return err
+	})
+
+	s.coldParam("cold-allow", func(p storage.ColdPolicy) string {
+		return strings.Join(p.Allow, " ")
+	}, func(p *storage.ColdPolicy, value string) error {
+		p.Allow = strings.Fields(value)
+		return nil
+	})
+
+	s.coldParam("cold-deny", func(p storage.ColdPolicy) string {
+		return strings.Join(p.Deny, " ")
+	}, func(p *storage.ColdPolicy, value string) error {
+		p.Deny = strings.Fields(value)
+		return nil
+	})
+}
+
+// coldParam регистрирует параметр CONFIG поля политики cold storage.
+// Ошибка set оставляет политику прежней.
+func (s *Server) coldParam(name string, get func(p storage.ColdPolicy) string, set func(p *storage.ColdPolicy, value string) error) {
+	WithConfig(name, func() string {
+		return get(s.cache.ColdPolicy())
+	}, func(value string) error {
+		var err error
+		s.cache.UpdateColdPolicy(func(p *storage.ColdPolicy) {
+			saved := *p
+			if err = set(p, value); err != nil {
+				*p = saved
+			}
+		})
+		return err
+	})(s)
+}
+
+// parseSeconds разбирает целое число секунд не меньше minimum.
+func parseSeconds(value string, minimum int64) (time.Duration, error) {
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < minimum || n > math.MaxInt64/int64(time.Second) {
+		if minimum > 0 {
+			return 0, errors.New("argument must be a positive integer")
+		}
+		return 0, errors.New("argument must be a non-negative integer")
+	}
+	return time.Duration(n) * time.Second, nil
+}
+
+func formatSeconds(d time.Duration) string {
+	return strconv.FormatInt(int64(d/time.Second), 10)
+}
+
+// infoCold — секция Cold для INFO: ключи и объём на диске, сколько ключей
+// выгружено и поднято обратно с запуска.
+func (s *Server) infoCold() string {
+	stats := s.cache.ColdStats()
+	return "# Cold\r\n" +
+		"cold_keys:" + strconv.Itoa(stats.Keys) + "\r\n" +
+		"cold_size:" + strconv.FormatInt(stats.Size, 10) + "\r\n" +
+		"cold_demoted_keys:" + strconv.FormatInt(stats.Demoted, 10) + "\r\n" +
+		"cold_promoted_keys:" + strconv.FormatInt(stats.Promoted, 10) + "\r\n"
+}
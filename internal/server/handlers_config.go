@@ -0,0 +1,73 @@
+package server
+
+import (
+	"sort"
+	"strings"
+
+	storage "imcs/internal/storage/cache"
+)
+
+// === Config Commands ===
+
+// configParam — параметр, доступный через CONFIG GET/SET.
+type configParam struct {
+	get func() string
+	set func(value string) error
+}
+
+// WithConfig регистрирует параметр name для CONFIG GET/SET. Ошибка set
+// возвращается клиенту, значение при этом не меняется.
+func WithConfig(name string, get func() string, set func(value string) error) Option {
+	return func(s *Server) {
+		if s.config == nil {
+			s.config = make(map[string]configParam)
+		}
+		s.config[strings.ToLower(name)] = configParam{get: get, set: set}
+	}
+}
+
+// cmdCONFIG выполняет CONFIG GET pattern и CONFIG SET name value [name value ...].
+// Незарегистрированные параметры CONFIG SET принимает молча — клиентские
+// библиотеки выставляют их при подключении.
+func (s *Server) cmdCONFIG(args []string) []byte {
+	if len(args) == 0 {
+		return respErrorMsg("wrong number of arguments for 'config' command")
+	}
+
+	switch strings.ToUpper(args[0]) {
+	case "GET":
+		if len(args) != 2 {
+			return respErrorMsg("wrong number of arguments for 'config|get' command")
+		}
+		pattern := strings.ToLower(args[1])
+		names := make([]string, 0, len(s.config))
+		for name := range s.config {
+			if storage.StringMatch(pattern, name) {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		pairs := make([]string, 0, len(names)*2)
+		for _, name := range names {
+			pairs = append(pairs, name, s.config[name].get())
+		}
+		return respArrayStrings(pairs)
+
+	case "SET":
+		if len(args) < 3 || len(args)%2 != 1 {
+			return respErrorMsg("wrong number of arguments for 'config|set' command")
+		}
+		for i := 1; i < len(args); i += 2 {
+			param, ok := s.config[strings.ToLower(args[i])]
+			if !ok {
+				continue
+			}
+			if err := param.set(args[i+1]); err != nil {
+				return respErrorMsg("CONFIG SET failed (possibly related to argument '" + args[i] + "') - " + err.Error())
+			}
+		}
+		return respOK()
+	}
+
+	return respOK() // RESETSTAT, REWRITE — заглушки
+}
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"imcs/internal/persistence/RDB"
+	storage "imcs/internal/storage/cache"
+)
+
+// === DUMP/RESTORE и выгрузка RDB ===
+// Payload — как у Redis (значение в кодировке RDB, версия, CRC64):
+// ключи переносятся между IMCS и Redis в обе стороны.
+
+// cmdDUMP — DUMP key: сериализованное значение или nil.
+func (s *Server) cmdDUMP(args []string) []byte {
+	if len(args) != 1 {
+		return respErrorMsg("wrong number of arguments for 'dump' command")
+	}
+	v, ok := s.cache.Dump(args[0])
+	if !ok {
+		return respNilBulk()
+	}
+	return respBulk(string(RDB.Dump(v)))
+}
+
+// cmdRESTORE — RESTORE key ttl payload [REPLACE] [ABSTTL] [IDLETIME s] [FREQ f].
+// ttl в миллисекундах, 0 — без TTL; с ABSTTL — unix-время в миллисекундах.
+func (s *Server) cmdRESTORE(args []string) []byte {
+	if len(args) < 3 {
+		return respErrorMsg("wrong number of arguments for 'restore' command")
+	}
+	ttl, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return respErrorMsg("value is not an integer or out of range")
+	}
+	if ttl < 0 || ttl > math.MaxInt64/int64(time.Millisecond) {
+		return respErrorMsg("Invalid TTL value, must be >= 0")
+	}
+
+	var replace, absTTL bool
+	freq := -1
+	for i := 3; i < len(args); i++ {
+		switch opt := strings.ToUpper(args[i]); opt {
+		case "REPLACE":
+			replace = true
+		case "ABSTTL":
+			absTTL = true
+		case "IDLETIME", "FREQ":
+			// Подсказки LRU/LFU: IDLETIME только проверяется (время
+			// обращения IMCS ведёт сама), FREQ становится LFU-счётчиком
+			if i+1 >= len(args) {
+				return respErrorMsg("syntax error")
+			}
+			i++
+			n, err := strconv.ParseInt(args[i], 10, 64)
+			if err != nil {
+				return respErrorMsg("value is not an integer or out of range")
+			}
+			if opt == "IDLETIME" && n < 0 {
+				return respErrorMsg("Invalid IDLETIME value, must be >= 0")
+			}
+			if opt == "FREQ" && (n < 0 || n > 255) {
+				return respErrorMsg("Invalid FREQ value, must be >= 0 and <= 255")
+			}
+			if opt == "FREQ" {
+				freq = int(n)
+			}
+		default:
+			return respErrorMsg("syntax error")
+		}
+	}
+
+	v, err := RDB.Undump([]byte(args[2]))
+	if errors.Is(err, RDB.ErrDumpPayload) {
+		return respErrorMsg(err.Error())
+	} else if err != nil {
+		return respErrorMsg("Bad data format")
+	}
+
+	var expireAt int64
+	switch {
+	case ttl > 0 && absTTL:
+		expireAt = ttl * int64(time.Millisecond)
+	case ttl > 0:
+		expireAt = time.Now().UnixNano() + ttl*int64(time.Millisecond)
+	}
+	if err := s.cache.Restore(args[0], v, expireAt, replace); errors.Is(err, storage.ErrKeyExist) {
+		return []byte("-BUSYKEY Target key name already exists.\r\n")
+	} else if err != nil {
+		return respErr(err)
+	}
+	if freq >= 0 {
+		s.cache.SetFreq(args[0], freq)
+	}
+	return respOK()
+}
+
+// cmdSYNC отдаёт снимок в RDB так, как мастер Redis отдаёт его реплике
+// при полной синхронизации: $<длина>\r\n и файл без завершающего \r\n.
+// Потока команд после снимка нет — этого хватает redis-cli --rdb и
+// похожим утилитам. Команда уже выполняется под gate кеша, поэтому
+// снимок берётся через ExportShared.
+func (s *Server) cmdSYNC() []byte {
+	var rdb bytes.Buffer
+	if _, err := RDB.Export(&rdb, s.cache.ExportShared); err != nil {
+		return respErrorMsg(err.Error())
+	}
+	resp := make([]byte, 0, rdb.Len()+16)
+	resp = append(resp, '$')
+	resp = strconv.AppendInt(resp, int64(rdb.Len()), 10)
+	resp = append(resp, '\r', '\n')
+	return append(resp, rdb.Bytes()...)
+}
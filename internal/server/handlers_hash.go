@@ -0,0 +1,150 @@
+package server
+
+import (
+	"strconv"
+	"strings"
+)
+
+// === Hash Commands ===
+
+func (s *Server) cmdHSET(cmd string, args []string) []byte {
+	if len(args) < 3 || len(args)%2 != 1 {
+		return respErrorMsg("wrong number of arguments for '" + strings.ToLower(cmd) + "' command")
+	}
+	added, err := s.cache.HSet(args[0], args[1:]...)
+	if err != nil {
+		return respErr(err)
+	}
+	// HMSET — устаревший вариант, отвечает OK
+	if cmd == "HMSET" {
+		return respOK()
+	}
+	return respInt(int64(added))
+}
+
+func (s *Server) cmdHSETNX(args []string) []byte {
+	if len(args) != 3 {
+		return respErrorMsg("wrong number of arguments for 'hsetnx' command")
+	}
+	ok, err := s.cache.HSetNX(args[0], args[1], args[2])
+	if err != nil {
+		return respErr(err)
+	}
+	if ok {
+		return respInt(1)
+	}
+	return respInt(0)
+}
+
+func (s *Server) cmdHGET(args []string) []byte {
+	if len(args) != 2 {
+		return respErrorMsg("wrong number of arguments for 'hget' command")
+	}
+	value, found, err := s.cache.HGet(args[0], args[1])
+	if err != nil {
+		return respErr(err)
+	}
+	if !found {
+		return respNilBulk()
+	}
+	return respBulk(value)
+}
+
+func (s *Server) cmdHMGET(args []string) []byte {
+	if len(args) < 2 {
+		return respErrorMsg("wrong number of arguments for 'hmget' command")
+	}
+	results, err := s.cache.HMGet(args[0], args[1:]...)
+	if err != nil {
+		return respErr(err)
+	}
+	return respArrayBulks(results)
+}
+
+func (s *Server) cmdHGETALL(args []string) []byte {
+	if len(args) != 1 {
+		return respErrorMsg("wrong number of arguments for 'hgetall' command")
+	}
+	hash, err := s.cache.HGetAll(args[0])
+	if err != nil {
+		return respErr(err)
+	}
+	flat := make([]string, 0, len(hash)*2)
+	for field, value := range hash {
+		flat = append(flat, field, value)
+	}
+	return respArrayStrings(flat)
+}
+
+func (s *Server) cmdHDEL(args []string) []byte {
+	if len(args) < 2 {
+		return respErrorMsg("wrong number of arguments for 'hdel' command")
+	}
+	removed, err := s.cache.HDel(args[0], args[1:]...)
+	if err != nil {
+		return respErr(err)
+	}
+	return respInt(int64(removed))
+}
+
+func (s *Server) cmdHEXISTS(args []string) []byte {
+	if len(args) != 2 {
+		return respErrorMsg("wrong number of arguments for 'hexists' command")
+	}
+	found, err := s.cache.HExists(args[0], args[1])
+	if err != nil {
+		return respErr(err)
+	}
+	if found {
+		return respInt(1)
+	}
+	return respInt(0)
+}
+
+func (s *Server) cmdHLEN(args []string) []byte {
+	if len(args) != 1 {
+		return respErrorMsg("wrong number of arguments for 'hlen' command")
+	}
+	n, err := s.cache.HLen(args[0])
+	if err != nil {
+		return respErr(err)
+	}
+	return respInt(int64(n))
+}
+
+func (s *Server) cmdHKEYS(args []string, values bool) []byte {
+	if len(args) != 1 {
+		if values {
+			return respErrorMsg("wrong number of arguments for 'hvals' command")
+		}
+		return respErrorMsg("wrong number of arguments for 'hkeys' command")
+	}
+	var (
+		items []string
+		err   error
+	)
+	if values {
+		items, err = s.cache.HVals(args[0])
+	} else {
+		items, err = s.cache.HKeys(args[0])
+	}
+	if err != nil {
+		return respErr(err)
+	}
+	return respArrayStrings(items)
+}
+
+func (s *Server) cmdHINCRBY(args []string) []byte {
+	if len(args) != 3 {
+		return respErrorMsg("wrong number of arguments for 'hincrby' command")
+	}
+	delta, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return respErrorMsg("value is not an integer or out of range")
+	}
+	result, err := s.cache.HIncrBy(args[0], args[1], delta)
+	if err != nil {
+		return respErr(err)
+	}
+	return respInt(result)
+}
@@ -0,0 +1,284 @@
+package server
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// blockingCommands — команды, которые могут ждать данных.
+// handleConnection выполняет их через executeBlocking.
+var blockingCommands = map[string]bool{
+	"BLPOP":  true,
+	"BRPOP":  true,
+	"BLMOVE": true,
+}
+
+// noWait — уже отменённый контекст: блокирующая команда делает одну
+// попытку и не ждёт (так они ведут себя вне обычного соединения).
+var noWait = func() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	return ctx
+}()
+
+// executeBlocking выполняет блокирующую команду с контекстом соединения.
+func (s *Server) executeBlocking(ctx context.Context, cmd string, args []string) []byte {
+	switch cmd {
+	case "BLPOP":
+		return s.cmdBPOP(ctx, args, true)
+	case "BRPOP":
+		return s.cmdBPOP(ctx, args, false)
+	case "BLMOVE":
+		return s.cmdBLMOVE(ctx, args)
+	}
+	return s.executeCommand(cmd, args)
+}
+
+// === List Commands ===
+
+func (s *Server) cmdPUSH(args []string, left bool) []byte {
+	if len(args) < 2 {
+		if left {
+			return respErrorMsg("wrong number of arguments for 'lpush' command")
+		}
+		return respErrorMsg("wrong number of arguments for 'rpush' command")
+	}
+	var (
+		n   int
+		err error
+	)
+	if left {
+		n, err = s.cache.LPush(args[0], args[1:]...)
+	} else {
+		n, err = s.cache.RPush(args[0], args[1:]...)
+	}
+	if err != nil {
+		return respErr(err)
+	}
+	return respInt(int64(n))
+}
+
+func (s *Server) cmdPOP(args []string, left bool) []byte {
+	if len(args) < 1 || len(args) > 2 {
+		if left {
+			return respErrorMsg("wrong number of arguments for 'lpop' command")
+		}
+		return respErrorMsg("wrong number of arguments for 'rpop' command")
+	}
+
+	count := 1
+	if len(args) == 2 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 0 {
+			return respErrorMsg("value is out of range, must be positive")
+		}
+		count = n
+	}
+
+	var (
+		values []string
+		err    error
+	)
+	if left {
+		values, err = s.cache.LPop(args[0], count)
+	} else {
+		values, err = s.cache.RPop(args[0], count)
+	}
+	if err != nil {
+		return respErr(err)
+	}
+
+	// Без count — одиночный bulk, с count — массив
+	if len(args) == 1 {
+		if len(values) == 0 {
+			return respNilBulk()
+		}
+		return respBulk(values[0])
+	}
+	if values == nil {
+		return respNilArray()
+	}
+	return respArrayStrings(values)
+}
+
+func (s *Server) cmdLRANGE(args []string) []byte {
+	if len(args) != 3 {
+		return respErrorMsg("wrong number of arguments for 'lrange' command")
+	}
+	start, err1 := strconv.Atoi(args[1])
+	stop, err2 := strconv.Atoi(args[2])
+	if err1 != nil || err2 != nil {
+		return respErrorMsg("value is not an integer or out of range")
+	}
+	values, err := s.cache.LRange(args[0], start, stop)
+	if err != nil {
+		return respErr(err)
+	}
+	return respArrayStrings(values)
+}
+
+func (s *Server) cmdLLEN(args []string) []byte {
+	if len(args) != 1 {
+		return respErrorMsg("wrong number of arguments for 'llen' command")
+	}
+	n, err := s.cache.LLen(args[0])
+	if err != nil {
+		return respErr(err)
+	}
+	return respInt(int64(n))
+}
+
+func (s *Server) cmdLINDEX(args []string) []byte {
+	if len(args) != 2 {
+		return respErrorMsg("wrong number of arguments for 'lindex' command")
+	}
+	index, err := strconv.Atoi(args[1])
+	if err != nil {
+		return respErrorMsg("value is not an integer or out of range")
+	}
+	value, found, err := s.cache.LIndex(args[0], index)
+	if err != nil {
+		return respErr(err)
+	}
+	if !found {
+		return respNilBulk()
+	}
+	return respBulk(value)
+}
+
+func (s *Server) cmdLSET(args []string) []byte {
+	if len(args) != 3 {
+		return respErrorMsg("wrong number of arguments for 'lset' command")
+	}
+	index, err := strconv.Atoi(args[1])
+	if err != nil {
+		return respErrorMsg("value is not an integer or out of range")
+	}
+	if err := s.cache.LSet(args[0], index, args[2]); err != nil {
+		return respErr(err)
+	}
+	return respOK()
+}
+
+func (s *Server) cmdLREM(args []string) []byte {
+	if len(args) != 3 {
+		return respErrorMsg("wrong number of arguments for 'lrem' command")
+	}
+	count, err := strconv.Atoi(args[1])
+	if err != nil {
+		return respErrorMsg("value is not an integer or out of range")
+	}
+	removed, err := s.cache.LRem(args[0], count, args[2])
+	if err != nil {
+		return respErr(err)
+	}
+	return respInt(int64(removed))
+}
+
+func (s *Server) cmdLTRIM(args []string) []byte {
+	if len(args) != 3 {
+		return respErrorMsg("wrong number of arguments for 'ltrim' command")
+	}
+	start, err1 := strconv.Atoi(args[1])
+	stop, err2 := strconv.Atoi(args[2])
+	if err1 != nil || err2 != nil {
+		return respErrorMsg("value is not an integer or out of range")
+	}
+	if err := s.cache.LTrim(args[0], start, stop); err != nil {
+		return respErr(err)
+	}
+	return respOK()
+}
+
+func (s *Server) cmdLMOVE(args []string) []byte {
+	if len(args) != 4 {
+		return respErrorMsg("wrong number of arguments for 'lmove' command")
+	}
+	fromLeft, ok1 := parseListEnd(args[2])
+	toLeft, ok2 := parseListEnd(args[3])
+	if !ok1 || !ok2 {
+		return respErrorMsg("syntax error")
+	}
+	value, moved, err := s.cache.LMove(args[0], args[1], fromLeft, toLeft)
+	if err != nil {
+		return respErr(err)
+	}
+	if !moved {
+		return respNilBulk()
+	}
+	return respBulk(value)
+}
+
+// cmdBPOP — BLPOP/BRPOP key [key ...] timeout
+func (s *Server) cmdBPOP(ctx context.Context, args []string, left bool) []byte {
+	if len(args) < 2 {
+		if left {
+			return respErrorMsg("wrong number of arguments for 'blpop' command")
+		}
+		return respErrorMsg("wrong number of arguments for 'brpop' command")
+	}
+	timeout, errResp := parseBlockTimeout(args[len(args)-1])
+	if errResp != nil {
+		return errResp
+	}
+
+	key, value, ok, err := s.cache.BPop(ctx, args[:len(args)-1], left, timeout)
+	if err != nil {
+		return respErr(err)
+	}
+	if !ok {
+		return respNilArray()
+	}
+	return respArrayStrings([]string{key, value})
+}
+
+// cmdBLMOVE — BLMOVE source destination LEFT|RIGHT LEFT|RIGHT timeout
+func (s *Server) cmdBLMOVE(ctx context.Context, args []string) []byte {
+	if len(args) != 5 {
+		return respErrorMsg("wrong number of arguments for 'blmove' command")
+	}
+	fromLeft, ok1 := parseListEnd(args[2])
+	toLeft, ok2 := parseListEnd(args[3])
+	if !ok1 || !ok2 {
+		return respErrorMsg("syntax error")
+	}
+	timeout, errResp := parseBlockTimeout(args[4])
+	if errResp != nil {
+		return errResp
+	}
+
+	value, moved, err := s.cache.BLMove(ctx, args[0], args[1], fromLeft, toLeft, timeout)
+	if err != nil {
+		return respErr(err)
+	}
+	if !moved {
+		return respNilBulk()
+	}
+	return respBulk(value)
+}
+
+// parseListEnd разбирает LEFT/RIGHT. Возвращает true для LEFT.
+func parseListEnd(arg string) (left bool, ok bool) {
+	switch strings.ToUpper(arg) {
+	case "LEFT":
+		return true, true
+	case "RIGHT":
+		return false, true
+	}
+	return false, false
+}
+
+// parseBlockTimeout разбирает таймаут блокирующей команды (секунды, дробные).
+func parseBlockTimeout(arg string) (time.Duration, []byte) {
+	secs, err := strconv.ParseFloat(arg, 64)
+	if err != nil || math.IsNaN(secs) || math.IsInf(secs, 0) {
+		return 0, respErrorMsg("timeout is not a float or out of range")
+	}
+	if secs < 0 {
+		return 0, respErrorMsg("timeout is negative")
+	}
+	return time.Duration(secs * float64(time.Second)), nil
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	storage "imcs/internal/storage/cache"
+)
+
+// === Memory ===
+
+// memoryConfig регистрирует параметры CONFIG maxmemory, maxmemory-policy,
+// maxmemory-samples, lfu-log-factor и lfu-decay-time. Их держит сам кеш, поэтому параметры
+// есть у любого сервера.
+func (s *Server) memoryConfig() {
+	WithConfig("maxmemory", func() string {
+		limit, _ := s.cache.MaxMemory()
+		return strconv.FormatInt(limit, 10)
+	}, func(value string) error {
+		limit, err := ParseMemory(value)
+		if err != nil {
+			return err
+		}
+		_, policy := s.cache.MaxMemory()
+		s.cache.SetMaxMemory(limit, policy)
+		// Новый лимит может быть меньше занятого — вытесняем сразу,
+		// а не на следующей записи. ErrOOM здесь не ошибка CONFIG SET.
+		s.cache.FreeMemory()
+		return nil
+	})(s)
+
+	WithConfig("maxmemory-policy", func() string {
+		_, policy := s.cache.MaxMemory()
+		return policy.String()
+	}, func(value string) error {
+		policy, err := storage.ParseEvictionPolicy(value)
+		if err != nil {
+			return err
+		}
+		limit, _ := s.cache.MaxMemory()
+		s.cache.SetMaxMemory(limit, policy)
+		return nil
+	})(s)
+
+	WithConfig("maxmemory-samples", func() string {
+		return strconv.Itoa(s.cache.EvictionSamples())
+	}, func(value string) error {
+		samples, err := strconv.Atoi(value)
+		if err != nil || samples <= 0 {
+			return errors.New("argument must be a positive integer")
+		}
+		s.cache.SetEvictionSamples(samples)
+		return nil
+	})(s)
+
+	WithConfig("lfu-log-factor", func() string {
+		logFactor, _ := s.cache.LFU()
+		return strconv.Itoa(logFactor)
+	}, func(value string) error {
+		logFactor, err := strconv.Atoi(value)
+		if err != nil || logFactor < 0 {
+			return errors.New("argument must be a non-negative integer")
+		}
+		_, decayTime := s.cache.LFU()
+		s.cache.SetLFU(logFactor, decayTime)
+		return nil
+	})(s)
+
+	WithConfig("lfu-decay-time", func() string {
+		_, decayTime := s.cache.LFU()
+		return strconv.Itoa(decayTime)
+	}, func(value string) error {
+		decayTime, err := strconv.Atoi(value)
+		if err != nil || decayTime < 0 {
+			return errors.New("argument must be a non-negative integer")
+		}
+		logFactor, _ := s.cache.LFU()
+		s.cache.SetLFU(logFactor, decayTime)
+		return nil
+	})(s)
+}
+
+// cmdOBJECT — OBJECT FREQ key: LFU-счётчик ключа (0–255) с учётом
+// затухания. Частота ведётся при любой политике вытеснения.
+func (s *Server) cmdOBJECT(args []string) []byte {
+	if len(args) == 0 {
+		return respErrorMsg("wrong number of arguments for 'object' command")
+	}
+	switch sub := strings.ToUpper(args[0]); sub {
+	case "FREQ":
+		if len(args) != 2 {
+			return respErrorMsg("wrong number of arguments for 'object|freq' command")
+		}
+		freq, ok := s.cache.Freq(args[1])
+		if !ok {
+			return respNilBulk()
+		}
+		return respInt(int64(freq))
+	case "HELP":
+		return respArrayStrings([]string{
+			"OBJECT <subcommand> [<arg> [value] [opt] ...]. Subcommands are:",
+			"FREQ <key>",
+			"    Return the access frequency index of the key <key>.",
+		})
+	default:
+		return respErrorMsg("unknown subcommand '" + args[0] + "'. Try OBJECT HELP.")
+	}
+}
+
+// infoMemory — секция Memory для INFO.
+func (s *Server) infoMemory() string {
+	limit, policy := s.cache.MaxMemory()
+	return "# Memory\r\n" +
+		"used_memory:" + strconv.FormatInt(s.cache.UsedMemory(), 10) + "\r\n" +
+		"maxmemory:" + strconv.FormatInt(limit, 10) + "\r\n" +
+		"maxmemory_policy:" + policy.String() + "\r\n"
+}
+
+// infoStats — секция Stats для INFO.
+func (s *Server) infoStats() string {
+	return "# Stats\r\n" +
+		"evicted_keys:" + strconv.FormatInt(s.cache.EvictedKeys(), 10) + "\r\n" +
+		"exec_write_errors:" + strconv.FormatInt(s.cache.ExecWriteErrors(), 10) + "\r\n"
+}
@@ -0,0 +1,196 @@
+package server
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"imcs/internal/persistence/AOF"
+)
+
+// === Persistence Commands ===
+
+// WithAOF подключает журнал: BGREWRITEAOF, SAVE/BGSAVE/LASTSAVE, секция
+// Persistence в INFO и параметры CONFIG appendfsync, save,
+// auto-aof-rewrite-percentage, auto-aof-rewrite-min-size.
+func WithAOF(p *AOF.AOFPersister) Option {
+	return func(s *Server) {
+		s.aof = p
+
+		WithConfig("appendfsync", func() string {
+			return p.FsyncPolicy().String()
+		}, func(value string) error {
+			policy, err := AOF.ParseFsyncPolicy(value)
+			if err == nil {
+				p.SetFsyncPolicy(policy)
+			}
+			return err
+		})(s)
+
+		WithConfig("save", func() string {
+			return AOF.FormatSaveRules(p.SaveRules())
+		}, func(value string) error {
+			rules, err := AOF.ParseSaveRules(value)
+			if err == nil {
+				p.SetSaveRules(rules)
+			}
+			return err
+		})(s)
+
+		WithConfig("auto-aof-rewrite-percentage", func() string {
+			percentage, _ := p.AutoRewrite()
+			return strconv.FormatInt(percentage, 10)
+		}, func(value string) error {
+			percentage, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || percentage < 0 {
+				return errors.New("argument must be a non-negative integer")
+			}
+			_, minSize := p.AutoRewrite()
+			p.SetAutoRewrite(percentage, minSize)
+			return nil
+		})(s)
+
+		WithConfig("auto-aof-rewrite-min-size", func() string {
+			_, minSize := p.AutoRewrite()
+			return strconv.FormatInt(minSize, 10)
+		}, func(value string) error {
+			minSize, err := ParseMemory(value)
+			if err != nil {
+				return err
+			}
+			percentage, _ := p.AutoRewrite()
+			p.SetAutoRewrite(percentage, minSize)
+			return nil
+		})(s)
+	}
+}
+
+// ParseMemory разбирает размер в формате конфига Redis: 1024, 64kb, 64mb,
+// 1gb (множитель 1024) или 64k, 64m, 1g (множитель 1000).
+func ParseMemory(value string) (int64, error) {
+	units := []struct {
+		suffix string
+		mul    int64
+	}{
+		{"kb", 1 << 10}, {"mb", 1 << 20}, {"gb", 1 << 30},
+		{"k", 1000}, {"m", 1000 * 1000}, {"g", 1000 * 1000 * 1000},
+		{"b", 1},
+	}
+
+	num, mul := strings.ToLower(value), int64(1)
+	for _, u := range units {
+		if strings.HasSuffix(num, u.suffix) {
+			num, mul = strings.TrimSuffix(num, u.suffix), u.mul
+			break
+		}
+	}
+	n, err := strconv.ParseInt(num, 10, 64)
+	if err != nil || n < 0 || n > (1<<63-1)/mul {
+		return 0, errors.New("argument must be a memory value")
+	}
+	return n * mul, nil
+}
+
+// cmdBGREWRITEAOF запускает rewrite журнала в фоне.
+func (s *Server) cmdBGREWRITEAOF() []byte {
+	if s.aof == nil {
+		return respErrorMsg("AOF is not enabled")
+	}
+	switch err := s.aof.BackgroundRewrite(); err {
+	case nil:
+		return respSimple("Background append only file rewriting started")
+	case AOF.ErrRewriteInProgress:
+		return respErrorMsg("Background append only file rewriting already in progress")
+	default:
+		return respErrorMsg(err.Error())
+	}
+}
+
+// cmdSAVE пишет снимок синхронно. Команда уже выполняется под gate кеша,
+// поэтому снимок берётся через SnapshotShared.
+func (s *Server) cmdSAVE() []byte {
+	if s.aof == nil {
+		return respErrorMsg("AOF is not enabled")
+	}
+	switch err := s.aof.Save(s.cache.SnapshotShared); err {
+	case nil:
+		return respOK()
+	case AOF.ErrSaveInProgress:
+		return respErrorMsg("Background save already in progress")
+	default:
+		return respErrorMsg(err.Error())
+	}
+}
+
+// cmdBGSAVE пишет снимок в фоне.
+func (s *Server) cmdBGSAVE() []byte {
+	if s.aof == nil {
+		return respErrorMsg("AOF is not enabled")
+	}
+	switch err := s.aof.BackgroundSave(); err {
+	case nil:
+		return respSimple("Background saving started")
+	case AOF.ErrSaveInProgress:
+		return respErrorMsg("Background save already in progress")
+	default:
+		return respErrorMsg(err.Error())
+	}
+}
+
+// cmdLASTSAVE — unix-время последнего успешного снимка.
+func (s *Server) cmdLASTSAVE() []byte {
+	if s.aof == nil {
+		return respErrorMsg("AOF is not enabled")
+	}
+	return respInt(s.aof.SaveStats().LastSave.Unix())
+}
+
+// infoPersistence — секция Persistence для INFO.
+func (s *Server) infoPersistence() string {
+	if s.aof == nil {
+		return "# Persistence\r\naof_enabled:0\r\n"
+	}
+
+	st, save := s.aof.RewriteStats(), s.aof.SaveStats()
+	seconds := func(d time.Duration) string {
+		if d < 0 {
+			return "-1"
+		}
+		return strconv.FormatInt(int64(d/time.Second), 10)
+	}
+	inProgress, current, status := "0", "-1", "ok"
+	if st.InProgress {
+		inProgress, current = "1", seconds(st.CurrentTime)
+	}
+	if st.LastErr != nil {
+		status = "err"
+	}
+	saveInProgress, saveCurrent, saveStatus := "0", "-1", "ok"
+	if save.InProgress {
+		saveInProgress, saveCurrent = "1", seconds(save.CurrentTime)
+	}
+	if save.LastErr != nil {
+		saveStatus = "err"
+	}
+	writeStatus := "ok"
+	if s.aof.WriteErr() != nil {
+		writeStatus = "err"
+	}
+
+	return "# Persistence\r\n" +
+		"rdb_changes_since_last_save:" + strconv.FormatInt(save.Changes, 10) + "\r\n" +
+		"rdb_bgsave_in_progress:" + saveInProgress + "\r\n" +
+		"rdb_last_save_time:" + strconv.FormatInt(save.LastSave.Unix(), 10) + "\r\n" +
+		"rdb_last_bgsave_status:" + saveStatus + "\r\n" +
+		"rdb_last_bgsave_time_sec:" + seconds(save.LastDuration) + "\r\n" +
+		"rdb_current_bgsave_time_sec:" + saveCurrent + "\r\n" +
+		"aof_enabled:1\r\n" +
+		"aof_rewrite_in_progress:" + inProgress + "\r\n" +
+		"aof_last_rewrite_time_sec:" + seconds(st.LastDuration) + "\r\n" +
+		"aof_current_rewrite_time_sec:" + current + "\r\n" +
+		"aof_last_bgrewrite_status:" + status + "\r\n" +
+		"aof_last_write_status:" + writeStatus + "\r\n" +
+		"aof_current_size:" + strconv.FormatInt(st.CurrentSize, 10) + "\r\n" +
+		"aof_base_size:" + strconv.FormatInt(st.BaseSize, 10) + "\r\n"
+}
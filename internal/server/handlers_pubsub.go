@@ -0,0 +1,217 @@
+package server
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"imcs/internal/pubsub"
+)
+
+// === Pub/Sub Commands ===
+
+// WithPubSub подключает внешнюю шину pub/sub — например, шину imcs.DB,
+// чтобы встроенные подписчики и TCP-клиенты делили одни каналы.
+func WithPubSub(bus *pubsub.Bus) Option {
+	return func(s *Server) {
+		s.bus = bus
+	}
+}
+
+const (
+	// subscriberBuffer — сколько сообщений может ждать отправки клиенту.
+	// Переполнение значит, что клиент не успевает читать: соединение закрывается.
+	subscriberBuffer = 4096
+
+	// subscriberWriteTimeout — сколько ждём клиента, не читающего сообщения.
+	subscriberWriteTimeout = 30 * time.Second
+)
+
+// subscriptionCommands — команды, меняющие pub/sub-состояние соединения.
+var subscriptionCommands = map[string]bool{
+	"SUBSCRIBE":    true,
+	"UNSUBSCRIBE":  true,
+	"PSUBSCRIBE":   true,
+	"PUNSUBSCRIBE": true,
+	"RESET":        true,
+}
+
+// subscriberCommands — всё, что разрешено клиенту с активными подписками
+// (QUIT обрабатывается раньше).
+var subscriberCommands = map[string]bool{
+	"SUBSCRIBE":    true,
+	"UNSUBSCRIBE":  true,
+	"PSUBSCRIBE":   true,
+	"PUNSUBSCRIBE": true,
+	"PING":         true,
+	"RESET":        true,
+}
+
+// subscription — pub/sub-состояние одного соединения.
+// Сообщения пишет отдельная горутина под тем же mu, что и ответы на команды,
+// поэтому подтверждение SUBSCRIBE всегда уходит раньше первого сообщения.
+type subscription struct {
+	bus     *pubsub.Bus
+	conn    net.Conn
+	writer  *bufio.Writer
+	mu      *sync.Mutex
+	sub     *pubsub.Subscriber // создаётся при первой подписке
+	closing atomic.Bool
+}
+
+// active — клиент в режиме подписки.
+func (c *subscription) active() bool {
+	return c.sub != nil && c.sub.Count() > 0
+}
+
+// execute выполняет SUBSCRIBE/UNSUBSCRIBE/PSUBSCRIBE/PUNSUBSCRIBE/RESET,
+// а в режиме подписки и PING. Вызывается под mu.
+func (c *subscription) execute(cmd string, args []string) []byte {
+	kind := strings.ToLower(cmd)
+
+	switch cmd {
+	case "SUBSCRIBE", "PSUBSCRIBE":
+		if len(args) == 0 {
+			return respErrorMsg("wrong number of arguments for '" + kind + "' command")
+		}
+		c.start()
+		var counts []int
+		if cmd == "SUBSCRIBE" {
+			counts = c.sub.Subscribe(args...)
+		} else {
+			counts = c.sub.PSubscribe(args...)
+		}
+		var buf []byte
+		for i, name := range args {
+			buf = append(buf, respSubscription(kind, name, counts[i])...)
+		}
+		return buf
+
+	case "UNSUBSCRIBE", "PUNSUBSCRIBE":
+		names, counts := args, make([]int, len(args))
+		if c.sub != nil {
+			if cmd == "UNSUBSCRIBE" {
+				names, counts = c.sub.Unsubscribe(args...)
+			} else {
+				names, counts = c.sub.PUnsubscribe(args...)
+			}
+		}
+		if len(names) == 0 {
+			// Отписка «от всего» без подписок — один ответ с nil вместо имени
+			buf := []byte("*3\r\n")
+			buf = append(buf, respBulk(kind)...)
+			buf = append(buf, respNilBulk()...)
+			return append(buf, respInt(int64(c.count()))...)
+		}
+		var buf []byte
+		for i, name := range names {
+			buf = append(buf, respSubscription(kind, name, counts[i])...)
+		}
+		return buf
+
+	case "PING":
+		if len(args) > 1 {
+			return respErrorMsg("wrong number of arguments for 'ping' command")
+		}
+		payload := ""
+		if len(args) == 1 {
+			payload = args[0]
+		}
+		return respArrayStrings([]string{"pong", payload})
+
+	case "RESET":
+		if c.sub != nil {
+			c.sub.Unsubscribe()
+			c.sub.PUnsubscribe()
+		}
+		return respSimple("RESET")
+	}
+	return respErrorMsg("unknown command '" + cmd + "'")
+}
+
+func (c *subscription) count() int {
+	if c.sub == nil {
+		return 0
+	}
+	return c.sub.Count()
+}
+
+// start создаёт подписчика и горутину доставки сообщений.
+func (c *subscription) start() {
+	if c.sub != nil {
+		return
+	}
+	c.sub = c.bus.NewSubscriber(subscriberBuffer)
+	go c.forward(c.sub.C())
+}
+
+// forward пишет сообщения клиенту, пока подписчик не закрыт.
+func (c *subscription) forward(ch <-chan pubsub.Message) {
+	for msg := range ch {
+		c.mu.Lock()
+		c.conn.SetWriteDeadline(time.Now().Add(subscriberWriteTimeout))
+		c.writer.Write(respMessage(msg))
+		err := c.writer.Flush()
+		c.conn.SetWriteDeadline(time.Time{})
+		c.mu.Unlock()
+
+		if err != nil {
+			c.conn.Close()
+			return
+		}
+	}
+	// Канал закрыт не нами — буфер переполнен, отключаем медленного клиента
+	if !c.closing.Load() {
+		c.conn.Close()
+	}
+}
+
+// close снимает все подписки соединения.
+func (c *subscription) close() {
+	c.closing.Store(true)
+	if c.sub != nil {
+		c.sub.Close()
+	}
+}
+
+// cmdPUBLISH — PUBLISH channel message
+func (s *Server) cmdPUBLISH(args []string) []byte {
+	if len(args) != 2 {
+		return respErrorMsg("wrong number of arguments for 'publish' command")
+	}
+	return respInt(int64(s.bus.Publish(args[0], args[1])))
+}
+
+// cmdPUBSUB — PUBSUB CHANNELS [pattern] | NUMSUB [channel ...] | NUMPAT
+func (s *Server) cmdPUBSUB(args []string) []byte {
+	if len(args) == 0 {
+		return respErrorMsg("wrong number of arguments for 'pubsub' command")
+	}
+
+	switch sub := strings.ToUpper(args[0]); {
+	case sub == "CHANNELS" && len(args) <= 2:
+		pattern := ""
+		if len(args) == 2 {
+			pattern = args[1]
+		}
+		return respArrayStrings(s.bus.Channels(pattern))
+
+	case sub == "NUMSUB":
+		channels := args[1:]
+		counts := s.bus.NumSub(channels...)
+		buf := []byte("*" + strconv.Itoa(2*len(channels)) + "\r\n")
+		for i, channel := range channels {
+			buf = append(buf, respBulk(channel)...)
+			buf = append(buf, respInt(int64(counts[i]))...)
+		}
+		return buf
+
+	case sub == "NUMPAT" && len(args) == 1:
+		return respInt(int64(s.bus.NumPat()))
+	}
+	return respErrorMsg("unknown subcommand or wrong number of arguments for '" + args[0] + "'. Try PUBSUB HELP.")
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"strconv"
+	"strings"
+
+	storage "imcs/internal/storage/cache"
+)
+
+// === Scan Commands ===
+
+// scanArgs — разобранные опции SCAN/HSCAN/SSCAN/ZSCAN.
+type scanArgs struct {
+	cursor   uint64
+	opts     storage.ScanOptions
+	noValues bool // HSCAN NOVALUES
+}
+
+// parseScanArgs разбирает cursor [MATCH pattern] [COUNT n] и опции,
+// разрешённые командой: TYPE — только SCAN, NOVALUES — только HSCAN.
+func parseScanArgs(cmd, cursor string, args []string) (scanArgs, []byte) {
+	var sa scanArgs
+	var err error
+	if sa.cursor, err = strconv.ParseUint(cursor, 10, 64); err != nil {
+		return sa, respErrorMsg("invalid cursor")
+	}
+
+	for i := 0; i < len(args); i++ {
+		opt := strings.ToUpper(args[i])
+		switch {
+		case opt == "NOVALUES" && cmd == "HSCAN":
+			sa.noValues = true
+			continue
+		case i+1 >= len(args):
+			return sa, respErrorMsg("syntax error")
+		}
+
+		switch {
+		case opt == "MATCH":
+			sa.opts.Match = args[i+1]
+		case opt == "COUNT":
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil {
+				return sa, respErrorMsg("value is not an integer or out of range")
+			}
+			if n < 1 {
+				return sa, respErrorMsg("syntax error")
+			}
+			sa.opts.Count = n
+		case opt == "TYPE" && cmd == "SCAN":
+			sa.opts.Type = strings.ToLower(args[i+1])
+		default:
+			return sa, respErrorMsg("syntax error")
+		}
+		i++
+	}
+	return sa, nil
+}
+
+// respScan возвращает ответ SCAN: [cursor, [items...]].
+func respScan(cursor uint64, items []byte) []byte {
+	buf := []byte("*2\r\n")
+	buf = append(buf, respBulk(strconv.FormatUint(cursor, 10))...)
+	return append(buf, items...)
+}
+
+// cmdSCAN выполняет SCAN cursor [MATCH pattern] [COUNT n] [TYPE type].
+func (s *Server) cmdSCAN(args []string) []byte {
+	if len(args) < 1 {
+		return respErrorMsg("wrong number of arguments for 'scan' command")
+	}
+	sa, errResp := parseScanArgs("SCAN", args[0], args[1:])
+	if errResp != nil {
+		return errResp
+	}
+	next, keys := s.cache.Scan(sa.cursor, sa.opts)
+	return respScan(next, respArrayStrings(keys))
+}
+
+// cmdXSCAN выполняет HSCAN/SSCAN/ZSCAN key cursor [MATCH pattern] [COUNT n].
+// Коллекция отдаётся за один вызов — курсор в ответе всегда 0,
+// как у компактных коллекций в Redis.
+func (s *Server) cmdXSCAN(cmd string, args []string) []byte {
+	if len(args) < 2 {
+		return respErrorMsg("wrong number of arguments for '" + strings.ToLower(cmd) + "' command")
+	}
+	key := args[0]
+	sa, errResp := parseScanArgs(cmd, args[1], args[2:])
+	if errResp != nil {
+		return errResp
+	}
+
+	switch cmd {
+	case "HSCAN":
+		pairs, err := s.cache.HScan(key, sa.opts.Match)
+		if err != nil {
+			return respErr(err)
+		}
+		if sa.noValues {
+			fields := pairs[:0]
+			for i := 0; i < len(pairs); i += 2 {
+				fields = append(fields, pairs[i])
+			}
+			pairs = fields
+		}
+		return respScan(0, respArrayStrings(pairs))
+	case "SSCAN":
+		members, err := s.cache.SScan(key, sa.opts.Match)
+		if err != nil {
+			return respErr(err)
+		}
+		return respScan(0, respArrayStrings(members))
+	default:
+		members, err := s.cache.ZScan(key, sa.opts.Match)
+		if err != nil {
+			return respErr(err)
+		}
+		return respScan(0, respZMembers(members, true))
+	}
+}
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// === Scripting Commands ===
+
+// WithScriptTimeLimit задаёт, через сколько долгий скрипт можно прервать
+// SCRIPT KILL, а остальные команды получают BUSY (по умолчанию 5s).
+func WithScriptTimeLimit(d time.Duration) Option {
+	return func(s *Server) {
+		s.scripts.timeLimit = d
+	}
+}
+
+// scriptCommands выполняются под cache.Exec: атомарно для других клиентов.
+var scriptCommands = map[string]bool{
+	"EVAL":    true,
+	"EVALSHA": true,
+}
+
+// scriptForbidden — команды, недоступные из redis.call. SAVE записал бы
+// маркер снимка посреди группы MULTI/EXEC скрипта.
+var scriptForbidden = map[string]bool{
+	"EVAL":    true,
+	"EVALSHA": true,
+	"SCRIPT":  true,
+	"MULTI":   true,
+	"EXEC":    true,
+	"DISCARD": true,
+	"WATCH":   true,
+	"UNWATCH": true,
+	"SAVE":    true,
+}
+
+// scriptReadOnly — команды, не изменяющие данные: скрипт, вызывавший
+// только их, можно прервать SCRIPT KILL. Всё остальное считается записью.
+var scriptReadOnly = map[string]bool{
+	"GET": true, "MGET": true, "STRLEN": true,
+	"HGET": true, "HMGET": true, "HGETALL": true, "HEXISTS": true, "HLEN": true, "HKEYS": true, "HVALS": true,
+	"LRANGE": true, "LLEN": true, "LINDEX": true,
+	"SISMEMBER": true, "SMISMEMBER": true, "SMEMBERS": true, "SCARD": true, "SRANDMEMBER": true,
+	"SINTER": true, "SUNION": true, "SDIFF": true,
+	"ZSCORE": true, "ZCARD": true, "ZRANK": true, "ZREVRANK": true, "ZCOUNT": true,
+	"ZRANGE": true, "ZREVRANGE": true, "ZRANGEBYSCORE": true, "ZREVRANGEBYSCORE": true,
+	"ZRANGEBYLEX": true, "ZREVRANGEBYLEX": true,
+	"EXISTS": true, "TTL": true, "PTTL": true, "TYPE": true, "KEYS": true, "DUMP": true, "OBJECT": true,
+	"SCAN": true, "HSCAN": true, "SSCAN": true, "ZSCAN": true,
+	"PUBLISH": true, "PUBSUB": true,
+	"PING": true, "ECHO": true, "DBSIZE": true, "INFO": true, "SELECT": true,
+}
+
+// busyReply — ответ на команды, пока скрипт превышает лимит времени.
+var busyReply = []byte("-BUSY Redis is busy running a script. You can only call SCRIPT KILL or SHUTDOWN NOSAVE.\r\n")
+
+// cmdEVAL выполняет EVAL script numkeys [key ...] [arg ...]
+// и EVALSHA sha1 numkeys [key ...] [arg ...].
+func (s *Server) cmdEVAL(cmd string, args []string) []byte {
+	if len(args) < 2 {
+		return respErrorMsg("wrong number of arguments for '" + strings.ToLower(cmd) + "' command")
+	}
+	numKeys, err := strconv.Atoi(args[1])
+	if err != nil {
+		return respErrorMsg("value is not an integer or out of range")
+	}
+	if numKeys < 0 {
+		return respErrorMsg("Number of keys can't be negative")
+	}
+	if numKeys > len(args)-2 {
+		return respErrorMsg("Number of keys can't be greater than number of args")
+	}
+
+	sha := args[0]
+	if cmd == "EVAL" {
+		// Как в Redis: EVAL заодно кеширует скрипт для EVALSHA
+		var errResp []byte
+		if sha, errResp = s.scripts.load(args[0]); errResp != nil {
+			return errResp
+		}
+	}
+	proto, ok := s.scripts.lookup(sha)
+	if !ok {
+		return []byte("-NOSCRIPT No matching script. Please use EVAL.\r\n")
+	}
+
+	keys, argv := args[2:2+numKeys], args[2+numKeys:]
+	return s.scripts.run(proto, keys, argv, s.executeCommand)
+}
+
+// cmdSCRIPT выполняет SCRIPT LOAD/EXISTS/FLUSH/KILL.
+func (s *Server) cmdSCRIPT(args []string) []byte {
+	if len(args) == 0 {
+		return respErrorMsg("wrong number of arguments for 'script' command")
+	}
+
+	switch strings.ToUpper(args[0]) {
+	case "LOAD":
+		if len(args) == 2 {
+			sha, errResp := s.scripts.load(args[1])
+			if errResp != nil {
+				return errResp
+			}
+			return respBulk(sha)
+		}
+	case "EXISTS":
+		if len(args) >= 2 {
+			return respArrayInts(s.scripts.exists(args[1:]))
+		}
+	case "FLUSH":
+		// ASYNC/SYNC принимаются для совместимости: очистка мгновенная
+		if len(args) == 1 || len(args) == 2 && (strings.EqualFold(args[1], "ASYNC") || strings.EqualFold(args[1], "SYNC")) {
+			s.scripts.flush()
+			return respOK()
+		}
+	case "KILL":
+		if len(args) == 1 {
+			return s.scripts.kill()
+		}
+	}
+	return respErrorMsg("unknown subcommand or wrong number of arguments for '" + args[0] + "'. Try SCRIPT HELP.")
+}
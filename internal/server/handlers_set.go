@@ -0,0 +1,191 @@
+package server
+
+import (
+	"strconv"
+	"strings"
+)
+
+// === Set Commands ===
+
+// cmdSADD — SADD/SREM key member [member ...]
+func (s *Server) cmdSADD(args []string, add bool) []byte {
+	if len(args) < 2 {
+		if add {
+			return respErrorMsg("wrong number of arguments for 'sadd' command")
+		}
+		return respErrorMsg("wrong number of arguments for 'srem' command")
+	}
+	var (
+		n   int
+		err error
+	)
+	if add {
+		n, err = s.cache.SAdd(args[0], args[1:]...)
+	} else {
+		n, err = s.cache.SRem(args[0], args[1:]...)
+	}
+	if err != nil {
+		return respErr(err)
+	}
+	return respInt(int64(n))
+}
+
+func (s *Server) cmdSISMEMBER(args []string) []byte {
+	if len(args) != 2 {
+		return respErrorMsg("wrong number of arguments for 'sismember' command")
+	}
+	ok, err := s.cache.SIsMember(args[0], args[1])
+	if err != nil {
+		return respErr(err)
+	}
+	if ok {
+		return respInt(1)
+	}
+	return respInt(0)
+}
+
+func (s *Server) cmdSMISMEMBER(args []string) []byte {
+	if len(args) < 2 {
+		return respErrorMsg("wrong number of arguments for 'smismember' command")
+	}
+	results, err := s.cache.SMIsMember(args[0], args[1:]...)
+	if err != nil {
+		return respErr(err)
+	}
+	ints := make([]int64, len(results))
+	for i, ok := range results {
+		if ok {
+			ints[i] = 1
+		}
+	}
+	return respArrayInts(ints)
+}
+
+func (s *Server) cmdSMEMBERS(args []string) []byte {
+	if len(args) != 1 {
+		return respErrorMsg("wrong number of arguments for 'smembers' command")
+	}
+	members, err := s.cache.SMembers(args[0])
+	if err != nil {
+		return respErr(err)
+	}
+	return respArrayStrings(members)
+}
+
+func (s *Server) cmdSCARD(args []string) []byte {
+	if len(args) != 1 {
+		return respErrorMsg("wrong number of arguments for 'scard' command")
+	}
+	n, err := s.cache.SCard(args[0])
+	if err != nil {
+		return respErr(err)
+	}
+	return respInt(int64(n))
+}
+
+// cmdSPOP — SPOP key [count]
+func (s *Server) cmdSPOP(args []string) []byte {
+	if len(args) < 1 || len(args) > 2 {
+		return respErrorMsg("wrong number of arguments for 'spop' command")
+	}
+
+	count := 1
+	if len(args) == 2 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 0 {
+			return respErrorMsg("value is out of range, must be positive")
+		}
+		count = n
+	}
+
+	members, err := s.cache.SPop(args[0], count)
+	if err != nil {
+		return respErr(err)
+	}
+
+	// Без count — одиночный bulk, с count — массив
+	if len(args) == 1 {
+		if len(members) == 0 {
+			return respNilBulk()
+		}
+		return respBulk(members[0])
+	}
+	return respArrayStrings(members)
+}
+
+// cmdSRANDMEMBER — SRANDMEMBER key [count]
+func (s *Server) cmdSRANDMEMBER(args []string) []byte {
+	if len(args) < 1 || len(args) > 2 {
+		return respErrorMsg("wrong number of arguments for 'srandmember' command")
+	}
+
+	count := 1
+	if len(args) == 2 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil {
+			return respErrorMsg("value is not an integer or out of range")
+		}
+		count = n
+	}
+
+	members, err := s.cache.SRandMember(args[0], count)
+	if err != nil {
+		return respErr(err)
+	}
+
+	if len(args) == 1 {
+		if len(members) == 0 {
+			return respNilBulk()
+		}
+		return respBulk(members[0])
+	}
+	return respArrayStrings(members)
+}
+
+// cmdSETOP — SINTER/SUNION/SDIFF key [key ...]
+func (s *Server) cmdSETOP(cmd string, args []string) []byte {
+	if len(args) < 1 {
+		return respErrorMsg("wrong number of arguments for '" + strings.ToLower(cmd) + "' command")
+	}
+
+	var (
+		members []string
+		err     error
+	)
+	switch cmd {
+	case "SINTER":
+		members, err = s.cache.SInter(args...)
+	case "SUNION":
+		members, err = s.cache.SUnion(args...)
+	default:
+		members, err = s.cache.SDiff(args...)
+	}
+	if err != nil {
+		return respErr(err)
+	}
+	return respArrayStrings(members)
+}
+
+// cmdSETOPSTORE — SINTERSTORE/SUNIONSTORE/SDIFFSTORE destination key [key ...]
+func (s *Server) cmdSETOPSTORE(cmd string, args []string) []byte {
+	if len(args) < 2 {
+		return respErrorMsg("wrong number of arguments for '" + strings.ToLower(cmd) + "' command")
+	}
+
+	var (
+		n   int
+		err error
+	)
+	switch cmd {
+	case "SINTERSTORE":
+		n, err = s.cache.SInterStore(args[0], args[1:]...)
+	case "SUNIONSTORE":
+		n, err = s.cache.SUnionStore(args[0], args[1:]...)
+	default:
+		n, err = s.cache.SDiffStore(args[0], args[1:]...)
+	}
+	if err != nil {
+		return respErr(err)
+	}
+	return respInt(int64(n))
+}
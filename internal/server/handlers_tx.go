@@ -0,0 +1,179 @@
+package server
+
+import (
+	"strconv"
+	"strings"
+
+	storage "imcs/internal/storage/cache"
+)
+
+// === Transaction Commands ===
+
+// transactionCommands — команды управления транзакцией: не ставятся в очередь.
+var transactionCommands = map[string]bool{
+	"MULTI":   true,
+	"EXEC":    true,
+	"DISCARD": true,
+	"WATCH":   true,
+	"UNWATCH": true,
+}
+
+// queuedCommand — команда, отложенная до EXEC.
+type queuedCommand struct {
+	cmd  string
+	args []string
+}
+
+// transaction — состояние MULTI/WATCH одного соединения.
+type transaction struct {
+	active  bool // после MULTI команды ставятся в очередь
+	dirty   bool // ошибка при постановке в очередь — EXEC откажет
+	queue   []queuedCommand
+	watches []storage.Watch
+}
+
+// commandArity — арность команд executeCommand, как в Redis: число
+// аргументов вместе с именем команды; отрицательное — не меньше модуля.
+// По ней MULTI отклоняет неизвестные команды и явно неверное число
+// аргументов до EXEC; полную проверку делает сам обработчик.
+var commandArity = map[string]int{
+	"SET": -3, "GET": 2, "DEL": -2, "SETNX": 3, "SETEX": 4,
+	"MGET": -2, "MSET": -3, "INCR": 2, "DECR": 2, "INCRBY": 3,
+	"DECRBY": 3, "APPEND": 3, "STRLEN": 2,
+
+	"HSET": -4, "HMSET": -4, "HSETNX": 4, "HGET": 3, "HMGET": -3,
+	"HGETALL": 2, "HDEL": -3, "HEXISTS": 3, "HLEN": 2, "HKEYS": 2,
+	"HVALS": 2, "HINCRBY": 4,
+
+	"LPUSH": -3, "RPUSH": -3, "LPOP": -2, "RPOP": -2, "LRANGE": 4,
+	"LLEN": 2, "LINDEX": 3, "LSET": 4, "LREM": 4, "LTRIM": 4,
+	"LMOVE": 5, "BLPOP": -3, "BRPOP": -3, "BLMOVE": 6,
+
+	"SADD": -3, "SREM": -3, "SISMEMBER": 3, "SMISMEMBER": -3,
+	"SMEMBERS": 2, "SCARD": 2, "SPOP": -2, "SRANDMEMBER": -2,
+	"SINTER": -2, "SUNION": -2, "SDIFF": -2,
+	"SINTERSTORE": -3, "SUNIONSTORE": -3, "SDIFFSTORE": -3,
+
+	"ZADD": -4, "ZINCRBY": 4, "ZREM": -3, "ZSCORE": 3, "ZCARD": 2,
+	"ZRANK": -3, "ZREVRANK": -3, "ZRANGE": -4, "ZREVRANGE": -4,
+	"ZRANGEBYSCORE": -4, "ZREVRANGEBYSCORE": -4, "ZRANGEBYLEX": -4,
+	"ZREVRANGEBYLEX": -4, "ZCOUNT": 4, "ZREMRANGEBYSCORE": 4,
+	"ZPOPMIN": -2, "ZPOPMAX": -2, "ZUNIONSTORE": -4, "ZINTERSTORE": -4,
+
+	"EXISTS": -2, "EXPIRE": -3, "PEXPIRE": -3, "TTL": 2, "PTTL": 2,
+	"PERSIST": 2, "TYPE": 2, "RENAME": 3, "KEYS": 2, "DUMP": 2,
+	"RESTORE": -4, "OBJECT": -2, "SCAN": -2,
+	"HSCAN": -3, "SSCAN": -3, "ZSCAN": -3,
+
+	"PUBLISH": 3, "PUBSUB": -2, "EVAL": -3, "EVALSHA": -3, "SCRIPT": -2,
+
+	"PING": -1, "ECHO": 2, "DBSIZE": 1, "FLUSHDB": -1, "FLUSHALL": -1,
+	"INFO": -1, "SELECT": 2, "COMMAND": -1, "CONFIG": -2,
+	"BGREWRITEAOF": 1, "SAVE": 1, "BGSAVE": -1, "LASTSAVE": 1,
+	"CLIENT": -2, "SYNC": 1, "REPLCONF": -1,
+}
+
+// checkArity проверяет, что команда известна и число аргументов
+// допустимо. Возвращает RESP-ошибку или nil.
+func checkArity(cmd string, args []string) []byte {
+	arity, ok := commandArity[cmd]
+	if !ok {
+		return respErrorMsg("unknown command '" + cmd + "'")
+	}
+	n := len(args) + 1
+	if arity > 0 && n != arity || arity < 0 && n < -arity {
+		return respErrorMsg("wrong number of arguments for '" + strings.ToLower(cmd) + "' command")
+	}
+	return nil
+}
+
+// enqueue ставит команду в очередь транзакции. Подписки, неизвестные
+// команды и неверное число аргументов отклоняются сразу, а EXEC затем
+// отменяет всю транзакцию.
+func (tx *transaction) enqueue(cmd string, args []string) []byte {
+	// Подписка меняет режим соединения, а маркер снимка SAVE попал бы
+	// в журнал посреди группы MULTI/EXEC
+	if subscriptionCommands[cmd] || cmd == "SAVE" {
+		tx.dirty = true
+		return respErrorMsg("Command not allowed inside a transaction")
+	}
+	if err := checkArity(cmd, args); err != nil {
+		tx.dirty = true
+		return err
+	}
+	tx.queue = append(tx.queue, queuedCommand{cmd, args})
+	return respSimple("QUEUED")
+}
+
+// resetTransaction завершает транзакцию и снимает WATCH.
+func (s *Server) resetTransaction(tx *transaction) {
+	s.cache.Unwatch(tx.watches)
+	*tx = transaction{}
+}
+
+// executeTransaction выполняет MULTI/EXEC/DISCARD/WATCH/UNWATCH.
+func (s *Server) executeTransaction(tx *transaction, cmd string, args []string) []byte {
+	switch cmd {
+	case "MULTI":
+		if tx.active {
+			return respErrorMsg("MULTI calls can not be nested")
+		}
+		tx.active = true
+		return respOK()
+
+	case "DISCARD":
+		if !tx.active {
+			return respErrorMsg("DISCARD without MULTI")
+		}
+		s.resetTransaction(tx)
+		return respOK()
+
+	case "WATCH":
+		if tx.active {
+			return respErrorMsg("WATCH inside MULTI is not allowed")
+		}
+		if len(args) == 0 {
+			return respErrorMsg("wrong number of arguments for 'watch' command")
+		}
+		tx.watches = append(tx.watches, s.cache.Watch(args...)...)
+		return respOK()
+
+	case "UNWATCH":
+		s.cache.Unwatch(tx.watches)
+		tx.watches = nil
+		return respOK()
+
+	case "EXEC":
+		if !tx.active {
+			return respErrorMsg("EXEC without MULTI")
+		}
+		defer s.resetTransaction(tx)
+		if tx.dirty {
+			return []byte("-EXECABORT Transaction discarded because of previous errors.\r\n")
+		}
+
+		buf := []byte("*" + strconv.Itoa(len(tx.queue)) + "\r\n")
+		// Сбой AOF не отменяет выполненные команды: клиент получает их
+		// ответы, а сбой виден в логе и INFO (exec_write_errors)
+		ok, _ := s.cache.Exec(tx.watches, func(c *storage.Cache) {
+			srv := s.withCache(c)
+			for _, q := range tx.queue {
+				buf = append(buf, srv.executeCommand(q.cmd, q.args)...)
+			}
+		})
+		if !ok {
+			// Наблюдаемый ключ изменился — транзакция не выполняется
+			return respNilArray()
+		}
+		return buf
+	}
+	return respErrorMsg("unknown command '" + strings.ToLower(cmd) + "'")
+}
+
+// withCache возвращает копию сервера, работающую с копией кеша c
+// (fn внутри cache.Exec): её записи AOF ждёт сам Exec.
+func (s *Server) withCache(c *storage.Cache) *Server {
+	srv := *s
+	srv.cache = c
+	return &srv
+}
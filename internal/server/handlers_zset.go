@@ -0,0 +1,372 @@
+package server
+
+import (
+	storage "imcs/internal/storage/cache"
+	"strconv"
+	"strings"
+)
+
+// === Sorted Set Commands ===
+
+// cmdZADD — ZADD key [NX|XX] [GT|LT] [CH] [INCR] score member [score member ...]
+func (s *Server) cmdZADD(args []string) []byte {
+	if len(args) < 3 {
+		return respErrorMsg("wrong number of arguments for 'zadd' command")
+	}
+
+	var (
+		opts storage.ZAddOptions
+		incr bool
+		i    = 1
+	)
+flags:
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NX":
+			opts.NX = true
+		case "XX":
+			opts.XX = true
+		case "GT":
+			opts.GT = true
+		case "LT":
+			opts.LT = true
+		case "CH":
+			opts.CH = true
+		case "INCR":
+			incr = true
+		default:
+			break flags
+		}
+	}
+
+	pairs := args[i:]
+	if len(pairs) == 0 || len(pairs)%2 != 0 {
+		return respErrorMsg("syntax error")
+	}
+	if opts.NX && opts.XX {
+		return respErrorMsg("XX and NX options at the same time are not compatible")
+	}
+	if opts.GT && opts.LT || opts.NX && (opts.GT || opts.LT) {
+		return respErrorMsg("GT, LT, and/or NX options at the same time are not compatible")
+	}
+	if incr && len(pairs) != 2 {
+		return respErrorMsg("INCR option supports a single increment-element pair")
+	}
+
+	members := make([]storage.ZMember, 0, len(pairs)/2)
+	for j := 0; j < len(pairs); j += 2 {
+		score, err := storage.ParseScore(pairs[j])
+		if err != nil {
+			return respErr(err)
+		}
+		members = append(members, storage.ZMember{Member: pairs[j+1], Score: score})
+	}
+
+	if incr {
+		score, ok, err := s.cache.ZIncrBy(args[0], opts, members[0].Member, members[0].Score)
+		if err != nil {
+			return respErr(err)
+		}
+		if !ok {
+			return respNilBulk()
+		}
+		return respBulk(storage.FormatScore(score))
+	}
+
+	n, err := s.cache.ZAdd(args[0], opts, members...)
+	if err != nil {
+		return respErr(err)
+	}
+	return respInt(int64(n))
+}
+
+func (s *Server) cmdZINCRBY(args []string) []byte {
+	if len(args) != 3 {
+		return respErrorMsg("wrong number of arguments for 'zincrby' command")
+	}
+	incr, err := storage.ParseScore(args[1])
+	if err != nil {
+		return respErr(err)
+	}
+	score, _, err := s.cache.ZIncrBy(args[0], storage.ZAddOptions{}, args[2], incr)
+	if err != nil {
+		return respErr(err)
+	}
+	return respBulk(storage.FormatScore(score))
+}
+
+func (s *Server) cmdZREM(args []string) []byte {
+	if len(args) < 2 {
+		return respErrorMsg("wrong number of arguments for 'zrem' command")
+	}
+	n, err := s.cache.ZRem(args[0], args[1:]...)
+	if err != nil {
+		return respErr(err)
+	}
+	return respInt(int64(n))
+}
+
+func (s *Server) cmdZSCORE(args []string) []byte {
+	if len(args) != 2 {
+		return respErrorMsg("wrong number of arguments for 'zscore' command")
+	}
+	score, found, err := s.cache.ZScore(args[0], args[1])
+	if err != nil {
+		return respErr(err)
+	}
+	if !found {
+		return respNilBulk()
+	}
+	return respBulk(storage.FormatScore(score))
+}
+
+func (s *Server) cmdZCARD(args []string) []byte {
+	if len(args) != 1 {
+		return respErrorMsg("wrong number of arguments for 'zcard' command")
+	}
+	n, err := s.cache.ZCard(args[0])
+	if err != nil {
+		return respErr(err)
+	}
+	return respInt(int64(n))
+}
+
+// cmdZRANK — ZRANK/ZREVRANK key member [WITHSCORE]
+func (s *Server) cmdZRANK(cmd string, args []string) []byte {
+	if len(args) < 2 || len(args) > 3 {
+		return respErrorMsg("wrong number of arguments for '" + strings.ToLower(cmd) + "' command")
+	}
+	withScore := len(args) == 3
+	if withScore && strings.ToUpper(args[2]) != "WITHSCORE" {
+		return respErrorMsg("syntax error")
+	}
+
+	rank, score, found, err := s.cache.ZRank(args[0], args[1], cmd == "ZREVRANK")
+	if err != nil {
+		return respErr(err)
+	}
+	if !found {
+		if withScore {
+			return respNilArray()
+		}
+		return respNilBulk()
+	}
+	if !withScore {
+		return respInt(int64(rank))
+	}
+
+	buf := []byte("*2\r\n")
+	buf = append(buf, respInt(int64(rank))...)
+	return append(buf, respBulk(storage.FormatScore(score))...)
+}
+
+// cmdZRANGE — ZRANGE key start stop [BYSCORE|BYLEX] [REV] [LIMIT offset count] [WITHSCORES]
+// и устаревшие ZREVRANGE, ZRANGEBYSCORE, ZREVRANGEBYSCORE, ZRANGEBYLEX, ZREVRANGEBYLEX.
+func (s *Server) cmdZRANGE(cmd string, args []string) []byte {
+	if len(args) < 3 {
+		return respErrorMsg("wrong number of arguments for '" + strings.ToLower(cmd) + "' command")
+	}
+
+	var (
+		by         string // "", "BYSCORE" или "BYLEX"
+		rev        = strings.HasPrefix(cmd, "ZREV")
+		withScores bool
+		limited    bool
+		offset     int
+		count      = -1
+	)
+	switch cmd {
+	case "ZRANGEBYSCORE", "ZREVRANGEBYSCORE":
+		by = "BYSCORE"
+	case "ZRANGEBYLEX", "ZREVRANGEBYLEX":
+		by = "BYLEX"
+	}
+
+	for i := 3; i < len(args); i++ {
+		opt := strings.ToUpper(args[i])
+		switch {
+		case (opt == "BYSCORE" || opt == "BYLEX") && cmd == "ZRANGE":
+			by = opt
+		case opt == "REV" && cmd == "ZRANGE":
+			rev = true
+		case opt == "WITHSCORES":
+			withScores = true
+		case opt == "LIMIT" && i+2 < len(args):
+			var err1, err2 error
+			offset, err1 = strconv.Atoi(args[i+1])
+			count, err2 = strconv.Atoi(args[i+2])
+			if err1 != nil || err2 != nil {
+				return respErrorMsg("value is not an integer or out of range")
+			}
+			limited = true
+			i += 2
+		default:
+			return respErrorMsg("syntax error")
+		}
+	}
+	if limited && by == "" {
+		return respErrorMsg("syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX")
+	}
+	if withScores && by == "BYLEX" {
+		return respErrorMsg("syntax error, WITHSCORES not supported in combination with BYLEX")
+	}
+
+	key, start, stop := args[0], args[1], args[2]
+	// В обратном порядке границы диапазона идут как max, min
+	if rev && by != "" {
+		start, stop = stop, start
+	}
+
+	var (
+		members []storage.ZMember
+		err     error
+	)
+	switch by {
+	case "BYSCORE":
+		r, perr := storage.ParseScoreRange(start, stop)
+		if perr != nil {
+			return respErr(perr)
+		}
+		members, err = s.cache.ZRangeByScore(key, r, rev, offset, count)
+	case "BYLEX":
+		r, perr := storage.ParseLexRange(start, stop)
+		if perr != nil {
+			return respErr(perr)
+		}
+		members, err = s.cache.ZRangeByLex(key, r, rev, offset, count)
+	default:
+		from, err1 := strconv.Atoi(start)
+		to, err2 := strconv.Atoi(stop)
+		if err1 != nil || err2 != nil {
+			return respErrorMsg("value is not an integer or out of range")
+		}
+		members, err = s.cache.ZRange(key, from, to, rev)
+	}
+	if err != nil {
+		return respErr(err)
+	}
+	return respZMembers(members, withScores)
+}
+
+// cmdZCOUNT — ZCOUNT/ZREMRANGEBYSCORE key min max
+func (s *Server) cmdZCOUNT(cmd string, args []string) []byte {
+	if len(args) != 3 {
+		return respErrorMsg("wrong number of arguments for '" + strings.ToLower(cmd) + "' command")
+	}
+	r, err := storage.ParseScoreRange(args[1], args[2])
+	if err != nil {
+		return respErr(err)
+	}
+
+	var n int
+	if cmd == "ZCOUNT" {
+		n, err = s.cache.ZCount(args[0], r)
+	} else {
+		n, err = s.cache.ZRemRangeByScore(args[0], r)
+	}
+	if err != nil {
+		return respErr(err)
+	}
+	return respInt(int64(n))
+}
+
+// cmdZPOP — ZPOPMIN/ZPOPMAX key [count]
+func (s *Server) cmdZPOP(cmd string, args []string) []byte {
+	if len(args) < 1 || len(args) > 2 {
+		return respErrorMsg("wrong number of arguments for '" + strings.ToLower(cmd) + "' command")
+	}
+
+	count := 1
+	if len(args) == 2 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 0 {
+			return respErrorMsg("value is out of range, must be positive")
+		}
+		count = n
+	}
+
+	var (
+		members []storage.ZMember
+		err     error
+	)
+	if cmd == "ZPOPMIN" {
+		members, err = s.cache.ZPopMin(args[0], count)
+	} else {
+		members, err = s.cache.ZPopMax(args[0], count)
+	}
+	if err != nil {
+		return respErr(err)
+	}
+	return respZMembers(members, true)
+}
+
+// cmdZSTORE — ZUNIONSTORE/ZINTERSTORE destination numkeys key [key ...]
+// [WEIGHTS weight [weight ...]] [AGGREGATE SUM|MIN|MAX]
+func (s *Server) cmdZSTORE(cmd string, args []string) []byte {
+	name := strings.ToLower(cmd)
+	if len(args) < 3 {
+		return respErrorMsg("wrong number of arguments for '" + name + "' command")
+	}
+
+	numKeys, err := strconv.Atoi(args[1])
+	if err != nil {
+		return respErrorMsg("value is not an integer or out of range")
+	}
+	if numKeys < 1 {
+		return respErrorMsg("at least 1 input key is needed for '" + name + "' command")
+	}
+	if 2+numKeys > len(args) {
+		return respErrorMsg("syntax error")
+	}
+	keys := args[2 : 2+numKeys]
+
+	var (
+		weights []float64
+		agg     = storage.AggregateSum
+	)
+	for i := 2 + numKeys; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "WEIGHTS":
+			if i+numKeys >= len(args) {
+				return respErrorMsg("syntax error")
+			}
+			weights = make([]float64, numKeys)
+			for j := range weights {
+				w, err := storage.ParseScore(args[i+1+j])
+				if err != nil {
+					return respErrorMsg("weight value is not a float")
+				}
+				weights[j] = w
+			}
+			i += numKeys
+		case "AGGREGATE":
+			if i+1 >= len(args) {
+				return respErrorMsg("syntax error")
+			}
+			i++
+			switch strings.ToUpper(args[i]) {
+			case "SUM":
+				agg = storage.AggregateSum
+			case "MIN":
+				agg = storage.AggregateMin
+			case "MAX":
+				agg = storage.AggregateMax
+			default:
+				return respErrorMsg("syntax error")
+			}
+		default:
+			return respErrorMsg("syntax error")
+		}
+	}
+
+	var n int
+	if cmd == "ZUNIONSTORE" {
+		n, err = s.cache.ZUnionStore(args[0], keys, weights, agg)
+	} else {
+		n, err = s.cache.ZInterStore(args[0], keys, weights, agg)
+	}
+	if err != nil {
+		return respErr(err)
+	}
+	return respInt(int64(n))
+}
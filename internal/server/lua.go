@@ -0,0 +1,448 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+/*
+	Lua-скрипты (EVAL/EVALSHA) на gopher-lua — чистый Go, без cgo.
+
+	Скрипт выполняется под cache.Exec, как EXEC: остальные клиенты ждут,
+	а записи redis.call попадают в AOF одной группой MULTI/EXEC
+	(репликация эффектов, а не текста скрипта — SPOP и TIME-зависимая
+	логика восстанавливаются ровно так, как выполнились).
+
+	Одно состояние Lua на сервер: скрипты не выполняются параллельно.
+	Глобальные переменные защищены метатаблицей — скрипт не может
+	оставить состояние для следующего.
+
+	Команды других клиентов ждут конца скрипта, но не дольше timeLimit:
+	дальше они получают BUSY, а SCRIPT KILL прерывает скрипт — пока он
+	ничего не записал.
+*/
+
+// defaultScriptTimeLimit — как lua-time-limit в Redis.
+const defaultScriptTimeLimit = 5 * time.Second
+
+// scriptEngine — кеш скомпилированных скриптов и состояние Lua.
+type scriptEngine struct {
+	timeLimit time.Duration
+
+	mu      sync.Mutex
+	scripts map[string]*lua.FunctionProto // sha1 → скомпилированный скрипт
+
+	L       *lua.LState // только под cache.Exec
+	running atomic.Pointer[runningScript]
+}
+
+// runningScript — выполняющийся скрипт (для BUSY и SCRIPT KILL).
+type runningScript struct {
+	started time.Time
+	cancel  context.CancelFunc
+	done    chan struct{} // закрывается по завершении скрипта
+
+	mu     sync.Mutex
+	wrote  bool // после записи скрипт нельзя убить
+	killed bool
+}
+
+func newScriptEngine(timeLimit time.Duration) *scriptEngine {
+	return &scriptEngine{
+		timeLimit: timeLimit,
+		scripts:   make(map[string]*lua.FunctionProto),
+	}
+}
+
+// sha1hex — идентификатор скрипта для EVALSHA.
+func sha1hex(body string) string {
+	sum := sha1.Sum([]byte(body))
+	return hex.EncodeToString(sum[:])
+}
+
+// load компилирует скрипт и кеширует его. Возвращает sha1.
+func (e *scriptEngine) load(body string) (string, []byte) {
+	sha := sha1hex(body)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, ok := e.scripts[sha]; ok {
+		return sha, nil
+	}
+	chunk, err := parse.Parse(strings.NewReader(body), "user_script")
+	if err != nil {
+		return "", respErrorMsg("Error compiling script (new function): " + oneLine(err.Error()))
+	}
+	proto, err := lua.Compile(chunk, "user_script")
+	if err != nil {
+		return "", respErrorMsg("Error compiling script (new function): " + oneLine(err.Error()))
+	}
+	e.scripts[sha] = proto
+	return sha, nil
+}
+
+// lookup возвращает скомпилированный скрипт по sha1.
+func (e *scriptEngine) lookup(sha string) (*lua.FunctionProto, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	proto, ok := e.scripts[strings.ToLower(sha)]
+	return proto, ok
+}
+
+// exists сообщает, какие скрипты есть в кеше (SCRIPT EXISTS).
+func (e *scriptEngine) exists(shas []string) []int64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	result := make([]int64, len(shas))
+	for i, sha := range shas {
+		if _, ok := e.scripts[strings.ToLower(sha)]; ok {
+			result[i] = 1
+		}
+	}
+	return result
+}
+
+// flush очищает кеш скриптов (SCRIPT FLUSH).
+func (e *scriptEngine) flush() {
+	e.mu.Lock()
+	e.scripts = make(map[string]*lua.FunctionProto)
+	e.mu.Unlock()
+}
+
+// busy ждёт завершения выполняющегося скрипта, но не дольше лимита.
+// true — скрипт превысил лимит: клиенту нужно ответить BUSY.
+func (e *scriptEngine) busy() bool {
+	run := e.running.Load()
+	if run == nil {
+		return false
+	}
+	timer := time.NewTimer(e.timeLimit - time.Since(run.started))
+	defer timer.Stop()
+	select {
+	case <-run.done:
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// kill прерывает выполняющийся скрипт (SCRIPT KILL).
+func (e *scriptEngine) kill() []byte {
+	run := e.running.Load()
+	if run == nil {
+		return []byte("-NOTBUSY No scripts in execution right now.\r\n")
+	}
+	run.mu.Lock()
+	defer run.mu.Unlock()
+	if run.wrote {
+		return []byte("-UNKILLABLE Sorry the script already executed write commands against the dataset. " +
+			"You can either wait the script termination or kill the server in a hard way using the SHUTDOWN NOSAVE command.\r\n")
+	}
+	run.killed = true
+	run.cancel()
+	return respOK()
+}
+
+// run выполняет скрипт; call выполняет команды redis.call.
+// Вызывается под cache.Exec.
+func (e *scriptEngine) run(proto *lua.FunctionProto, keys, argv []string, call func(cmd string, args []string) []byte) []byte {
+	if e.L == nil {
+		e.L = newLuaState()
+	}
+	L := e.L
+
+	ctx, cancel := context.WithCancel(context.Background())
+	run := &runningScript{started: time.Now(), cancel: cancel, done: make(chan struct{})}
+	e.running.Store(run)
+	defer func() {
+		e.running.Store(nil)
+		close(run.done)
+		cancel()
+	}()
+
+	globals := L.G.Global
+	globals.RawSetString("KEYS", luaStrings(L, keys))
+	globals.RawSetString("ARGV", luaStrings(L, argv))
+	redis := globals.RawGetString("redis").(*lua.LTable)
+	redis.RawSetString("call", L.NewFunction(e.bridge(run, call, true)))
+	redis.RawSetString("pcall", L.NewFunction(e.bridge(run, call, false)))
+
+	L.SetContext(ctx)
+	L.Push(L.NewFunctionFromProto(proto))
+	err := L.PCall(0, 1, nil)
+	L.RemoveContext()
+
+	if err != nil {
+		L.SetTop(0)
+		run.mu.Lock()
+		killed := run.killed
+		run.mu.Unlock()
+		if killed {
+			// Состояние после прерывания не переиспользуем
+			L.Close()
+			e.L = nil
+			return respErrorMsg("Script killed by user with SCRIPT KILL...")
+		}
+		if apiErr, ok := err.(*lua.ApiError); ok {
+			if reply, ok := errorReply(apiErr.Object); ok {
+				return reply
+			}
+			return respErrorMsg("Error running script: " + oneLine(apiErr.Object.String()))
+		}
+		return respErrorMsg("Error running script: " + oneLine(err.Error()))
+	}
+
+	ret := L.Get(-1)
+	L.Pop(1)
+	return luaToRESP(ret)
+}
+
+// bridge создаёт redis.call (raise = true) или redis.pcall.
+func (e *scriptEngine) bridge(run *runningScript, call func(cmd string, args []string) []byte, raise bool) lua.LGFunction {
+	return func(L *lua.LState) int {
+		reply := e.call(L, run, call)
+		if raise {
+			if _, ok := errorReply(reply); ok {
+				L.Error(reply, 0)
+			}
+		}
+		L.Push(reply)
+		return 1
+	}
+}
+
+// call выполняет команду из скрипта и переводит ответ в значение Lua.
+func (e *scriptEngine) call(L *lua.LState, run *runningScript, call func(cmd string, args []string) []byte) lua.LValue {
+	n := L.GetTop()
+	if n == 0 {
+		return luaError(L, "ERR Please specify at least one argument for this redis lib call")
+	}
+	args := make([]string, n)
+	for i := 1; i <= n; i++ {
+		switch v := L.Get(i).(type) {
+		case lua.LString:
+			args[i-1] = string(v)
+		case lua.LNumber:
+			args[i-1] = formatLuaNumber(v)
+		default:
+			return luaError(L, "ERR Lua redis lib command arguments must be strings or integers")
+		}
+	}
+
+	cmd := strings.ToUpper(args[0])
+	if scriptForbidden[cmd] {
+		return luaError(L, "ERR This Redis command is not allowed from script")
+	}
+	if !scriptReadOnly[cmd] {
+		// Под mu: SCRIPT KILL не прервёт скрипт между проверкой и записью
+		run.mu.Lock()
+		if run.killed {
+			run.mu.Unlock()
+			L.RaiseError("Script killed by user with SCRIPT KILL...")
+		}
+		run.wrote = true
+		run.mu.Unlock()
+	}
+	return respToLua(L, call(cmd, args[1:]))
+}
+
+// newLuaState создаёт песочницу: base/table/string/math и библиотека redis.
+func newLuaState() *lua.LState {
+	L := lua.NewState(lua.Options{SkipOpenLibs: true})
+	for _, lib := range []struct {
+		name string
+		open lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	} {
+		L.Push(L.NewFunction(lib.open))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+	// Доступ к файловой системе из скриптов запрещён
+	for _, name := range []string{"dofile", "loadfile"} {
+		L.SetGlobal(name, lua.LNil)
+	}
+
+	redis := L.NewTable()
+	L.SetFuncs(redis, map[string]lua.LGFunction{
+		"error_reply": func(L *lua.LState) int {
+			L.Push(luaError(L, L.CheckString(1)))
+			return 1
+		},
+		"status_reply": func(L *lua.LState) int {
+			t := L.NewTable()
+			t.RawSetString("ok", lua.LString(L.CheckString(1)))
+			L.Push(t)
+			return 1
+		},
+		"sha1hex": func(L *lua.LState) int {
+			L.Push(lua.LString(sha1hex(L.CheckString(1))))
+			return 1
+		},
+		// Эффекты реплицируются всегда; вызов оставлен для старых скриптов
+		"replicate_commands": func(L *lua.LState) int {
+			L.Push(lua.LTrue)
+			return 1
+		},
+	})
+	L.SetGlobal("redis", redis)
+	L.SetGlobal("KEYS", L.NewTable())
+	L.SetGlobal("ARGV", L.NewTable())
+
+	// Новые глобальные переменные запрещены: скрипты не делят состояние
+	meta := L.NewTable()
+	L.SetFuncs(meta, map[string]lua.LGFunction{
+		"__newindex": func(L *lua.LState) int {
+			L.RaiseError("Script attempted to create global variable '%s'", L.CheckString(2))
+			return 0
+		},
+		"__index": func(L *lua.LState) int {
+			L.RaiseError("Script attempted to access nonexistent global variable '%s'", L.CheckString(2))
+			return 0
+		},
+	})
+	L.SetMetatable(L.G.Global, meta)
+	return L
+}
+
+// luaStrings — таблица-массив строк (KEYS, ARGV).
+func luaStrings(L *lua.LState, items []string) *lua.LTable {
+	t := L.CreateTable(len(items), 0)
+	for _, item := range items {
+		t.Append(lua.LString(item))
+	}
+	return t
+}
+
+// luaError — таблица {err = msg}, как redis.error_reply.
+func luaError(L *lua.LState, msg string) *lua.LTable {
+	t := L.NewTable()
+	t.RawSetString("err", lua.LString(msg))
+	return t
+}
+
+// errorReply возвращает RESP-ошибку, если v — таблица {err = ...}.
+func errorReply(v lua.LValue) ([]byte, bool) {
+	t, ok := v.(*lua.LTable)
+	if !ok {
+		return nil, false
+	}
+	msg, ok := t.RawGetString("err").(lua.LString)
+	if !ok {
+		return nil, false
+	}
+	return []byte("-" + oneLine(string(msg)) + "\r\n"), true
+}
+
+// formatLuaNumber форматирует число аргумента redis.call: 3 → "3".
+func formatLuaNumber(n lua.LNumber) string {
+	f := float64(n)
+	if f == float64(int64(f)) {
+		return strconv.FormatInt(int64(f), 10)
+	}
+	return strconv.FormatFloat(f, 'g', 17, 64)
+}
+
+// oneLine убирает переводы строк: RESP-ошибка занимает одну строку.
+func oneLine(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
+
+// luaToRESP переводит результат скрипта в RESP по правилам Redis:
+// число — integer (дробная часть отбрасывается), true — 1,
+// false и nil — nil, таблица — массив до первого nil.
+func luaToRESP(v lua.LValue) []byte {
+	switch v := v.(type) {
+	case lua.LString:
+		return respBulk(string(v))
+	case lua.LNumber:
+		return respInt(int64(v))
+	case lua.LBool:
+		if v {
+			return respInt(1)
+		}
+		return respNilBulk()
+	case *lua.LTable:
+		if reply, ok := errorReply(v); ok {
+			return reply
+		}
+		if status, ok := v.RawGetString("ok").(lua.LString); ok {
+			return respSimple(oneLine(string(status)))
+		}
+		var items [][]byte
+		for i := 1; ; i++ {
+			item := v.RawGetInt(i)
+			if item == lua.LNil {
+				break
+			}
+			items = append(items, luaToRESP(item))
+		}
+		buf := []byte("*" + strconv.Itoa(len(items)) + "\r\n")
+		for _, item := range items {
+			buf = append(buf, item...)
+		}
+		return buf
+	}
+	return respNilBulk()
+}
+
+// respToLua переводит ответ executeCommand в значение Lua: integer —
+// число, bulk — строка, nil — false, статус — {ok}, ошибка — {err}.
+func respToLua(L *lua.LState, reply []byte) lua.LValue {
+	v, _ := parseRESPValue(L, reply)
+	return v
+}
+
+// parseRESPValue разбирает одно значение и возвращает остаток буфера.
+func parseRESPValue(L *lua.LState, b []byte) (lua.LValue, []byte) {
+	end := bytes.Index(b, []byte("\r\n"))
+	if len(b) == 0 || end < 0 {
+		return lua.LFalse, nil
+	}
+	line, rest := string(b[1:end]), b[end+2:]
+
+	switch b[0] {
+	case '+':
+		t := L.NewTable()
+		t.RawSetString("ok", lua.LString(line))
+		return t, rest
+	case '-':
+		return luaError(L, line), rest
+	case ':':
+		n, _ := strconv.ParseInt(line, 10, 64)
+		return lua.LNumber(n), rest
+	case '$':
+		size, _ := strconv.Atoi(line)
+		if size < 0 || size > len(rest) {
+			return lua.LFalse, rest
+		}
+		return lua.LString(rest[:size]), rest[min(size+2, len(rest)):]
+	case '*':
+		count, _ := strconv.Atoi(line)
+		if count < 0 {
+			return lua.LFalse, rest
+		}
+		t := L.CreateTable(count, 0)
+		for i := 0; i < count; i++ {
+			var item lua.LValue
+			item, rest = parseRESPValue(L, rest)
+			t.Append(item)
+		}
+		return t, rest
+	}
+	return lua.LFalse, rest
+}
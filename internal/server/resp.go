@@ -2,8 +2,13 @@ package server
 
 import (
 	"bufio"
+	"errors"
 	"io"
 	"strconv"
+
+	"imcs/internal/persistence/AOF"
+	"imcs/internal/pubsub"
+	storage "imcs/internal/storage/cache"
 )
 
 // RESP types
@@ -144,6 +149,11 @@ func respNilBulk() []byte {
 	return []byte("$-1\r\n")
 }
 
+// respNilArray возвращает *-1\r\n (nil array — таймаут BLPOP и т.п.)
+func respNilArray() []byte {
+	return []byte("*-1\r\n")
+}
+
 // respBulk возвращает $len\r\ndata\r\n
 func respBulk(s string) []byte {
 	lenStr := strconv.Itoa(len(s))
@@ -165,6 +175,25 @@ func respErrorMsg(msg string) []byte {
 	return buf
 }
 
+// respErr возвращает ошибку кеша. Ошибки с собственным префиксом
+// (WRONGTYPE ..., OOM ...) отдаются как есть, остальные — с префиксом ERR.
+func respErr(err error) []byte {
+	if err == storage.ErrWrongType || err == storage.ErrOOM {
+		return []byte("-" + err.Error() + "\r\n")
+	}
+	if isWriteError(err) {
+		return []byte("-MISCONF " + err.Error() + "\r\n")
+	}
+	return respErrorMsg(err.Error())
+}
+
+// isWriteError — сбой записи AOF (команда выполнена, но может не
+// пережить рестарт).
+func isWriteError(err error) bool {
+	var writeErr *AOF.WriteError
+	return errors.As(err, &writeErr)
+}
+
 // respInt возвращает :N\r\n
 func respInt(n int64) []byte {
 	s := strconv.FormatInt(n, 10)
@@ -220,3 +249,48 @@ func respArrayStrings(items []string) []byte {
 	}
 	return buf
 }
+
+// respArrayInts возвращает RESP array из integers (для SMISMEMBER).
+func respArrayInts(items []int64) []byte {
+	buf := make([]byte, 0, 16+len(items)*4)
+	buf = append(buf, '*')
+	buf = append(buf, strconv.Itoa(len(items))...)
+	buf = append(buf, '\r', '\n')
+	for _, n := range items {
+		buf = append(buf, ':')
+		buf = append(buf, strconv.FormatInt(n, 10)...)
+		buf = append(buf, '\r', '\n')
+	}
+	return buf
+}
+
+// respZMembers возвращает элементы sorted set плоским массивом:
+// member [score] member [score] ...
+func respZMembers(members []storage.ZMember, withScores bool) []byte {
+	flat := make([]string, 0, len(members)*2)
+	for _, m := range members {
+		flat = append(flat, m.Member)
+		if withScores {
+			flat = append(flat, storage.FormatScore(m.Score))
+		}
+	}
+	return respArrayStrings(flat)
+}
+
+// respSubscription возвращает подтверждение (P)(UN)SUBSCRIBE:
+// [kind, channel, число подписок соединения].
+func respSubscription(kind, channel string, count int) []byte {
+	buf := []byte("*3\r\n")
+	buf = append(buf, respBulk(kind)...)
+	buf = append(buf, respBulk(channel)...)
+	return append(buf, respInt(int64(count))...)
+}
+
+// respMessage возвращает сообщение подписчику: [message, channel, payload]
+// или, для подписки по шаблону, [pmessage, pattern, channel, payload].
+func respMessage(msg pubsub.Message) []byte {
+	if msg.Pattern != "" {
+		return respArrayStrings([]string{"pmessage", msg.Pattern, msg.Channel, msg.Payload})
+	}
+	return respArrayStrings([]string{"message", msg.Channel, msg.Payload})
+}
@@ -2,9 +2,13 @@ package server
 
 import (
 	"bufio"
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"math/rand"
 	"net"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -12,18 +16,39 @@ import (
 	"testing"
 	"time"
 
+	"imcs/internal/persistence/AOF"
+	"imcs/internal/persistence/RDB"
 	"imcs/internal/storage/cache"
 )
 
 type nullPersistence struct{}
 
-func (n *nullPersistence) Write(cmd, key, value string, d time.Duration) error { return nil }
+func (n *nullPersistence) Write(cmd, key, value string, d time.Duration) func() error { return nil }
+func (n *nullPersistence) WriteAt(cmd, key, value string, e int64) func() error       { return nil }
 
-func startTestServer(t *testing.T) (string, *storage.Cache) {
+// failingPersistence — журнал, запись в который не удаётся.
+type failingPersistence struct{}
+
+var errDiskFull = &AOF.WriteError{Err: errors.New("no space left on device")}
+
+func (f *failingPersistence) Write(cmd, key, value string, d time.Duration) func() error {
+	return func() error { return errDiskFull }
+}
+func (f *failingPersistence) WriteAt(cmd, key, value string, e int64) func() error {
+	return func() error { return errDiskFull }
+}
+
+func startTestServer(t *testing.T, opts ...Option) (string, *storage.Cache) {
+	t.Helper()
+	return startTestServerWith(t, &nullPersistence{}, opts...)
+}
+
+// startTestServerWith — startTestServer с журналом кеша persister.
+func startTestServerWith(t *testing.T, persister storage.Persistence, opts ...Option) (string, *storage.Cache) {
 	t.Helper()
 
-	cache := storage.New(&nullPersistence{})
-	srv := New("127.0.0.1:0", cache)
+	cache := storage.New(persister)
+	srv := New("127.0.0.1:0", cache, opts...)
 
 	ln, err := net.Listen("tcp", "127.0.0.1:0")
 	if err != nil {
@@ -117,7 +142,13 @@ func readRESPReply(reader *bufio.Reader) (string, error) {
 // ====================================================================
 
 func TestRESPProtocol(t *testing.T) {
-	addr, _ := startTestServer(t)
+	persister, err := AOF.NewPersister(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer persister.Close()
+	addr, cache := startTestServer(t, WithAOF(persister))
+	persister.SetSnapshot(cache.Snapshot)
 
 	conn, err := net.Dial("tcp", addr)
 	if err != nil {
@@ -181,6 +212,179 @@ func TestRESPProtocol(t *testing.T) {
 		{"MGET mk1 mk2 mk3 mkX\r\n", "[mv1, mv2, mv3, (nil)]"},
 		{"SELECT 0\r\n", "OK"},
 		{"SELECT 1\r\n", "OK"},
+		{"HSET user:1 name John age 30\r\n", "2"},
+		{"HSET user:1 age 31\r\n", "0"},
+		{"HGET user:1 age\r\n", "31"},
+		{"HGET user:1 nofield\r\n", "(nil)"},
+		{"HMGET user:1 name nofield\r\n", "[John, (nil)]"},
+		{"HSETNX user:1 name Jane\r\n", "0"},
+		{"HSETNX user:1 city Paris\r\n", "1"},
+		{"HLEN user:1\r\n", "3"},
+		{"HEXISTS user:1 city\r\n", "1"},
+		{"HINCRBY user:1 age 2\r\n", "33"},
+		{"HINCRBY user:1 name 1\r\n", "-ERR hash value is not an integer"},
+		{"HDEL user:1 age city nofield\r\n", "2"},
+		{"HGETALL user:1\r\n", "[name, John]"},
+		{"HKEYS user:1\r\n", "[name]"},
+		{"HVALS user:1\r\n", "[John]"},
+		{"TYPE user:1\r\n", "hash"},
+		{"GET user:1\r\n", "-WRONGTYPE Operation against a key holding the wrong kind of value"},
+		{"STRLEN user:1\r\n", "-WRONGTYPE Operation against a key holding the wrong kind of value"},
+		{"HGET mykey name\r\n", "-WRONGTYPE Operation against a key holding the wrong kind of value"},
+		{"HDEL user:1 name\r\n", "1"},
+		{"EXISTS user:1\r\n", "0"},
+		{"RPUSH jobs b c\r\n", "2"},
+		{"LPUSH jobs a\r\n", "3"},
+		{"LRANGE jobs 0 -1\r\n", "[a, b, c]"},
+		{"LLEN jobs\r\n", "3"},
+		{"LINDEX jobs -1\r\n", "c"},
+		{"LSET jobs 1 B\r\n", "OK"},
+		{"LSET jobs 9 x\r\n", "-ERR index out of range"},
+		{"LMOVE jobs done LEFT RIGHT\r\n", "a"},
+		{"RPUSH jobs c c\r\n", "4"},
+		{"LREM jobs 0 c\r\n", "3"},
+		{"LTRIM jobs 0 0\r\n", "OK"},
+		{"LPOP jobs\r\n", "B"},
+		{"LPOP jobs\r\n", "(nil)"},
+		{"RPOP done 5\r\n", "[a]"},
+		{"TYPE done\r\n", "none"},
+		{"RPUSH q1 x\r\n", "1"},
+		{"TYPE q1\r\n", "list"},
+		{"BLPOP nolist q1 1\r\n", "[q1, x]"},
+		{"BRPOP q1 0.05\r\n", "[]"},
+		{"LPUSH mykey x\r\n", "-WRONGTYPE Operation against a key holding the wrong kind of value"},
+		{"SADD s1 a b c\r\n", "3"},
+		{"SADD s1 a\r\n", "0"},
+		{"SADD s2 b c d\r\n", "3"},
+		{"SISMEMBER s1 a\r\n", "1"},
+		{"SMISMEMBER s1 a z\r\n", "[1, 0]"},
+		{"SCARD s1\r\n", "3"},
+		{"SDIFF s1 s2\r\n", "[a]"},
+		{"SINTERSTORE s3 s1 s2\r\n", "2"},
+		{"SUNIONSTORE s3 s1 s2\r\n", "4"},
+		{"SDIFFSTORE s3 s1 s2 s3\r\n", "0"},
+		{"EXISTS s3\r\n", "0"},
+		{"SREM s1 b c\r\n", "2"},
+		{"SPOP s1\r\n", "a"},
+		{"TYPE s2\r\n", "set"},
+		{"SADD mykey x\r\n", "-WRONGTYPE Operation against a key holding the wrong kind of value"},
+		{"SINTER s2 mykey\r\n", "-WRONGTYPE Operation against a key holding the wrong kind of value"},
+		{"ZADD lb 10 alice 20 bob 15 carol\r\n", "3"},
+		{"ZADD lb XX GT CH 5 alice 30 bob 1 dave\r\n", "1"},
+		{"ZADD lb NX GT 1 x\r\n", "-ERR GT, LT, and/or NX options at the same time are not compatible"},
+		{"ZADD lb INCR 2.5 alice\r\n", "12.5"},
+		{"ZINCRBY lb -0.5 alice\r\n", "12"},
+		{"ZSCORE lb bob\r\n", "30"},
+		{"ZSCORE lb nobody\r\n", "(nil)"},
+		{"ZCARD lb\r\n", "3"},
+		{"ZRANK lb carol\r\n", "1"},
+		{"ZREVRANK lb bob\r\n", "0"},
+		{"ZRANGE lb 0 -1\r\n", "[alice, carol, bob]"},
+		{"ZRANGE lb 0 0 REV WITHSCORES\r\n", "[bob, 30]"},
+		{"ZRANGE lb +inf (12 BYSCORE REV\r\n", "[bob, carol]"},
+		{"ZRANGEBYSCORE lb -inf +inf LIMIT 1 1\r\n", "[carol]"},
+		{"ZREVRANGEBYSCORE lb 20 10 WITHSCORES\r\n", "[carol, 15, alice, 12]"},
+		{"ZRANGE lb 0 1 LIMIT 0 1\r\n", "-ERR syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX"},
+		{"ZADD names 0 a 0 b 0 c\r\n", "3"},
+		{"ZRANGEBYLEX names (a +\r\n", "[b, c]"},
+		{"ZRANGE names [c - BYLEX REV\r\n", "[c, b, a]"},
+		{"ZCOUNT lb (12 +inf\r\n", "2"},
+		{"ZUNIONSTORE lbsum 2 lb names WEIGHTS 2 1\r\n", "6"},
+		{"ZINTERSTORE lbint 2 lb names\r\n", "0"},
+		{"EXISTS lbint\r\n", "0"},
+		{"ZREMRANGEBYSCORE lb -inf 12\r\n", "1"},
+		{"ZPOPMAX lb\r\n", "[bob, 30]"},
+		{"ZPOPMIN lb 5\r\n", "[carol, 15]"},
+		{"TYPE names\r\n", "zset"},
+		{"ZADD mykey 1 x\r\n", "-WRONGTYPE Operation against a key holding the wrong kind of value"},
+		{"ZADD lb 1\r\n", "-ERR wrong number of arguments for 'zadd' command"},
+		{"ZADD lb abc x\r\n", "-ERR value is not a valid float"},
+
+		// Pub/Sub (без подписчиков; доставка — в TestHardPubSub)
+		{"PUBLISH news hello\r\n", "0"},
+		{"PUBSUB CHANNELS\r\n", "[]"},
+		{"PUBSUB NUMSUB news\r\n", "[news, 0]"},
+		{"PUBSUB NUMPAT\r\n", "0"},
+		{"UNSUBSCRIBE\r\n", "[unsubscribe, (nil), 0]"},
+		{"PUBLISH news\r\n", "-ERR wrong number of arguments for 'publish' command"},
+
+		// Транзакции (WATCH между соединениями — в TestHardTransactions)
+		{"MULTI\r\n", "OK"},
+		{"SET txkey 1\r\n", "QUEUED"},
+		{"INCR txkey\r\n", "QUEUED"},
+		{"LPOP nolist\r\n", "QUEUED"},
+		{"EXEC\r\n", "[OK, 2, (nil)]"},
+		{"EXEC\r\n", "-ERR EXEC without MULTI"},
+		{"DISCARD\r\n", "-ERR DISCARD without MULTI"},
+		{"MULTI\r\n", "OK"},
+		{"MULTI\r\n", "-ERR MULTI calls can not be nested"},
+		{"INCR txkey\r\n", "QUEUED"},
+		{"DISCARD\r\n", "OK"},
+		{"GET txkey\r\n", "2"},
+		{"MULTI\r\n", "OK"},
+		{"SUBSCRIBE news\r\n", "-ERR Command not allowed inside a transaction"},
+		{"EXEC\r\n", "-EXECABORT Transaction discarded because of previous errors."},
+		{"MULTI\r\n", "OK"},
+		{"SAVE\r\n", "-ERR Command not allowed inside a transaction"},
+		{"EXEC\r\n", "-EXECABORT Transaction discarded because of previous errors."},
+		{"MULTI\r\n", "OK"},
+		{"FOO\r\n", "-ERR unknown command 'FOO'"},
+		{"SET txabort v\r\n", "QUEUED"},
+		{"EXEC\r\n", "-EXECABORT Transaction discarded because of previous errors."},
+		{"EXISTS txabort\r\n", "0"},
+		{"MULTI\r\n", "OK"},
+		{"SET txabort v\r\n", "QUEUED"},
+		{"GET\r\n", "-ERR wrong number of arguments for 'get' command"},
+		{"EXEC\r\n", "-EXECABORT Transaction discarded because of previous errors."},
+		{"EXISTS txabort\r\n", "0"},
+
+		// Lua (скрипты с пробелами — в TestHardScripting)
+		{"EVAL return(ARGV[1]) 0 hi\r\n", "hi"},
+		{"EVAL return(redis.call('INCR',KEYS[1])) 1 txkey\r\n", "3"},
+		{"EVAL return({1,'a',false,true}) 0\r\n", "[1, a, (nil), 1]"},
+		{"EVAL return(redis.call('LPUSH',KEYS[1],'x')) 1 txkey\r\n", "-WRONGTYPE Operation against a key holding the wrong kind of value"},
+		{"EVAL return(redis.pcall('LPUSH',KEYS[1],'x')['err']) 1 txkey\r\n", "WRONGTYPE Operation against a key holding the wrong kind of value"},
+		{"EVAL return(redis.status_reply('FINE')) 0\r\n", "FINE"},
+		{"EVAL return(redis.call('EVAL','return(1)','0')) 0\r\n", "-ERR This Redis command is not allowed from script"},
+		{"EVAL return(redis.call('SAVE')) 0\r\n", "-ERR This Redis command is not allowed from script"},
+		{"EVAL return(1) 2 k\r\n", "-ERR Number of keys can't be greater than number of args"},
+		{"SCRIPT LOAD return(1)\r\n", "930269f31393d0be681588b6ab08dccee7d6bb67"},
+		{"EVALSHA 930269f31393d0be681588b6ab08dccee7d6bb67 0\r\n", "1"},
+		{"SCRIPT EXISTS 930269f31393d0be681588b6ab08dccee7d6bb67 ffff\r\n", "[1, 0]"},
+		{"SCRIPT FLUSH\r\n", "OK"},
+		{"EVALSHA 930269f31393d0be681588b6ab08dccee7d6bb67 0\r\n", "-NOSCRIPT No matching script. Please use EVAL."},
+		{"SCRIPT KILL\r\n", "-NOTBUSY No scripts in execution right now."},
+
+		// SCAN (гарантии обхода — в storage.TestScanConcurrentWrites)
+		{"SCAN 0 MATCH renamenew COUNT 1000\r\n", "[0, [renamenew]]"},
+		{"SCAN 0 TYPE zset MATCH nam* COUNT 1000\r\n", "[0, [names]]"},
+		{"SCAN abc\r\n", "-ERR invalid cursor"},
+		{"SCAN 0 COUNT 0\r\n", "-ERR syntax error"},
+		{"SCAN 0 NOVALUES\r\n", "-ERR syntax error"},
+		{"HSET hs f1 v1\r\n", "1"},
+		{"HSCAN hs 0\r\n", "[0, [f1, v1]]"},
+		{"HSCAN hs 0 MATCH f* NOVALUES\r\n", "[0, [f1]]"},
+		{"SSCAN s2 0 MATCH d\r\n", "[0, [d]]"},
+		{"ZSCAN lbsum 0 MATCH bob\r\n", "[0, [bob, 60]]"},
+		{"ZSCAN hs 0\r\n", "-WRONGTYPE Operation against a key holding the wrong kind of value"},
+
+		// CONFIG
+		{"CONFIG SET appendfsync always\r\n", "OK"},
+		{"CONFIG GET append*\r\n", "[appendfsync, always]"},
+		{"CONFIG SET appendfsync sometimes\r\n", "-ERR CONFIG SET failed (possibly related to argument 'appendfsync') - invalid appendfsync \"sometimes\" (want always, everysec or no)"},
+		{"CONFIG GET appendfsync\r\n", "[appendfsync, always]"},
+		{"CONFIG SET maxclients 100\r\n", "OK"},
+		{"CONFIG SET auto-aof-rewrite-min-size 1mb\r\n", "OK"},
+		{"CONFIG GET auto-aof-rewrite-*\r\n", "[auto-aof-rewrite-min-size, 1048576, auto-aof-rewrite-percentage, 100]"},
+		{"CONFIG SET auto-aof-rewrite-percentage -1\r\n", "-ERR CONFIG SET failed (possibly related to argument 'auto-aof-rewrite-percentage') - argument must be a non-negative integer"},
+		{"BGREWRITEAOF\r\n", "Background append only file rewriting started"},
+
+		// Снимки
+		{"*4\r\n$6\r\nCONFIG\r\n$3\r\nSET\r\n$4\r\nsave\r\n$8\r\n900 1 60\r\n", "-ERR CONFIG SET failed (possibly related to argument 'save') - invalid save \"900 1 60\" (want <seconds> <changes> pairs)"},
+		{"*4\r\n$6\r\nCONFIG\r\n$3\r\nSET\r\n$4\r\nsave\r\n$5\r\n900 1\r\n", "OK"},
+		{"CONFIG GET save\r\n", "[save, 900 1]"},
+		{"SAVE\r\n", "OK"},
+		{"BGSAVE\r\n", "Background saving started"},
 	}
 
 	fmt.Println("╔══════════════════════════════════════════════════╗")
@@ -858,3 +1062,675 @@ func TestHardMixedChaos(t *testing.T) {
 
 	fmt.Println("╚══════════════════════════════════════════════════╝")
 }
+
+// ====================================================================
+// TEST: BLPOP блокирует только своё соединение
+// ====================================================================
+
+func TestHardBlockingPop(t *testing.T) {
+	addr, _ := startTestServer(t)
+
+	blocked, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer blocked.Close()
+
+	other, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+
+	blockedReader := bufio.NewReader(blocked)
+	otherReader := bufio.NewReader(other)
+
+	blocked.Write([]byte("BLPOP queue 5\r\n"))
+
+	reply := make(chan string, 1)
+	go func() {
+		resp, _ := readRESPReply(blockedReader)
+		reply <- resp
+	}()
+
+	// Другое соединение продолжает работать, пока первое ждёт
+	time.Sleep(50 * time.Millisecond)
+	start := time.Now()
+	other.Write([]byte("SET k v\r\n"))
+	if resp, _ := readRESPReply(otherReader); resp != "OK" {
+		t.Fatalf("SET while BLPOP waits: %q", resp)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("other connection stalled for %v", elapsed)
+	}
+
+	other.Write([]byte("RPUSH queue job\r\n"))
+	readRESPReply(otherReader)
+
+	select {
+	case resp := <-reply:
+		if resp != "[queue, job]" {
+			t.Fatalf("BLPOP = %q", resp)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("BLPOP was not woken up by RPUSH")
+	}
+
+	// Соединение после блокировки остаётся рабочим
+	blocked.Write([]byte("PING\r\n"))
+	if resp, _ := readRESPReply(blockedReader); resp != "PONG" {
+		t.Fatalf("PING after BLPOP = %q", resp)
+	}
+}
+
+// ====================================================================
+// TEST: Pub/Sub между соединениями
+// ====================================================================
+
+func TestHardPubSub(t *testing.T) {
+	addr, _ := startTestServer(t)
+
+	subscriber, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer subscriber.Close()
+
+	publisher, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer publisher.Close()
+
+	subReader := bufio.NewReader(subscriber)
+	pubReader := bufio.NewReader(publisher)
+
+	expect := func(reader *bufio.Reader, want string) {
+		t.Helper()
+		if resp, err := readRESPReply(reader); err != nil || resp != want {
+			t.Fatalf("reply = %q, %v; want %q", resp, err, want)
+		}
+	}
+
+	subscriber.Write([]byte("SUBSCRIBE news sport\r\n"))
+	expect(subReader, "[subscribe, news, 1]")
+	expect(subReader, "[subscribe, sport, 2]")
+	subscriber.Write([]byte("PSUBSCRIBE news.*\r\n"))
+	expect(subReader, "[psubscribe, news.*, 3]")
+
+	// В режиме подписки обычные команды запрещены, PING отвечает массивом
+	subscriber.Write([]byte("GET k\r\n"))
+	expect(subReader, "-ERR Can't execute 'get': only (P|S)SUBSCRIBE / (P|S)UNSUBSCRIBE / PING / QUIT / RESET are allowed in this context")
+	subscriber.Write([]byte("PING\r\n"))
+	expect(subReader, "[pong, ]")
+
+	publisher.Write([]byte("PUBSUB NUMSUB news nobody\r\n"))
+	expect(pubReader, "[news, 1, nobody, 0]")
+	publisher.Write([]byte("PUBSUB CHANNELS s*\r\n"))
+	expect(pubReader, "[sport]")
+	publisher.Write([]byte("PUBSUB NUMPAT\r\n"))
+	expect(pubReader, "1")
+
+	publisher.Write([]byte("PUBLISH news hello\r\n"))
+	expect(pubReader, "1")
+	expect(subReader, "[message, news, hello]")
+	publisher.Write([]byte("PUBLISH news.tech go\r\n"))
+	expect(pubReader, "1")
+	expect(subReader, "[pmessage, news.*, news.tech, go]")
+
+	// Отписка от всего возвращает соединение в обычный режим
+	subscriber.Write([]byte("UNSUBSCRIBE\r\n"))
+	expect(subReader, "[unsubscribe, news, 2]")
+	expect(subReader, "[unsubscribe, sport, 1]")
+	subscriber.Write([]byte("PUNSUBSCRIBE\r\n"))
+	expect(subReader, "[punsubscribe, news.*, 0]")
+	subscriber.Write([]byte("GET k\r\n"))
+	expect(subReader, "(nil)")
+
+	publisher.Write([]byte("PUBLISH news again\r\n"))
+	expect(pubReader, "0")
+}
+
+// ====================================================================
+// TEST: MULTI/EXEC атомарны, WATCH отменяет EXEC после чужой записи
+// ====================================================================
+
+func TestHardTransactions(t *testing.T) {
+	addr, _ := startTestServer(t)
+
+	dial := func() (net.Conn, *bufio.Reader) {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		return conn, bufio.NewReader(conn)
+	}
+	do := func(conn net.Conn, reader *bufio.Reader, cmd string) string {
+		t.Helper()
+		conn.Write([]byte(cmd + "\r\n"))
+		resp, err := readRESPReply(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	a, ar := dial()
+	b, br := dial()
+
+	// Чужая запись после WATCH — EXEC возвращает nil и ничего не применяет
+	do(a, ar, "SET balance 100")
+	do(a, ar, "WATCH balance")
+	do(b, br, "DECRBY balance 30")
+	do(a, ar, "MULTI")
+	do(a, ar, "SET balance 0")
+	if resp := do(a, ar, "EXEC"); resp != "[]" {
+		t.Fatalf("EXEC after concurrent write = %q, want nil", resp)
+	}
+	if resp := do(a, ar, "GET balance"); resp != "70" {
+		t.Fatalf("balance = %q, want 70", resp)
+	}
+
+	// Без чужих записей — транзакция проходит
+	do(a, ar, "WATCH balance")
+	do(a, ar, "MULTI")
+	do(a, ar, "DECRBY balance 70")
+	do(a, ar, "INCRBY stock 1")
+	if resp := do(a, ar, "EXEC"); resp != "[0, 1]" {
+		t.Fatalf("EXEC = %q", resp)
+	}
+
+	// Истечение TTL тоже считается изменением
+	do(a, ar, "SET lease x PX 50")
+	do(a, ar, "WATCH lease")
+	time.Sleep(100 * time.Millisecond)
+	do(a, ar, "MULTI")
+	do(a, ar, "SET lease y")
+	if resp := do(a, ar, "EXEC"); resp != "[]" {
+		t.Fatalf("EXEC after expiry = %q, want nil", resp)
+	}
+
+	// Атомарность: параллельные INCR не вклиниваются между GET и SET
+	const workers, rounds = 8, 200
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conn, err := net.Dial("tcp", addr)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer conn.Close()
+			reader := bufio.NewReader(conn)
+			for i := 0; i < rounds; i++ {
+				conn.Write([]byte("MULTI\r\nINCR counter\r\nINCR counter\r\nEXEC\r\n"))
+				for j := 0; j < 3; j++ {
+					readRESPReply(reader)
+				}
+				resp, _ := readRESPReply(reader)
+				var x, y int
+				if _, err := fmt.Sscanf(resp, "[%d, %d]", &x, &y); err != nil || y != x+1 {
+					t.Errorf("EXEC = %q: increments interleaved", resp)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if resp := do(a, ar, "GET counter"); resp != strconv.Itoa(workers*rounds*2) {
+		t.Fatalf("counter = %q, want %d", resp, workers*rounds*2)
+	}
+}
+
+// ====================================================================
+// TEST: Lua — атомарность, EVALSHA, изоляция глобалов, SCRIPT KILL
+// ====================================================================
+
+// respCommand кодирует команду в multibulk (аргументы с пробелами).
+func respCommand(args ...string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	return b.String()
+}
+
+func TestHardScripting(t *testing.T) {
+	addr, _ := startTestServer(t, WithScriptTimeLimit(100*time.Millisecond))
+
+	dial := func() (net.Conn, *bufio.Reader) {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		return conn, bufio.NewReader(conn)
+	}
+	do := func(conn net.Conn, reader *bufio.Reader, args ...string) string {
+		t.Helper()
+		conn.Write([]byte(respCommand(args...)))
+		resp, err := readRESPReply(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	a, ar := dial()
+
+	// Rate limiter: GET и SET из разных клиентов не вклиниваются в скрипт
+	const limiter = `
+local current = tonumber(redis.call('GET', KEYS[1]) or '0')
+if current >= tonumber(ARGV[1]) then
+    return 0
+end
+redis.call('SET', KEYS[1], current + 1)
+return 1`
+	sha := do(a, ar, "SCRIPT", "LOAD", limiter)
+
+	const workers, rounds, limit = 8, 100, 500
+	var allowed atomic.Int64
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conn, err := net.Dial("tcp", addr)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer conn.Close()
+			reader := bufio.NewReader(conn)
+			for i := 0; i < rounds; i++ {
+				conn.Write([]byte(respCommand("EVALSHA", sha, "1", "hits", strconv.Itoa(limit))))
+				if resp, _ := readRESPReply(reader); resp == "1" {
+					allowed.Add(1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if allowed.Load() != limit {
+		t.Fatalf("allowed = %d, want %d", allowed.Load(), limit)
+	}
+	if resp := do(a, ar, "GET", "hits"); resp != strconv.Itoa(limit) {
+		t.Fatalf("hits = %q, want %d", resp, limit)
+	}
+
+	// Глобальные переменные не переживают скрипт
+	if resp := do(a, ar, "EVAL", "leak = 1", "0"); !strings.Contains(resp, "Script attempted to create global variable 'leak'") {
+		t.Fatalf("global write = %q", resp)
+	}
+	if resp := do(a, ar, "EVAL", "return type(KEYS)", "0"); resp != "table" {
+		t.Fatalf("type(KEYS) = %q", resp)
+	}
+	if resp := do(a, ar, "EVAL", "return {", "0"); !strings.HasPrefix(resp, "-ERR Error compiling script") {
+		t.Fatalf("syntax error = %q", resp)
+	}
+
+	// Долгий скрипт: после лимита остальным — BUSY, SCRIPT KILL прерывает
+	done := make(chan string, 1)
+	go func() {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			done <- err.Error()
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte(respCommand("EVAL", "while true do end", "0")))
+		resp, _ := readRESPReply(bufio.NewReader(conn))
+		done <- resp
+	}()
+
+	b, br := dial()
+	time.Sleep(50 * time.Millisecond)
+	if resp := do(b, br, "PING"); !strings.HasPrefix(resp, "-BUSY") {
+		t.Fatalf("PING during long script = %q, want BUSY", resp)
+	}
+	if resp := do(b, br, "SCRIPT", "KILL"); resp != "OK" {
+		t.Fatalf("SCRIPT KILL = %q", resp)
+	}
+	if resp := <-done; resp != "-ERR Script killed by user with SCRIPT KILL..." {
+		t.Fatalf("killed script reply = %q", resp)
+	}
+	if resp := do(b, br, "EVAL", "return redis.call('GET', KEYS[1])", "1", "hits"); resp != strconv.Itoa(limit) {
+		t.Fatalf("EVAL after kill = %q", resp)
+	}
+}
+
+// ====================================================================
+// TEST: DUMP/RESTORE и SYNC — payload и RDB в формате Redis
+// ====================================================================
+
+func TestDumpRestoreSync(t *testing.T) {
+	addr, _ := startTestServer(t)
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	do := func(args ...string) string {
+		t.Helper()
+		conn.Write([]byte(respCommand(args...)))
+		resp, err := readRESPReply(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	do("RPUSH", "list", "a", "b")
+	do("ZADD", "z", "1.5", "m")
+	payload := do("DUMP", "list")
+	steps := []struct {
+		args []string
+		want string
+	}{
+		// DUMP mykey из документации Redis (mykey = 10)
+		{[]string{"RESTORE", "redis", "0", "\x00\xc0\n\t\x00\xbem\x06\x89Z(\x00\n"}, "OK"},
+		{[]string{"GET", "redis"}, "10"},
+		{[]string{"RESTORE", "copy", "60000", payload}, "OK"},
+		{[]string{"LRANGE", "copy", "0", "-1"}, "[a, b]"},
+		{[]string{"RESTORE", "copy", "0", payload}, "-BUSYKEY Target key name already exists."},
+		{[]string{"RESTORE", "z", "0", payload, "REPLACE", "IDLETIME", "10"}, "OK"},
+		{[]string{"TYPE", "z"}, "list"},
+		{[]string{"RESTORE", "gone", "1000", payload, "ABSTTL"}, "OK"},
+		{[]string{"EXISTS", "gone"}, "0"},
+		{[]string{"RESTORE", "bad", "0", payload[:len(payload)-1] + "x"}, "-ERR DUMP payload version or checksum are wrong"},
+		{[]string{"RESTORE", "bad", "-1", payload}, "-ERR Invalid TTL value, must be >= 0"},
+		{[]string{"DUMP", "missing"}, "(nil)"},
+	}
+	for _, st := range steps {
+		if got := do(st.args...); got != st.want {
+			t.Errorf("%q = %q, want %q", st.args, got, st.want)
+		}
+	}
+	if pttl, _ := strconv.Atoi(do("PTTL", "copy")); pttl <= 0 || pttl > 60000 {
+		t.Fatalf("PTTL copy = %d", pttl)
+	}
+
+	// SYNC: $<длина>\r\n и RDB без завершающего \r\n
+	do("REPLCONF", "rdb-only", "1")
+	conn.Write([]byte(respCommand("SYNC")))
+	line, _ := reader.ReadString('\n')
+	size, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "$")))
+	if err != nil {
+		t.Fatalf("SYNC header %q", line)
+	}
+	rdb := make([]byte, size)
+	if _, err := io.ReadFull(reader, rdb); err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	if _, err := RDB.Load(bytes.NewReader(rdb), func(e *RDB.Entry) error {
+		keys = append(keys, e.Key)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(keys)
+	if fmt.Sprint(keys) != "[copy list redis z]" {
+		t.Fatalf("SYNC keys = %v", keys)
+	}
+	if resp := do("PING"); resp != "PONG" {
+		t.Fatalf("PING after SYNC = %q", resp)
+	}
+}
+
+// TestMaxMemory — те же 1MB значения, что в TestHardBigValues, под
+// maxmemory: noeviction отвечает OOM, allkeys-lru держит лимит.
+func TestMaxMemory(t *testing.T) {
+	addr, cache := startTestServer(t)
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	do := func(args ...string) string {
+		t.Helper()
+		conn.Write([]byte(respCommand(args...)))
+		resp, err := readRESPReply(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	info := func(field string) int64 {
+		t.Helper()
+		for _, line := range strings.Split(do("INFO"), "\r\n") {
+			if value, ok := strings.CutPrefix(line, field+":"); ok {
+				n, _ := strconv.ParseInt(value, 10, 64)
+				return n
+			}
+		}
+		t.Fatalf("INFO has no %s", field)
+		return 0
+	}
+
+	bigVal := strings.Repeat("x", 1024*1024)
+	if resp := do("CONFIG", "SET", "maxmemory", "3mb"); resp != "OK" {
+		t.Fatalf("CONFIG SET maxmemory = %q", resp)
+	}
+
+	var oom string
+	for i := 0; i < 10 && oom == ""; i++ {
+		if resp := do("SET", fmt.Sprintf("big:%d", i), bigVal); resp != "OK" {
+			oom = resp
+		}
+	}
+	if oom != "-"+storage.ErrOOM.Error() {
+		t.Fatalf("noeviction: %q", oom)
+	}
+	if resp := do("RPUSH", "list", "x"); resp != oom {
+		t.Fatalf("RPUSH over limit = %q", resp)
+	}
+	if resp := do("GET", "big:0"); resp != bigVal {
+		t.Fatal("GET over limit failed")
+	}
+
+	do("CONFIG", "SET", "maxmemory-policy", "allkeys-lru")
+	do("CONFIG", "SET", "maxmemory-samples", "10")
+	if resp := do("CONFIG", "SET", "maxmemory-samples", "0"); !strings.HasSuffix(resp, "argument must be a positive integer") {
+		t.Fatalf("CONFIG SET maxmemory-samples 0 = %q", resp)
+	}
+	if resp := do("CONFIG", "GET", "maxmemory*"); resp != "[maxmemory, 3145728, maxmemory-policy, allkeys-lru, maxmemory-samples, 10]" {
+		t.Fatalf("CONFIG GET = %q", resp)
+	}
+	for i := 0; i < 10; i++ {
+		// LRU-часы идут с точностью в секунду: последний ключ пишем
+		// в следующей, чтобы он был заведомо самым свежим
+		if i == 9 {
+			time.Sleep(1100 * time.Millisecond)
+		}
+		if resp := do("SET", fmt.Sprintf("big:%d", i), bigVal); resp != "OK" {
+			t.Fatalf("allkeys-lru SET big:%d = %q", i, resp)
+		}
+	}
+	// Вытеснение идёт перед записью и в фоне, поэтому лимит можно
+	// превысить на одно значение
+	used := info("used_memory")
+	for deadline := time.Now().Add(time.Second); used > 3<<20+int64(len(bigVal))+1024 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+		used = info("used_memory")
+	}
+	if used > 3<<20+int64(len(bigVal))+1024 || used != cache.UsedMemory() {
+		t.Fatalf("used_memory = %d", used)
+	}
+	if evicted := info("evicted_keys"); evicted < 7 {
+		t.Fatalf("evicted_keys = %d", evicted)
+	}
+	if resp := do("GET", "big:9"); resp != bigVal {
+		t.Fatal("last written key evicted")
+	}
+}
+
+// TestObjectFreq — OBJECT FREQ, RESTORE ... FREQ и параметры LFU в CONFIG.
+func TestObjectFreq(t *testing.T) {
+	addr, _ := startTestServer(t)
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	do := func(args ...string) string {
+		t.Helper()
+		conn.Write([]byte(respCommand(args...)))
+		resp, err := readRESPReply(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	do("SET", "k", "v")
+	payload := do("DUMP", "k")
+	steps := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"OBJECT", "FREQ", "k"}, "5"},
+		{[]string{"OBJECT", "FREQ", "missing"}, "(nil)"},
+		{[]string{"OBJECT", "FREQ"}, "-ERR wrong number of arguments for 'object|freq' command"},
+		{[]string{"OBJECT", "ENCODING", "k"}, "-ERR unknown subcommand 'ENCODING'. Try OBJECT HELP."},
+		{[]string{"CONFIG", "SET", "lfu-log-factor", "0"}, "OK"},
+		{[]string{"CONFIG", "SET", "lfu-decay-time", "-1"}, "-ERR CONFIG SET failed (possibly related to argument 'lfu-decay-time') - argument must be a non-negative integer"},
+		{[]string{"CONFIG", "GET", "lfu-*"}, "[lfu-decay-time, 1, lfu-log-factor, 0]"},
+		{[]string{"GET", "k"}, "v"},
+		{[]string{"GET", "k"}, "v"},
+		{[]string{"OBJECT", "FREQ", "k"}, "7"},
+		{[]string{"RESTORE", "copy", "0", payload, "FREQ", "100"}, "OK"},
+		{[]string{"OBJECT", "FREQ", "copy"}, "100"},
+		{[]string{"RESTORE", "copy", "0", payload, "REPLACE", "FREQ", "256"}, "-ERR Invalid FREQ value, must be >= 0 and <= 255"},
+	}
+	for _, st := range steps {
+		if got := do(st.args...); got != st.want {
+			t.Errorf("%q = %q, want %q", st.args, got, st.want)
+		}
+	}
+}
+
+// TestColdConfig — параметры cold storage в CONFIG и секция Cold в INFO.
+func TestColdConfig(t *testing.T) {
+	addr, cache := startTestServer(t)
+	if err := cache.InitColdStorage(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	do := func(args ...string) string {
+		t.Helper()
+		conn.Write([]byte(respCommand(args...)))
+		resp, err := readRESPReply(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	info := func(field string) string {
+		t.Helper()
+		for _, line := range strings.Split(do("INFO"), "\r\n") {
+			if value, ok := strings.CutPrefix(line, field+":"); ok {
+				return value
+			}
+		}
+		t.Fatalf("INFO has no %s", field)
+		return ""
+	}
+
+	do("SET", "user:1", "value")
+	do("SET", "session:1", "value")
+	do("SET", "user:2", "abc")
+	steps := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"CONFIG", "SET", "cold-idle-time", "1", "cold-deny", "session:* tmp:*", "cold-min-value-size", "4"}, "OK"},
+		{[]string{"CONFIG", "SET", "cold-samples", "0"}, "-ERR CONFIG SET failed (possibly related to argument 'cold-samples') - argument must be a positive integer"},
+		{[]string{"CONFIG", "SET", "cold-idle-time", "-1"}, "-ERR CONFIG SET failed (possibly related to argument 'cold-idle-time') - argument must be a non-negative integer"},
+		{[]string{"CONFIG", "SET", "cold-max-size", "1x"}, "-ERR CONFIG SET failed (possibly related to argument 'cold-max-size') - argument must be a memory value"},
+		{[]string{"CONFIG", "GET", "cold-*"}, "[cold-allow, , cold-deny, session:* tmp:*, cold-flush-interval, 30, cold-idle-time, 1, cold-interval, 10, cold-max-size, 0, cold-min-value-size, 4, cold-samples, 16]"},
+	}
+	for _, st := range steps {
+		if got := do(st.args...); got != st.want {
+			t.Errorf("%q = %q, want %q", st.args, got, st.want)
+		}
+	}
+
+	// Часы LRU идут с точностью в секунду
+	time.Sleep(2100 * time.Millisecond)
+	cache.EvictCold()
+	if keys, demoted := info("cold_keys"), info("cold_demoted_keys"); keys != "1" || demoted != "1" {
+		t.Fatalf("cold_keys = %s, cold_demoted_keys = %s", keys, demoted)
+	}
+	if resp := do("TTL", "user:1"); resp != "-1" {
+		t.Fatalf("TTL of demoted key = %q", resp)
+	}
+	if resp := do("GET", "user:1"); resp != "value" {
+		t.Fatalf("GET of demoted key = %q", resp)
+	}
+	if keys, promoted := info("cold_keys"), info("cold_promoted_keys"); keys != "0" || promoted != "1" {
+		t.Fatalf("cold_keys = %s, cold_promoted_keys = %s", keys, promoted)
+	}
+}
+
+// TestAOFWriteError — сбой записи журнала возвращается клиенту ошибкой
+// MISCONF, хотя команда уже выполнена.
+func TestAOFWriteError(t *testing.T) {
+	addr, _ := startTestServerWith(t, &failingPersistence{})
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	misconf := "-MISCONF Errors writing to the AOF file: no space left on device"
+	steps := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"SET", "k", "v"}, misconf},
+		{[]string{"GET", "k"}, "v"},
+		{[]string{"INCR", "n"}, misconf},
+		{[]string{"EXPIRE", "n", "100"}, misconf},
+		{[]string{"RPUSH", "l", "a"}, misconf},
+		{[]string{"DEL", "k"}, misconf},
+		{[]string{"EXISTS", "k"}, "0"},
+		{[]string{"MULTI"}, "OK"},
+		{[]string{"SET", "tx", "1"}, "QUEUED"},
+		// EXEC отдаёт ответы выполненных команд, сбой — в INFO
+		{[]string{"EXEC"}, "[OK]"},
+		{[]string{"GET", "tx"}, "1"},
+	}
+	for _, st := range steps {
+		conn.Write([]byte(respCommand(st.args...)))
+		got, err := readRESPReply(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != st.want {
+			t.Errorf("%q = %q, want %q", st.args, got, st.want)
+		}
+	}
+
+	conn.Write([]byte(respCommand("INFO")))
+	info, err := readRESPReply(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(info, "exec_write_errors:1\r\n") {
+		t.Errorf("INFO has no failed EXEC:\n%s", info)
+	}
+}
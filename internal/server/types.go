@@ -3,6 +3,8 @@ package server
 import (
 	"net"
 
+	"imcs/internal/persistence/AOF"
+	"imcs/internal/pubsub"
 	"imcs/internal/storage/cache"
 )
 
@@ -11,6 +13,10 @@ type Server struct {
 	addr     string
 	cache    *storage.Cache
 	password string // optional AUTH password
+	bus      *pubsub.Bus
+	scripts  *scriptEngine
+	config   map[string]configParam // параметры CONFIG GET/SET
+	aof      *AOF.AOFPersister      // nil — журнал не подключён
 	listener net.Listener
 	stopCh   chan struct{}
 }
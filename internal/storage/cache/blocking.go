@@ -0,0 +1,157 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+/*
+	Блокирующие операции над списками (BLPOP, BRPOP, BLMOVE).
+
+	Заблокированный клиент регистрирует канал на всех своих ключах и ждёт
+	сигнала от push. Сигнал — лишь подсказка «попробуй ещё раз»: элемент
+	может забрать другой клиент, тогда ожидание продолжается.
+	Блокируется только горутина клиента — шарды не удерживаются.
+*/
+
+// add регистрирует канал ожидания на ключах.
+func (w *listWaiters) add(keys []string) chan struct{} {
+	ch := make(chan struct{}, 1)
+
+	w.mu.Lock()
+	if w.waiters == nil {
+		w.waiters = make(map[string]map[chan struct{}]struct{})
+	}
+	for _, key := range keys {
+		set := w.waiters[key]
+		if set == nil {
+			set = make(map[chan struct{}]struct{})
+			w.waiters[key] = set
+		}
+		set[ch] = struct{}{}
+	}
+	w.mu.Unlock()
+
+	w.count.Add(1)
+	return ch
+}
+
+// remove снимает канал ожидания с ключей.
+func (w *listWaiters) remove(keys []string, ch chan struct{}) {
+	w.mu.Lock()
+	for _, key := range keys {
+		if set := w.waiters[key]; set != nil {
+			delete(set, ch)
+			if len(set) == 0 {
+				delete(w.waiters, key)
+			}
+		}
+	}
+	w.mu.Unlock()
+
+	w.count.Add(-1)
+}
+
+// notify будит всех, кто ждёт данный ключ.
+func (w *listWaiters) notify(key string) {
+	if w.count.Load() == 0 {
+		return
+	}
+
+	w.mu.Lock()
+	for ch := range w.waiters[key] {
+		select {
+		case ch <- struct{}{}:
+		default: // сигнал уже ждёт обработки
+		}
+	}
+	w.mu.Unlock()
+}
+
+// Blocked возвращает число клиентов, заблокированных на списках.
+func (c *Cache) Blocked() int {
+	return int(c.blocked.count.Load())
+}
+
+// block повторяет try, пока тот не вернёт done = true, не истечёт timeout
+// (0 = ждать бесконечно) или не отменится ctx.
+// Возвращает false по таймауту или отмене.
+func (c *Cache) block(ctx context.Context, keys []string, timeout time.Duration, try func() bool) bool {
+	// Без ожидания (ctx уже отменён) — одна попытка в контексте вызывающего:
+	// так блокирующие команды выполняются внутри EXEC
+	if ctx.Err() != nil {
+		return try()
+	}
+
+	// Ожидающий клиент выполняется вне Shared, поэтому каждую попытку
+	// берём под ним сами — элемент не заберут посреди EXEC
+	try = c.sharedTry(try)
+	if try() {
+		return true
+	}
+
+	ch := c.blocked.add(keys)
+	defer c.blocked.remove(keys, ch)
+
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	for {
+		// Повторная попытка после регистрации: push мог случиться между
+		// первой попыткой и add
+		if try() {
+			return true
+		}
+
+		select {
+		case <-ch:
+		case <-deadline:
+			return false
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// sharedTry оборачивает попытку в Shared.
+func (c *Cache) sharedTry(try func() bool) func() bool {
+	return func() (done bool) {
+		c.Shared(func() { done = try() })
+		return done
+	}
+}
+
+// BPop извлекает элемент из первого непустого списка среди keys,
+// ожидая появления данных до timeout (0 = бесконечно).
+// ok = false — таймаут или отмена ctx.
+func (c *Cache) BPop(ctx context.Context, keys []string, left bool, timeout time.Duration) (key, value string, ok bool, err error) {
+	c.block(ctx, keys, timeout, func() bool {
+		for _, k := range keys {
+			var values []string
+			values, err = c.pop(k, 1, left)
+			if len(values) > 0 {
+				key, value, ok = k, values[0], true
+				return true
+			}
+			if err != nil {
+				return true
+			}
+		}
+		return false
+	})
+	return key, value, ok, err
+}
+
+// BLMove — блокирующий LMOVE: ждёт появления элемента в src до timeout.
+func (c *Cache) BLMove(ctx context.Context, src, dst string, fromLeft, toLeft bool, timeout time.Duration) (value string, ok bool, err error) {
+	var moved bool
+	c.block(ctx, []string{src}, timeout, func() bool {
+		value, moved, err = c.LMove(src, dst, fromLeft, toLeft)
+		return moved || err != nil
+	})
+	return value, moved, err
+}
@@ -8,8 +8,28 @@ import (
 	"imcs/internal/storage/cold"
 )
 
-// ErrKeyExist возвращается при SET NX, если ключ уже существует.
-var ErrKeyExist = errors.New("key already exists")
+var (
+	// ErrKeyExist возвращается при SET NX, если ключ уже существует.
+	ErrKeyExist = errors.New("key already exists")
+
+	// ErrWrongType возвращается при операции над ключом другого типа.
+	ErrWrongType = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+
+	// ErrHashValueNotInt возвращается HINCRBY, если поле не число.
+	ErrHashValueNotInt = errors.New("hash value is not an integer")
+
+	// ErrOverflow возвращается при переполнении int64 в инкрементах.
+	ErrOverflow = errors.New("increment or decrement would overflow")
+
+	// ErrNoSuchKey возвращается LSET по несуществующему ключу.
+	ErrNoSuchKey = errors.New("no such key")
+
+	// ErrIndexOutOfRange возвращается LSET с индексом за пределами списка.
+	ErrIndexOutOfRange = errors.New("index out of range")
+
+	// ErrTxReadOnly возвращается записью внутри View.
+	ErrTxReadOnly = errors.New("transaction is read-only")
+)
 
 // New создаёт шардированный кеш без лимита ключей.
 func New(p Persistence) *Cache {
@@ -19,14 +39,19 @@ func New(p Persistence) *Cache {
 // NewWithMaxKeys создаёт кеш с лимитом ключей.
 func NewWithMaxKeys(p Persistence, maxKeys int64) *Cache {
 	c := &Cache{
+		core: &core{
+			maxKeys: maxKeys,
+			stopCh:  make(chan struct{}),
+		},
 		persister: p,
-		maxKeys:   maxKeys,
-		flushCh:   make(chan coldItem, flushChanSize),
-		stopCh:    make(chan struct{}),
 	}
 
+	c.pool.samples.Store(defaultEvictionSamples)
+	c.SetColdPolicy(DefaultColdPolicy())
+	c.lfu.logFactor.Store(defaultLFULogFactor)
+	c.lfu.decayTime.Store(defaultLFUDecayTime)
 	for i := 0; i < shardCount; i++ {
-		c.shards[i] = newShard()
+		c.shards[i] = newShard(&c.lfu)
 	}
 
 	return c
@@ -39,11 +64,6 @@ func (c *Cache) InitColdStorage(dir string) error {
 		return err
 	}
 	c.cold = store
-
-	for i := 0; i < flushWorkers; i++ {
-		go c.flushWorker(i)
-	}
-
 	return nil
 }
 
@@ -61,19 +81,13 @@ func (c *Cache) Set(key, value string, duration time.Duration, nx bool) error {
 		item, found := s.items[key]
 		s.RUnlock()
 
-		if found && !item.IsExpired() {
+		if found && !item.IsExpired() || c.cold != nil && c.cold.Has(key) {
 			return ErrKeyExist
 		}
 	}
 
-	if c.maxKeys > 0 {
-		s.RLock()
-		_, exists := s.items[key]
-		s.RUnlock()
-
-		if !exists && c.totalKeys.Load() >= c.maxKeys {
-			c.evictLRU()
-		}
+	if err := c.reserve(s, key); err != nil {
+		return err
 	}
 
 	isNew := s.set(key, value, expireAt)
@@ -85,9 +99,7 @@ func (c *Cache) Set(key, value string, duration time.Duration, nx bool) error {
 		c.cold.Delete(key)
 	}
 
-	c.persister.Write("SET", key, value, duration)
-
-	return nil
+	return c.durable(nil, c.persister.Write("SET", key, value, duration))
 }
 
 // Get возвращает значение по ключу (RAM → cold storage).
@@ -98,31 +110,77 @@ func (c *Cache) Get(key string) (string, bool) {
 		return val, true
 	}
 
-	if c.cold != nil {
-		val, found = c.cold.Get(key)
-		if found {
-			s.set(key, val, 0)
-			c.totalKeys.Add(1)
-			c.cold.Delete(key)
-			return val, true
-		}
+	if c.promote(s, key) {
+		return s.get(key)
 	}
 
 	return "", false
 }
 
-// Delete удаляет ключ из RAM и cold storage.
-func (c *Cache) Delete(key string) {
-	s := c.getShard(key)
-	if s.del(key) {
+// promote поднимает ключ из cold storage обратно в RAM вместе с TTL.
+// Чтение с диска идёт под блокировкой шарда: иначе SET или DEL, успевшие
+// между чтением и записью в RAM, были бы затёрты прежним значением.
+// Ключ пишется в AOF до удаления из cold: rewrite и Save ключи cold
+// не сохраняют, и без записи поднятый ключ пропал бы после рестарта.
+// Возвращает true, если ключ найден в cold или уже появился в RAM.
+func (c *Cache) promote(s *shard, key string) bool {
+	if c.cold == nil || !c.cold.Has(key) {
+		return false
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	_, live, expired := s.liveLocked(key)
+	if expired {
 		c.totalKeys.Add(-1)
 	}
+	if live {
+		return true
+	}
 
-	if c.cold != nil {
-		c.cold.Delete(key)
+	val, expireAt, found := c.cold.Get(key)
+	if !found {
+		return false
+	}
+	if s.setLocked(key, val, expireAt) {
+		c.totalKeys.Add(1)
 	}
+	c.persister.Write("SET", key, val, 0)
+	if expireAt > 0 {
+		c.persister.WriteAt("EXPIREAT", key, "", expireAt)
+	}
+	c.cold.Delete(key)
+	c.coldPromoted.Add(1)
+	return true
+}
+
+// reserve освобождает место перед записью: под новый ключ, если включён
+// лимит maxKeys, и по maxmemory (см. reserveMemory). Вытеснение обычно
+// идёт в фоне (см. evictpool.go). ErrOOM — запись выполнять нельзя.
+func (c *Cache) reserve(s *shard, key string) error {
+	if c.maxKeys > 0 && c.totalKeys.Load() >= c.maxKeys {
+		s.RLock()
+		_, exists := s.items[key]
+		s.RUnlock()
+
+		if !exists {
+			if c.totalKeys.Load() >= c.maxKeys+max(c.maxKeys/evictionSlack, 1) {
+				c.evictWhile(c.keysPolicy(), func() bool {
+					return c.totalKeys.Load() >= c.maxKeys
+				})
+			} else {
+				c.evictInBackground()
+			}
+		}
+	}
+	return c.reserveMemory()
+}
 
-	c.persister.Write("DEL", key, "", 0)
+// Delete удаляет ключ из RAM и cold storage. Ошибка — сбой записи AOF:
+// ключ уже удалён, но удаление может не пережить рестарт.
+func (c *Cache) Delete(key string) error {
+	c.dropKey(c.getShard(key), key)
+	return c.durable(nil, c.persister.Write("DEL", key, "", 0))
 }
 
 // CountKeys возвращает общее число ключей в RAM.
@@ -130,21 +188,74 @@ func (c *Cache) CountKeys() int64 {
 	return c.totalKeys.Load()
 }
 
-// Snapshot вызывает fn для каждого живого ключа (для AOF Rewrite).
-func (c *Cache) Snapshot(fn func(cmd, key, value string, expireAt int64)) {
-	now := time.Now().UnixNano()
+// Snapshot вызывает fn для каждого живого ключа (для AOF Rewrite и Save).
+// mark вызывается, пока запись остановлена во всех шардах, — это граница
+// между снимком и записями журнала. Дальше шарды отпускаются по мере
+// обхода. EXEC и скрипты на время снимка ждут.
+func (c *Cache) Snapshot(mark func(), fn func(cmd, key, value string, expireAt int64)) {
+	c.Shared(func() {
+		c.SnapshotShared(mark, fn)
+	})
+}
 
-	for i := 0; i < shardCount; i++ {
-		s := c.shards[i]
+// SnapshotShared — Snapshot для вызова изнутри Shared (SAVE как команда):
+// gate уже взят вызывающим. Не для Exec: маркер снимка оказался бы
+// в журнале посреди группы MULTI/EXEC.
+func (c *Cache) SnapshotShared(mark func(), fn func(cmd, key, value string, expireAt int64)) {
+	c.snapshot(mark, fn, false)
+}
+
+// Export — Snapshot вместе с ключами cold storage, для выгрузки в RDB
+// (export-rdb, SYNC). AOF и Save ключи cold не пишут: cold storage
+// хранится на диске сам, а при загрузке журнала они подняли бы в RAM
+// всё выгруженное.
+func (c *Cache) Export(mark func(), fn func(cmd, key, value string, expireAt int64)) {
+	c.Shared(func() {
+		c.ExportShared(mark, fn)
+	})
+}
+
+// ExportShared — Export для вызова изнутри Shared или Exec (SYNC).
+func (c *Cache) ExportShared(mark func(), fn func(cmd, key, value string, expireAt int64)) {
+	c.snapshot(mark, fn, true)
+}
+
+// snapshot обходит шарды для Snapshot и Export. Ключи cold storage
+// выгружаются и поднимаются обратно только под блокировкой своего шарда,
+// поэтому их список берётся, пока заблокированы все шарды, а значения
+// читаются до того, как отпущен шард ключа: промоутнутый ключ не
+// пропадёт из снимка.
+func (c *Cache) snapshot(mark func(), fn func(cmd, key, value string, expireAt int64), withCold bool) {
+	for _, s := range c.shards {
 		s.RLock()
+	}
+	mark()
+
+	var coldKeys [shardCount][]string
+	if withCold && c.cold != nil {
+		c.cold.Keys(func(key string) bool {
+			i := shardIndex(key)
+			if _, inRAM := c.shards[i].items[key]; !inRAM {
+				coldKeys[i] = append(coldKeys[i], key)
+			}
+			return false
+		})
+	}
 
+	now := time.Now().UnixNano()
+	for i, s := range c.shards {
 		for _, item := range s.items {
 			if item.ExpireAt > 0 && item.ExpireAt <= now {
 				continue
 			}
-			fn("SET", item.Key, item.Value, item.ExpireAt)
+			cmd, value := item.record()
+			fn(cmd, item.Key, value, item.ExpireAt)
+		}
+		for _, key := range coldKeys[i] {
+			if value, expireAt, ok := c.cold.Get(key); ok {
+				fn("SET", key, value, expireAt)
+			}
 		}
-
 		s.RUnlock()
 	}
 }
@@ -152,10 +263,9 @@ func (c *Cache) Snapshot(fn func(cmd, key, value string, expireAt int64)) {
 // Close останавливает workers, сбрасывает cold на диск.
 func (c *Cache) Close() {
 	close(c.stopCh)
-	close(c.flushCh)
 
 	if c.cold != nil {
-		if err := c.cold.Flush(); err != nil {
+		if err := c.cold.Close(); err != nil {
 			log.Println("cold flush error:", err)
 		}
 	}
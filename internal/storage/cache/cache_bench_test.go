@@ -12,7 +12,11 @@ import (
 // mockPersistence — мок для бенчмарков, не пишет на диск.
 type mockPersistence struct{}
 
-func (m *mockPersistence) Write(cmd, key, value string, duration time.Duration) error {
+func (m *mockPersistence) Write(cmd, key, value string, duration time.Duration) func() error {
+	return nil
+}
+
+func (m *mockPersistence) WriteAt(cmd, key, value string, expireAt int64) func() error {
 	return nil
 }
 
@@ -222,6 +226,65 @@ func BenchmarkGetWithLoad(b *testing.B) {
 	}
 }
 
+// --- Вытеснение на лимите ключей ---
+
+// BenchmarkSetAtKeyLimit — запись новых ключей в заполненный кеш: каждая
+// запись требует вытеснения.
+func BenchmarkSetAtKeyLimit(b *testing.B) {
+	const maxKeys = 10000
+
+	for _, policy := range []EvictionPolicy{AllKeysLRU, AllKeysLFU, AllKeysRandom} {
+		for _, samples := range []int{5, 10} {
+			b.Run(fmt.Sprintf("%v/samples-%d", policy, samples), func(b *testing.B) {
+				c := NewWithMaxKeys(&mockPersistence{}, maxKeys)
+				defer c.Close()
+				c.SetMaxMemory(0, policy)
+				c.SetEvictionSamples(samples)
+
+				for i := 0; i < maxKeys; i++ {
+					c.Set("key"+strconv.Itoa(i), "value", 0, false)
+				}
+
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					c.Set("new"+strconv.Itoa(i), "value", 0, false)
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkHitRateAtKeyLimit — доля попаданий (hit%) при zipf-обращениях
+// к пространству ключей в 10 раз больше лимита. Промах дописывает ключ,
+// как cache-aside.
+func BenchmarkHitRateAtKeyLimit(b *testing.B) {
+	const maxKeys, keySpace = 10000, 100000
+
+	for _, policy := range []EvictionPolicy{AllKeysLRU, AllKeysLFU, AllKeysRandom} {
+		for _, samples := range []int{5, 10} {
+			b.Run(fmt.Sprintf("%v/samples-%d", policy, samples), func(b *testing.B) {
+				c := NewWithMaxKeys(&mockPersistence{}, maxKeys)
+				defer c.Close()
+				c.SetMaxMemory(0, policy)
+				c.SetEvictionSamples(samples)
+				zipf := rand.NewZipf(rand.New(rand.NewSource(1)), 1.1, 1, keySpace-1)
+
+				hits := 0
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					key := "key" + strconv.FormatUint(zipf.Uint64(), 10)
+					if _, found := c.Get(key); found {
+						hits++
+					} else {
+						c.Set(key, "value", 0, false)
+					}
+				}
+				b.ReportMetric(float64(hits)*100/float64(b.N), "hit%")
+			})
+		}
+	}
+}
+
 // --- Вспомогательные ---
 
 func randString(n int) string {
@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"container/heap"
 	"strconv"
 	"time"
 )
@@ -14,33 +15,52 @@ func (c *Cache) Exists(keys ...string) int64 {
 		s := c.getShard(key)
 		if s.exists(key) {
 			count++
-		} else if c.cold != nil {
-			if _, found := c.cold.Get(key); found {
-				count++
-			}
+		} else if c.cold != nil && c.cold.Has(key) {
+			count++
 		}
 	}
 	return count
 }
 
 // Expire устанавливает TTL на существующий ключ.
-func (c *Cache) Expire(key string, ttl time.Duration) bool {
+// В AOF пишется EXPIREAT с абсолютным временем: при replay TTL
+// не продлевается на время простоя.
+func (c *Cache) Expire(key string, ttl time.Duration) (bool, error) {
 	s := c.getShard(key)
+	c.promote(s, key)
 	expireAt := time.Now().Add(ttl).UnixNano()
-	return s.expire(key, expireAt)
+
+	s.Lock()
+	if !s.expireLocked(key, expireAt) {
+		s.Unlock()
+		return false, nil
+	}
+	wait := c.persister.WriteAt("EXPIREAT", key, "", expireAt)
+	s.Unlock()
+
+	return true, c.durable(nil, wait)
 }
 
 // Persist убирает TTL с ключа (делает его вечным).
-func (c *Cache) Persist(key string) bool {
+func (c *Cache) Persist(key string) (bool, error) {
 	s := c.getShard(key)
-	return s.expire(key, 0)
+	c.promote(s, key)
+
+	s.Lock()
+	if !s.expireLocked(key, 0) {
+		s.Unlock()
+		return false, nil
+	}
+	wait := c.persister.Write("PERSIST", key, "", 0)
+	s.Unlock()
+
+	return true, c.durable(nil, wait)
 }
 
 // GetTTL возвращает оставшееся время жизни в секундах.
 // -1 = ключ без TTL, -2 = ключ не найден.
 func (c *Cache) GetTTL(key string) int64 {
-	s := c.getShard(key)
-	ns := s.ttl(key)
+	ns := c.ttl(key)
 	switch ns {
 	case -1, -2:
 		return ns
@@ -51,8 +71,7 @@ func (c *Cache) GetTTL(key string) int64 {
 
 // GetPTTL возвращает оставшееся время жизни в миллисекундах.
 func (c *Cache) GetPTTL(key string) int64 {
-	s := c.getShard(key)
-	ns := s.ttl(key)
+	ns := c.ttl(key)
 	switch ns {
 	case -1, -2:
 		return ns
@@ -61,9 +80,31 @@ func (c *Cache) GetPTTL(key string) int64 {
 	}
 }
 
+// ttl — shard.ttl с учётом cold storage: TTL выгруженного ключа берётся
+// из индекса, без чтения значения и без подъёма в RAM.
+func (c *Cache) ttl(key string) int64 {
+	ns := c.getShard(key).ttl(key)
+	if ns != -2 || c.cold == nil {
+		return ns
+	}
+	_, expireAt, found := c.cold.Stat(key)
+	switch {
+	case !found:
+		return -2
+	case expireAt == 0:
+		return -1
+	default:
+		return max(expireAt-time.Now().UnixNano(), 0)
+	}
+}
+
 // IncrBy атомарно добавляет delta к значению ключа. Возвращает новое значение.
 func (c *Cache) IncrBy(key string, delta int64) (int64, error) {
 	s := c.getShard(key)
+	c.promote(s, key)
+	if err := c.reserve(s, key); err != nil {
+		return 0, err
+	}
 	result, isNew, err := s.incrBy(key, delta)
 	if err != nil {
 		return 0, err
@@ -71,28 +112,38 @@ func (c *Cache) IncrBy(key string, delta int64) (int64, error) {
 	if isNew {
 		c.totalKeys.Add(1)
 	}
-	c.persister.Write("SET", key, strconv.FormatInt(result, 10), 0)
-	return result, nil
+	return result, c.durable(nil, c.persister.Write("SET", key, strconv.FormatInt(result, 10), 0))
 }
 
 // Append дописывает к значению ключа. Возвращает новую длину.
-func (c *Cache) Append(key, suffix string) int {
+func (c *Cache) Append(key, suffix string) (int, error) {
 	s := c.getShard(key)
-	length, isNew := s.appendVal(key, suffix)
+	c.promote(s, key)
+	if err := c.reserve(s, key); err != nil {
+		return 0, err
+	}
+
+	length, isNew, err := s.appendVal(key, suffix)
+	if err != nil {
+		return 0, err
+	}
 	if isNew {
 		c.totalKeys.Add(1)
-		c.persister.Write("SET", key, suffix, 0)
-	} else {
-		val, _ := s.get(key)
-		c.persister.Write("SET", key, val, 0)
+		return length, c.durable(nil, c.persister.Write("SET", key, suffix, 0))
 	}
-	return length
+	val, _ := s.get(key)
+	return length, c.durable(nil, c.persister.Write("SET", key, val, 0))
 }
 
-// Strlen возвращает длину строки.
-func (c *Cache) Strlen(key string) int {
-	s := c.getShard(key)
-	return s.strlen(key)
+// Strlen возвращает длину строки. Длина выгруженного в cold storage
+// значения известна из индекса — оно не читается с диска. Для ключа
+// другого типа — ErrWrongType.
+func (c *Cache) Strlen(key string) (int, error) {
+	n, found, err := c.getShard(key).strlen(key)
+	if !found && c.cold != nil {
+		n, _, _ = c.cold.Stat(key)
+	}
+	return n, err
 }
 
 // MGet пакетное чтение.
@@ -112,74 +163,166 @@ func (c *Cache) MGet(keys ...string) []struct {
 	return result
 }
 
-// MSet пакетная запись.
-func (c *Cache) MSet(pairs ...string) {
+// MSet пакетная запись. Останавливается на ErrOOM; ошибка записи AOF
+// возвращается, когда записаны все пары.
+func (c *Cache) MSet(pairs ...string) error {
+	var werr error
 	for i := 0; i+1 < len(pairs); i += 2 {
-		c.Set(pairs[i], pairs[i+1], 0, false)
+		if err := c.Set(pairs[i], pairs[i+1], 0, false); err == ErrOOM {
+			return err
+		} else if err != nil {
+			werr = err
+		}
 	}
+	return werr
 }
 
-// Keys возвращает все ключи, matching glob pattern.
+// Keys возвращает все ключи, matching glob pattern, включая выгруженные
+// в cold storage. Ключ, выгруженный по ходу обхода, может попасть в обе
+// части — такие повторы убираются.
 func (c *Cache) Keys(pattern string) []string {
 	var result []string
 	for i := 0; i < shardCount; i++ {
 		result = append(result, c.shards[i].keys(pattern)...)
 	}
+	if c.cold == nil {
+		return result
+	}
+
+	cold := c.cold.Keys(func(key string) bool {
+		return matchPattern(pattern, key)
+	})
+	if len(cold) == 0 {
+		return result
+	}
+	seen := make(map[string]struct{}, len(result))
+	for _, key := range result {
+		seen[key] = struct{}{}
+	}
+	for _, key := range cold {
+		if _, dup := seen[key]; !dup {
+			result = append(result, key)
+		}
+	}
 	return result
 }
 
-// FlushDB очищает все данные.
-func (c *Cache) FlushDB() {
-	for i := 0; i < shardCount; i++ {
-		s := c.shards[i]
-		s.Lock()
+// FlushDB очищает все данные. Запись FLUSH делается под блокировкой
+// всех шардов: в журнале она стоит ровно между записями, пережившими
+// очистку, и стёртыми ею. Durability ждём уже после очистки.
+func (c *Cache) FlushDB() error {
+	var wait func() error
+	c.flush(func() { wait = c.persister.Write("FLUSH", "", "", 0) })
+	return c.durable(nil, wait)
+}
+
+// flush очищает RAM и cold storage; persist вызывается под блокировкой.
+func (c *Cache) flush(persist func()) {
+	unlock := c.lockAllShards()
+	if persist != nil {
+		persist()
+	}
+	for _, s := range c.shards {
+		s.touchAllLocked()
 		s.items = make(map[string]*Item)
+		s.slots = nil
 		s.pq = make(priorityQueue, 0)
-		s.Unlock()
+		s.mem.Store(0)
 	}
 	c.totalKeys.Store(0)
+	unlock()
 
 	if c.cold != nil {
 		c.cold.FlushAll()
 	}
 }
 
-// Rename переименовывает ключ. Thread-safe для кросс-шардного случая.
-func (c *Cache) Rename(oldKey, newKey string) bool {
-	sSrc := c.getShard(oldKey)
-	item, found := sSrc.getItem(oldKey)
-	if !found {
-		return false
-	}
+// Rename переименовывает ключ. Оба шарда блокируются одновременно
+// (в порядке номеров), поэтому перенос атомарен и для кросс-шардного случая.
+func (c *Cache) Rename(oldKey, newKey string) (bool, error) {
+	sSrc, sDst := c.getShard(oldKey), c.getShard(newKey)
+	c.promote(sSrc, oldKey)
 
-	val := item.Value
-	exp := item.ExpireAt
+	unlock := c.lockShards(oldKey, newKey)
 
-	sSrc.del(oldKey)
-	c.totalKeys.Add(-1)
+	item, found, expired := sSrc.liveLocked(oldKey)
+	if !found {
+		unlock()
+		if expired {
+			c.totalKeys.Add(-1)
+		}
+		return false, nil
+	}
+	if oldKey == newKey {
+		unlock()
+		return true, nil
+	}
 
-	sDst := c.getShard(newKey)
-	isNew := sDst.set(newKey, val, exp)
-	if isNew {
-		c.totalKeys.Add(1)
+	// Переносим элемент целиком — вместе с типом и TTL
+	var delta int64
+	sSrc.removeLocked(item)
+	if old, exists := sDst.items[newKey]; exists {
+		sDst.removeLocked(old)
+		delta--
+	}
+	item.Key = newKey
+	sDst.linkLocked(item)
+	sDst.touchLocked(newKey)
+	if item.ExpireAt > 0 {
+		heap.Push(&sDst.pq, item)
+	}
+	// Прежнее значение newKey могло лежать в cold — иначе оно всплывёт,
+	// когда переименованный ключ истечёт или будет удалён
+	if c.cold != nil {
+		c.cold.Delete(newKey)
 	}
 
 	c.persister.Write("DEL", oldKey, "", 0)
-
-	var ttl time.Duration
-	if exp > 0 {
-		ttl = time.Duration(exp-time.Now().UnixNano()) * time.Nanosecond
+	// Составные типы replay мёржит — сначала затираем старый newKey
+	cmd, value := item.record()
+	if cmd != "SET" {
+		c.persister.Write("DEL", newKey, "", 0)
 	}
-	c.persister.Write("SET", newKey, val, ttl)
+	wait := c.persister.Write(cmd, newKey, value, 0)
+	// TTL переносится отдельной записью с абсолютным временем
+	if item.ExpireAt > 0 {
+		wait = c.persister.WriteAt("EXPIREAT", newKey, "", item.ExpireAt)
+	}
+
+	unlock()
 
-	return true
+	c.totalKeys.Add(delta)
+	if item.Kind == KindList {
+		c.blocked.notify(newKey)
+	}
+	return true, c.durable(nil, wait)
 }
 
 // Type возвращает тип ключа.
 func (c *Cache) Type(key string) string {
 	s := c.getShard(key)
-	if s.exists(key) {
+	kind, found := s.kind(key)
+	if !found {
+		if c.cold != nil && c.cold.Has(key) {
+			return KindString.String()
+		}
+		return "none"
+	}
+	return kind.String()
+}
+
+// String возвращает имя типа в терминах Redis (TYPE).
+func (k Kind) String() string {
+	switch k {
+	case KindHash:
+		return "hash"
+	case KindList:
+		return "list"
+	case KindSet:
+		return "set"
+	case KindZSet:
+		return "zset"
+	default:
 		return "string"
 	}
-	return "none"
 }
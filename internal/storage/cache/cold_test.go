@@ -0,0 +1,420 @@
+package storage
+
+import (
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"imcs/internal/storage/cold"
+)
+
+// newColdCache — кеш с cold storage во временном каталоге.
+func newColdCache(t *testing.T) *Cache {
+	t.Helper()
+	c := New(&mockPersistence{})
+	t.Cleanup(c.Close)
+	if err := c.InitColdStorage(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// demote пишет ключ и выгружает его в cold storage.
+func demote(t *testing.T, c *Cache, key, value string, ttl time.Duration) {
+	t.Helper()
+	if err := c.Set(key, value, ttl, false); err != nil {
+		t.Fatal(err)
+	}
+	if !c.evictKey(c.getShard(key), key) || !c.cold.Has(key) {
+		t.Fatalf("%s not demoted", key)
+	}
+}
+
+// checkTTL — TTL ключа в секундах около want (-1 — без TTL).
+func checkTTL(t *testing.T, c *Cache, key string, want int64) {
+	t.Helper()
+	got := c.GetTTL(key)
+	if got != want && (want < 0 || got < want-2 || got > want) {
+		t.Fatalf("TTL %s = %d, want %d", key, got, want)
+	}
+}
+
+// TestColdCommands — каждая команда над строковым ключом работает с
+// выгруженным ключом как с ключом в RAM и сохраняет его TTL.
+func TestColdCommands(t *testing.T) {
+	const ttl = time.Hour
+	tests := []struct {
+		name    string
+		run     func(t *testing.T, c *Cache)
+		inCold  bool  // ключ должен остаться в cold
+		wantTTL int64 // TTL ключа после команды, с; 0 — не проверять
+	}{
+		{"GET", func(t *testing.T, c *Cache) {
+			if v, ok := c.Get("k"); !ok || v != "10" {
+				t.Fatalf("Get = %q, %v", v, ok)
+			}
+		}, false, 3600},
+		{"MGET", func(t *testing.T, c *Cache) {
+			if r := c.MGet("k", "missing"); !r[0].Found || r[0].Value != "10" || r[1].Found {
+				t.Fatalf("MGet = %+v", r)
+			}
+		}, false, 3600},
+		{"TTL", func(t *testing.T, c *Cache) {
+			if ms := c.GetPTTL("k"); ms <= 3590_000 || ms > 3600_000 {
+				t.Fatalf("PTTL = %d", ms)
+			}
+		}, true, 3600},
+		{"TYPE", func(t *testing.T, c *Cache) {
+			if typ := c.Type("k"); typ != "string" {
+				t.Fatalf("Type = %q", typ)
+			}
+		}, true, 3600},
+		{"STRLEN", func(t *testing.T, c *Cache) {
+			if n, err := c.Strlen("k"); n != 2 || err != nil {
+				t.Fatalf("Strlen = %d, %v", n, err)
+			}
+		}, true, 3600},
+		{"EXISTS", func(t *testing.T, c *Cache) {
+			if n := c.Exists("k", "missing"); n != 1 {
+				t.Fatalf("Exists = %d", n)
+			}
+		}, true, 3600},
+		{"KEYS", func(t *testing.T, c *Cache) {
+			c.Set("kk", "ram", 0, false)
+			keys := c.Keys("k*")
+			slices.Sort(keys)
+			if !slices.Equal(keys, []string{"k", "kk"}) {
+				t.Fatalf("Keys = %v", keys)
+			}
+		}, true, 3600},
+		{"SCAN", func(t *testing.T, c *Cache) {
+			c.Set("kk", "ram", 0, false)
+			scan := func(opts ScanOptions) []string {
+				var keys []string
+				cursor := uint64(0)
+				for {
+					var batch []string
+					cursor, batch = c.Scan(cursor, opts)
+					keys = append(keys, batch...)
+					if cursor == 0 {
+						break
+					}
+				}
+				slices.Sort(keys)
+				return keys
+			}
+			if keys := scan(ScanOptions{Match: "k*"}); !slices.Equal(keys, []string{"k", "kk"}) {
+				t.Fatalf("Scan = %v", keys)
+			}
+			if keys := scan(ScanOptions{Type: "hash"}); len(keys) != 0 {
+				t.Fatalf("Scan TYPE hash = %v", keys)
+			}
+		}, true, 3600},
+		{"EXPIRE", func(t *testing.T, c *Cache) {
+			if ok, err := c.Expire("k", time.Minute); !ok || err != nil {
+				t.Fatal("Expire on demoted key failed")
+			}
+		}, false, 60},
+		{"PERSIST", func(t *testing.T, c *Cache) {
+			if ok, err := c.Persist("k"); !ok || err != nil {
+				t.Fatal("Persist on demoted key failed")
+			}
+		}, false, -1},
+		{"INCRBY", func(t *testing.T, c *Cache) {
+			if n, err := c.IncrBy("k", 5); err != nil || n != 15 {
+				t.Fatalf("IncrBy = %d, %v", n, err)
+			}
+		}, false, 3600},
+		{"APPEND", func(t *testing.T, c *Cache) {
+			if n, err := c.Append("k", "0"); err != nil || n != 3 {
+				t.Fatalf("Append = %d, %v", n, err)
+			}
+			if v, _ := c.Get("k"); v != "100" {
+				t.Fatalf("after Append: %q", v)
+			}
+		}, false, 3600},
+		{"SETNX", func(t *testing.T, c *Cache) {
+			if err := c.Set("k", "new", 0, true); !errors.Is(err, ErrKeyExist) {
+				t.Fatalf("Set NX over demoted key: %v", err)
+			}
+			if v, _ := c.Get("k"); v != "10" {
+				t.Fatalf("after Set NX: %q", v)
+			}
+		}, false, 3600},
+		{"SET", func(t *testing.T, c *Cache) {
+			c.Set("k", "new", 0, false)
+			if v, _ := c.Get("k"); v != "new" {
+				t.Fatalf("after Set: %q", v)
+			}
+		}, false, -1},
+		{"RENAME", func(t *testing.T, c *Cache) {
+			if ok, err := c.Rename("k", "k2"); !ok || err != nil || c.Exists("k") != 0 {
+				t.Fatal("Rename of demoted key failed")
+			}
+			if v, _ := c.Get("k2"); v != "10" {
+				t.Fatalf("after Rename: %q", v)
+			}
+			checkTTL(t, c, "k2", 3600)
+		}, false, 0},
+		{"DEL", func(t *testing.T, c *Cache) {
+			c.Delete("k")
+			if c.Exists("k") != 0 || c.cold.Len() != 0 {
+				t.Fatal("demoted key survived Delete")
+			}
+		}, false, 0},
+		{"DUMP", func(t *testing.T, c *Cache) {
+			if v, ok := c.Dump("k"); !ok || v.Kind != KindString || v.String != "10" {
+				t.Fatalf("Dump = %+v, %v", v, ok)
+			}
+		}, false, 3600},
+		{"OBJECT FREQ", func(t *testing.T, c *Cache) {
+			if _, ok := c.Freq("k"); !ok {
+				t.Fatal("Freq of demoted key not found")
+			}
+		}, false, 3600},
+		{"MULTI", func(t *testing.T, c *Cache) {
+			err := c.Update(func(tx *Tx) error {
+				v, ok := tx.Get("k")
+				if !ok || v != "10" {
+					t.Fatalf("tx.Get = %q, %v", v, ok)
+				}
+				_, err := tx.Incr("k")
+				return err
+			})
+			if v, _ := c.Get("k"); err != nil || v != "11" {
+				t.Fatalf("after Update: %q, %v", v, err)
+			}
+		}, false, 3600},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newColdCache(t)
+			demote(t, c, "k", "10", ttl)
+
+			tt.run(t, c)
+			if c.cold.Has("k") != tt.inCold {
+				t.Fatalf("in cold = %v, want %v", !tt.inCold, tt.inCold)
+			}
+			if tt.wantTTL != 0 {
+				checkTTL(t, c, "k", tt.wantTTL)
+			}
+			// Ключ ровно в одном месте: RAM и cold не расходятся
+			if c.cold.Has("k") && c.getShard("k").exists("k") {
+				t.Fatal("key both in RAM and in cold")
+			}
+		})
+	}
+}
+
+// TestColdExpire — ключ, истёкший в cold storage, не виден ни одной
+// командой, не поднимается в RAM вечным и убирается janitor'ом.
+func TestColdExpire(t *testing.T) {
+	c := newColdCache(t)
+	demote(t, c, "session", "data", 50*time.Millisecond)
+	demote(t, c, "forever", "data", 0)
+	checkTTL(t, c, "forever", -1)
+
+	time.Sleep(60 * time.Millisecond)
+	if _, ok := c.Get("session"); ok {
+		t.Fatal("expired cold key returned by Get")
+	}
+	if n, _ := c.Strlen("session"); c.Exists("session") != 0 || c.GetTTL("session") != -2 ||
+		c.Type("session") != "none" || n != 0 {
+		t.Fatal("expired cold key still visible")
+	}
+	if keys := c.Keys("*"); !slices.Equal(keys, []string{"forever"}) {
+		t.Fatalf("Keys = %v", keys)
+	}
+	if ok, _ := c.Expire("session", time.Hour); ok || c.CountKeys() != 0 {
+		t.Fatal("Expire revived expired cold key")
+	}
+	if err := c.Set("session", "new", 0, true); err != nil {
+		t.Fatalf("Set NX over expired cold key: %v", err)
+	}
+	c.Delete("session")
+
+	c.ExpireByTTL()
+	if c.cold.Len() != 1 {
+		t.Fatalf("cold keys after ExpireByTTL: %d", c.cold.Len())
+	}
+}
+
+// TestEvictColdKeepsTTL — EvictCold выгружает ключ вместе с TTL,
+// а поднятый обратно ключ истекает вовремя.
+func TestEvictColdKeepsTTL(t *testing.T) {
+	c := newColdCache(t)
+	c.Set("k", "v", 200*time.Millisecond, false)
+	c.Set("gone", "v", time.Millisecond, false)
+	for _, s := range c.shards {
+		for _, item := range s.items {
+			item.LastAccess -= int64(2 * defaultColdIdleTime)
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	c.EvictCold()
+	if !c.cold.Has("k") || c.cold.Has("gone") || c.CountKeys() != 1 {
+		t.Fatalf("EvictCold: %d cold, %d in RAM", c.cold.Len(), c.CountKeys())
+	}
+	if ms := c.GetPTTL("k"); ms <= 0 || ms > 200 {
+		t.Fatalf("PTTL of demoted key = %d", ms)
+	}
+	if _, ok := c.Get("k"); !ok {
+		t.Fatal("demoted key lost")
+	}
+	time.Sleep(200 * time.Millisecond)
+	if _, ok := c.Get("k"); ok {
+		t.Fatal("promoted key outlived its TTL")
+	}
+}
+
+// TestColdRenameOverDemoted — RENAME поверх выгруженного ключа стирает
+// его копию в cold: когда новый ключ истекает, старое значение
+// не возвращается.
+func TestColdRenameOverDemoted(t *testing.T) {
+	c := newColdCache(t)
+	demote(t, c, "dst", "old-cold", 0)
+	c.Set("src", "new", 50*time.Millisecond, false)
+
+	if ok, err := c.Rename("src", "dst"); !ok || err != nil {
+		t.Fatalf("Rename = %v, %v", ok, err)
+	}
+	if v, _ := c.Get("dst"); v != "new" || c.cold.Has("dst") {
+		t.Fatalf("after Rename: %q, in cold %v", v, c.cold.Has("dst"))
+	}
+	time.Sleep(60 * time.Millisecond)
+	if v, ok := c.Get("dst"); ok {
+		t.Fatalf("stale cold value after expiry: %q", v)
+	}
+}
+
+// TestColdPromoteAfterRewrite — rewrite не сохраняет ключи cold, поэтому
+// поднятый после него ключ должен попасть в журнал: rewrite → promote →
+// рестарт не теряет ключ и его TTL.
+func TestColdPromoteAfterRewrite(t *testing.T) {
+	dir := t.TempDir()
+	rec := &recordPersistence{}
+	c := New(rec)
+	if err := c.InitColdStorage(dir); err != nil {
+		t.Fatal(err)
+	}
+	demote(t, c, "k", "v", time.Hour)
+
+	// Rewrite: журнал заменяется снимком RAM
+	rec.entries = nil
+	c.Snapshot(func() {}, func(cmd, key, value string, expireAt int64) {
+		rec.entries = append(rec.entries, recordEntry{cmd, key, value, expireAt})
+	})
+	if v, ok := c.Get("k"); !ok || v != "v" || c.cold.Has("k") {
+		t.Fatalf("promote: %q, %v", v, ok)
+	}
+	c.Close()
+
+	reopened := New(&mockPersistence{})
+	defer reopened.Close()
+	if err := reopened.InitColdStorage(dir); err != nil {
+		t.Fatal(err)
+	}
+	rec.replayInto(reopened)
+	if v, ok := reopened.Get("k"); !ok || v != "v" {
+		t.Fatalf("promoted key lost after restart: %q, %v", v, ok)
+	}
+	checkTTL(t, reopened, "k", 3600)
+}
+
+// TestColdWriteError — при ошибке записи на диск EvictCold оставляет
+// ключи в RAM, а вытеснение по maxmemory удаляет строку, как другие ключи.
+func TestColdWriteError(t *testing.T) {
+	c := newColdCache(t)
+	c.Set("k", "v", time.Minute, false)
+	for _, s := range c.shards {
+		for _, item := range s.items {
+			item.LastAccess -= int64(2 * defaultColdIdleTime)
+		}
+	}
+	c.cold.Close() // дальнейшие записи в сегмент завершаются ошибкой
+
+	c.EvictCold()
+	if v, ok := c.Get("k"); !ok || v != "v" || c.CountKeys() != 1 {
+		t.Fatalf("key lost on failed demotion: %q, %v, %d in RAM", v, ok, c.CountKeys())
+	}
+	if ms := c.GetPTTL("k"); ms <= 0 {
+		t.Fatalf("PTTL after failed demotion = %d", ms)
+	}
+	if stats := c.ColdStats(); stats.Demoted != 0 {
+		t.Fatalf("Demoted = %d", stats.Demoted)
+	}
+
+	if !c.evictKey(c.getShard("k"), "k") {
+		t.Fatal("evictKey: key not evicted")
+	}
+	if c.Exists("k") != 0 || c.ColdStats().Demoted != 0 {
+		t.Fatal("evictKey: key reported as demoted")
+	}
+}
+
+// TestColdPolicy — в cold уходят только ключи, допущенные шаблонами,
+// с длинными значениями и пока есть место; счётчики в ColdStats.
+func TestColdPolicy(t *testing.T) {
+	c := newColdCache(t)
+	value, big := "value", strings.Repeat("b", 100)
+	c.SetColdPolicy(ColdPolicy{
+		IdleTime:     time.Minute,
+		MinValueSize: 4,
+		MaxSize:      cold.RecordLen("user:1", value) + 2*cold.RecordLen("big:1", big),
+		Allow:        []string{"user:*", "big:*"},
+		Deny:         []string{"user:admin"},
+	})
+	for _, key := range []string{"user:1", "user:admin", "other:1"} {
+		c.Set(key, value, 0, false)
+	}
+	c.Set("user:short", "abc", 0, false)
+	for i := 1; i <= 3; i++ {
+		c.Set("big:"+strconv.Itoa(i), big, 0, false)
+	}
+	age := func() {
+		for _, s := range c.shards {
+			for _, item := range s.items {
+				item.LastAccess -= int64(2 * time.Minute)
+			}
+		}
+	}
+
+	age()
+	c.EvictCold()
+	stats := c.ColdStats()
+	if stats.Keys != 3 || stats.Demoted != 3 || stats.Size != c.ColdPolicy().MaxSize || !c.cold.Has("user:1") {
+		t.Fatalf("after EvictCold: %+v", stats)
+	}
+	for _, key := range []string{"user:admin", "other:1", "user:short"} {
+		if c.cold.Has(key) || !c.getShard(key).exists(key) {
+			t.Fatalf("%s moved to cold", key)
+		}
+	}
+
+	// Вытеснение по maxmemory: не допущенная строка удаляется
+	if !c.evictKey(c.getShard("user:admin"), "user:admin") || c.Exists("user:admin") != 0 {
+		t.Fatal("denied key survived eviction")
+	}
+
+	if _, ok := c.Get("user:1"); !ok || c.ColdStats().Promoted != 1 {
+		t.Fatalf("after promotion: %+v", c.ColdStats())
+	}
+
+	c.UpdateColdPolicy(func(p *ColdPolicy) {
+		p.IdleTime = 0
+		p.MaxSize = 0
+	})
+	age()
+	c.EvictCold()
+	if got := c.ColdStats(); got.Demoted != 3 {
+		t.Fatalf("EvictCold with IdleTime 0: %+v", got)
+	}
+	if p := c.ColdPolicy(); p.Samples != defaultColdSamples || len(p.Allow) != 2 {
+		t.Fatalf("policy after update: %+v", p)
+	}
+}
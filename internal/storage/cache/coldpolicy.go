@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"math"
+	"slices"
+	"time"
+
+	"imcs/internal/storage/cold"
+)
+
+/*
+	Политика cold storage.
+
+	EvictCold (janitor, раз в Interval) смотрит Samples ключей каждого
+	шарда и выгружает на диск строки, к которым не обращались дольше
+	IdleTime. Ключ допускается в cold, только если значение не короче
+	MinValueSize, ключ не подходит ни под один шаблон Deny и подходит
+	под один из Allow (пустой Allow — любой ключ), а на диске ещё есть
+	место до MaxSize. Те же правила действуют для строк, вытесняемых по
+	maxmemory: не допущенная строка удаляется, как ключи других типов.
+
+	Политика меняется на ходу (CONFIG SET): она неизменяема и
+	подменяется целиком через atomic.Pointer.
+*/
+
+const (
+	defaultColdIdleTime      = 5 * time.Minute  // данные старше 5 минут → на диск
+	defaultColdSamples       = 16               // ключей на шард за проход EvictCold
+	defaultColdInterval      = 10 * time.Second // период EvictCold
+	defaultColdFlushInterval = 30 * time.Second // fsync и компактизация cold store
+)
+
+// ColdPolicy — когда и какие строки уходят в cold storage.
+type ColdPolicy struct {
+	IdleTime      time.Duration // простой, после которого ключ выгружается; 0 — только по maxmemory
+	Samples       int           // ключей на шард за проход EvictCold
+	MaxSize       int64         // байт записей на диске, 0 — без лимита
+	MinValueSize  int           // более короткие значения не выгружаются
+	Allow         []string      // glob-шаблоны допускаемых ключей; пусто — все
+	Deny          []string      // glob-шаблоны ключей, которые не выгружаются
+	Interval      time.Duration // период EvictCold в janitor
+	FlushInterval time.Duration // период fsync и компактизации cold store
+}
+
+// DefaultColdPolicy — политика нового кеша.
+func DefaultColdPolicy() ColdPolicy {
+	return ColdPolicy{
+		IdleTime:      defaultColdIdleTime,
+		Samples:       defaultColdSamples,
+		Interval:      defaultColdInterval,
+		FlushInterval: defaultColdFlushInterval,
+	}
+}
+
+// ColdStats — счётчики cold storage для INFO.
+type ColdStats struct {
+	Keys     int   // ключей на диске
+	Size     int64 // байт живых записей
+	Demoted  int64 // выгружено в cold с запуска
+	Promoted int64 // поднято обратно в RAM с запуска
+}
+
+// SetColdPolicy задаёт политику cold storage. Отрицательные значения
+// считаются нулём, неположительные Samples и интервалы — значениями по
+// умолчанию.
+func (c *Cache) SetColdPolicy(p ColdPolicy) {
+	c.coldPolicy.Store(p.normalize())
+}
+
+// UpdateColdPolicy меняет политику через fn атомарно относительно
+// других изменений (CONFIG SET одного параметра).
+func (c *Cache) UpdateColdPolicy(fn func(p *ColdPolicy)) {
+	for {
+		old := c.coldPolicy.Load()
+		p := *old
+		p.Allow = slices.Clone(p.Allow)
+		p.Deny = slices.Clone(p.Deny)
+		fn(&p)
+		if c.coldPolicy.CompareAndSwap(old, p.normalize()) {
+			return
+		}
+	}
+}
+
+// normalize — копия политики с допустимыми значениями (см. SetColdPolicy).
+func (p ColdPolicy) normalize() *ColdPolicy {
+	p.IdleTime = max(p.IdleTime, 0)
+	p.MaxSize = max(p.MaxSize, 0)
+	p.MinValueSize = max(p.MinValueSize, 0)
+	if p.Samples <= 0 {
+		p.Samples = defaultColdSamples
+	}
+	if p.Interval <= 0 {
+		p.Interval = defaultColdInterval
+	}
+	if p.FlushInterval <= 0 {
+		p.FlushInterval = defaultColdFlushInterval
+	}
+	p.Allow = slices.Clone(p.Allow)
+	p.Deny = slices.Clone(p.Deny)
+	return &p
+}
+
+// ColdPolicy возвращает текущую политику cold storage.
+func (c *Cache) ColdPolicy() ColdPolicy {
+	p := *c.coldPolicy.Load()
+	p.Allow = slices.Clone(p.Allow)
+	p.Deny = slices.Clone(p.Deny)
+	return p
+}
+
+// ColdStats возвращает состояние cold storage и счётчики выгрузки.
+func (c *Cache) ColdStats() ColdStats {
+	stats := ColdStats{
+		Demoted:  c.coldDemoted.Load(),
+		Promoted: c.coldPromoted.Load(),
+	}
+	if c.cold != nil {
+		stats.Keys = c.cold.Len()
+		stats.Size = c.cold.Size()
+	}
+	return stats
+}
+
+// admits — допускает ли политика ключ со значением длины valueLen.
+func (p *ColdPolicy) admits(key string, valueLen int) bool {
+	if valueLen < p.MinValueSize {
+		return false
+	}
+	for _, pattern := range p.Deny {
+		if matchPattern(pattern, key) {
+			return false
+		}
+	}
+	if len(p.Allow) == 0 {
+		return true
+	}
+	for _, pattern := range p.Allow {
+		if matchPattern(pattern, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// coldRoom — сколько байт записей ещё помещается в cold storage.
+func (c *Cache) coldRoom(p *ColdPolicy) int64 {
+	if p.MaxSize == 0 {
+		return math.MaxInt64
+	}
+	return p.MaxSize - c.cold.Size()
+}
+
+// toCold — уходит ли строка item в cold storage при вытеснении
+// (под блокировкой шарда).
+func (c *Cache) toCold(item *Item) bool {
+	if c.cold == nil || item.Kind != KindString || item.IsExpired() {
+		return false
+	}
+	p := c.coldPolicy.Load()
+	return p.admits(item.Key, len(item.Value)) &&
+		c.coldRoom(p) >= cold.RecordLen(item.Key, item.Value)
+}
@@ -0,0 +1,123 @@
+package storage
+
+// deque — кольцевой буфер строк для списков.
+// push/pop с обоих концов — O(1), доступ по индексу — O(1).
+type deque struct {
+	buf  []string
+	head int
+	size int
+}
+
+const dequeMinCap = 8
+
+// newDeque создаёт пустой deque.
+func newDeque() *deque {
+	return &deque{buf: make([]string, dequeMinCap)}
+}
+
+// Len возвращает количество элементов.
+func (d *deque) Len() int { return d.size }
+
+// At возвращает i-й элемент (0 ≤ i < Len).
+func (d *deque) At(i int) string {
+	return d.buf[(d.head+i)&(len(d.buf)-1)]
+}
+
+// Set заменяет i-й элемент.
+func (d *deque) Set(i int, v string) {
+	d.buf[(d.head+i)&(len(d.buf)-1)] = v
+}
+
+// PushFront добавляет элемент в начало.
+func (d *deque) PushFront(v string) {
+	d.grow()
+	d.head = (d.head - 1) & (len(d.buf) - 1)
+	d.buf[d.head] = v
+	d.size++
+}
+
+// PushBack добавляет элемент в конец.
+func (d *deque) PushBack(v string) {
+	d.grow()
+	d.buf[(d.head+d.size)&(len(d.buf)-1)] = v
+	d.size++
+}
+
+// PopFront извлекает первый элемент.
+func (d *deque) PopFront() string {
+	v := d.buf[d.head]
+	d.buf[d.head] = ""
+	d.head = (d.head + 1) & (len(d.buf) - 1)
+	d.size--
+	d.shrink()
+	return v
+}
+
+// PopBack извлекает последний элемент.
+func (d *deque) PopBack() string {
+	i := (d.head + d.size - 1) & (len(d.buf) - 1)
+	v := d.buf[i]
+	d.buf[i] = ""
+	d.size--
+	d.shrink()
+	return v
+}
+
+// Slice копирует элементы [start, stop] (включительно, индексы уже нормализованы).
+func (d *deque) Slice(start, stop int) []string {
+	if start > stop {
+		return []string{}
+	}
+	out := make([]string, 0, stop-start+1)
+	for i := start; i <= stop; i++ {
+		out = append(out, d.At(i))
+	}
+	return out
+}
+
+// Keep оставляет только элементы, для которых keep(i, v) == true.
+func (d *deque) Keep(keep func(i int, v string) bool) {
+	kept := make([]string, 0, d.size)
+	for i := 0; i < d.size; i++ {
+		if v := d.At(i); keep(i, v) {
+			kept = append(kept, v)
+		}
+	}
+	d.reset(kept)
+}
+
+// reset заполняет deque заново из среза.
+func (d *deque) reset(items []string) {
+	capacity := dequeMinCap
+	for capacity < len(items) {
+		capacity <<= 1
+	}
+	d.buf = make([]string, capacity)
+	copy(d.buf, items)
+	d.head = 0
+	d.size = len(items)
+}
+
+// grow удваивает буфер, если он заполнен (ёмкость — степень двойки).
+func (d *deque) grow() {
+	if d.size < len(d.buf) {
+		return
+	}
+	d.resize(len(d.buf) << 1)
+}
+
+// shrink уменьшает буфер, если он заполнен меньше чем на четверть.
+func (d *deque) shrink() {
+	if len(d.buf) > dequeMinCap && d.size <= len(d.buf)>>2 {
+		d.resize(len(d.buf) >> 1)
+	}
+}
+
+func (d *deque) resize(capacity int) {
+	buf := make([]string, capacity)
+	for i := 0; i < d.size; i++ {
+		buf[i] = d.At(i)
+	}
+	d.buf = buf
+	d.head = 0
+}
@@ -0,0 +1,76 @@
+package storage
+
+import "strconv"
+
+/*
+	Кодирование нескольких аргументов в одно значение AOF-записи.
+	Формат: <len>:<bytes><len>:<bytes>...
+	Например ["name", "John"] → "4:name4:John".
+*/
+
+// encodeArgs упаковывает аргументы в одну строку.
+func encodeArgs(args []string) string {
+	size := 0
+	for _, a := range args {
+		size += len(a) + 4
+	}
+
+	buf := make([]byte, 0, size)
+	for _, a := range args {
+		buf = strconv.AppendInt(buf, int64(len(a)), 10)
+		buf = append(buf, ':')
+		buf = append(buf, a...)
+	}
+	return string(buf)
+}
+
+// decodeArgs распаковывает строку, собранную encodeArgs.
+// Возвращает false, если формат повреждён.
+func decodeArgs(s string) ([]string, bool) {
+	var args []string
+	for len(s) > 0 {
+		sep := 0
+		for sep < len(s) && s[sep] != ':' {
+			sep++
+		}
+		if sep == len(s) {
+			return nil, false
+		}
+
+		n, err := strconv.Atoi(s[:sep])
+		if err != nil || n < 0 || sep+1+n > len(s) {
+			return nil, false
+		}
+
+		args = append(args, s[sep+1:sep+1+n])
+		s = s[sep+1+n:]
+	}
+	return args, true
+}
+
+// encodeScores упаковывает элементы sorted set парами score, member.
+func encodeScores(members []ZMember) string {
+	args := make([]string, 0, len(members)*2)
+	for _, m := range members {
+		args = append(args, FormatScore(m.Score), m.Member)
+	}
+	return encodeArgs(args)
+}
+
+// decodeScores распаковывает строку, собранную encodeScores.
+func decodeScores(s string) ([]ZMember, bool) {
+	args, ok := decodeArgs(s)
+	if !ok || len(args)%2 != 0 {
+		return nil, false
+	}
+
+	members := make([]ZMember, 0, len(args)/2)
+	for i := 0; i < len(args); i += 2 {
+		score, err := ParseScore(args[i])
+		if err != nil {
+			return nil, false
+		}
+		members = append(members, ZMember{args[i+1], score})
+	}
+	return members, true
+}
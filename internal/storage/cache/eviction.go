@@ -2,19 +2,13 @@ package storage
 
 import (
 	"container/heap"
+	"log"
 	"sync/atomic"
 	"time"
 
 	"imcs/internal/storage/cold"
 )
 
-const (
-	coldThreshold  = 5 * time.Minute  // данные старше 5 минут → на диск
-	flushDiskEvery = 30 * time.Second // сброс cold store на диск
-	flushWorkers   = 4                // кол-во горутин для выгрузки на диск
-	flushChanSize  = 1024             // буфер канала
-)
-
 // HasCold возвращает true если cold storage инициализирован.
 func (c *Cache) HasCold() bool {
 	return c.cold != nil
@@ -22,6 +16,7 @@ func (c *Cache) HasCold() bool {
 
 // ExpireByTTL — O(1) per expired key. Использует min-heap.
 // Лимит: до 128 ключей за тик (чтобы не блокировать шарды надолго).
+// Истёкшие ключи cold storage убираются так же, своим heap.
 func (c *Cache) ExpireByTTL() {
 	now := time.Now().UnixNano()
 	const maxPerShard = 128
@@ -37,58 +32,86 @@ func (c *Cache) ExpireByTTL() {
 				break
 			}
 			heap.Pop(&s.pq)
-			delete(s.items, top.Key)
+			s.unlinkLocked(top)
 			c.totalKeys.Add(-1)
 			removed++
 		}
 
 		s.Unlock()
 	}
+
+	if c.cold != nil {
+		c.cold.Expire(now, maxPerShard*shardCount)
+	}
 }
 
 // EvictCold — sample-based cold eviction.
-// Смотрим до 16 ключей в каждом шарде.
-// Если ключ не использовался > coldThreshold — выгружаем в cold storage.
+// Смотрим до ColdPolicy.Samples ключей в каждом шарде.
+// Если ключ не использовался дольше ColdPolicy.IdleTime и политика его
+// допускает (см. coldpolicy.go) — выгружаем в cold storage.
+// Пачка шарда пишется на диск до снятия блокировки: выгружаемый ключ
+// всё время виден либо в RAM, либо в cold, и SET посреди выгрузки не
+// оставит в cold устаревшее значение.
 func (c *Cache) EvictCold() {
 	if c.cold == nil {
 		return
 	}
+	p := c.coldPolicy.Load()
+	if p.IdleTime == 0 {
+		return
+	}
 
 	now := time.Now().UnixNano()
-	coldDeadline := now - int64(coldThreshold)
-	const sampleSize = 16
+	coldDeadline := now - int64(p.IdleTime)
+	room := c.coldRoom(p)
 
-	for i := 0; i < shardCount; i++ {
+	batch := make([]cold.Item, 0, p.Samples)
+	victims := make([]*Item, 0, p.Samples)
+	for i := 0; i < shardCount && room > 0; i++ {
 		s := c.shards[i]
 		s.Lock()
 
 		sampled := 0
-		for key, item := range s.items {
-			if sampled >= sampleSize {
+		for _, item := range s.items {
+			if sampled >= p.Samples {
 				break
 			}
 			sampled++
 
-			access := atomic.LoadInt64(&item.LastAccess)
-			if access < coldDeadline {
-				select {
-				case c.flushCh <- coldItem{
-					key:      key,
-					value:    item.Value,
-					expireAt: item.ExpireAt,
-				}:
-					delete(s.items, key)
-					if item.HeapIndex >= 0 {
-						heap.Remove(&s.pq, item.HeapIndex)
-					}
-					c.totalKeys.Add(-1)
-				default:
-					// канал полон — пропускаем
-				}
+			// В cold storage уходят только строки; истёкшие убирает ExpireByTTL
+			if item.Kind != KindString || item.IsExpired() ||
+				atomic.LoadInt64(&item.LastAccess) >= coldDeadline ||
+				!p.admits(item.Key, len(item.Value)) {
+				continue
+			}
+			size := cold.RecordLen(item.Key, item.Value)
+			if size > room {
+				continue
 			}
+			room -= size
+			batch = append(batch, cold.Item{
+				Key:      item.Key,
+				Value:    item.Value,
+				ExpireAt: item.ExpireAt,
+			})
+			victims = append(victims, item)
 		}
 
+		// Ключи уходят из RAM только после успешной записи на диск:
+		// при ошибке они остаются в RAM, а проход прекращается
+		if err := c.cold.PutBatch(batch); err != nil {
+			s.Unlock()
+			log.Println("cold write error:", err)
+			return
+		}
+		for _, item := range victims {
+			s.removeLocked(item)
+		}
+		c.totalKeys.Add(-int64(len(victims)))
+		c.coldDemoted.Add(int64(len(victims)))
+
 		s.Unlock()
+		batch, victims = batch[:0], victims[:0]
 	}
 }
 
@@ -99,81 +122,13 @@ func (c *Cache) FlushCold() {
 	}
 }
 
-// evictLRU вытесняет один ключ с минимальным LastAccess.
-// Если cold storage включён — выгружает на диск вместо удаления.
-func (c *Cache) evictLRU() {
-	var (
-		victimKey   string
-		victimValue string
-		victimExp   int64
-		victimShard *shard
-		minAccess   int64 = 1<<63 - 1
-	)
-
-	for i := 0; i < shardCount; i++ {
-		s := c.shards[i]
-		s.RLock()
-
-		sampled := 0
-		for _, item := range s.items {
-			access := atomic.LoadInt64(&item.LastAccess)
-			if access < minAccess {
-				minAccess = access
-				victimKey = item.Key
-				victimValue = item.Value
-				victimExp = item.ExpireAt
-				victimShard = s
-			}
-			sampled++
-			if sampled >= 5 {
-				break
-			}
-		}
-
-		s.RUnlock()
-	}
-
-	if victimShard != nil {
-		if victimShard.del(victimKey) {
-			c.totalKeys.Add(-1)
-			if c.cold != nil {
-				c.cold.Put(victimKey, victimValue, victimExp)
-			}
-		}
+// CompactCold переписывает сегменты cold storage, где больше половины
+// мёртвых записей. Долгая операция — janitor зовёт её в отдельной горутине.
+func (c *Cache) CompactCold() {
+	if c.cold == nil {
+		return
 	}
-}
-
-// flushWorker — горутина-worker для записи в cold storage.
-func (c *Cache) flushWorker(_ int) {
-	batch := make([]cold.Item, 0, 64)
-
-	for item := range c.flushCh {
-		batch = append(batch, cold.Item{
-			Key:      item.key,
-			Value:    item.value,
-			ExpireAt: item.expireAt,
-		})
-
-		// Drain: собираем пачку
-		drained := true
-		for drained && len(batch) < 64 {
-			select {
-			case it, ok := <-c.flushCh:
-				if !ok {
-					drained = false
-					break
-				}
-				batch = append(batch, cold.Item{
-					Key:      it.key,
-					Value:    it.value,
-					ExpireAt: it.expireAt,
-				})
-			default:
-				drained = false
-			}
-		}
-
-		c.cold.PutBatch(batch)
-		batch = batch[:0]
+	if err := c.cold.Compact(); err != nil {
+		log.Println("cold compact error:", err)
 	}
 }
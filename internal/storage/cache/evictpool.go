@@ -0,0 +1,225 @@
+package storage
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+/*
+
+	Пул кандидатов на вытеснение — как evictionPoolEntry в Redis.
+
+	Лучший из пяти случайных ключей часто далеко не самый старый, а
+	обходить выборкой все 64 шарда ради одного ключа дорого. Пул хранит
+	evictionPoolSize лучших кандидатов из всех прошлых выборок: каждая
+	выборка (maxmemory-samples ключей, начиная со случайного шарда) лишь
+	дополняет его, вытесняется лучший из пула. Чем дольше идёт
+	вытеснение, тем ближе результат к точному LRU/LFU/TTL.
+
+	Запись не вытесняет сама: превысив лимит, она будит фоновую горутину,
+	которая освобождает место пачками по evictionBatch ключей. Только
+	если лимит превышен больше чем на 1/evictionSlack (фон не успевает
+	за потоком записей), запись вытесняет синхронно — иначе память росла
+	бы без предела.
+
+*/
+
+const (
+	evictionPoolSize       = 16
+	evictionBatch          = 32 // вытеснений за один захват пула
+	evictionSlack          = 32 // допуск сверх лимита: 1/32 maxmemory и maxKeys
+	defaultEvictionSamples = 5
+)
+
+// poolEntry — кандидат на вытеснение. Меньше score — лучше кандидат.
+type poolEntry struct {
+	key   string
+	shard *shard
+	score int64
+}
+
+// evictionPool — лучшие кандидаты по возрастанию score. Оценки разных
+// политик несравнимы, поэтому при смене политики пул очищается.
+type evictionPool struct {
+	mu      sync.Mutex
+	policy  EvictionPolicy
+	entries []poolEntry
+	samples atomic.Int32 // maxmemory-samples
+}
+
+// SetEvictionSamples задаёт, сколько ключей смотрит одна выборка
+// (maxmemory-samples, минимум 1). Больше — точнее и медленнее.
+func (c *Cache) SetEvictionSamples(n int) {
+	c.pool.samples.Store(int32(max(n, 1)))
+}
+
+// EvictionSamples возвращает maxmemory-samples.
+func (c *Cache) EvictionSamples() int {
+	return int(c.pool.samples.Load())
+}
+
+// evictInBackground будит фоновое вытеснение, если оно ещё не идёт.
+func (c *Cache) evictInBackground() {
+	if !c.evicting.CompareAndSwap(false, true) {
+		return
+	}
+	go func() {
+		for {
+			ok := c.evictOverLimits()
+			c.evicting.Store(false)
+			// Запись могла превысить лимит, пока флаг ещё стоял, и
+			// не разбудить нас — проверяем сами
+			if !ok || !c.overLimits() || !c.evicting.CompareAndSwap(false, true) {
+				return
+			}
+		}
+	}()
+}
+
+// overLimits — ключей больше maxKeys или памяти больше maxmemory.
+func (c *Cache) overLimits() bool {
+	if c.maxKeys > 0 && c.totalKeys.Load() > c.maxKeys {
+		return true
+	}
+	limit := c.maxMemory.Load()
+	return limit > 0 && c.UsedMemory() > limit
+}
+
+// evictOverLimits вытесняет до maxKeys и maxmemory. false — кандидатов
+// не хватило.
+func (c *Cache) evictOverLimits() bool {
+	keysOK := c.maxKeys <= 0 || c.evictWhile(c.keysPolicy(), func() bool {
+		return c.totalKeys.Load() > c.maxKeys
+	})
+	return c.FreeMemory() == nil && keysOK
+}
+
+// evictWhile вытесняет по политике пачками, пока over() истинно.
+// false — кандидатов не осталось.
+func (c *Cache) evictWhile(policy EvictionPolicy, over func() bool) bool {
+	for over() {
+		if !c.evictBatch(policy, over) {
+			return false
+		}
+	}
+	return true
+}
+
+// evictBatch — до evictionBatch вытеснений за один захват пула.
+func (c *Cache) evictBatch(policy EvictionPolicy, over func() bool) bool {
+	c.pool.mu.Lock()
+	defer c.pool.mu.Unlock()
+
+	for n := 0; n < evictionBatch && over(); n++ {
+		if !c.evictOneLocked(policy) {
+			return false
+		}
+	}
+	return true
+}
+
+// evictOneLocked вытесняет лучшего кандидата (под pool.mu).
+func (c *Cache) evictOneLocked(policy EvictionPolicy) bool {
+	for {
+		var (
+			s   *shard
+			key string
+			ok  bool
+		)
+		if policy == AllKeysRandom {
+			s, key, ok = c.randomKey()
+		} else {
+			s, key, ok = c.pool.next(c, policy)
+		}
+		if !ok {
+			return false
+		}
+		// Кандидат мог исчезнуть после выборки — берём следующего
+		if c.evictKey(s, key) {
+			return true
+		}
+	}
+}
+
+// randomKey — первый ключ случайного непустого шарда (allkeys-random).
+func (c *Cache) randomKey() (*shard, string, bool) {
+	start := rand.Intn(shardCount)
+	for n := 0; n < shardCount; n++ {
+		s := c.shards[(start+n)%shardCount]
+		s.RLock()
+		for _, item := range s.items {
+			s.RUnlock()
+			return s, item.Key, true
+		}
+		s.RUnlock()
+	}
+	return nil, "", false
+}
+
+// next дополняет пул свежей выборкой и извлекает из него лучшего кандидата.
+func (p *evictionPool) next(c *Cache, policy EvictionPolicy) (*shard, string, bool) {
+	if p.policy != policy {
+		p.policy = policy
+		p.entries = p.entries[:0]
+	}
+	p.populate(c, policy)
+	if len(p.entries) == 0 {
+		return nil, "", false
+	}
+
+	best := p.entries[0]
+	copy(p.entries, p.entries[1:])
+	p.entries[len(p.entries)-1] = poolEntry{}
+	p.entries = p.entries[:len(p.entries)-1]
+	return best.shard, best.key, true
+}
+
+// populate добавляет в пул samples подходящих ключей, начиная со
+// случайного шарда. Для volatile-* ключи без TTL пропускаются — если
+// таких нет, обходит все шарды и ничего не добавляет.
+func (p *evictionPool) populate(c *Cache, policy EvictionPolicy) {
+	samples := int(p.samples.Load())
+	now := nowCached()
+
+	sampled := 0
+	start := rand.Intn(shardCount)
+	for n := 0; n < shardCount && sampled < samples; n++ {
+		s := c.shards[(start+n)%shardCount]
+		s.RLock()
+		for _, item := range s.items {
+			if policy.volatile() && atomic.LoadInt64(&item.ExpireAt) == 0 {
+				continue
+			}
+			p.insert(poolEntry{key: item.Key, shard: s, score: evictionScore(policy, s, item, now)})
+			sampled++
+			if sampled >= samples {
+				break
+			}
+		}
+		s.RUnlock()
+	}
+}
+
+// insert ставит кандидата на своё место по score; худший выпадает из
+// полного пула. Ключ, уже стоящий в пуле, получает новую оценку.
+func (p *evictionPool) insert(e poolEntry) {
+	for i := range p.entries {
+		if p.entries[i].key == e.key && p.entries[i].shard == e.shard {
+			copy(p.entries[i:], p.entries[i+1:])
+			p.entries = p.entries[:len(p.entries)-1]
+			break
+		}
+	}
+
+	i := sort.Search(len(p.entries), func(i int) bool { return p.entries[i].score > e.score })
+	if i >= evictionPoolSize {
+		return
+	}
+	if len(p.entries) < evictionPoolSize {
+		p.entries = append(p.entries, poolEntry{})
+	}
+	copy(p.entries[i+1:], p.entries[i:len(p.entries)-1])
+	p.entries[i] = e
+}
@@ -0,0 +1,233 @@
+package storage
+
+import (
+	"math"
+	"strconv"
+)
+
+// === Hash: операции уровня шарда ===
+
+// hset записывает пары field/value в хеш. Возвращает число новых полей.
+// nx = true — поле пишется, только если его ещё нет (HSETNX).
+// delta — изменение числа ключей в шарде (для totalKeys).
+func (s *shard) hset(key string, pairs []string, nx bool) (added int, delta int64, err error) {
+	s.Lock()
+	defer s.Unlock()
+
+	item, ok, expired := s.liveLocked(key)
+	if expired {
+		delta--
+	}
+	if ok && item.Kind != KindHash {
+		return 0, delta, ErrWrongType
+	}
+	if !ok {
+		item = s.newItemLocked(key, KindHash)
+		delta++
+	}
+
+	for i := 0; i+1 < len(pairs); i += 2 {
+		field, value := pairs[i], pairs[i+1]
+		if old, exists := item.Hash[field]; exists {
+			if nx {
+				continue
+			}
+			s.growLocked(item, int64(len(value)-len(old)))
+		} else {
+			added++
+			s.growLocked(item, hashFieldSize(field, value))
+		}
+		item.Hash[field] = value
+	}
+	s.touchLocked(key)
+	s.access(item, nowCached())
+
+	return added, delta, nil
+}
+
+// hget возвращает значение поля хеша.
+func (s *shard) hget(key, field string) (string, bool, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	item, ok := s.liveRLocked(key)
+	if !ok {
+		return "", false, nil
+	}
+	if item.Kind != KindHash {
+		return "", false, ErrWrongType
+	}
+	s.access(item, nowCached())
+
+	val, found := item.Hash[field]
+	return val, found, nil
+}
+
+// hmget возвращает значения нескольких полей хеша.
+func (s *shard) hmget(key string, fields []string) ([]struct {
+	Value string
+	Found bool
+}, error) {
+	result := make([]struct {
+		Value string
+		Found bool
+	}, len(fields))
+
+	s.RLock()
+	defer s.RUnlock()
+
+	item, ok := s.liveRLocked(key)
+	if !ok {
+		return result, nil
+	}
+	if item.Kind != KindHash {
+		return nil, ErrWrongType
+	}
+	s.access(item, nowCached())
+
+	for i, field := range fields {
+		result[i].Value, result[i].Found = item.Hash[field]
+	}
+	return result, nil
+}
+
+// hgetall возвращает копию хеша.
+func (s *shard) hgetall(key string) (map[string]string, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	item, ok := s.liveRLocked(key)
+	if !ok {
+		return map[string]string{}, nil
+	}
+	if item.Kind != KindHash {
+		return nil, ErrWrongType
+	}
+	s.access(item, nowCached())
+
+	result := make(map[string]string, len(item.Hash))
+	for field, val := range item.Hash {
+		result[field] = val
+	}
+	return result, nil
+}
+
+// hdel удаляет поля хеша. Пустой хеш удаляется целиком.
+// Возвращает число удалённых полей.
+func (s *shard) hdel(key string, fields []string) (removed int, delta int64, err error) {
+	s.Lock()
+	defer s.Unlock()
+
+	item, ok, expired := s.liveLocked(key)
+	if expired {
+		delta--
+	}
+	if !ok {
+		return 0, delta, nil
+	}
+	if item.Kind != KindHash {
+		return 0, delta, ErrWrongType
+	}
+
+	for _, field := range fields {
+		if val, exists := item.Hash[field]; exists {
+			delete(item.Hash, field)
+			s.growLocked(item, -hashFieldSize(field, val))
+			removed++
+		}
+	}
+	if removed > 0 {
+		s.touchLocked(key)
+	}
+
+	if len(item.Hash) == 0 {
+		s.removeLocked(item)
+		delta--
+	}
+	return removed, delta, nil
+}
+
+// hlen возвращает количество полей хеша.
+func (s *shard) hlen(key string) (int, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	item, ok := s.liveRLocked(key)
+	if !ok {
+		return 0, nil
+	}
+	if item.Kind != KindHash {
+		return 0, ErrWrongType
+	}
+	return len(item.Hash), nil
+}
+
+// hkeys возвращает поля (values = false) или значения (values = true) хеша.
+func (s *shard) hkeys(key string, values bool) ([]string, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	item, ok := s.liveRLocked(key)
+	if !ok {
+		return []string{}, nil
+	}
+	if item.Kind != KindHash {
+		return nil, ErrWrongType
+	}
+	s.access(item, nowCached())
+
+	result := make([]string, 0, len(item.Hash))
+	for field, val := range item.Hash {
+		if values {
+			result = append(result, val)
+		} else {
+			result = append(result, field)
+		}
+	}
+	return result, nil
+}
+
+// hincrBy атомарно прибавляет delta к числовому полю хеша.
+func (s *shard) hincrBy(key, field string, incr int64) (result int64, delta int64, err error) {
+	s.Lock()
+	defer s.Unlock()
+
+	item, ok, expired := s.liveLocked(key)
+	if expired {
+		delta--
+	}
+	if ok && item.Kind != KindHash {
+		return 0, delta, ErrWrongType
+	}
+
+	var current int64
+	if ok {
+		if raw, exists := item.Hash[field]; exists {
+			current, err = strconv.ParseInt(raw, 10, 64)
+			if err != nil {
+				return 0, delta, ErrHashValueNotInt
+			}
+		}
+	}
+
+	if (incr > 0 && current > math.MaxInt64-incr) || (incr < 0 && current < math.MinInt64-incr) {
+		return 0, delta, ErrOverflow
+	}
+	current += incr
+
+	if !ok {
+		item = s.newItemLocked(key, KindHash)
+		delta++
+	}
+	val := strconv.FormatInt(current, 10)
+	if old, exists := item.Hash[field]; exists {
+		s.growLocked(item, int64(len(val)-len(old)))
+	} else {
+		s.growLocked(item, hashFieldSize(field, val))
+	}
+	item.Hash[field] = val
+	s.touchLocked(key)
+	s.access(item, nowCached())
+
+	return current, delta, nil
+}
@@ -0,0 +1,125 @@
+package storage
+
+import "strconv"
+
+// === Hash: Redis-совместимые операции ===
+
+// HSet записывает пары field/value в хеш. Возвращает число новых полей.
+func (c *Cache) HSet(key string, pairs ...string) (int, error) {
+	s := c.getShard(key)
+	c.promote(s, key)
+	if err := c.reserve(s, key); err != nil {
+		return 0, err
+	}
+
+	added, delta, err := s.hset(key, pairs, false)
+	c.totalKeys.Add(delta)
+	if err != nil {
+		return 0, err
+	}
+
+	return added, c.durable(nil, c.persister.Write("HSET", key, encodeArgs(pairs), 0))
+}
+
+// HSetNX записывает поле, только если его ещё нет в хеше.
+func (c *Cache) HSetNX(key, field, value string) (bool, error) {
+	s := c.getShard(key)
+	c.promote(s, key)
+	if err := c.reserve(s, key); err != nil {
+		return false, err
+	}
+
+	pair := []string{field, value}
+	added, delta, err := s.hset(key, pair, true)
+	c.totalKeys.Add(delta)
+	if err != nil || added == 0 {
+		return false, err
+	}
+
+	return true, c.durable(nil, c.persister.Write("HSET", key, encodeArgs(pair), 0))
+}
+
+// HGet возвращает значение поля хеша.
+func (c *Cache) HGet(key, field string) (string, bool, error) {
+	s := c.getShard(key)
+	c.promote(s, key)
+	return s.hget(key, field)
+}
+
+// HMGet возвращает значения нескольких полей хеша.
+func (c *Cache) HMGet(key string, fields ...string) ([]struct {
+	Value string
+	Found bool
+}, error) {
+	s := c.getShard(key)
+	c.promote(s, key)
+	return s.hmget(key, fields)
+}
+
+// HGetAll возвращает все поля и значения хеша.
+func (c *Cache) HGetAll(key string) (map[string]string, error) {
+	s := c.getShard(key)
+	c.promote(s, key)
+	return s.hgetall(key)
+}
+
+// HDel удаляет поля хеша. Возвращает число удалённых полей.
+func (c *Cache) HDel(key string, fields ...string) (int, error) {
+	s := c.getShard(key)
+	c.promote(s, key)
+
+	removed, delta, err := s.hdel(key, fields)
+	c.totalKeys.Add(delta)
+	if err != nil {
+		return 0, err
+	}
+
+	if removed > 0 {
+		err = c.durable(nil, c.persister.Write("HDEL", key, encodeArgs(fields), 0))
+	}
+	return removed, err
+}
+
+// HExists проверяет наличие поля в хеше.
+func (c *Cache) HExists(key, field string) (bool, error) {
+	_, found, err := c.HGet(key, field)
+	return found, err
+}
+
+// HLen возвращает количество полей хеша.
+func (c *Cache) HLen(key string) (int, error) {
+	s := c.getShard(key)
+	c.promote(s, key)
+	return s.hlen(key)
+}
+
+// HKeys возвращает все поля хеша.
+func (c *Cache) HKeys(key string) ([]string, error) {
+	s := c.getShard(key)
+	c.promote(s, key)
+	return s.hkeys(key, false)
+}
+
+// HVals возвращает все значения хеша.
+func (c *Cache) HVals(key string) ([]string, error) {
+	s := c.getShard(key)
+	c.promote(s, key)
+	return s.hkeys(key, true)
+}
+
+// HIncrBy атомарно прибавляет delta к числовому полю хеша.
+func (c *Cache) HIncrBy(key, field string, delta int64) (int64, error) {
+	s := c.getShard(key)
+	c.promote(s, key)
+	if err := c.reserve(s, key); err != nil {
+		return 0, err
+	}
+
+	result, keyDelta, err := s.hincrBy(key, field, delta)
+	c.totalKeys.Add(keyDelta)
+	if err != nil {
+		return 0, err
+	}
+
+	return result, c.durable(nil, c.persister.Write("HSET", key, encodeArgs([]string{field, strconv.FormatInt(result, 10)}), 0))
+}
@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+// recordPersistence запоминает все записи AOF (для проверки replay)
+// и команды записей, durability которых дождался кеш.
+type recordPersistence struct {
+	entries []recordEntry
+	waited  []string
+}
+
+type recordEntry struct {
+	cmd, key, value string
+	expire          int64
+}
+
+func (r *recordPersistence) Write(cmd, key, value string, duration time.Duration) func() error {
+	var expire int64
+	if duration > 0 {
+		expire = time.Now().Add(duration).UnixNano()
+	}
+	return r.WriteAt(cmd, key, value, expire)
+}
+
+func (r *recordPersistence) WriteAt(cmd, key, value string, expireAt int64) func() error {
+	r.entries = append(r.entries, recordEntry{cmd, key, value, expireAt})
+	return func() error {
+		r.waited = append(r.waited, cmd)
+		return nil
+	}
+}
+
+// replayInto проигрывает записанный журнал в новый кеш.
+func (r *recordPersistence) replayInto(c *Cache) {
+	for _, e := range r.entries {
+		c.Replay(e.cmd, e.key, e.value, e.expire)
+	}
+}
+
+func TestHashBasic(t *testing.T) {
+	c := New(&mockPersistence{})
+	defer c.Close()
+
+	added, err := c.HSet("user:1", "name", "John", "age", "30")
+	if err != nil || added != 2 {
+		t.Fatalf("HSet: added=%d err=%v", added, err)
+	}
+
+	if val, found, _ := c.HGet("user:1", "name"); !found || val != "John" {
+		t.Fatalf("HGet name = %q, %v", val, found)
+	}
+
+	if n, _ := c.HIncrBy("user:1", "age", 5); n != 35 {
+		t.Fatalf("HIncrBy = %d, want 35", n)
+	}
+	if n, err := c.Strlen("user:1"); n != 0 || err != ErrWrongType {
+		t.Fatalf("Strlen on hash = %d, %v", n, err)
+	}
+	if _, err := c.HIncrBy("user:1", "name", 1); err != ErrHashValueNotInt {
+		t.Fatalf("HIncrBy on text: err=%v", err)
+	}
+
+	if ok, _ := c.HSetNX("user:1", "name", "Jane"); ok {
+		t.Fatal("HSetNX overwrote existing field")
+	}
+
+	if c.Type("user:1") != "hash" {
+		t.Fatalf("Type = %q, want hash", c.Type("user:1"))
+	}
+	if c.CountKeys() != 1 {
+		t.Fatalf("CountKeys = %d, want 1", c.CountKeys())
+	}
+
+	// Удаление последнего поля удаляет ключ
+	if n, _ := c.HDel("user:1", "name", "age"); n != 2 {
+		t.Fatalf("HDel = %d, want 2", n)
+	}
+	if c.Exists("user:1") != 0 || c.CountKeys() != 0 {
+		t.Fatal("empty hash must be removed")
+	}
+}
+
+func TestHashWrongType(t *testing.T) {
+	c := New(&mockPersistence{})
+	defer c.Close()
+
+	c.Set("str", "value", 0, false)
+	if _, err := c.HSet("str", "f", "v"); err != ErrWrongType {
+		t.Fatalf("HSet on string: err=%v", err)
+	}
+
+	c.HSet("hash", "f", "v")
+	if _, err := c.IncrBy("hash", 1); err != ErrWrongType {
+		t.Fatalf("IncrBy on hash: err=%v", err)
+	}
+	if _, found := c.Get("hash"); found {
+		t.Fatal("Get must not return a hash as a string")
+	}
+
+	// SET перезаписывает хеш строкой
+	c.Set("hash", "plain", 0, false)
+	if val, _ := c.Get("hash"); val != "plain" || c.Type("hash") != "string" {
+		t.Fatalf("SET over hash: val=%q type=%q", val, c.Type("hash"))
+	}
+}
+
+func TestHashReplay(t *testing.T) {
+	rec := &recordPersistence{}
+	c := New(rec)
+	defer c.Close()
+
+	c.HSet("h", "a", "1", "b", "2", "sep|with:colon", "multi\x00byte")
+	c.HIncrBy("h", "a", 10)
+	c.HDel("h", "b")
+	c.HSet("gone", "x", "y")
+	c.Rename("gone", "moved")
+
+	restored := New(&mockPersistence{})
+	defer restored.Close()
+	rec.replayInto(restored)
+
+	got, _ := restored.HGetAll("h")
+	want := map[string]string{"a": "11", "sep|with:colon": "multi\x00byte"}
+	if len(got) != len(want) {
+		t.Fatalf("replayed hash = %v, want %v", got, want)
+	}
+	for f, v := range want {
+		if got[f] != v {
+			t.Fatalf("field %q = %q, want %q", f, got[f], v)
+		}
+	}
+	if restored.Exists("gone") != 0 {
+		t.Fatal("renamed source key survived replay")
+	}
+	if val, _, _ := restored.HGet("moved", "x"); val != "y" {
+		t.Fatalf("renamed hash field = %q", val)
+	}
+
+	// Snapshot (rewrite) воссоздаёт то же состояние
+	snap := New(&mockPersistence{})
+	defer snap.Close()
+	restored.Snapshot(func() {}, func(cmd, key, value string, expireAt int64) {
+		snap.Replay(cmd, key, value, expireAt)
+	})
+	if n, _ := snap.HLen("h"); n != 2 {
+		t.Fatalf("snapshot HLen = %d, want 2", n)
+	}
+}
@@ -17,3 +17,24 @@ func (i *Item) IsExpired() bool {
 func (i *Item) IsStale() bool {
 	return time.Now().UnixNano()-atomic.LoadInt64(&i.LastAccess) > int64(staleThreshold)
 }
+
+// record возвращает AOF-команду и значение, воссоздающие элемент целиком.
+// Вызывается под блокировкой шарда.
+func (i *Item) record() (string, string) {
+	switch i.Kind {
+	case KindHash:
+		pairs := make([]string, 0, len(i.Hash)*2)
+		for field, val := range i.Hash {
+			pairs = append(pairs, field, val)
+		}
+		return "HSET", encodeArgs(pairs)
+	case KindList:
+		return "RPUSH", encodeArgs(i.List.Slice(0, i.List.Len()-1))
+	case KindSet:
+		return "SADD", encodeArgs(setMembers(i.Set))
+	case KindZSet:
+		return "ZADD", encodeScores(i.ZSet.Members())
+	default:
+		return "SET", i.Value
+	}
+}
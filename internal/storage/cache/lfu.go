@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+/*
+
+	LFU — частота обращений к ключу, как в Redis (Morris counter).
+
+	Item.Freq: младшие 8 бит — логарифмический счётчик, старшие 16 —
+	минута последнего обращения (по модулю 65536).
+
+	Счётчик растёт с вероятностью 1/((counter-lfuInitVal)*logFactor+1):
+	при logFactor 10 до 255 доходит примерно за миллион обращений, так
+	что 8 бит различают и тёплые, и очень горячие ключи. За каждые
+	decayTime минут без обращений счётчик уменьшается на 1 — ключ, горячий
+	час назад, со временем уступает тем, кого читают сейчас. Новый ключ
+	начинает с lfuInitVal, чтобы его не вытеснили раньше первого чтения.
+
+*/
+
+const (
+	lfuInitVal          = 5
+	lfuCounterMax       = 255
+	defaultLFULogFactor = 10
+	defaultLFUDecayTime = 1 // минут
+)
+
+// lfuParams — lfu-log-factor и lfu-decay-time кеша. Общие для всех шардов.
+type lfuParams struct {
+	logFactor atomic.Int32
+	decayTime atomic.Int32 // минут, 0 — не уменьшать
+}
+
+// SetLFU задаёт lfu-log-factor (>= 0) и lfu-decay-time в минутах
+// (0 — счётчик не уменьшается). Можно менять на ходу.
+func (c *Cache) SetLFU(logFactor, decayTime int) {
+	c.lfu.logFactor.Store(int32(max(logFactor, 0)))
+	c.lfu.decayTime.Store(int32(max(decayTime, 0)))
+}
+
+// LFU возвращает lfu-log-factor и lfu-decay-time (минут).
+func (c *Cache) LFU() (logFactor, decayTime int) {
+	return int(c.lfu.logFactor.Load()), int(c.lfu.decayTime.Load())
+}
+
+// Freq возвращает LFU-счётчик живого ключа с учётом затухания (OBJECT FREQ).
+func (c *Cache) Freq(key string) (int, bool) {
+	s := c.getShard(key)
+	c.promote(s, key)
+
+	s.RLock()
+	defer s.RUnlock()
+	item, ok := s.liveRLocked(key)
+	if !ok {
+		return 0, false
+	}
+	return s.lfu.counter(atomic.LoadUint32(&item.Freq), nowCached()), true
+}
+
+// SetFreq выставляет LFU-счётчик ключа (RESTORE ... FREQ). false — ключа нет.
+func (c *Cache) SetFreq(key string, freq int) bool {
+	s := c.getShard(key)
+	s.RLock()
+	defer s.RUnlock()
+	item, ok := s.liveRLocked(key)
+	if ok {
+		atomic.StoreUint32(&item.Freq, lfuPack(nowCached(), min(max(freq, 0), lfuCounterMax)))
+	}
+	return ok
+}
+
+// access отмечает обращение к элементу: время (LRU) и счётчик (LFU).
+// Вызывается и под read lock — только атомарные операции; гонка двух
+// читателей теряет разве что одно приращение.
+func (s *shard) access(item *Item, now int64) {
+	atomic.StoreInt64(&item.LastAccess, now)
+	counter := s.lfu.counter(atomic.LoadUint32(&item.Freq), now)
+	atomic.StoreUint32(&item.Freq, lfuPack(now, s.lfu.increment(counter)))
+}
+
+// newFreq — Item.Freq нового ключа.
+func newFreq(now int64) uint32 {
+	return lfuPack(now, lfuInitVal)
+}
+
+// counter — счётчик из Freq за вычетом затухания к моменту now.
+func (p *lfuParams) counter(freq uint32, now int64) int {
+	counter := int(freq & 0xFF)
+	decay := int(p.decayTime.Load())
+	if decay == 0 {
+		return counter
+	}
+	elapsed := int(uint16(lfuMinutes(now) - uint16(freq>>8)))
+	return max(counter-elapsed/decay, 0)
+}
+
+// increment — логарифмическое приращение счётчика.
+func (p *lfuParams) increment(counter int) int {
+	if counter >= lfuCounterMax {
+		return lfuCounterMax
+	}
+	base := max(counter-lfuInitVal, 0)
+	if rand.Float64() < 1/float64(base*int(p.logFactor.Load())+1) {
+		counter++
+	}
+	return counter
+}
+
+func lfuPack(now int64, counter int) uint32 {
+	return uint32(lfuMinutes(now))<<8 | uint32(counter)
+}
+
+func lfuMinutes(now int64) uint16 {
+	return uint16(now / int64(time.Minute))
+}
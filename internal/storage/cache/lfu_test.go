@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLFUCounter(t *testing.T) {
+	c := New(&mockPersistence{})
+	defer c.Close()
+
+	c.Set("k", "v", 0, false)
+	if freq, ok := c.Freq("k"); !ok || freq != lfuInitVal {
+		t.Fatalf("new key: freq = %d, %v", freq, ok)
+	}
+	if _, ok := c.Freq("missing"); ok {
+		t.Fatal("Freq of a missing key")
+	}
+
+	// Рост логарифмический: тысяча чтений — всего несколько единиц
+	for i := 0; i < 1000; i++ {
+		c.Get("k")
+	}
+	freq, _ := c.Freq("k")
+	if freq <= lfuInitVal || freq > 30 {
+		t.Fatalf("after 1000 reads: freq = %d", freq)
+	}
+
+	// logFactor 0 — каждое обращение +1
+	c.SetLFU(0, 1)
+	c.SetFreq("k", 10)
+	for i := 0; i < 10; i++ {
+		c.Get("k")
+	}
+	if freq, _ := c.Freq("k"); freq != 20 {
+		t.Fatalf("logFactor 0: freq = %d, want 20", freq)
+	}
+	c.SetFreq("k", 1000)
+	if freq, _ := c.Freq("k"); freq != lfuCounterMax {
+		t.Fatalf("SetFreq above max: freq = %d", freq)
+	}
+}
+
+func TestLFUDecay(t *testing.T) {
+	c := New(&mockPersistence{})
+	defer c.Close()
+
+	c.Set("k", "v", 0, false)
+	c.SetFreq("k", 20)
+
+	// Последнее обращение — 6 минут назад
+	s := c.getShard("k")
+	s.Lock()
+	item := s.items["k"]
+	atomic.StoreUint32(&item.Freq, lfuPack(nowCached()-int64(6*time.Minute), 20))
+	s.Unlock()
+
+	for _, tc := range []struct{ decayTime, want int }{{1, 14}, {2, 17}, {0, 20}} {
+		c.SetLFU(defaultLFULogFactor, tc.decayTime)
+		if freq, _ := c.Freq("k"); freq != tc.want {
+			t.Fatalf("decay %d: freq = %d, want %d", tc.decayTime, freq, tc.want)
+		}
+	}
+}
+
+// TestLFUEviction — лимит ключей с allkeys-lfu оставляет часто читаемые
+// ключи, даже если их давно не трогали.
+func TestLFUEviction(t *testing.T) {
+	const maxKeys = 1000
+
+	c := NewWithMaxKeys(&mockPersistence{}, maxKeys)
+	defer c.Close()
+	c.SetMaxMemory(0, AllKeysLFU)
+	c.SetLFU(0, defaultLFUDecayTime)
+
+	for i := 0; i < maxKeys; i++ {
+		c.Set("key:"+strconv.Itoa(i), "val", 0, false)
+	}
+	// Первые 100 ключей читаются часто, но до новых записей
+	for i := 0; i < 100; i++ {
+		for j := 0; j < 20; j++ {
+			c.Get("key:" + strconv.Itoa(i))
+		}
+	}
+	for i := maxKeys; i < maxKeys+500; i++ {
+		c.Set("key:"+strconv.Itoa(i), "newval", 0, false)
+	}
+
+	survived := 0
+	for i := 0; i < 100; i++ {
+		if c.Exists("key:"+strconv.Itoa(i)) > 0 {
+			survived++
+		}
+	}
+	if survived < 90 {
+		t.Fatalf("hot keys survived: %d/100", survived)
+	}
+}
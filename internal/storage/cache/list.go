@@ -0,0 +1,172 @@
+package storage
+
+// === List: операции уровня шарда ===
+// Все функции *Locked вызываются под write lock шарда: вызывающий
+// (Cache или Replay) держит блокировку, чтобы запись в AOF шла в том же
+// порядке, в котором изменения применялись к списку.
+
+// listLocked возвращает список по ключу (см. typedLocked).
+func (s *shard) listLocked(key string, create bool) (*Item, int64, error) {
+	return s.typedLocked(key, KindList, create)
+}
+
+// listRLocked возвращает список под read lock (nil, если ключа нет).
+func (s *shard) listRLocked(key string) (*deque, error) {
+	item, err := s.typedRLocked(key, KindList)
+	if err != nil || item == nil {
+		return nil, err
+	}
+	return item.List, nil
+}
+
+// pushLocked добавляет элементы в начало (left) или конец списка.
+// Возвращает новую длину.
+func (s *shard) pushLocked(key string, values []string, left bool) (length int, delta int64, err error) {
+	item, delta, err := s.listLocked(key, true)
+	if err != nil {
+		return 0, delta, err
+	}
+
+	for _, v := range values {
+		if left {
+			item.List.PushFront(v)
+		} else {
+			item.List.PushBack(v)
+		}
+		s.growLocked(item, listElemSize(v))
+	}
+	return item.List.Len(), delta, nil
+}
+
+// popLocked извлекает до count элементов с начала (left) или конца списка.
+// Опустевший список удаляется.
+func (s *shard) popLocked(key string, count int, left bool) (values []string, delta int64, err error) {
+	item, delta, err := s.listLocked(key, false)
+	if err != nil || item == nil {
+		return nil, delta, err
+	}
+
+	if count > item.List.Len() {
+		count = item.List.Len()
+	}
+	values = make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		if left {
+			values = append(values, item.List.PopFront())
+		} else {
+			values = append(values, item.List.PopBack())
+		}
+		s.growLocked(item, -listElemSize(values[i]))
+	}
+
+	if item.List.Len() == 0 {
+		s.removeLocked(item)
+		delta--
+	}
+	return values, delta, nil
+}
+
+// lsetLocked заменяет элемент по индексу.
+func (s *shard) lsetLocked(key string, index int, value string) (delta int64, err error) {
+	item, delta, err := s.listLocked(key, false)
+	if err != nil {
+		return delta, err
+	}
+	if item == nil {
+		return delta, ErrNoSuchKey
+	}
+
+	i, ok := normIndex(index, item.List.Len())
+	if !ok {
+		return delta, ErrIndexOutOfRange
+	}
+	s.growLocked(item, int64(len(value)-len(item.List.At(i))))
+	item.List.Set(i, value)
+	return delta, nil
+}
+
+// lremLocked удаляет вхождения value: count > 0 — с начала, count < 0 — с конца,
+// count = 0 — все. Возвращает число удалённых.
+func (s *shard) lremLocked(key string, count int, value string) (removed int, delta int64, err error) {
+	item, delta, err := s.listLocked(key, false)
+	if err != nil || item == nil {
+		return 0, delta, err
+	}
+
+	n := item.List.Len()
+	limit := count
+	if limit < 0 {
+		limit = -limit
+	}
+
+	drop := make(map[int]bool)
+	for j := 0; j < n && (limit == 0 || len(drop) < limit); j++ {
+		i := j
+		if count < 0 {
+			i = n - 1 - j
+		}
+		if item.List.At(i) == value {
+			drop[i] = true
+		}
+	}
+	if len(drop) == 0 {
+		return 0, delta, nil
+	}
+
+	item.List.Keep(func(i int, _ string) bool { return !drop[i] })
+	s.growLocked(item, -int64(len(drop))*listElemSize(value))
+	if item.List.Len() == 0 {
+		s.removeLocked(item)
+		delta--
+	}
+	return len(drop), delta, nil
+}
+
+// ltrimLocked оставляет только элементы в диапазоне [start, stop].
+func (s *shard) ltrimLocked(key string, start, stop int) (delta int64, err error) {
+	item, delta, err := s.listLocked(key, false)
+	if err != nil || item == nil {
+		return delta, err
+	}
+
+	from, to, ok := normRange(start, stop, item.List.Len())
+	if !ok {
+		s.removeLocked(item)
+		return delta - 1, nil
+	}
+	item.List.reset(item.List.Slice(from, to))
+	s.resizeLocked(item)
+	return delta, nil
+}
+
+// normIndex переводит Redis-индекс (отрицательный — с конца) в позицию.
+func normIndex(index, n int) (int, bool) {
+	if index < 0 {
+		index += n
+	}
+	if index < 0 || index >= n {
+		return 0, false
+	}
+	return index, true
+}
+
+// normRange переводит Redis-диапазон [start, stop] в позиции.
+// ok = false — диапазон пустой.
+func normRange(start, stop, n int) (int, int, bool) {
+	if start < 0 {
+		start += n
+	}
+	if stop < 0 {
+		stop += n
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= n {
+		stop = n - 1
+	}
+	if start > stop || start >= n {
+		return 0, 0, false
+	}
+	return start, stop, true
+}
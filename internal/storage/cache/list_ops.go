@@ -0,0 +1,225 @@
+package storage
+
+import "strconv"
+
+// === List: Redis-совместимые операции ===
+// Изменения пишутся в AOF под блокировкой шарда — порядок записей
+// в журнале совпадает с порядком применения к списку.
+
+// LPush добавляет элементы в начало списка. Возвращает новую длину.
+func (c *Cache) LPush(key string, values ...string) (int, error) {
+	return c.push(key, values, true)
+}
+
+// RPush добавляет элементы в конец списка. Возвращает новую длину.
+func (c *Cache) RPush(key string, values ...string) (int, error) {
+	return c.push(key, values, false)
+}
+
+func (c *Cache) push(key string, values []string, left bool) (int, error) {
+	s := c.getShard(key)
+	c.promote(s, key)
+	if err := c.reserve(s, key); err != nil {
+		return 0, err
+	}
+
+	s.Lock()
+	length, delta, err := s.pushLocked(key, values, left)
+	if err != nil {
+		s.Unlock()
+		c.totalKeys.Add(delta)
+		return length, err
+	}
+	wait := c.persister.Write(pushCmd(left), key, encodeArgs(values), 0)
+	s.Unlock()
+
+	c.totalKeys.Add(delta)
+	c.blocked.notify(key)
+	return length, c.durable(nil, wait)
+}
+
+// LPop извлекает до count элементов из начала списка.
+func (c *Cache) LPop(key string, count int) ([]string, error) {
+	return c.pop(key, count, true)
+}
+
+// RPop извлекает до count элементов из конца списка.
+func (c *Cache) RPop(key string, count int) ([]string, error) {
+	return c.pop(key, count, false)
+}
+
+func (c *Cache) pop(key string, count int, left bool) ([]string, error) {
+	s := c.getShard(key)
+	c.promote(s, key)
+
+	s.Lock()
+	values, delta, err := s.popLocked(key, count, left)
+	var wait func() error
+	if err == nil && len(values) > 0 {
+		wait = c.persister.Write(popCmd(left), key, strconv.Itoa(len(values)), 0)
+	}
+	s.Unlock()
+
+	c.totalKeys.Add(delta)
+	return values, c.durable(err, wait)
+}
+
+// LRange возвращает элементы в диапазоне [start, stop] (индексы как в Redis).
+func (c *Cache) LRange(key string, start, stop int) ([]string, error) {
+	s := c.getShard(key)
+	c.promote(s, key)
+
+	s.RLock()
+	defer s.RUnlock()
+
+	list, err := s.listRLocked(key)
+	if err != nil || list == nil {
+		return []string{}, err
+	}
+	from, to, ok := normRange(start, stop, list.Len())
+	if !ok {
+		return []string{}, nil
+	}
+	return list.Slice(from, to), nil
+}
+
+// LLen возвращает длину списка.
+func (c *Cache) LLen(key string) (int, error) {
+	s := c.getShard(key)
+	c.promote(s, key)
+
+	s.RLock()
+	defer s.RUnlock()
+
+	list, err := s.listRLocked(key)
+	if err != nil || list == nil {
+		return 0, err
+	}
+	return list.Len(), nil
+}
+
+// LIndex возвращает элемент списка по индексу.
+func (c *Cache) LIndex(key string, index int) (string, bool, error) {
+	s := c.getShard(key)
+	c.promote(s, key)
+
+	s.RLock()
+	defer s.RUnlock()
+
+	list, err := s.listRLocked(key)
+	if err != nil || list == nil {
+		return "", false, err
+	}
+	i, ok := normIndex(index, list.Len())
+	if !ok {
+		return "", false, nil
+	}
+	return list.At(i), true, nil
+}
+
+// LSet заменяет элемент списка по индексу.
+func (c *Cache) LSet(key string, index int, value string) error {
+	s := c.getShard(key)
+	c.promote(s, key)
+
+	s.Lock()
+	delta, err := s.lsetLocked(key, index, value)
+	var wait func() error
+	if err == nil {
+		wait = c.persister.Write("LSET", key, encodeArgs([]string{strconv.Itoa(index), value}), 0)
+	}
+	s.Unlock()
+
+	c.totalKeys.Add(delta)
+	return c.durable(err, wait)
+}
+
+// LRem удаляет count вхождений value (см. lremLocked). Возвращает число удалённых.
+func (c *Cache) LRem(key string, count int, value string) (int, error) {
+	s := c.getShard(key)
+	c.promote(s, key)
+
+	s.Lock()
+	removed, delta, err := s.lremLocked(key, count, value)
+	var wait func() error
+	if err == nil && removed > 0 {
+		wait = c.persister.Write("LREM", key, encodeArgs([]string{strconv.Itoa(count), value}), 0)
+	}
+	s.Unlock()
+
+	c.totalKeys.Add(delta)
+	return removed, c.durable(err, wait)
+}
+
+// LTrim оставляет в списке только диапазон [start, stop].
+func (c *Cache) LTrim(key string, start, stop int) error {
+	s := c.getShard(key)
+	c.promote(s, key)
+
+	s.Lock()
+	delta, err := s.ltrimLocked(key, start, stop)
+	var wait func() error
+	if err == nil {
+		wait = c.persister.Write("LTRIM", key, encodeArgs([]string{strconv.Itoa(start), strconv.Itoa(stop)}), 0)
+	}
+	s.Unlock()
+
+	c.totalKeys.Add(delta)
+	return c.durable(err, wait)
+}
+
+// LMove атомарно перекладывает элемент из src в dst.
+// fromLeft/toLeft — с какого конца брать и в какой конец класть.
+// ok = false — src пуст. В журнал снятие и вставка идут одной группой
+// MULTI/EXEC (см. writeGroup), поэтому вне Exec LMove вызывается под Shared.
+func (c *Cache) LMove(src, dst string, fromLeft, toLeft bool) (string, bool, error) {
+	sSrc, sDst := c.getShard(src), c.getShard(dst)
+	c.promote(sSrc, src)
+	c.promote(sDst, dst)
+	if err := c.reserve(sDst, dst); err != nil {
+		return "", false, err
+	}
+
+	unlock := c.lockShards(src, dst)
+
+	// Проверяем тип dst до того, как что-то снимать с src
+	_, dstDelta, err := sDst.listLocked(dst, false)
+	if err != nil {
+		unlock()
+		c.totalKeys.Add(dstDelta)
+		return "", false, err
+	}
+
+	values, srcDelta, err := sSrc.popLocked(src, 1, fromLeft)
+	if err != nil || len(values) == 0 {
+		unlock()
+		c.totalKeys.Add(dstDelta + srcDelta)
+		return "", false, err
+	}
+
+	_, pushDelta, _ := sDst.pushLocked(dst, values, toLeft)
+
+	wait := c.writeGroup(func() {
+		c.persister.Write(popCmd(fromLeft), src, "1", 0)
+		c.persister.Write(pushCmd(toLeft), dst, encodeArgs(values), 0)
+	})
+	unlock()
+
+	c.totalKeys.Add(dstDelta + srcDelta + pushDelta)
+	c.blocked.notify(dst)
+	return values[0], true, c.durable(nil, wait)
+}
+
+func pushCmd(left bool) string {
+	if left {
+		return "LPUSH"
+	}
+	return "RPUSH"
+}
+
+func popCmd(left bool) string {
+	if left {
+		return "LPOP"
+	}
+	return "RPOP"
+}
@@ -0,0 +1,176 @@
+package storage
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestListBasic(t *testing.T) {
+	c := New(&mockPersistence{})
+	defer c.Close()
+
+	c.RPush("l", "b", "c")
+	c.LPush("l", "a")
+
+	if got, _ := c.LRange("l", 0, -1); !reflect.DeepEqual(got, []string{"a", "b", "c"}) {
+		t.Fatalf("LRange = %v", got)
+	}
+	if got, _ := c.LRange("l", -2, 100); !reflect.DeepEqual(got, []string{"b", "c"}) {
+		t.Fatalf("LRange(-2, 100) = %v", got)
+	}
+	if v, ok, _ := c.LIndex("l", -1); !ok || v != "c" {
+		t.Fatalf("LIndex(-1) = %q, %v", v, ok)
+	}
+	if err := c.LSet("l", 5, "x"); err != ErrIndexOutOfRange {
+		t.Fatalf("LSet out of range: err=%v", err)
+	}
+	if err := c.LSet("nolist", 0, "x"); err != ErrNoSuchKey {
+		t.Fatalf("LSet missing key: err=%v", err)
+	}
+
+	if v, ok, _ := c.LMove("l", "dst", true, false); !ok || v != "a" {
+		t.Fatalf("LMove = %q, %v", v, ok)
+	}
+	if n, _ := c.LLen("dst"); n != 1 {
+		t.Fatalf("LLen(dst) = %d", n)
+	}
+
+	// Опустевший список удаляется
+	c.LPop("l", 10)
+	if c.Exists("l") != 0 {
+		t.Fatal("empty list must be removed")
+	}
+	if c.CountKeys() != 1 {
+		t.Fatalf("CountKeys = %d, want 1", c.CountKeys())
+	}
+}
+
+func TestListRemTrim(t *testing.T) {
+	c := New(&mockPersistence{})
+	defer c.Close()
+
+	c.RPush("l", "x", "a", "x", "b", "x")
+
+	if n, _ := c.LRem("l", -2, "x"); n != 2 {
+		t.Fatalf("LRem(-2) = %d", n)
+	}
+	if got, _ := c.LRange("l", 0, -1); !reflect.DeepEqual(got, []string{"x", "a", "b"}) {
+		t.Fatalf("after LRem(-2) = %v", got)
+	}
+
+	c.LTrim("l", 1, -1)
+	if got, _ := c.LRange("l", 0, -1); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Fatalf("after LTrim = %v", got)
+	}
+}
+
+func TestDequeGrowShrink(t *testing.T) {
+	d := newDeque()
+	for i := 0; i < 100; i++ {
+		if i%2 == 0 {
+			d.PushBack(strconv.Itoa(i))
+		} else {
+			d.PushFront(strconv.Itoa(i))
+		}
+	}
+	if d.Len() != 100 || d.At(0) != "99" || d.At(99) != "98" {
+		t.Fatalf("deque: len=%d first=%s last=%s", d.Len(), d.At(0), d.At(99))
+	}
+	for d.Len() > 1 {
+		d.PopFront()
+	}
+	if d.At(0) != "98" {
+		t.Fatalf("last element = %s", d.At(0))
+	}
+}
+
+func TestListReplay(t *testing.T) {
+	rec := &recordPersistence{}
+	c := New(rec)
+	defer c.Close()
+
+	c.RPush("q", "1", "2", "3", "4", "5")
+	c.LPop("q", 2)
+	c.LSet("q", 0, "three")
+	c.LRem("q", 0, "4")
+	c.LMove("q", "done", false, true)
+	c.LPush("q", "0")
+	c.LTrim("q", 0, 0)
+
+	restored := New(&mockPersistence{})
+	defer restored.Close()
+	rec.replayInto(restored)
+
+	// LMove пишет снятие и вставку одной группой
+	var cmds []string
+	for _, e := range rec.entries {
+		cmds = append(cmds, e.cmd)
+	}
+	if want := "MULTI RPOP LPUSH EXEC"; !strings.Contains(strings.Join(cmds, " "), want) {
+		t.Fatalf("AOF = %v, want group %q", cmds, want)
+	}
+
+	for _, key := range []string{"q", "done"} {
+		want, _ := c.LRange(key, 0, -1)
+		got, _ := restored.LRange(key, 0, -1)
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("replayed %s = %v, want %v", key, got, want)
+		}
+	}
+}
+
+func TestBlockingPop(t *testing.T) {
+	c := New(&mockPersistence{})
+	defer c.Close()
+
+	// Таймаут на пустом списке
+	start := time.Now()
+	if _, _, ok, _ := c.BPop(context.Background(), []string{"q"}, true, 50*time.Millisecond); ok {
+		t.Fatal("BPop on empty list returned a value")
+	}
+	if time.Since(start) < 50*time.Millisecond {
+		t.Fatal("BPop returned before timeout")
+	}
+
+	// Push будит ожидающего
+	type result struct {
+		key, value string
+		ok         bool
+	}
+	done := make(chan result, 1)
+	go func() {
+		k, v, ok, _ := c.BPop(context.Background(), []string{"other", "q"}, true, 5*time.Second)
+		done <- result{k, v, ok}
+	}()
+
+	for c.Blocked() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	c.RPush("q", "job")
+
+	select {
+	case r := <-done:
+		if !r.ok || r.key != "q" || r.value != "job" {
+			t.Fatalf("BPop = %+v", r)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("BPop was not woken up by RPush")
+	}
+
+	// Отмена контекста
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+	if _, ok, _ := c.BLMove(ctx, "q", "dst", true, true, 0); ok {
+		t.Fatal("BLMove on empty list returned a value")
+	}
+	if c.Blocked() != 0 {
+		t.Fatalf("waiters left registered: %d", c.Blocked())
+	}
+}
@@ -0,0 +1,255 @@
+package storage
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+/*
+
+	maxmemory — лимит памяти под ключи, как в Redis.
+
+	Каждый элемент знает свой приблизительный размер (Item.Mem): байты
+	ключа и значений плюс накладные расходы структур Go. Размер
+	обновляется под write lock шарда при каждом изменении, сумма по шарду
+	хранится в shard.mem. Точный учёт через runtime.MemStats слишком дорог
+	на каждую запись, а для решения «пора вытеснять» хватает оценки.
+
+	Перед записью reserve сверяет used_memory с лимитом: при превышении
+	ключи вытесняются согласно политике — в фоне, а при большом
+	превышении прямо в записи (см. evictpool.go). noeviction и volatile-*
+	без ключей с TTL — запись отклоняется с ErrOOM.
+
+*/
+
+// Накладные расходы на элемент и на единицу значения составных типов (байт).
+const (
+	itemOverhead       = 176 // Item, запись в items, слот SCAN
+	hashFieldOverhead  = 48  // запись map[string]string
+	listElemOverhead   = 24  // строка в кольцевом буфере deque с запасом
+	setMemberOverhead  = 24  // запись map[string]struct{}
+	zsetMemberOverhead = 112 // запись dict и узел skiplist
+)
+
+// ErrOOM возвращается записью, если used_memory превышает maxmemory и
+// политика не позволяет ничего вытеснить.
+var ErrOOM = errors.New("OOM command not allowed when used memory > 'maxmemory'.")
+
+// EvictionPolicy — что вытеснять при превышении maxmemory
+// (maxmemory-policy в Redis).
+type EvictionPolicy int32
+
+const (
+	NoEviction    EvictionPolicy = iota // отклонять записи с ErrOOM
+	AllKeysLRU                          // давно не использованные
+	VolatileLRU                         // давно не использованные среди ключей с TTL
+	AllKeysLFU                          // редко используемые
+	VolatileLFU                         // редко используемые среди ключей с TTL
+	AllKeysRandom                       // случайные
+	VolatileTTL                         // с ближайшим истечением TTL
+)
+
+var evictionPolicyNames = [...]string{
+	NoEviction:    "noeviction",
+	AllKeysLRU:    "allkeys-lru",
+	VolatileLRU:   "volatile-lru",
+	AllKeysLFU:    "allkeys-lfu",
+	VolatileLFU:   "volatile-lfu",
+	AllKeysRandom: "allkeys-random",
+	VolatileTTL:   "volatile-ttl",
+}
+
+// String возвращает имя политики как в redis.conf.
+func (p EvictionPolicy) String() string {
+	if p < 0 || int(p) >= len(evictionPolicyNames) {
+		return "unknown"
+	}
+	return evictionPolicyNames[p]
+}
+
+// ParseEvictionPolicy разбирает имя политики (noeviction, allkeys-lru, ...).
+func ParseEvictionPolicy(s string) (EvictionPolicy, error) {
+	for p, name := range evictionPolicyNames {
+		if strings.EqualFold(s, name) {
+			return EvictionPolicy(p), nil
+		}
+	}
+	return NoEviction, errors.New("invalid maxmemory-policy " + s)
+}
+
+// volatile — политика выбирает только среди ключей с TTL.
+func (p EvictionPolicy) volatile() bool {
+	return p == VolatileLRU || p == VolatileLFU || p == VolatileTTL
+}
+
+// SetMaxMemory задаёт лимит памяти в байтах (0 — без лимита) и политику
+// вытеснения. Можно менять на ходу (CONFIG SET maxmemory).
+func (c *Cache) SetMaxMemory(limit int64, policy EvictionPolicy) {
+	c.maxMemory.Store(limit)
+	c.policy.Store(int32(policy))
+}
+
+// MaxMemory возвращает лимит памяти и политику вытеснения.
+func (c *Cache) MaxMemory() (int64, EvictionPolicy) {
+	return c.maxMemory.Load(), EvictionPolicy(c.policy.Load())
+}
+
+// UsedMemory — приблизительный объём памяти под ключи и значения в RAM.
+func (c *Cache) UsedMemory() int64 {
+	var used int64
+	for _, s := range c.shards {
+		used += s.mem.Load()
+	}
+	return used
+}
+
+// EvictedKeys — сколько ключей вытеснено по maxmemory и maxKeys.
+func (c *Cache) EvictedKeys() int64 {
+	return c.evictedKeys.Load()
+}
+
+// keysPolicy — политика для лимита maxKeys: та же, что для maxmemory, а
+// при noeviction — allkeys-lru (лимит ключей вытесняет всегда).
+func (c *Cache) keysPolicy() EvictionPolicy {
+	if policy := EvictionPolicy(c.policy.Load()); policy != NoEviction {
+		return policy
+	}
+	return AllKeysLRU
+}
+
+// FreeMemory синхронно вытесняет ключи, пока used_memory больше
+// maxmemory. ErrOOM — освободить место не удалось.
+func (c *Cache) FreeMemory() error {
+	limit := c.maxMemory.Load()
+	if limit <= 0 || c.UsedMemory() <= limit {
+		return nil
+	}
+	policy := EvictionPolicy(c.policy.Load())
+	if policy == NoEviction || !c.evictWhile(policy, func() bool {
+		return c.UsedMemory() > limit
+	}) {
+		return ErrOOM
+	}
+	return nil
+}
+
+// reserveMemory — проверка maxmemory перед записью. Небольшое превышение
+// снимает фоновое вытеснение, большое — синхронное.
+func (c *Cache) reserveMemory() error {
+	limit := c.maxMemory.Load()
+	if limit <= 0 {
+		return nil
+	}
+	used := c.UsedMemory()
+	switch {
+	case used <= limit:
+		return nil
+	case EvictionPolicy(c.policy.Load()) == NoEviction:
+		return ErrOOM
+	case used > limit+limit/evictionSlack:
+		return c.FreeMemory()
+	}
+	c.evictInBackground()
+	return nil
+}
+
+// evictionScore — оценка кандидата для пула: меньше — раньше вытесняется.
+func evictionScore(policy EvictionPolicy, s *shard, item *Item, now int64) int64 {
+	switch policy {
+	case AllKeysLFU, VolatileLFU:
+		// При равных счётчиках — давно не использованный
+		return int64(s.lfu.counter(atomic.LoadUint32(&item.Freq), now))<<32 |
+			atomic.LoadInt64(&item.LastAccess)/int64(time.Second)
+	case VolatileTTL:
+		return atomic.LoadInt64(&item.ExpireAt)
+	}
+	// Часы идут с точностью в секунду (clock.go): при равном времени
+	// обращения — реже используемый
+	return atomic.LoadInt64(&item.LastAccess)/int64(time.Second)<<8 |
+		int64(s.lfu.counter(atomic.LoadUint32(&item.Freq), now))
+}
+
+// evictKey убирает ключ из RAM: строку — в cold storage (если он
+// включён и политика её допускает, см. toCold), остальное — насовсем,
+// с DEL в журнале. Строка пишется в cold
+// до снятия блокировки: ключ не пропадает из виду ни на миг. Если
+// запись на диск не удалась, строка вытесняется, как остальные ключи.
+// false — ключ успели удалить или перезаписать до захвата блокировки,
+// и это не вытеснение.
+func (c *Cache) evictKey(s *shard, key string) bool {
+	s.Lock()
+	item, exists := s.items[key]
+	if !exists {
+		s.Unlock()
+		return false
+	}
+	demoted := false
+	if c.toCold(item) {
+		if err := c.cold.Put(key, item.Value, item.ExpireAt); err != nil {
+			log.Printf("cold write error: key %q evicted: %v", key, err)
+		} else {
+			demoted = true
+			c.coldDemoted.Add(1)
+		}
+	}
+	if !demoted {
+		c.persister.Write("DEL", key, "", 0)
+	}
+	s.removeLocked(item)
+	s.Unlock()
+
+	c.totalKeys.Add(-1)
+	c.evictedKeys.Add(1)
+	return true
+}
+
+// memUsage — приблизительный размер элемента в байтах (под блокировкой шарда).
+func (i *Item) memUsage() int64 {
+	size := int64(itemOverhead + len(i.Key))
+	switch i.Kind {
+	case KindHash:
+		for field, val := range i.Hash {
+			size += hashFieldSize(field, val)
+		}
+	case KindList:
+		for j := 0; j < i.List.Len(); j++ {
+			size += listElemSize(i.List.At(j))
+		}
+	case KindSet:
+		for m := range i.Set {
+			size += setMemberSize(m)
+		}
+	case KindZSet:
+		for m := range i.ZSet.dict {
+			size += zsetMemberSize(m)
+		}
+	default:
+		size += int64(len(i.Value))
+	}
+	return size
+}
+
+func hashFieldSize(field, val string) int64 {
+	return int64(hashFieldOverhead + len(field) + len(val))
+}
+
+func listElemSize(v string) int64 { return int64(listElemOverhead + len(v)) }
+
+func setMemberSize(m string) int64 { return int64(setMemberOverhead + len(m)) }
+
+func zsetMemberSize(m string) int64 { return int64(zsetMemberOverhead + len(m)) }
+
+// growLocked учитывает изменение размера элемента на delta байт (write lock).
+func (s *shard) growLocked(item *Item, delta int64) {
+	item.Mem += delta
+	s.mem.Add(delta)
+}
+
+// resizeLocked пересчитывает размер элемента целиком (write lock) — после
+// замены значения или операций, которые и так проходят всё значение.
+func (s *shard) resizeLocked(item *Item) {
+	s.growLocked(item, item.memUsage()-item.Mem)
+}
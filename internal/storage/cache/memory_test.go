@@ -0,0 +1,238 @@
+package storage
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// checkMemory сверяет учёт памяти с пересчётом с нуля.
+func checkMemory(t *testing.T, c *Cache) {
+	t.Helper()
+	for i, s := range c.shards {
+		s.RLock()
+		var sum int64
+		for _, item := range s.items {
+			if item.Mem != item.memUsage() {
+				t.Errorf("%q: Mem = %d, actual %d", item.Key, item.Mem, item.memUsage())
+			}
+			sum += item.memUsage()
+		}
+		if s.mem.Load() != sum {
+			t.Errorf("shard %d: mem = %d, actual %d", i, s.mem.Load(), sum)
+		}
+		s.RUnlock()
+	}
+}
+
+// waitEviction ждёт конца фонового вытеснения.
+func waitEviction(t *testing.T, c *Cache) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); c.evicting.Load(); {
+		if time.Now().After(deadline) {
+			t.Fatal("background eviction did not finish")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// TestMemoryAccounting — размер меняется вместе со значением во всех
+// пишущих операциях и обнуляется, когда ключей не остаётся.
+func TestMemoryAccounting(t *testing.T) {
+	c := New(&mockPersistence{})
+	defer c.Close()
+
+	c.Set("s", "value", 0, false)
+	c.Append("s", "-tail")
+	c.IncrBy("n", 5)
+	c.IncrBy("n", 1000)
+	c.HSet("h", "a", "1", "b", "22")
+	c.HSet("h", "a", "longer value")
+	c.HIncrBy("h", "n", 7)
+	c.HDel("h", "b")
+	c.RPush("l", "a", "bb", "ccc", "bb", "e")
+	c.LPop("l", 1)
+	c.LSet("l", 0, "replaced")
+	c.LRem("l", 0, "bb")
+	c.LPush("l", "x", "y", "z")
+	c.LTrim("l", 1, 2)
+	c.LMove("l", "l2", true, false)
+	c.SAdd("set", "a", "b", "c")
+	c.SRem("set", "a")
+	c.SPop("set", 1)
+	c.SAdd("set2", "b", "c", "d")
+	c.SUnionStore("union", "set", "set2")
+	c.ZAdd("z", ZAddOptions{}, ZMember{"a", 1}, ZMember{"b", 2}, ZMember{"c", 3})
+	c.ZIncrBy("z", ZAddOptions{}, "a", 5)
+	c.ZRem("z", "b")
+	c.ZPopMin("z", 1)
+	c.ZUnionStore("zu", []string{"z"}, nil, AggregateSum)
+	c.Restore("r", Value{Kind: KindHash, Items: []string{"f", "v"}}, 0, true)
+	c.Rename("r", "renamed-hash")
+	c.Set("set2", "now a string", 0, false)
+	checkMemory(t, c)
+
+	if c.UsedMemory() <= itemOverhead*c.CountKeys() {
+		t.Fatalf("used_memory = %d for %d keys", c.UsedMemory(), c.CountKeys())
+	}
+	for _, key := range c.Keys("*") {
+		c.Delete(key)
+	}
+	if used := c.UsedMemory(); used != 0 {
+		t.Fatalf("used_memory after DEL = %d", used)
+	}
+
+	c.HSet("h", "f", "v")
+	c.FlushDB()
+	if used := c.UsedMemory(); used != 0 {
+		t.Fatalf("used_memory after FLUSHDB = %d", used)
+	}
+}
+
+// TestMaxMemoryPolicies — каждая политика держит used_memory у лимита и
+// выбирает тех, кого должна.
+func TestMaxMemoryPolicies(t *testing.T) {
+	value := strings.Repeat("v", 1000)
+	const keys = 100
+	size := int64(itemOverhead + 1000 + len("key:00"))
+	limit := keys / 2 * size
+
+	fill := func(policy EvictionPolicy, limit int64, samples int, ttl func(i int) time.Duration) (*Cache, error) {
+		c := New(&mockPersistence{})
+		c.SetMaxMemory(limit, policy)
+		c.SetEvictionSamples(samples)
+		for i := 0; i < keys; i++ {
+			if err := c.Set("key:"+strconv.Itoa(i), value, ttl(i), false); err != nil {
+				return c, err
+			}
+			// Первые 10 ключей — горячие
+			for j := 0; j < 10 && j < i; j++ {
+				c.Get("key:" + strconv.Itoa(j))
+			}
+		}
+		return c, nil
+	}
+	noTTL := func(int) time.Duration { return 0 }
+
+	t.Run("noeviction", func(t *testing.T) {
+		c, err := fill(NoEviction, limit, defaultEvictionSamples, noTTL)
+		defer c.Close()
+		if !errors.Is(err, ErrOOM) || c.EvictedKeys() != 0 {
+			t.Fatalf("err = %v, evicted %d", err, c.EvictedKeys())
+		}
+		if _, err := c.HSet("h", "f", "v"); !errors.Is(err, ErrOOM) {
+			t.Fatalf("HSET over limit: %v", err)
+		}
+		// Удаление освобождает место
+		c.Delete("key:0")
+		c.Delete("key:1")
+		if err := c.Set("small", "v", 0, false); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("volatile without TTL keys", func(t *testing.T) {
+		for _, policy := range []EvictionPolicy{VolatileLRU, VolatileLFU, VolatileTTL} {
+			c, err := fill(policy, limit, defaultEvictionSamples, noTTL)
+			c.Close()
+			if !errors.Is(err, ErrOOM) {
+				t.Fatalf("%v: err = %v", policy, err)
+			}
+		}
+	})
+
+	for _, policy := range []EvictionPolicy{AllKeysLRU, AllKeysLFU, AllKeysRandom} {
+		t.Run(policy.String(), func(t *testing.T) {
+			c, err := fill(policy, limit, defaultEvictionSamples, noTTL)
+			defer c.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			waitEviction(t, c)
+			if used := c.UsedMemory(); used > limit {
+				t.Fatalf("used_memory = %d, limit %d", used, limit)
+			}
+			if c.EvictedKeys() < keys/2-1 {
+				t.Fatalf("evicted %d", c.EvictedKeys())
+			}
+			if policy == AllKeysRandom {
+				return
+			}
+			hot := 0
+			for i := 0; i < 10; i++ {
+				if c.Exists("key:"+strconv.Itoa(i)) > 0 {
+					hot++
+				}
+			}
+			if hot < 8 {
+				t.Fatalf("hot keys survived: %d/10", hot)
+			}
+		})
+	}
+
+	t.Run("volatile-ttl", func(t *testing.T) {
+		// Чётные ключи вечные, нечётные — с TTL тем короче, чем позже
+		// записаны. Места хватает на 3/4 ключей. Выборка во весь кеш
+		// делает вытеснение точным.
+		c, err := fill(VolatileTTL, keys*3/4*size, keys, func(i int) time.Duration {
+			if i%2 == 0 {
+				return 0
+			}
+			return time.Duration(keys-i) * time.Minute
+		})
+		defer c.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		waitEviction(t, c)
+		for i := 0; i < keys; i += 2 {
+			if c.Exists("key:"+strconv.Itoa(i)) == 0 {
+				t.Fatalf("key:%d without TTL evicted", i)
+			}
+		}
+		for i := 1; i < keys/2; i += 2 {
+			if c.Exists("key:"+strconv.Itoa(i)) == 0 {
+				t.Fatalf("key:%d with a long TTL evicted", i)
+			}
+		}
+	})
+}
+
+// TestMaxMemoryCold — вытесненные строки уходят в cold storage на диск,
+// освобождая RAM, и читаются оттуда по запросу.
+func TestMaxMemoryCold(t *testing.T) {
+	c := New(&mockPersistence{})
+	defer c.Close()
+	if err := c.InitColdStorage(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	value := strings.Repeat("v", 1000)
+	size := int64(itemOverhead + 1000 + len("key:00"))
+	limit := 20 * size
+	c.SetMaxMemory(limit, AllKeysLRU)
+	for i := 0; i < 100; i++ {
+		if err := c.Set("key:"+strconv.Itoa(i), value, 0, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Лимит меньше 32 значений: вытеснение синхронное, перед записью
+	if used := c.UsedMemory(); used > limit+size {
+		t.Fatalf("used_memory = %d, limit %d", used, limit)
+	}
+	if c.cold.Len() < 75 || c.Exists("key:0") != 1 {
+		t.Fatalf("cold keys: %d", c.cold.Len())
+	}
+
+	c.SetMaxMemory(0, NoEviction)
+	for i := 0; i < 100; i++ {
+		if got, ok := c.Get("key:" + strconv.Itoa(i)); !ok || got != value {
+			t.Fatalf("key:%d lost", i)
+		}
+	}
+	if c.cold.Len() != 0 || c.CountKeys() != 100 {
+		t.Fatalf("after promotion: %d cold, %d in RAM", c.cold.Len(), c.CountKeys())
+	}
+}
@@ -0,0 +1,190 @@
+package storage
+
+import (
+	"errors"
+	"log"
+	"strconv"
+	"time"
+)
+
+var errMalformedRecord = errors.New("malformed record")
+
+// Replay применяет одну запись AOF к кешу, не записывая её обратно в журнал.
+// Используется при восстановлении (imcs.Open, cmd/imcs).
+// expire — абсолютное время истечения в наносекундах (0 = без TTL).
+func (c *Cache) Replay(cmd, key, value string, expire int64) {
+	s := c.getShard(key)
+
+	// Запись с уже истёкшим TTL означает, что ключа больше нет
+	if expire > 0 && expire <= time.Now().UnixNano() {
+		c.dropKey(s, key)
+		return
+	}
+
+	switch cmd {
+	case "SET":
+		if s.set(key, value, expire) {
+			c.totalKeys.Add(1)
+		}
+		if c.cold != nil {
+			c.cold.Delete(key)
+		}
+
+	case "DEL":
+		c.dropKey(s, key)
+
+	case "HSET":
+		pairs, ok := decodeArgs(value)
+		if !ok || len(pairs)%2 != 0 {
+			log.Printf("AOF replay: malformed HSET for key %q", key)
+			return
+		}
+		_, delta, _ := s.hset(key, pairs, false)
+		c.totalKeys.Add(delta)
+		if expire > 0 {
+			s.expire(key, expire)
+		}
+
+	case "HDEL":
+		fields, ok := decodeArgs(value)
+		if !ok {
+			log.Printf("AOF replay: malformed HDEL for key %q", key)
+			return
+		}
+		_, delta, _ := s.hdel(key, fields)
+		c.totalKeys.Add(delta)
+
+	case "LPUSH", "RPUSH", "LPOP", "RPOP", "LSET", "LREM", "LTRIM":
+		c.replayList(s, cmd, key, value)
+		// Rewrite пишет список одной RPUSH вместе с TTL
+		if expire > 0 {
+			s.expire(key, expire)
+		}
+
+	case "EXPIREAT":
+		s.expire(key, expire)
+
+	case "PERSIST":
+		s.expire(key, 0)
+
+	case "FLUSH":
+		c.flush(nil)
+
+	case "SADD", "SREM":
+		members, ok := decodeArgs(value)
+		if !ok {
+			log.Printf("AOF replay: malformed %s for key %q", cmd, key)
+			return
+		}
+		s.Lock()
+		var delta int64
+		if cmd == "SADD" {
+			_, delta, _ = s.saddLocked(key, members)
+		} else {
+			_, delta, _ = s.sremLocked(key, members)
+		}
+		s.Unlock()
+		c.totalKeys.Add(delta)
+		if cmd == "SADD" && expire > 0 {
+			s.expire(key, expire)
+		}
+
+	case "ZADD":
+		members, ok := decodeScores(value)
+		if !ok {
+			log.Printf("AOF replay: malformed ZADD for key %q", key)
+			return
+		}
+		s.Lock()
+		_, _, _, delta, _ := s.zaddLocked(key, ZAddOptions{}, false, members)
+		s.Unlock()
+		c.totalKeys.Add(delta)
+		if expire > 0 {
+			s.expire(key, expire)
+		}
+
+	case "ZREM":
+		members, ok := decodeArgs(value)
+		if !ok {
+			log.Printf("AOF replay: malformed ZREM for key %q", key)
+			return
+		}
+		s.Lock()
+		_, delta, _ := s.zremLocked(key, members)
+		s.Unlock()
+		c.totalKeys.Add(delta)
+	}
+}
+
+// replayList применяет запись AOF, изменяющую список.
+func (c *Cache) replayList(s *shard, cmd, key, value string) {
+	args := []string{value} // *POP: значение — число элементов
+	if cmd != "LPOP" && cmd != "RPOP" {
+		var ok bool
+		if args, ok = decodeArgs(value); !ok {
+			log.Printf("AOF replay: malformed %s for key %q", cmd, key)
+			return
+		}
+	}
+
+	s.Lock()
+	delta, err := s.replayListLocked(cmd, key, args)
+	s.Unlock()
+
+	c.totalKeys.Add(delta)
+	if err != nil {
+		log.Printf("AOF replay: %s for key %q: %v", cmd, key, err)
+	}
+}
+
+func (s *shard) replayListLocked(cmd, key string, args []string) (int64, error) {
+	switch cmd {
+	case "LPUSH", "RPUSH":
+		_, delta, err := s.pushLocked(key, args, cmd == "LPUSH")
+		return delta, err
+	case "LPOP", "RPOP":
+		count, err := strconv.Atoi(args[0])
+		if err != nil {
+			return 0, err
+		}
+		_, delta, err := s.popLocked(key, count, cmd == "LPOP")
+		return delta, err
+	}
+
+	// LSET index value, LREM count value, LTRIM start stop
+	if len(args) != 2 {
+		return 0, errMalformedRecord
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil {
+		return 0, err
+	}
+
+	switch cmd {
+	case "LSET":
+		return s.lsetLocked(key, n, args[1])
+	case "LREM":
+		_, delta, err := s.lremLocked(key, n, args[1])
+		return delta, err
+	default: // LTRIM
+		stop, err := strconv.Atoi(args[1])
+		if err != nil {
+			return 0, err
+		}
+		return s.ltrimLocked(key, n, stop)
+	}
+}
+
+// dropKey удаляет ключ из RAM и cold storage без записи в AOF. Оба
+// удаления под блокировкой шарда, чтобы promote не вернул ключ в RAM.
+func (c *Cache) dropKey(s *shard, key string) {
+	s.Lock()
+	defer s.Unlock()
+	if item, exists := s.items[key]; exists {
+		s.removeLocked(item)
+		c.totalKeys.Add(-1)
+	}
+	if c.cold != nil {
+		c.cold.Delete(key)
+	}
+}
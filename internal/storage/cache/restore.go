@@ -0,0 +1,189 @@
+package storage
+
+import (
+	"container/heap"
+	"time"
+)
+
+// Value — значение ключа целиком, вне кеша: импорт RDB и RESTORE.
+type Value struct {
+	Kind   Kind
+	String string    // KindString
+	Items  []string  // KindList — по порядку, KindSet; KindHash — пары поле, значение
+	ZSet   []ZMember // KindZSet
+}
+
+// Restore создаёт ключ с готовым значением и абсолютным TTL (expireAt, нс,
+// 0 — без TTL). Существующий ключ заменяется только при replace, иначе
+// ErrKeyExist. Уже истёкший TTL означает, что ключа нет: прежний (при
+// replace) удаляется. В AOF ключ пишется как при RENAME — DEL, значение
+// целиком и EXPIREAT.
+func (c *Cache) Restore(key string, v Value, expireAt int64, replace bool) error {
+	s := c.getShard(key)
+	c.promote(s, key)
+	if err := c.reserve(s, key); err != nil {
+		return err
+	}
+
+	s.Lock()
+	old, found, expired := s.liveLocked(key)
+	var delta int64
+	if expired {
+		delta--
+	}
+	if found && !replace {
+		s.Unlock()
+		c.totalKeys.Add(delta)
+		return ErrKeyExist
+	}
+	if found {
+		s.removeLocked(old)
+		delta--
+	}
+
+	var item *Item
+	var wait func() error
+	if expireAt <= 0 || expireAt > time.Now().UnixNano() {
+		item = s.newItemLocked(key, v.Kind)
+		fillItem(item, v)
+		s.resizeLocked(item)
+		if item.empty() {
+			s.removeLocked(item)
+			item = nil
+		} else {
+			delta++
+		}
+	}
+
+	if item == nil {
+		if found {
+			wait = c.persister.Write("DEL", key, "", 0)
+		}
+	} else {
+		// Составные типы replay мёржит — сначала затираем прежний ключ
+		cmd, value := item.record()
+		if cmd != "SET" {
+			c.persister.Write("DEL", key, "", 0)
+		}
+		wait = c.persister.Write(cmd, key, value, 0)
+		if expireAt > 0 {
+			item.ExpireAt = expireAt
+			heap.Push(&s.pq, item)
+			wait = c.persister.WriteAt("EXPIREAT", key, "", expireAt)
+		}
+	}
+	s.Unlock()
+
+	c.totalKeys.Add(delta)
+	if c.cold != nil {
+		c.cold.Delete(key)
+	}
+	if item != nil && item.Kind == KindList {
+		c.blocked.notify(key)
+	}
+	return c.durable(nil, wait)
+}
+
+// Dump возвращает значение живого ключа целиком (DUMP).
+func (c *Cache) Dump(key string) (Value, bool) {
+	s := c.getShard(key)
+	c.promote(s, key)
+
+	s.RLock()
+	defer s.RUnlock()
+	item, ok := s.liveRLocked(key)
+	if !ok {
+		return Value{}, false
+	}
+	return item.value(), true
+}
+
+// RecordValue собирает Value из записи Snapshot (cmd и value, как их
+// отдаёт Item.record). false — запись не из Snapshot или повреждена.
+func RecordValue(cmd, value string) (Value, bool) {
+	var (
+		v  Value
+		ok = true
+	)
+	switch cmd {
+	case "SET":
+		v.Kind, v.String = KindString, value
+	case "HSET":
+		v.Kind = KindHash
+		v.Items, ok = decodeArgs(value)
+		ok = ok && len(v.Items)%2 == 0
+	case "RPUSH":
+		v.Kind = KindList
+		v.Items, ok = decodeArgs(value)
+	case "SADD":
+		v.Kind = KindSet
+		v.Items, ok = decodeArgs(value)
+	case "ZADD":
+		v.Kind = KindZSet
+		v.ZSet, ok = decodeScores(value)
+	default:
+		ok = false
+	}
+	return v, ok
+}
+
+// value копирует значение элемента (под блокировкой шарда).
+func (i *Item) value() Value {
+	v := Value{Kind: i.Kind}
+	switch i.Kind {
+	case KindHash:
+		v.Items = make([]string, 0, len(i.Hash)*2)
+		for field, val := range i.Hash {
+			v.Items = append(v.Items, field, val)
+		}
+	case KindList:
+		v.Items = i.List.Slice(0, i.List.Len()-1)
+	case KindSet:
+		v.Items = setMembers(i.Set)
+	case KindZSet:
+		v.ZSet = i.ZSet.Members()
+	default:
+		v.String = i.Value
+	}
+	return v
+}
+
+// fillItem заполняет только что созданный элемент значением v.
+func fillItem(item *Item, v Value) {
+	switch v.Kind {
+	case KindHash:
+		for i := 0; i+1 < len(v.Items); i += 2 {
+			item.Hash[v.Items[i]] = v.Items[i+1]
+		}
+	case KindList:
+		for _, e := range v.Items {
+			item.List.PushBack(e)
+		}
+	case KindSet:
+		for _, m := range v.Items {
+			item.Set[m] = struct{}{}
+		}
+	case KindZSet:
+		for _, m := range v.ZSet {
+			item.ZSet.Put(m.Member, m.Score)
+		}
+	default:
+		item.Value = v.String
+	}
+}
+
+// empty сообщает, что у составного значения не осталось элементов.
+// Пустых хешей, списков и множеств в кеше не бывает.
+func (i *Item) empty() bool {
+	switch i.Kind {
+	case KindHash:
+		return len(i.Hash) == 0
+	case KindList:
+		return i.List.Len() == 0
+	case KindSet:
+		return len(i.Set) == 0
+	case KindZSet:
+		return i.ZSet.Len() == 0
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// TestRestore — Restore создаёт ключ с типом и TTL, без replace не трогает
+// существующий, и журнал воспроизводит результат.
+func TestRestore(t *testing.T) {
+	rec := &recordPersistence{}
+	c := New(rec)
+	defer c.Close()
+
+	expireAt := time.Now().Add(time.Hour).UnixNano()
+	c.SAdd("s", "stale")
+	if err := c.Restore("s", Value{Kind: KindSet, Items: []string{"a", "b"}}, expireAt, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Restore("s", Value{Kind: KindString, String: "x"}, 0, false); !errors.Is(err, ErrKeyExist) {
+		t.Fatalf("Restore without replace: err = %v", err)
+	}
+	c.Restore("z", Value{Kind: KindZSet, ZSet: []ZMember{{"m", 1.5}}}, 0, false)
+	c.Restore("h", Value{Kind: KindHash, Items: []string{"f", "v"}}, 0, false)
+	// Истёкший TTL: ключа нет, прежний удаляется
+	c.Restore("h", Value{Kind: KindString, String: "x"}, time.Now().Add(-time.Second).UnixNano(), true)
+
+	check := func(c *Cache) {
+		t.Helper()
+		members, _ := c.SMembers("s")
+		if len(members) != 2 || c.GetTTL("s") < 3590 {
+			t.Fatalf("s = %v, TTL %d", members, c.GetTTL("s"))
+		}
+		if z, _ := c.ZScan("z", "*"); fmt.Sprint(z) != "[{m 1.5}]" {
+			t.Fatalf("z = %v", z)
+		}
+		if c.Exists("h") != 0 || c.CountKeys() != 2 {
+			t.Fatalf("h exists = %d, keys = %d", c.Exists("h"), c.CountKeys())
+		}
+	}
+	check(c)
+
+	replayed := New(&mockPersistence{})
+	defer replayed.Close()
+	rec.replayInto(replayed)
+	check(replayed)
+}
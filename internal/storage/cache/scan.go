@@ -0,0 +1,181 @@
+package storage
+
+/*
+	SCAN — обход ключей курсором без блокировок между вызовами.
+
+	Курсор: номер шарда в старших битах, в младших — сколько слотов
+	шарда (shard.slots) ещё не просмотрено. Шард обходится с конца;
+	удаление переносит последний элемент в освободившийся слот, то есть
+	элементы сдвигаются только к началу — в непросмотренную часть.
+	Отсюда гарантия Redis: ключ, существовавший весь обход, вернётся
+	хотя бы раз (возможно, дважды); ключи, добавленные во время обхода,
+	могут не вернуться.
+
+	За шардами тем же способом обходится cold storage (номер шарда
+	shardCount). Ключ, перешедший между RAM и cold посреди обхода, может
+	не вернуться.
+*/
+
+const (
+	scanSlotBits = 40
+	scanSlotMask = 1<<scanSlotBits - 1 // «шард ещё не начат»
+
+	// DefaultScanCount — сколько слотов просматривает SCAN без COUNT.
+	DefaultScanCount = 10
+)
+
+// ScanOptions — фильтры SCAN.
+type ScanOptions struct {
+	Match string // glob-шаблон; "" — все ключи
+	Count int    // сколько слотов просмотреть за вызов; 0 — DefaultScanCount
+	Type  string // тип в терминах TYPE ("hash", "zset", ...); "" — любой
+}
+
+// Scan возвращает очередную порцию ключей и следующий курсор.
+// Обход начинается с курсора 0 и заканчивается, когда возвращён 0.
+// Порция может быть пустой и при ненулевом курсоре.
+func (c *Cache) Scan(cursor uint64, opts ScanOptions) (uint64, []string) {
+	count := opts.Count
+	if count <= 0 {
+		count = DefaultScanCount
+	}
+
+	idx, remaining := cursor>>scanSlotBits, cursor&scanSlotMask
+	if cursor == 0 {
+		remaining = scanSlotMask
+	}
+
+	var keys []string
+	for idx <= shardCount && count > 0 {
+		var examined int
+		if idx < shardCount {
+			keys, remaining, examined = c.shards[idx].scan(keys, remaining, count, opts)
+		} else {
+			keys, remaining, examined = c.scanCold(keys, remaining, count, opts)
+		}
+		count -= examined
+		if remaining == 0 {
+			idx, remaining = idx+1, scanSlotMask
+		}
+	}
+	if idx > shardCount {
+		return 0, keys
+	}
+	return idx<<scanSlotBits | remaining, keys
+}
+
+// scanCold — shard.scan для ключей cold storage (все они строки).
+func (c *Cache) scanCold(keys []string, remaining uint64, count int, opts ScanOptions) ([]string, uint64, int) {
+	if c.cold == nil || opts.Type != "" && opts.Type != KindString.String() {
+		return keys, 0, 1
+	}
+	remaining, examined := c.cold.Scan(remaining, count, func(key string) {
+		if matchPattern(opts.Match, key) {
+			keys = append(keys, key)
+		}
+	})
+	return keys, remaining, max(examined, 1)
+}
+
+// scan просматривает до count слотов ниже remaining и дописывает
+// подходящие ключи в keys. Возвращает новое remaining и число
+// просмотренных слотов.
+func (s *shard) scan(keys []string, remaining uint64, count int, opts ScanOptions) ([]string, uint64, int) {
+	s.RLock()
+	defer s.RUnlock()
+
+	// Шард мог уменьшиться с прошлого вызова
+	remaining = min(remaining, uint64(len(s.slots)))
+
+	examined := 0
+	for remaining > 0 && examined < count {
+		remaining--
+		examined++
+
+		item := s.slots[remaining]
+		if item.IsExpired() {
+			continue
+		}
+		if opts.Type != "" && item.Kind.String() != opts.Type {
+			continue
+		}
+		if !matchPattern(opts.Match, item.Key) {
+			continue
+		}
+		keys = append(keys, item.Key)
+	}
+	// Пустой шард — тоже шаг: иначе 64 пустых шарда съели бы весь вызов
+	return keys, remaining, max(examined, 1)
+}
+
+// HScan возвращает поля и значения хеша, подходящие под шаблон,
+// парами [field, value, ...]. Коллекция отдаётся за один вызов.
+func (c *Cache) HScan(key, pattern string) ([]string, error) {
+	s := c.getShard(key)
+	c.promote(s, key)
+
+	s.RLock()
+	defer s.RUnlock()
+
+	item, err := s.typedRLocked(key, KindHash)
+	if err != nil || item == nil {
+		return []string{}, err
+	}
+	result := make([]string, 0, 2*len(item.Hash))
+	for field, value := range item.Hash {
+		if matchPattern(pattern, field) {
+			result = append(result, field, value)
+		}
+	}
+	return result, nil
+}
+
+// SScan возвращает элементы множества, подходящие под шаблон.
+func (c *Cache) SScan(key, pattern string) ([]string, error) {
+	s := c.getShard(key)
+	c.promote(s, key)
+
+	s.RLock()
+	defer s.RUnlock()
+
+	set, err := s.setRLocked(key)
+	if err != nil || set == nil {
+		return []string{}, err
+	}
+	result := make([]string, 0, len(set))
+	for member := range set {
+		if matchPattern(pattern, member) {
+			result = append(result, member)
+		}
+	}
+	return result, nil
+}
+
+// ZScan возвращает элементы sorted set (по возрастанию score),
+// подходящие под шаблон.
+func (c *Cache) ZScan(key, pattern string) ([]ZMember, error) {
+	s := c.getShard(key)
+	c.promote(s, key)
+
+	s.RLock()
+	defer s.RUnlock()
+
+	z, err := s.zsetRLocked(key)
+	if err != nil || z == nil || z.Len() == 0 {
+		return []ZMember{}, err
+	}
+	members := z.Slice(0, z.Len()-1, false)
+	result := members[:0]
+	for _, m := range members {
+		if matchPattern(pattern, m.Member) {
+			result = append(result, m)
+		}
+	}
+	return result, nil
+}
+
+// matchPattern сопоставляет строку с glob-шаблоном; "" и "*" — всё
+// (включая пустой ключ, как KEYS * в Redis).
+func matchPattern(pattern, s string) bool {
+	return pattern == "" || pattern == "*" || StringMatch(pattern, s)
+}
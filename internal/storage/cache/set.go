@@ -0,0 +1,112 @@
+package storage
+
+import "math/rand"
+
+// === Set: операции уровня шарда ===
+// Функции *Locked вызываются под write lock шарда (см. list.go).
+
+// saddLocked добавляет элементы во множество. Возвращает число новых.
+func (s *shard) saddLocked(key string, members []string) (added int, delta int64, err error) {
+	item, delta, err := s.typedLocked(key, KindSet, true)
+	if err != nil {
+		return 0, delta, err
+	}
+
+	for _, m := range members {
+		if _, exists := item.Set[m]; !exists {
+			item.Set[m] = struct{}{}
+			s.growLocked(item, setMemberSize(m))
+			added++
+		}
+	}
+	return added, delta, nil
+}
+
+// sremLocked удаляет элементы. Пустое множество удаляется.
+func (s *shard) sremLocked(key string, members []string) (removed int, delta int64, err error) {
+	item, delta, err := s.typedLocked(key, KindSet, false)
+	if err != nil || item == nil {
+		return 0, delta, err
+	}
+
+	for _, m := range members {
+		if _, exists := item.Set[m]; exists {
+			delete(item.Set, m)
+			s.growLocked(item, -setMemberSize(m))
+			removed++
+		}
+	}
+
+	if len(item.Set) == 0 {
+		s.removeLocked(item)
+		delta--
+	}
+	return removed, delta, nil
+}
+
+// spopLocked извлекает до count случайных элементов.
+func (s *shard) spopLocked(key string, count int) (members []string, delta int64, err error) {
+	item, delta, err := s.typedLocked(key, KindSet, false)
+	if err != nil || item == nil {
+		return nil, delta, err
+	}
+
+	// Порядок обхода map в Go случаен — этого достаточно для SPOP
+	for m := range item.Set {
+		if len(members) >= count {
+			break
+		}
+		members = append(members, m)
+		delete(item.Set, m)
+		s.growLocked(item, -setMemberSize(m))
+	}
+
+	if len(item.Set) == 0 {
+		s.removeLocked(item)
+		delta--
+	}
+	return members, delta, nil
+}
+
+// setRLocked возвращает множество под read lock (nil, если ключа нет).
+func (s *shard) setRLocked(key string) (map[string]struct{}, error) {
+	item, err := s.typedRLocked(key, KindSet)
+	if err != nil || item == nil {
+		return nil, err
+	}
+	return item.Set, nil
+}
+
+// setMembers возвращает элементы множества срезом.
+func setMembers(set map[string]struct{}) []string {
+	members := make([]string, 0, len(set))
+	for m := range set {
+		members = append(members, m)
+	}
+	return members
+}
+
+// randMembers реализует SRANDMEMBER:
+// count > 0 — до count различных элементов, count < 0 — |count| с повторами.
+func randMembers(set map[string]struct{}, count int) []string {
+	if count >= 0 {
+		result := make([]string, 0, min(count, len(set)))
+		for m := range set {
+			if len(result) >= count {
+				break
+			}
+			result = append(result, m)
+		}
+		return result
+	}
+
+	all := setMembers(set)
+	if len(all) == 0 {
+		return []string{}
+	}
+	result := make([]string, -count)
+	for i := range result {
+		result[i] = all[rand.Intn(len(all))]
+	}
+	return result
+}
@@ -0,0 +1,278 @@
+package storage
+
+// === Set: Redis-совместимые операции ===
+
+// SAdd добавляет элементы во множество. Возвращает число новых.
+func (c *Cache) SAdd(key string, members ...string) (int, error) {
+	s := c.getShard(key)
+	c.promote(s, key)
+	if err := c.reserve(s, key); err != nil {
+		return 0, err
+	}
+
+	s.Lock()
+	added, delta, err := s.saddLocked(key, members)
+	var wait func() error
+	if err == nil && added > 0 {
+		wait = c.persister.Write("SADD", key, encodeArgs(members), 0)
+	}
+	s.Unlock()
+
+	c.totalKeys.Add(delta)
+	return added, c.durable(err, wait)
+}
+
+// SRem удаляет элементы из множества. Возвращает число удалённых.
+func (c *Cache) SRem(key string, members ...string) (int, error) {
+	s := c.getShard(key)
+	c.promote(s, key)
+
+	s.Lock()
+	removed, delta, err := s.sremLocked(key, members)
+	var wait func() error
+	if err == nil && removed > 0 {
+		wait = c.persister.Write("SREM", key, encodeArgs(members), 0)
+	}
+	s.Unlock()
+
+	c.totalKeys.Add(delta)
+	return removed, c.durable(err, wait)
+}
+
+// SIsMember проверяет принадлежность элемента множеству.
+func (c *Cache) SIsMember(key, member string) (bool, error) {
+	result, err := c.SMIsMember(key, member)
+	if err != nil {
+		return false, err
+	}
+	return result[0], nil
+}
+
+// SMIsMember проверяет принадлежность нескольких элементов.
+func (c *Cache) SMIsMember(key string, members ...string) ([]bool, error) {
+	s := c.getShard(key)
+	c.promote(s, key)
+
+	s.RLock()
+	defer s.RUnlock()
+
+	set, err := s.setRLocked(key)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]bool, len(members))
+	for i, m := range members {
+		_, result[i] = set[m]
+	}
+	return result, nil
+}
+
+// SMembers возвращает все элементы множества.
+func (c *Cache) SMembers(key string) ([]string, error) {
+	s := c.getShard(key)
+	c.promote(s, key)
+
+	s.RLock()
+	defer s.RUnlock()
+
+	set, err := s.setRLocked(key)
+	if err != nil {
+		return nil, err
+	}
+	return setMembers(set), nil
+}
+
+// SCard возвращает мощность множества.
+func (c *Cache) SCard(key string) (int, error) {
+	s := c.getShard(key)
+	c.promote(s, key)
+
+	s.RLock()
+	defer s.RUnlock()
+
+	set, err := s.setRLocked(key)
+	return len(set), err
+}
+
+// SPop извлекает до count случайных элементов.
+func (c *Cache) SPop(key string, count int) ([]string, error) {
+	s := c.getShard(key)
+	c.promote(s, key)
+
+	s.Lock()
+	members, delta, err := s.spopLocked(key, count)
+	var wait func() error
+	if err == nil && len(members) > 0 {
+		// В журнал — конкретные элементы, чтобы replay был детерминирован
+		wait = c.persister.Write("SREM", key, encodeArgs(members), 0)
+	}
+	s.Unlock()
+
+	c.totalKeys.Add(delta)
+	return members, c.durable(err, wait)
+}
+
+// SRandMember возвращает случайные элементы, не удаляя их.
+// count > 0 — различные элементы, count < 0 — |count| элементов с повторами.
+func (c *Cache) SRandMember(key string, count int) ([]string, error) {
+	s := c.getShard(key)
+	c.promote(s, key)
+
+	s.RLock()
+	defer s.RUnlock()
+
+	set, err := s.setRLocked(key)
+	if err != nil {
+		return nil, err
+	}
+	return randMembers(set, count), nil
+}
+
+// === Алгебра множеств ===
+
+// setOp — операция над несколькими множествами.
+type setOp int
+
+const (
+	setInter setOp = iota
+	setUnion
+	setDiff
+)
+
+// SInter возвращает пересечение множеств.
+func (c *Cache) SInter(keys ...string) ([]string, error) {
+	return c.combine(setInter, keys)
+}
+
+// SUnion возвращает объединение множеств.
+func (c *Cache) SUnion(keys ...string) ([]string, error) {
+	return c.combine(setUnion, keys)
+}
+
+// SDiff возвращает элементы первого множества, которых нет в остальных.
+func (c *Cache) SDiff(keys ...string) ([]string, error) {
+	return c.combine(setDiff, keys)
+}
+
+// SInterStore сохраняет пересечение в dst. Возвращает мощность результата.
+func (c *Cache) SInterStore(dst string, keys ...string) (int, error) {
+	return c.combineStore(setInter, dst, keys)
+}
+
+// SUnionStore сохраняет объединение в dst.
+func (c *Cache) SUnionStore(dst string, keys ...string) (int, error) {
+	return c.combineStore(setUnion, dst, keys)
+}
+
+// SDiffStore сохраняет разность в dst.
+func (c *Cache) SDiffStore(dst string, keys ...string) (int, error) {
+	return c.combineStore(setDiff, dst, keys)
+}
+
+// combine вычисляет op под read lock всех задействованных шардов —
+// результат согласован, даже если ключи лежат в разных шардах.
+func (c *Cache) combine(op setOp, keys []string) ([]string, error) {
+	for _, key := range keys {
+		c.promote(c.getShard(key), key)
+	}
+
+	unlock := c.rlockShards(keys...)
+	result, err := c.combineLocked(op, keys)
+	unlock()
+
+	if err != nil {
+		return nil, err
+	}
+	return setMembers(result), nil
+}
+
+// combineStore вычисляет op и атомарно заменяет dst результатом.
+// Пустой результат удаляет dst.
+func (c *Cache) combineStore(op setOp, dst string, keys []string) (int, error) {
+	sDst := c.getShard(dst)
+	for _, key := range keys {
+		c.promote(c.getShard(key), key)
+	}
+	c.promote(sDst, dst)
+	if err := c.reserve(sDst, dst); err != nil {
+		return 0, err
+	}
+
+	unlock := c.lockShards(append([]string{dst}, keys...)...)
+
+	result, err := c.combineLocked(op, keys)
+	if err != nil {
+		unlock()
+		return 0, err
+	}
+
+	var delta int64
+	if old, exists := sDst.items[dst]; exists {
+		sDst.removeLocked(old)
+		delta--
+	}
+	wait := c.persister.Write("DEL", dst, "", 0)
+
+	if len(result) > 0 {
+		item := sDst.newItemLocked(dst, KindSet)
+		item.Set = result
+		sDst.resizeLocked(item)
+		delta++
+		wait = c.persister.Write("SADD", dst, encodeArgs(setMembers(result)), 0)
+	}
+	unlock()
+
+	c.totalKeys.Add(delta)
+	return len(result), c.durable(nil, wait)
+}
+
+// combineLocked вычисляет op над множествами keys (шарды уже заблокированы).
+// Отсутствующий ключ — пустое множество. Результат — новая map.
+func (c *Cache) combineLocked(op setOp, keys []string) (map[string]struct{}, error) {
+	sets := make([]map[string]struct{}, len(keys))
+	for i, key := range keys {
+		set, err := c.getShard(key).setRLocked(key)
+		if err != nil {
+			return nil, err
+		}
+		sets[i] = set
+	}
+
+	result := make(map[string]struct{})
+	if len(sets) == 0 {
+		return result, nil
+	}
+
+	switch op {
+	case setUnion:
+		for _, set := range sets {
+			for m := range set {
+				result[m] = struct{}{}
+			}
+		}
+
+	case setInter:
+	members:
+		for m := range sets[0] {
+			for _, set := range sets[1:] {
+				if _, ok := set[m]; !ok {
+					continue members
+				}
+			}
+			result[m] = struct{}{}
+		}
+
+	case setDiff:
+	candidates:
+		for m := range sets[0] {
+			for _, set := range sets[1:] {
+				if _, ok := set[m]; ok {
+					continue candidates
+				}
+			}
+			result[m] = struct{}{}
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func sorted(members []string) []string {
+	sort.Strings(members)
+	return members
+}
+
+func TestSetBasic(t *testing.T) {
+	c := New(&mockPersistence{})
+	defer c.Close()
+
+	if n, _ := c.SAdd("s", "a", "b", "a"); n != 2 {
+		t.Fatalf("SAdd = %d, want 2", n)
+	}
+	if ok, _ := c.SIsMember("s", "a"); !ok {
+		t.Fatal("SIsMember(a) = false")
+	}
+	if got, _ := c.SMIsMember("s", "b", "z"); !reflect.DeepEqual(got, []bool{true, false}) {
+		t.Fatalf("SMIsMember = %v", got)
+	}
+	if got, _ := c.SRandMember("s", -5); len(got) != 5 {
+		t.Fatalf("SRandMember(-5) returned %d members", len(got))
+	}
+	if got, _ := c.SRandMember("s", 5); len(got) != 2 {
+		t.Fatalf("SRandMember(5) returned %d members", len(got))
+	}
+
+	popped, _ := c.SPop("s", 10)
+	if !reflect.DeepEqual(sorted(popped), []string{"a", "b"}) {
+		t.Fatalf("SPop = %v", popped)
+	}
+	if c.Exists("s") != 0 || c.CountKeys() != 0 {
+		t.Fatal("empty set must be removed")
+	}
+
+	c.Set("str", "v", 0, false)
+	if _, err := c.SAdd("str", "x"); err != ErrWrongType {
+		t.Fatalf("SAdd on string: err=%v", err)
+	}
+}
+
+func TestSetAlgebra(t *testing.T) {
+	c := New(&mockPersistence{})
+	defer c.Close()
+
+	c.SAdd("a", "1", "2", "3")
+	c.SAdd("b", "2", "3", "4")
+
+	tests := []struct {
+		name string
+		fn   func(...string) ([]string, error)
+		keys []string
+		want []string
+	}{
+		{"inter", c.SInter, []string{"a", "b"}, []string{"2", "3"}},
+		{"union", c.SUnion, []string{"a", "b"}, []string{"1", "2", "3", "4"}},
+		{"diff", c.SDiff, []string{"a", "b"}, []string{"1"}},
+		{"inter with missing", c.SInter, []string{"a", "none"}, []string{}},
+		{"diff with missing", c.SDiff, []string{"a", "none"}, []string{"1", "2", "3"}},
+	}
+	for _, tt := range tests {
+		got, err := tt.fn(tt.keys...)
+		if err != nil || !reflect.DeepEqual(sorted(got), tt.want) {
+			t.Errorf("%s = %v, %v; want %v", tt.name, got, err, tt.want)
+		}
+	}
+
+	if n, _ := c.SUnionStore("u", "a", "b"); n != 4 {
+		t.Fatalf("SUnionStore = %d", n)
+	}
+	// dst может быть среди источников
+	if n, _ := c.SInterStore("u", "u", "a"); n != 3 {
+		t.Fatalf("SInterStore(u, u, a) = %d", n)
+	}
+	if n, _ := c.SDiffStore("u", "a", "u"); n != 0 || c.Exists("u") != 0 {
+		t.Fatalf("SDiffStore with empty result = %d, exists=%d", n, c.Exists("u"))
+	}
+	if c.CountKeys() != 2 {
+		t.Fatalf("CountKeys = %d, want 2", c.CountKeys())
+	}
+
+	c.Set("str", "v", 0, false)
+	if _, err := c.SUnionStore("dst", "a", "str"); err != ErrWrongType {
+		t.Fatalf("SUnionStore with string source: err=%v", err)
+	}
+}
+
+func TestSetReplay(t *testing.T) {
+	rec := &recordPersistence{}
+	c := New(rec)
+	defer c.Close()
+
+	c.SAdd("a", "1", "2", "3", "4")
+	c.SRem("a", "4")
+	c.SPop("a", 1)
+	c.SAdd("b", "2", "3", "9")
+	c.SInterStore("both", "a", "b")
+	c.SUnionStore("a", "a", "b")
+
+	restored := New(&mockPersistence{})
+	defer restored.Close()
+	rec.replayInto(restored)
+
+	for _, key := range []string{"a", "b", "both"} {
+		want, _ := c.SMembers(key)
+		got, _ := restored.SMembers(key)
+		if !reflect.DeepEqual(sorted(got), sorted(want)) {
+			t.Fatalf("replayed %s = %v, want %v", key, got, want)
+		}
+	}
+	if restored.CountKeys() != c.CountKeys() {
+		t.Fatalf("CountKeys = %d, want %d", restored.CountKeys(), c.CountKeys())
+	}
+}
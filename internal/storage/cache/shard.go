@@ -3,7 +3,6 @@ package storage
 import (
 	"container/heap"
 	"hash/fnv"
-	"path/filepath"
 	"strconv"
 	"sync/atomic"
 	"time"
@@ -11,10 +10,11 @@ import (
 
 const shardCount = 64
 
-func newShard() *shard {
+func newShard(lfu *lfuParams) *shard {
 	s := &shard{
 		items: make(map[string]*Item),
 		pq:    make(priorityQueue, 0),
+		lfu:   lfu,
 	}
 	heap.Init(&s.pq)
 	return s
@@ -22,22 +22,94 @@ func newShard() *shard {
 
 // getShard возвращает шард для данного ключа по FNV-хешу.
 func (c *Cache) getShard(key string) *shard {
+	return c.shards[shardIndex(key)]
+}
+
+// shardIndex возвращает номер шарда для ключа.
+func shardIndex(key string) uint32 {
 	h := fnv.New32a()
 	h.Write([]byte(key))
-	return c.shards[h.Sum32()&(shardCount-1)]
+	return h.Sum32() & (shardCount - 1)
+}
+
+// lockShards захватывает write lock шардов всех ключей в порядке возрастания
+// номера шарда — многоключевые операции не дедлочат друг друга.
+// Каждый шард блокируется один раз, даже если ключей в нём несколько.
+func (c *Cache) lockShards(keys ...string) (unlock func()) {
+	locked := c.shardsOf(keys)
+	for _, s := range locked {
+		s.Lock()
+	}
+	return func() {
+		for j := len(locked) - 1; j >= 0; j-- {
+			locked[j].Unlock()
+		}
+	}
+}
+
+// rlockShards — то же для read lock.
+func (c *Cache) rlockShards(keys ...string) (unlock func()) {
+	locked := c.shardsOf(keys)
+	for _, s := range locked {
+		s.RLock()
+	}
+	return func() {
+		for j := len(locked) - 1; j >= 0; j-- {
+			locked[j].RUnlock()
+		}
+	}
+}
+
+// lockAllShards захватывает write lock всех шардов по порядку (FLUSHDB).
+func (c *Cache) lockAllShards() (unlock func()) {
+	for _, s := range c.shards {
+		s.Lock()
+	}
+	return func() {
+		for j := shardCount - 1; j >= 0; j-- {
+			c.shards[j].Unlock()
+		}
+	}
+}
+
+// shardsOf возвращает различные шарды ключей в порядке возрастания номера.
+func (c *Cache) shardsOf(keys []string) []*shard {
+	var used [shardCount]bool
+	for _, key := range keys {
+		used[shardIndex(key)] = true
+	}
+
+	result := make([]*shard, 0, len(keys))
+	for i := 0; i < shardCount; i++ {
+		if used[i] {
+			result = append(result, c.shards[i])
+		}
+	}
+	return result
 }
 
 // set записывает значение в шард. Возвращает true, если ключ новый.
 func (s *shard) set(key, value string, expireAt int64) bool {
 	s.Lock()
 	defer s.Unlock()
+	return s.setLocked(key, value, expireAt)
+}
 
+// setLocked — то же под уже захваченным write lock.
+func (s *shard) setLocked(key, value string, expireAt int64) bool {
 	now := nowCached()
+	s.touchLocked(key)
 
 	if item, exist := s.items[key]; exist {
+		item.Kind = KindString
 		item.Value = value
+		item.Hash = nil
+		item.List = nil
+		item.Set = nil
+		item.ZSet = nil
+		s.resizeLocked(item)
 		atomic.StoreInt64(&item.ExpireAt, expireAt)
-		atomic.StoreInt64(&item.LastAccess, now)
+		s.access(item, now)
 		// Обновляем heap
 		if expireAt > 0 {
 			if item.HeapIndex >= 0 {
@@ -56,9 +128,10 @@ func (s *shard) set(key, value string, expireAt int64) bool {
 		Value:      value,
 		ExpireAt:   expireAt,
 		LastAccess: now,
+		Freq:       newFreq(now),
 		HeapIndex:  -1,
 	}
-	s.items[key] = item
+	s.linkLocked(item)
 	if expireAt > 0 {
 		heap.Push(&s.pq, item)
 	}
@@ -82,7 +155,7 @@ func (s *shard) get(key string) (string, bool) {
 		s.Lock()
 		item, exists = s.items[key]
 		if exists && item.IsExpired() {
-			delete(s.items, key)
+			s.unlinkLocked(item)
 			if item.HeapIndex >= 0 {
 				heap.Remove(&s.pq, item.HeapIndex)
 			}
@@ -90,40 +163,27 @@ func (s *shard) get(key string) (string, bool) {
 			return "", false
 		}
 		// Ключ обновили пока ждали Lock — вернём актуальное значение
-		if !exists {
+		if !exists || item.Kind != KindString {
 			s.Unlock()
 			return "", false
 		}
 		val := item.Value
-		atomic.StoreInt64(&item.LastAccess, nowCached())
+		s.access(item, nowCached())
 		s.Unlock()
 		return val, true
 	}
 
 	// Fast path: не протух — копируем и возвращаем
+	if item.Kind != KindString {
+		s.RUnlock()
+		return "", false
+	}
 	val := item.Value
-	atomic.StoreInt64(&item.LastAccess, nowCached())
+	s.access(item, nowCached())
 	s.RUnlock()
 	return val, true
 }
 
-// del удаляет ключ из шарда. Возвращает true, если ключ был удалён.
-func (s *shard) del(key string) bool {
-	s.Lock()
-	defer s.Unlock()
-
-	item, exists := s.items[key]
-	if !exists {
-		return false
-	}
-
-	delete(s.items, key)
-	if item.HeapIndex >= 0 {
-		heap.Remove(&s.pq, item.HeapIndex)
-	}
-	return true
-}
-
 // exists проверяет существование ключа (с учётом TTL).
 func (s *shard) exists(key string) bool {
 	s.RLock()
@@ -145,12 +205,16 @@ func (s *shard) exists(key string) bool {
 func (s *shard) expire(key string, expireAt int64) bool {
 	s.Lock()
 	defer s.Unlock()
+	return s.expireLocked(key, expireAt)
+}
 
+func (s *shard) expireLocked(key string, expireAt int64) bool {
 	item, exists := s.items[key]
 	if !exists || item.IsExpired() {
 		return false
 	}
 
+	s.touchLocked(key)
 	atomic.StoreInt64(&item.ExpireAt, expireAt)
 	if expireAt > 0 {
 		if item.HeapIndex >= 0 {
@@ -200,7 +264,7 @@ func (s *shard) incrBy(key string, delta int64) (int64, bool, error) {
 	item, exists := s.items[key]
 
 	if exists && item.IsExpired() {
-		delete(s.items, key)
+		s.unlinkLocked(item)
 		if item.HeapIndex >= 0 {
 			heap.Remove(&s.pq, item.HeapIndex)
 		}
@@ -211,6 +275,9 @@ func (s *shard) incrBy(key string, delta int64) (int64, bool, error) {
 	isNew := false
 
 	if exists {
+		if item.Kind != KindString {
+			return 0, false, ErrWrongType
+		}
 		var err error
 		current, err = strconv.ParseInt(item.Value, 10, 64)
 		if err != nil {
@@ -218,7 +285,8 @@ func (s *shard) incrBy(key string, delta int64) (int64, bool, error) {
 		}
 		current += delta
 		item.Value = strconv.FormatInt(current, 10)
-		atomic.StoreInt64(&item.LastAccess, now)
+		s.resizeLocked(item)
+		s.access(item, now)
 	} else {
 		current = delta
 		isNew = true
@@ -226,16 +294,18 @@ func (s *shard) incrBy(key string, delta int64) (int64, bool, error) {
 			Key:        key,
 			Value:      strconv.FormatInt(current, 10),
 			LastAccess: now,
+			Freq:       newFreq(now),
 			HeapIndex:  -1,
 		}
-		s.items[key] = newItem
+		s.linkLocked(newItem)
 	}
 
+	s.touchLocked(key)
 	return current, isNew, nil
 }
 
 // appendVal дописывает к значению ключа. Возвращает новую длину.
-func (s *shard) appendVal(key, suffix string) (int, bool) {
+func (s *shard) appendVal(key, suffix string) (int, bool, error) {
 	s.Lock()
 	defer s.Unlock()
 
@@ -243,7 +313,7 @@ func (s *shard) appendVal(key, suffix string) (int, bool) {
 	item, exists := s.items[key]
 
 	if exists && item.IsExpired() {
-		delete(s.items, key)
+		s.unlinkLocked(item)
 		if item.HeapIndex >= 0 {
 			heap.Remove(&s.pq, item.HeapIndex)
 		}
@@ -251,37 +321,48 @@ func (s *shard) appendVal(key, suffix string) (int, bool) {
 	}
 
 	if exists {
+		if item.Kind != KindString {
+			return 0, false, ErrWrongType
+		}
 		item.Value += suffix
-		atomic.StoreInt64(&item.LastAccess, now)
-		return len(item.Value), false
+		s.growLocked(item, int64(len(suffix)))
+		s.touchLocked(key)
+		s.access(item, now)
+		return len(item.Value), false, nil
 	}
 
 	newItem := &Item{
 		Key:        key,
 		Value:      suffix,
 		LastAccess: now,
+		Freq:       newFreq(now),
 		HeapIndex:  -1,
 	}
-	s.items[key] = newItem
-	return len(suffix), true
+	s.linkLocked(newItem)
+	s.touchLocked(key)
+	return len(suffix), true, nil
 }
 
-// strlen возвращает длину строки.
-func (s *shard) strlen(key string) int {
+// strlen возвращает длину строки. found = false — живого ключа в RAM нет.
+func (s *shard) strlen(key string) (n int, found bool, err error) {
 	s.RLock()
 	item, exists := s.items[key]
 	if !exists {
 		s.RUnlock()
-		return 0
+		return 0, false, nil
 	}
 	expireAt := atomic.LoadInt64(&item.ExpireAt)
 	vlen := len(item.Value)
+	isString := item.Kind == KindString
 	s.RUnlock()
 
 	if expireAt > 0 && time.Now().UnixNano() > expireAt {
-		return 0
+		return 0, false, nil
+	}
+	if !isString {
+		return 0, true, ErrWrongType
 	}
-	return vlen
+	return vlen, true, nil
 }
 
 // keys возвращает ключи в этом шарде, matching pattern.
@@ -294,27 +375,139 @@ func (s *shard) keys(pattern string) []string {
 		if item.IsExpired() {
 			continue
 		}
-		if pattern == "*" {
+		if matchPattern(pattern, key) {
 			result = append(result, key)
-		} else {
-			matched, _ := filepath.Match(pattern, key)
-			if matched {
-				result = append(result, key)
-			}
 		}
 	}
 	return result
 }
 
-// rename переименовывает ключ. Атомарно внутри одного шарда
-// Для кросс-шардного rename используется Cache.Rename
-func (s *shard) getItem(key string) (*Item, bool) {
+// kind возвращает тип значения живого ключа.
+func (s *shard) kind(key string) (Kind, bool) {
 	s.RLock()
+	defer s.RUnlock()
+
 	item, exists := s.items[key]
-	s.RUnlock()
+	if !exists || item.IsExpired() {
+		return 0, false
+	}
+	return item.Kind, true
+}
 
+// liveLocked возвращает живой элемент под уже захваченным write lock.
+// Истёкший элемент удаляется; expired=true сообщает вызывающему,
+// что ключ пропал из шарда и totalKeys нужно уменьшить.
+func (s *shard) liveLocked(key string) (item *Item, ok bool, expired bool) {
+	item, exists := s.items[key]
+	if !exists {
+		return nil, false, false
+	}
+	if item.IsExpired() {
+		s.removeLocked(item)
+		return nil, false, true
+	}
+	return item, true, false
+}
+
+// liveRLocked — то же под read lock: истёкший элемент просто не виден.
+func (s *shard) liveRLocked(key string) (*Item, bool) {
+	item, exists := s.items[key]
 	if !exists || item.IsExpired() {
 		return nil, false
 	}
 	return item, true
 }
+
+// removeLocked удаляет элемент из шарда (write lock).
+func (s *shard) removeLocked(item *Item) {
+	s.touchLocked(item.Key)
+	s.unlinkLocked(item)
+	if item.HeapIndex >= 0 {
+		heap.Remove(&s.pq, item.HeapIndex)
+	}
+}
+
+// linkLocked добавляет элемент в шард (write lock).
+// Размер элемента считается заново: ключ мог смениться (RENAME).
+func (s *shard) linkLocked(item *Item) {
+	item.Mem = item.memUsage()
+	s.mem.Add(item.Mem)
+	item.SlotIndex = len(s.slots)
+	s.slots = append(s.slots, item)
+	s.items[item.Key] = item
+}
+
+// unlinkLocked убирает элемент из шарда (write lock). Его слот занимает
+// последний элемент: элементы сдвигаются только к началу slots,
+// поэтому SCAN, идущий с конца, не пропускает ни одного.
+func (s *shard) unlinkLocked(item *Item) {
+	s.mem.Add(-item.Mem)
+	delete(s.items, item.Key)
+	last := len(s.slots) - 1
+	moved := s.slots[last]
+	moved.SlotIndex = item.SlotIndex
+	s.slots[item.SlotIndex] = moved
+	s.slots[last] = nil
+	s.slots = s.slots[:last]
+}
+
+// newItemLocked создаёт пустой элемент заданного типа (write lock).
+func (s *shard) newItemLocked(key string, kind Kind) *Item {
+	now := nowCached()
+	item := &Item{
+		Key:        key,
+		Kind:       kind,
+		LastAccess: now,
+		Freq:       newFreq(now),
+		HeapIndex:  -1,
+	}
+	switch kind {
+	case KindHash:
+		item.Hash = make(map[string]string)
+	case KindList:
+		item.List = newDeque()
+	case KindSet:
+		item.Set = make(map[string]struct{})
+	case KindZSet:
+		item.ZSet = newZSet()
+	}
+	s.linkLocked(item)
+	s.touchLocked(key)
+	return item
+}
+
+// typedLocked возвращает живой элемент составного типа kind (write lock).
+// create = true — создать пустой, если ключа нет; иначе вернуть nil.
+// delta — изменение числа ключей в шарде (для totalKeys).
+func (s *shard) typedLocked(key string, kind Kind, create bool) (item *Item, delta int64, err error) {
+	item, ok, expired := s.liveLocked(key)
+	if expired {
+		delta--
+	}
+	if ok {
+		if item.Kind != kind {
+			return nil, delta, ErrWrongType
+		}
+		// Вызывается только пишущими командами — считаем ключ изменённым
+		s.touchLocked(key)
+		s.access(item, nowCached())
+		return item, delta, nil
+	}
+	if !create {
+		return nil, delta, nil
+	}
+	return s.newItemLocked(key, kind), delta + 1, nil
+}
+
+// typedRLocked — то же под read lock: nil, если ключа нет.
+func (s *shard) typedRLocked(key string, kind Kind) (*Item, error) {
+	item, ok := s.liveRLocked(key)
+	if !ok {
+		return nil, nil
+	}
+	if item.Kind != kind {
+		return nil, ErrWrongType
+	}
+	s.access(item, nowCached())
+	return item, nil
+}
@@ -0,0 +1,209 @@
+package storage
+
+import "math/rand"
+
+// skiplist — упорядоченный по (score, member) список для sorted set.
+// Как в Redis: span на каждом уровне хранит число пропускаемых узлов,
+// поэтому ранг и доступ по рангу — O(log n).
+type skiplist struct {
+	head   *skiplistNode
+	tail   *skiplistNode
+	length int
+	level  int
+}
+
+type skiplistNode struct {
+	member   string
+	score    float64
+	backward *skiplistNode
+	level    []skiplistLevel
+}
+
+type skiplistLevel struct {
+	forward *skiplistNode
+	span    int
+}
+
+const skiplistMaxLevel = 32
+
+// newSkiplist создаёт пустой skiplist.
+func newSkiplist() *skiplist {
+	return &skiplist{
+		head:  &skiplistNode{level: make([]skiplistLevel, skiplistMaxLevel)},
+		level: 1,
+	}
+}
+
+// randomLevel — уровень нового узла, вероятность каждого следующего 1/4.
+func randomLevel() int {
+	level := 1
+	for level < skiplistMaxLevel && rand.Intn(4) == 0 {
+		level++
+	}
+	return level
+}
+
+// before сообщает, стоит ли узел строго раньше пары (score, member).
+func (n *skiplistNode) before(score float64, member string) bool {
+	return n.score < score || (n.score == score && n.member < member)
+}
+
+// after сообщает, стоит ли узел строго позже пары (score, member).
+func (n *skiplistNode) after(score float64, member string) bool {
+	return n.score > score || (n.score == score && n.member > member)
+}
+
+// Len возвращает количество элементов.
+func (sl *skiplist) Len() int { return sl.length }
+
+// Insert добавляет элемент. Вызывающий гарантирует, что member ещё нет.
+func (sl *skiplist) Insert(score float64, member string) {
+	var (
+		update [skiplistMaxLevel]*skiplistNode
+		rank   [skiplistMaxLevel]int
+	)
+
+	x := sl.head
+	for i := sl.level - 1; i >= 0; i-- {
+		if i < sl.level-1 {
+			rank[i] = rank[i+1]
+		}
+		for x.level[i].forward != nil && x.level[i].forward.before(score, member) {
+			rank[i] += x.level[i].span
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+
+	level := randomLevel()
+	if level > sl.level {
+		for i := sl.level; i < level; i++ {
+			update[i] = sl.head
+			update[i].level[i].span = sl.length
+		}
+		sl.level = level
+	}
+
+	x = &skiplistNode{member: member, score: score, level: make([]skiplistLevel, level)}
+	for i := 0; i < level; i++ {
+		x.level[i].forward = update[i].level[i].forward
+		update[i].level[i].forward = x
+		x.level[i].span = update[i].level[i].span - (rank[0] - rank[i])
+		update[i].level[i].span = rank[0] - rank[i] + 1
+	}
+	for i := level; i < sl.level; i++ {
+		update[i].level[i].span++
+	}
+
+	if update[0] != sl.head {
+		x.backward = update[0]
+	}
+	if x.level[0].forward != nil {
+		x.level[0].forward.backward = x
+	} else {
+		sl.tail = x
+	}
+	sl.length++
+}
+
+// Delete удаляет элемент. Возвращает false, если его нет.
+func (sl *skiplist) Delete(score float64, member string) bool {
+	var update [skiplistMaxLevel]*skiplistNode
+
+	x := sl.head
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && x.level[i].forward.before(score, member) {
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+
+	x = x.level[0].forward
+	if x == nil || x.score != score || x.member != member {
+		return false
+	}
+
+	for i := 0; i < sl.level; i++ {
+		if update[i].level[i].forward == x {
+			update[i].level[i].span += x.level[i].span - 1
+			update[i].level[i].forward = x.level[i].forward
+		} else {
+			update[i].level[i].span--
+		}
+	}
+	if x.level[0].forward != nil {
+		x.level[0].forward.backward = x.backward
+	} else {
+		sl.tail = x.backward
+	}
+	for sl.level > 1 && sl.head.level[sl.level-1].forward == nil {
+		sl.level--
+	}
+	sl.length--
+	return true
+}
+
+// Rank возвращает позицию элемента (с нуля) или -1, если его нет.
+func (sl *skiplist) Rank(score float64, member string) int {
+	rank := 0
+	x := sl.head
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && !x.level[i].forward.after(score, member) {
+			rank += x.level[i].span
+			x = x.level[i].forward
+		}
+		if x != sl.head && x.score == score && x.member == member {
+			return rank - 1
+		}
+	}
+	return -1
+}
+
+// ByRank возвращает узел на позиции rank (с нуля) или nil.
+func (sl *skiplist) ByRank(rank int) *skiplistNode {
+	if rank < 0 || rank >= sl.length {
+		return nil
+	}
+
+	traversed := 0
+	x := sl.head
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && traversed+x.level[i].span <= rank+1 {
+			traversed += x.level[i].span
+			x = x.level[i].forward
+		}
+		if traversed == rank+1 {
+			return x
+		}
+	}
+	return nil
+}
+
+// First возвращает первый узел, попадающий в диапазон r, или nil.
+func (sl *skiplist) First(r zrange) *skiplistNode {
+	x := sl.head
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && !r.aboveMin(x.level[i].forward) {
+			x = x.level[i].forward
+		}
+	}
+	x = x.level[0].forward
+	if x == nil || !r.belowMax(x) {
+		return nil
+	}
+	return x
+}
+
+// Last возвращает последний узел, попадающий в диапазон r, или nil.
+func (sl *skiplist) Last(r zrange) *skiplistNode {
+	x := sl.head
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && r.belowMax(x.level[i].forward) {
+			x = x.level[i].forward
+		}
+	}
+	if x == sl.head || !r.aboveMin(x) {
+		return nil
+	}
+	return x
+}
@@ -0,0 +1,311 @@
+package storage
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrNotFloat возвращается, если score не число.
+	ErrNotFloat = errors.New("value is not a valid float")
+
+	// ErrScoreNaN возвращается ZINCRBY, если результат — NaN (inf + -inf).
+	ErrScoreNaN = errors.New("resulting score is not a number (NaN)")
+
+	// ErrScoreRange возвращается при неверной границе диапазона по score.
+	ErrScoreRange = errors.New("min or max is not a float")
+
+	// ErrLexRange возвращается при неверной границе лексикографического диапазона.
+	ErrLexRange = errors.New("min or max not valid string range item")
+)
+
+// ZMember — элемент sorted set.
+type ZMember struct {
+	Member string
+	Score  float64
+}
+
+// zset — sorted set: map для O(1) поиска score + skiplist для порядка.
+type zset struct {
+	dict map[string]float64
+	sl   *skiplist
+}
+
+// newZSet создаёт пустой sorted set.
+func newZSet() *zset {
+	return &zset{dict: make(map[string]float64), sl: newSkiplist()}
+}
+
+// Len возвращает количество элементов.
+func (z *zset) Len() int { return len(z.dict) }
+
+// Score возвращает score элемента.
+func (z *zset) Score(member string) (float64, bool) {
+	score, ok := z.dict[member]
+	return score, ok
+}
+
+// Put добавляет элемент или меняет его score. Возвращает true, если элемент новый.
+func (z *zset) Put(member string, score float64) bool {
+	if cur, ok := z.dict[member]; ok {
+		if cur != score {
+			z.sl.Delete(cur, member)
+			z.sl.Insert(score, member)
+			z.dict[member] = score
+		}
+		return false
+	}
+	z.sl.Insert(score, member)
+	z.dict[member] = score
+	return true
+}
+
+// Remove удаляет элемент. Возвращает false, если его не было.
+func (z *zset) Remove(member string) bool {
+	score, ok := z.dict[member]
+	if !ok {
+		return false
+	}
+	z.sl.Delete(score, member)
+	delete(z.dict, member)
+	return true
+}
+
+// Rank возвращает позицию элемента (с нуля); rev — считать от наибольшего.
+func (z *zset) Rank(member string, rev bool) (int, bool) {
+	score, ok := z.dict[member]
+	if !ok {
+		return 0, false
+	}
+	rank := z.sl.Rank(score, member)
+	if rev {
+		rank = z.Len() - 1 - rank
+	}
+	return rank, true
+}
+
+// Slice возвращает элементы с позиций [start, stop] (индексы уже нормализованы).
+func (z *zset) Slice(start, stop int, rev bool) []ZMember {
+	out := make([]ZMember, 0, stop-start+1)
+	if rev {
+		start, stop = z.Len()-1-stop, z.Len()-1-start
+	}
+	x := z.sl.ByRank(start)
+	for i := start; i <= stop && x != nil; i++ {
+		out = append(out, ZMember{x.member, x.score})
+		x = x.level[0].forward
+	}
+	if rev {
+		for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+			out[i], out[j] = out[j], out[i]
+		}
+	}
+	return out
+}
+
+// Range возвращает элементы из диапазона r, пропустив offset
+// и взяв не больше count (count < 0 — без ограничения).
+func (z *zset) Range(r zrange, rev bool, offset, count int) []ZMember {
+	var x *skiplistNode
+	if rev {
+		x = z.sl.Last(r)
+	} else {
+		x = z.sl.First(r)
+	}
+
+	next := func(n *skiplistNode) *skiplistNode {
+		if rev {
+			return n.backward
+		}
+		return n.level[0].forward
+	}
+
+	for ; x != nil && offset > 0; offset-- {
+		x = next(x)
+	}
+
+	out := []ZMember{}
+	for ; x != nil && count != 0; count-- {
+		if rev && !r.aboveMin(x) || !rev && !r.belowMax(x) {
+			break
+		}
+		out = append(out, ZMember{x.member, x.score})
+		x = next(x)
+	}
+	return out
+}
+
+// Count возвращает число элементов в диапазоне r.
+func (z *zset) Count(r zrange) int {
+	first := z.sl.First(r)
+	if first == nil {
+		return 0
+	}
+	last := z.sl.Last(r)
+	return z.sl.Rank(last.score, last.member) - z.sl.Rank(first.score, first.member) + 1
+}
+
+// Pop извлекает до count элементов с наименьшим (или наибольшим) score.
+func (z *zset) Pop(count int, max bool) []ZMember {
+	count = min(count, z.Len())
+	out := make([]ZMember, 0, count)
+	for i := 0; i < count; i++ {
+		x := z.sl.head.level[0].forward
+		if max {
+			x = z.sl.tail
+		}
+		out = append(out, ZMember{x.member, x.score})
+		z.Remove(x.member)
+	}
+	return out
+}
+
+// Members возвращает все элементы по возрастанию score.
+func (z *zset) Members() []ZMember {
+	if z.Len() == 0 {
+		return []ZMember{}
+	}
+	return z.Slice(0, z.Len()-1, false)
+}
+
+// === Диапазоны ===
+
+// zrange — диапазон для выборок по skiplist (по score или лексикографический).
+type zrange interface {
+	aboveMin(n *skiplistNode) bool
+	belowMax(n *skiplistNode) bool
+}
+
+// ScoreRange — диапазон по score. Бесконечности задаются math.Inf.
+type ScoreRange struct {
+	Min, Max                   float64
+	MinExclusive, MaxExclusive bool
+}
+
+func (r ScoreRange) aboveMin(n *skiplistNode) bool {
+	if r.MinExclusive {
+		return n.score > r.Min
+	}
+	return n.score >= r.Min
+}
+
+func (r ScoreRange) belowMax(n *skiplistNode) bool {
+	if r.MaxExclusive {
+		return n.score < r.Max
+	}
+	return n.score <= r.Max
+}
+
+// LexRange — лексикографический диапазон по member (для элементов
+// с одинаковым score). NoMin/NoMax — границы "-" и "+".
+type LexRange struct {
+	Min, Max                   string
+	MinExclusive, MaxExclusive bool
+	NoMin, NoMax               bool
+}
+
+func (r LexRange) aboveMin(n *skiplistNode) bool {
+	switch {
+	case r.NoMin:
+		return true
+	case r.MinExclusive:
+		return n.member > r.Min
+	default:
+		return n.member >= r.Min
+	}
+}
+
+func (r LexRange) belowMax(n *skiplistNode) bool {
+	switch {
+	case r.NoMax:
+		return true
+	case r.MaxExclusive:
+		return n.member < r.Max
+	default:
+		return n.member <= r.Max
+	}
+}
+
+// ParseScoreRange разбирает границы в синтаксисе Redis: 1.5, (1.5, -inf, +inf.
+func ParseScoreRange(min, max string) (ScoreRange, error) {
+	var (
+		r   ScoreRange
+		err error
+	)
+	if r.Min, r.MinExclusive, err = parseScoreBound(min); err != nil {
+		return r, err
+	}
+	if r.Max, r.MaxExclusive, err = parseScoreBound(max); err != nil {
+		return r, err
+	}
+	return r, nil
+}
+
+func parseScoreBound(s string) (float64, bool, error) {
+	exclusive := strings.HasPrefix(s, "(")
+	if exclusive {
+		s = s[1:]
+	}
+	score, err := ParseScore(s)
+	if err != nil {
+		return 0, false, ErrScoreRange
+	}
+	return score, exclusive, nil
+}
+
+// ParseLexRange разбирает границы в синтаксисе Redis: [a, (a, -, +.
+func ParseLexRange(min, max string) (LexRange, error) {
+	var (
+		r  LexRange
+		ok bool
+	)
+	if r.Min, r.MinExclusive, r.NoMin, ok = parseLexBound(min, "-"); !ok {
+		return r, ErrLexRange
+	}
+	if r.Max, r.MaxExclusive, r.NoMax, ok = parseLexBound(max, "+"); !ok {
+		return r, ErrLexRange
+	}
+	// "+" снизу или "-" сверху — заведомо пустой диапазон
+	if min == "+" || max == "-" {
+		r.NoMin, r.NoMax = false, false
+		r.Min, r.Max, r.MinExclusive = "", "", true
+	}
+	return r, nil
+}
+
+func parseLexBound(s, unbounded string) (value string, exclusive, none, ok bool) {
+	switch {
+	case s == unbounded:
+		return "", false, true, true
+	case s == "+" || s == "-":
+		return "", false, false, true
+	case strings.HasPrefix(s, "["):
+		return s[1:], false, false, true
+	case strings.HasPrefix(s, "("):
+		return s[1:], true, false, true
+	}
+	return "", false, false, false
+}
+
+// ParseScore разбирает score. NaN не допускается.
+func ParseScore(s string) (float64, error) {
+	score, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(score) {
+		return 0, ErrNotFloat
+	}
+	return score, nil
+}
+
+// FormatScore форматирует score так, как его отдаёт Redis (inf, -inf, 1.5).
+// Кратчайшее представление однозначно читается обратно ParseScore.
+func FormatScore(score float64) string {
+	switch {
+	case math.IsInf(score, 1):
+		return "inf"
+	case math.IsInf(score, -1):
+		return "-inf"
+	}
+	return strconv.FormatFloat(score, 'g', -1, 64)
+}
@@ -0,0 +1,117 @@
+package storage
+
+/*
+	Glob-шаблоны в семантике Redis (stringmatchlen из util.c) — для KEYS,
+	SCAN, HSCAN/SSCAN/ZSCAN и PSUBSCRIBE.
+
+	В отличие от filepath.Match:
+	  - '/' — обычный символ: "user*" совпадает с "user/1/x";
+	  - сравнение побайтовое: '?' — один байт, а не руна;
+	  - некорректный шаблон не ошибка: незакрытый '[' длится до конца
+	    шаблона, '\' в конце совпадает сам с собой;
+	  - диапазон можно писать в любом порядке: [z-a] = [a-z].
+*/
+
+// maxMatchNesting — защита от шаблонов вида "*a*a*a*...".
+const maxMatchNesting = 1000
+
+// StringMatch сообщает, совпадает ли str с glob-шаблоном Redis:
+// '*' — любая последовательность байт, '?' — один байт, [abc], [a-z],
+// [^x] — класс, '\' экранирует следующий символ.
+func StringMatch(pattern, str string) bool {
+	skipLonger := false
+	return stringMatch(pattern, str, &skipLonger, 0)
+}
+
+// stringMatch — перенос stringmatchlen_impl. skipLonger: если хвост шаблона
+// после '*' не нашёлся ни с какой позиции строки, более ранние '*'
+// не помогут — перебор можно прекращать (иначе "a*a*a*...b" экспоненциален).
+func stringMatch(pattern, str string, skipLonger *bool, nesting int) bool {
+	if nesting > maxMatchNesting {
+		return false
+	}
+
+	for len(pattern) > 0 && len(str) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 1 && pattern[1] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 1 {
+				return true
+			}
+			for len(str) > 0 {
+				if stringMatch(pattern[1:], str, skipLonger, nesting+1) {
+					return true
+				}
+				if *skipLonger {
+					return false
+				}
+				str = str[1:]
+			}
+			*skipLonger = true
+			return false
+
+		case '?':
+			str = str[1:]
+
+		case '[':
+			pattern = pattern[1:]
+			not := len(pattern) > 0 && pattern[0] == '^'
+			if not {
+				pattern = pattern[1:]
+			}
+			match := false
+			for len(pattern) > 0 && pattern[0] != ']' {
+				switch {
+				case pattern[0] == '\\' && len(pattern) >= 2:
+					pattern = pattern[1:]
+					if pattern[0] == str[0] {
+						match = true
+					}
+				case len(pattern) >= 3 && pattern[1] == '-':
+					lo, hi := pattern[0], pattern[2]
+					if lo > hi {
+						lo, hi = hi, lo
+					}
+					if str[0] >= lo && str[0] <= hi {
+						match = true
+					}
+					pattern = pattern[2:]
+				case pattern[0] == str[0]:
+					match = true
+				}
+				pattern = pattern[1:]
+			}
+			if match == not {
+				return false
+			}
+			str = str[1:]
+			// Незакрытый класс дочитан до конца шаблона — ']' пропускать нечего
+			if len(pattern) == 0 {
+				continue
+			}
+
+		case '\\':
+			if len(pattern) >= 2 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+
+		default:
+			if pattern[0] != str[0] {
+				return false
+			}
+			str = str[1:]
+		}
+
+		pattern = pattern[1:]
+		if len(str) == 0 {
+			for len(pattern) > 0 && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+			break
+		}
+	}
+	return len(pattern) == 0 && len(str) == 0
+}
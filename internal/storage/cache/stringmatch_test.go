@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestStringMatch — поведение stringmatchlen из Redis (util.c и
+// tests/unit/keyspace.tcl), включая случаи, где filepath.Match расходится.
+func TestStringMatch(t *testing.T) {
+	tests := []struct {
+		pattern, str string
+		want         bool
+	}{
+		// '*' и '?'
+		{"*", "anything", true},
+		{"*", "", false}, // как stringmatchlen; KEYS * обрабатывается отдельно
+		{"a*", "a", true},
+		{"*a", "", false},
+		{"h*llo", "hllo", true},
+		{"h*llo", "heeeello", true},
+		{"h*llo", "hellox", false},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"**a**", "bab", true},
+
+		// '/' — обычный символ (filepath.Match: false)
+		{"user*", "user/1/x", true},
+		{"user/*", "user/1/x", true},
+		{"*/profile", "user/1/profile", true},
+
+		// Классы
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-b]llo", "hbllo", true},
+		{"h[a-b]llo", "hcllo", false},
+		{"h[b-a]llo", "hallo", true}, // обратный диапазон
+		{"[\\]]", "]", true},
+		{"[\\-]", "-", true},
+		{"[a-]", "]", true}, // "a-]" — диапазон до ']', класс не закрыт
+		{"[abc", "c", true}, // незакрытый класс длится до конца шаблона
+		{"[abc", "d", false},
+		{"x[", "x", false},
+
+		// Экранирование
+		{"h\\*llo", "h*llo", true},
+		{"h\\*llo", "hello", false},
+		{"\\?", "?", true},
+		{"\\?", "a", false},
+		{"\\", "\\", true}, // одиночный '\' в конце совпадает сам с собой
+		{"a\\", "a\\", true},
+
+		// Побайтовое сравнение
+		{"?", "é", false}, // два байта UTF-8
+		{"??", "é", true},
+		{"caf?", "café", false},
+		{"caf??", "café", true},
+		{"[\xc3]*", "é", true},
+	}
+	for _, tt := range tests {
+		if got := StringMatch(tt.pattern, tt.str); got != tt.want {
+			t.Errorf("StringMatch(%q, %q) = %v, want %v", tt.pattern, tt.str, got, tt.want)
+		}
+	}
+}
+
+// TestStringMatchNestedStars — регрессия Redis: шаблон "a*a*a*...b"
+// на длинной строке из 'a' не должен перебирать экспоненциально.
+func TestStringMatchNestedStars(t *testing.T) {
+	pattern := strings.Repeat("a*", 100) + "b"
+	str := strings.Repeat("a", 10000)
+
+	start := time.Now()
+	if StringMatch(pattern, str) {
+		t.Fatal("pattern must not match")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("match took %v", elapsed)
+	}
+}
+
+func TestKeysGlob(t *testing.T) {
+	c := New(&mockPersistence{})
+	defer c.Close()
+
+	c.Set("user/1/name", "a", 0, false)
+	c.Set("user*", "b", 0, false)
+	c.Set("", "empty", 0, false)
+
+	if got := c.Keys("user/*"); len(got) != 1 || got[0] != "user/1/name" {
+		t.Fatalf("Keys(user/*) = %v", got)
+	}
+	if got := c.Keys("user\\*"); len(got) != 1 || got[0] != "user*" {
+		t.Fatalf("Keys(user\\*) = %v", got)
+	}
+	if got := c.Keys("*"); len(got) != 3 {
+		t.Fatalf("Keys(*) = %v, want all 3 keys including empty", got)
+	}
+}
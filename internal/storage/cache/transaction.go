@@ -0,0 +1,204 @@
+package storage
+
+import (
+	"log"
+	"time"
+)
+
+/*
+	Транзакции MULTI/EXEC и оптимистичные блокировки WATCH.
+
+	Атомарность обеспечивает gate: обычные команды сервера выполняются
+	под Shared (read lock), EXEC — под Exec (write lock). Пока идёт
+	EXEC, остальные клиенты ждут, а ожидающие BLPOP/BLMOVE не забирают
+	элементы посреди транзакции.
+
+	Записи AOF внутри Exec обрамляются маркерами MULTI/EXEC —
+	при replay незавершённая группа отбрасывается целиком.
+
+	WATCH — счётчики версий в шардах. Счётчик заводится только для ключей,
+	за которыми кто-то следит, и растёт при каждом изменении ключа.
+*/
+
+// watchedKey — счётчик изменений ключа под WATCH.
+type watchedKey struct {
+	refs    int    // сколько наблюдателей следят за ключом
+	version uint64 // растёт при каждом изменении ключа
+}
+
+// Watch — снимок ключа на момент WATCH.
+type Watch struct {
+	key     string
+	version uint64
+	live    bool
+}
+
+// Shared выполняет fn параллельно с другими Shared, но не во время Exec.
+func (c *Cache) Shared(fn func()) {
+	c.gate.RLock()
+	defer c.gate.RUnlock()
+	fn()
+}
+
+// Exec выполняет fn атомарно относительно Shared-вызовов и блокирующих
+// операций, если ни один ключ из watches не изменился (иначе — false).
+// fn получает копию кеша, записи AOF которой образуют одну группу и не
+// ждут fsync по одной: durability группы Exec ждёт один раз, на записи
+// EXEC и уже отпустив gate. Остальные вызовы, включая встраиваемый API
+// мимо gate, ждут свои записи как обычно. Внутри fn нельзя вызывать
+// Shared и Exec. Ошибка — сбой записи AOF: fn уже выполнена, но группа
+// может не пережить рестарт; такой сбой пишется в лог и учитывается
+// в ExecWriteErrors.
+func (c *Cache) Exec(watches []Watch, fn func(c *Cache)) (bool, error) {
+	c.gate.Lock()
+	if c.Touched(watches) {
+		c.gate.Unlock()
+		return false, nil
+	}
+
+	c.persister.Write("MULTI", "", "", 0)
+	fn(&Cache{core: c.core, persister: groupPersistence{c.persister}})
+	wait := c.persister.Write("EXEC", "", "", 0)
+	c.gate.Unlock()
+
+	if err := c.durable(nil, wait); err != nil {
+		c.execWriteErrors.Add(1)
+		log.Printf("EXEC applied but not durable: %v", err)
+		return true, err
+	}
+	return true, nil
+}
+
+// ExecWriteErrors — сколько Exec выполнено, но не записано в AOF.
+func (c *Cache) ExecWriteErrors() int64 {
+	return c.execWriteErrors.Load()
+}
+
+// groupPersistence — журнал копии кеша внутри Exec: записи ставятся
+// в очередь, ждать нечего. Writer пишет их по порядку, поэтому их
+// покрывает ожидание записи EXEC.
+type groupPersistence struct {
+	Persistence
+}
+
+func (p groupPersistence) Write(cmd, key, value string, duration time.Duration) func() error {
+	p.Persistence.Write(cmd, key, value, duration)
+	return nil
+}
+
+func (p groupPersistence) WriteAt(cmd, key, value string, expireAt int64) func() error {
+	p.Persistence.WriteAt(cmd, key, value, expireAt)
+	return nil
+}
+
+// writeGroup пишет записи одной команды группой MULTI/EXEC: replay
+// применит их все или ни одной. Группы не должны вкладываться друг
+// в друга: вызывающий держит Shared, поэтому Exec и commit исключены,
+// а конкурентные группы упорядочивает groups. Внутри Exec группа уже
+// открыта — записи идут в неё. Возвращает ожидание записи EXEC.
+func (c *Cache) writeGroup(write func()) func() error {
+	if _, inExec := c.persister.(groupPersistence); inExec {
+		write()
+		return nil
+	}
+
+	c.groups.Lock()
+	defer c.groups.Unlock()
+	c.persister.Write("MULTI", "", "", 0)
+	write()
+	return c.persister.Write("EXEC", "", "", 0)
+}
+
+// durable возвращает err команды, а если его нет — ждёт durability её
+// последней записи AOF (wait из Persistence). Вызывается после снятия
+// блокировок шардов, чтобы fsync не держал шард и записи по одному ключу
+// попадали в общий group commit.
+func (c *Cache) durable(err error, wait func() error) error {
+	if err != nil || wait == nil {
+		return err
+	}
+	return wait()
+}
+
+// Watch начинает следить за ключами. Снимки передаются в Touched и Unwatch.
+func (c *Cache) Watch(keys ...string) []Watch {
+	watches := make([]Watch, len(keys))
+	for i, key := range keys {
+		s := c.getShard(key)
+		c.promote(s, key)
+
+		s.Lock()
+		watches[i] = s.watchLocked(key)
+		s.Unlock()
+	}
+	return watches
+}
+
+// watchLocked регистрирует наблюдателя ключа и снимает его версию (write lock).
+func (s *shard) watchLocked(key string) Watch {
+	if s.watched == nil {
+		s.watched = make(map[string]*watchedKey)
+	}
+	w := s.watched[key]
+	if w == nil {
+		w = &watchedKey{}
+		s.watched[key] = w
+	}
+	w.refs++
+	_, live := s.liveRLocked(key)
+	return Watch{key: key, version: w.version, live: live}
+}
+
+// Unwatch перестаёт следить за ключами.
+func (c *Cache) Unwatch(watches []Watch) {
+	for _, watch := range watches {
+		s := c.getShard(watch.key)
+		s.Lock()
+		if w := s.watched[watch.key]; w != nil {
+			if w.refs--; w.refs == 0 {
+				delete(s.watched, watch.key)
+			}
+		}
+		s.Unlock()
+	}
+}
+
+// Touched сообщает, изменился ли хоть один ключ после Watch —
+// включая удаление по истечении TTL.
+func (c *Cache) Touched(watches []Watch) bool {
+	for _, watch := range watches {
+		s := c.getShard(watch.key)
+		s.RLock()
+		touched := s.touchedLocked(watch)
+		s.RUnlock()
+
+		if touched {
+			return true
+		}
+	}
+	return false
+}
+
+// touchedLocked — то же для одного ключа под read или write lock шарда.
+func (s *shard) touchedLocked(watch Watch) bool {
+	w := s.watched[watch.key]
+	_, live := s.liveRLocked(watch.key)
+	return w == nil || w.version != watch.version || live != watch.live
+}
+
+// touchLocked отмечает изменение ключа для WATCH (write lock).
+func (s *shard) touchLocked(key string) {
+	if len(s.watched) == 0 {
+		return
+	}
+	if w := s.watched[key]; w != nil {
+		w.version++
+	}
+}
+
+// touchAllLocked отмечает изменение всех наблюдаемых ключей шарда (FLUSHDB).
+func (s *shard) touchAllLocked() {
+	for _, w := range s.watched {
+		w.version++
+	}
+}
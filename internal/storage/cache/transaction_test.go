@@ -0,0 +1,188 @@
+package storage
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWatchTouched(t *testing.T) {
+	c := New(&mockPersistence{})
+	defer c.Close()
+
+	c.Set("str", "v", 0, false)
+	c.HSet("h", "f", "v")
+	c.SAdd("s", "a")
+
+	tests := []struct {
+		name   string
+		key    string
+		modify func()
+		want   bool
+	}{
+		{"untouched", "str", func() { c.Get("str") }, false},
+		{"set", "str", func() { c.Set("str", "w", 0, false) }, true},
+		{"hset", "h", func() { c.HSet("h", "f", "x") }, true},
+		{"hdel missing field", "h", func() { c.HDel("h", "nope") }, false},
+		{"srem last member", "s", func() { c.SRem("s", "a") }, true},
+		{"create", "new", func() { c.LPush("new", "x") }, true},
+		{"expire", "str", func() { c.Expire("str", time.Hour) }, true},
+		{"rename dst", "dst", func() { c.Rename("str", "dst") }, true},
+		{"flushdb", "h", func() { c.FlushDB() }, true},
+	}
+	for _, tt := range tests {
+		watches := c.Watch(tt.key)
+		tt.modify()
+		if got := c.Touched(watches); got != tt.want {
+			t.Errorf("%s: Touched = %v, want %v", tt.name, got, tt.want)
+		}
+		c.Unwatch(watches)
+	}
+
+	// Счётчики существуют только пока за ключом следят
+	for _, s := range c.shards {
+		if len(s.watched) != 0 {
+			t.Fatal("Unwatch must drop version counters")
+		}
+	}
+}
+
+func TestExecGroupsAOF(t *testing.T) {
+	rec := &recordPersistence{}
+	c := New(rec)
+	defer c.Close()
+
+	watches := c.Watch("k")
+	c.Set("k", "other", 0, false)
+	if ok, _ := c.Exec(watches, func(tx *Cache) { tx.Set("k", "tx", 0, false) }); ok {
+		t.Fatal("Exec must fail after a watched key changed")
+	}
+	c.Unwatch(watches)
+
+	if ok, err := c.Exec(nil, func(tx *Cache) {
+		tx.Set("a", "1", 0, false)
+		tx.RPush("l", "x", "y")
+		tx.LMove("l", "m", true, false) // без вложенной группы
+		// Запись мимо копии (встраиваемый API) ждёт свой fsync
+		c.Set("b", "2", 0, false)
+	}); !ok || err != nil {
+		t.Fatal("Exec without watches must succeed")
+	}
+
+	var cmds []string
+	for _, e := range rec.entries {
+		cmds = append(cmds, e.cmd)
+	}
+	if want := []string{"SET", "MULTI", "SET", "RPUSH", "LPOP", "RPUSH", "SET", "EXEC"}; !reflect.DeepEqual(cmds, want) {
+		t.Fatalf("AOF = %v, want %v", cmds, want)
+	}
+	// Группа ждёт fsync один раз — на записи EXEC
+	if want := []string{"SET", "SET", "EXEC"}; !reflect.DeepEqual(rec.waited, want) {
+		t.Fatalf("waited = %v, want %v", rec.waited, want)
+	}
+}
+
+func TestTxUpdate(t *testing.T) {
+	rec := &recordPersistence{}
+	c := New(rec)
+	defer c.Close()
+
+	c.Set("balance", "100", 0, false)
+
+	// Ошибка fn откатывает все записи
+	errNoFunds := errors.New("no funds")
+	err := c.Update(func(tx *Tx) error {
+		tx.Set("order", "1", 0)
+		if n, _ := tx.IncrBy("balance", -500); n < 0 {
+			return errNoFunds
+		}
+		return nil
+	})
+	if err != errNoFunds {
+		t.Fatalf("Update err = %v", err)
+	}
+	if v, _ := c.Get("balance"); v != "100" || c.Exists("order") != 0 {
+		t.Fatalf("rollback failed: balance=%s order=%d", v, c.Exists("order"))
+	}
+
+	err = c.Update(func(tx *Tx) error {
+		n, err := tx.IncrBy("balance", -30)
+		if err != nil {
+			return err
+		}
+		if v, _ := tx.Get("balance"); v != "70" || n != 70 {
+			t.Errorf("read-your-writes: %s, %d", v, n)
+		}
+		tx.Set("order", "1", time.Hour)
+		return tx.Del("cart")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := c.Get("balance"); v != "70" {
+		t.Fatalf("balance = %s, want 70", v)
+	}
+	if ttl := c.GetTTL("order"); ttl <= 0 {
+		t.Fatalf("order TTL = %d", ttl)
+	}
+
+	if err := c.View(func(tx *Tx) error { return tx.Set("x", "1", 0) }); err != ErrTxReadOnly {
+		t.Fatalf("Set in View: err = %v", err)
+	}
+	c.HSet("h", "f", "v")
+	if err := c.Update(func(tx *Tx) error { _, err := tx.Incr("h"); return err }); err != ErrWrongType {
+		t.Fatalf("Incr on hash: err = %v", err)
+	}
+
+	// Журнал: успешная транзакция — одна группа, откаченные не пишутся
+	restored := New(&mockPersistence{})
+	defer restored.Close()
+	rec.replayInto(restored)
+	if v, _ := restored.Get("balance"); v != "70" || restored.Exists("order") != 1 {
+		t.Fatalf("replayed balance=%s order=%d", v, restored.Exists("order"))
+	}
+}
+
+// TestTxConflict — параллельные Update с чтением и записью одних ключей
+// не теряют обновлений: конфликтующая транзакция перезапускается.
+func TestTxConflict(t *testing.T) {
+	c := New(&mockPersistence{})
+	defer c.Close()
+
+	const workers, rounds = 8, 200
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < rounds; i++ {
+				// Перевод между счетами в разных шардах в разном порядке
+				from, to := "acc:a", "acc:b"
+				if (w+i)%2 == 0 {
+					from, to = to, from
+				}
+				c.Update(func(tx *Tx) error {
+					tx.IncrBy(from, -1)
+					tx.IncrBy(to, 1)
+					_, err := tx.Incr("transfers")
+					return err
+				})
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	a, _ := c.Get("acc:a")
+	b, _ := c.Get("acc:b")
+	na, _ := strconv.Atoi(a)
+	nb, _ := strconv.Atoi(b)
+	if na+nb != 0 {
+		t.Fatalf("acc:a + acc:b = %d, want 0", na+nb)
+	}
+	if v, _ := c.Get("transfers"); v != strconv.Itoa(workers*rounds) {
+		t.Fatalf("transfers = %s, want %d", v, workers*rounds)
+	}
+}
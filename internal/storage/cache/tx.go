@@ -0,0 +1,258 @@
+package storage
+
+import (
+	"math"
+	"strconv"
+	"time"
+)
+
+/*
+	Встраиваемые транзакции (Update/View) в стиле bbolt.
+
+	Транзакция оптимистичная: чтение сначала регистрирует WATCH на ключ,
+	потом берёт значение (запись между ними даст лишний конфликт, но не
+	потерю обновления), записи копятся в буфере. При commit шарды всех
+	ключей блокируются в порядке номеров (см. lockShards) — дедлок
+	невозможен; если прочитанный ключ успели изменить, буфер
+	отбрасывается и fn вызывается заново.
+
+	Commit идёт под gate, как EXEC: записи попадают в AOF одной группой
+	MULTI/EXEC и не перемешиваются с транзакциями TCP-клиентов.
+*/
+
+// Tx — транзакция над строковыми ключами. Действительна только внутри fn.
+type Tx struct {
+	c        *Cache
+	readOnly bool
+	reads    map[string]Watch
+	writes   map[string]txWrite
+	order    []string // порядок первых записей ключей — для AOF
+}
+
+// txWrite — отложенная запись: новое значение или удаление.
+type txWrite struct {
+	value    string
+	expireAt int64 // 0 — без TTL
+	del      bool
+}
+
+// Update выполняет fn в пишущей транзакции. Ошибка fn откатывает все
+// записи. При конфликте с параллельной записью fn вызывается повторно,
+// поэтому она не должна иметь побочных эффектов вне tx.
+func (c *Cache) Update(fn func(tx *Tx) error) error {
+	return c.runTx(fn, false)
+}
+
+// View выполняет fn в читающей транзакции: все чтения видят одно
+// согласованное состояние. Set/Del/Incr возвращают ErrTxReadOnly.
+func (c *Cache) View(fn func(tx *Tx) error) error {
+	return c.runTx(fn, true)
+}
+
+func (c *Cache) runTx(fn func(tx *Tx) error, readOnly bool) error {
+	for {
+		tx := &Tx{
+			c:        c,
+			readOnly: readOnly,
+			reads:    make(map[string]Watch),
+			writes:   make(map[string]txWrite),
+		}
+		err := fn(tx)
+		committed := false
+		if err == nil {
+			committed, err = c.commit(tx)
+		}
+		tx.release()
+		if err != nil || committed {
+			return err
+		}
+	}
+}
+
+// Get возвращает значение ключа с учётом записей этой транзакции.
+func (tx *Tx) Get(key string) (string, bool) {
+	w, found, _ := tx.get(key)
+	return w.value, found
+}
+
+// Set записывает значение (ttl = 0 — без TTL).
+func (tx *Tx) Set(key, value string, ttl time.Duration) error {
+	if tx.readOnly {
+		return ErrTxReadOnly
+	}
+	var expireAt int64
+	if ttl > 0 {
+		expireAt = time.Now().Add(ttl).UnixNano()
+	}
+	tx.write(key, txWrite{value: value, expireAt: expireAt})
+	return nil
+}
+
+// Del удаляет ключи.
+func (tx *Tx) Del(keys ...string) error {
+	if tx.readOnly {
+		return ErrTxReadOnly
+	}
+	for _, key := range keys {
+		tx.write(key, txWrite{del: true})
+	}
+	return nil
+}
+
+// Incr увеличивает числовое значение на 1.
+func (tx *Tx) Incr(key string) (int64, error) {
+	return tx.IncrBy(key, 1)
+}
+
+// IncrBy прибавляет delta к числовому значению. Отсутствующий ключ — 0.
+func (tx *Tx) IncrBy(key string, delta int64) (int64, error) {
+	if tx.readOnly {
+		return 0, ErrTxReadOnly
+	}
+
+	w, found, err := tx.get(key)
+	if err != nil {
+		return 0, err
+	}
+	var current int64
+	if found {
+		if current, err = strconv.ParseInt(w.value, 10, 64); err != nil {
+			return 0, err
+		}
+	}
+	if (delta > 0 && current > math.MaxInt64-delta) || (delta < 0 && current < math.MinInt64-delta) {
+		return 0, ErrOverflow
+	}
+	current += delta
+
+	// Как INCR: TTL ключа сохраняется
+	w.value, w.del = strconv.FormatInt(current, 10), false
+	tx.write(key, w)
+	return current, nil
+}
+
+// get читает ключ: из буфера записей или из кеша с регистрацией WATCH.
+func (tx *Tx) get(key string) (txWrite, bool, error) {
+	if w, ok := tx.writes[key]; ok {
+		return w, !w.del, nil
+	}
+	if _, ok := tx.reads[key]; !ok {
+		tx.reads[key] = tx.c.Watch(key)[0]
+	}
+	return tx.c.readString(key)
+}
+
+func (tx *Tx) write(key string, w txWrite) {
+	if _, ok := tx.writes[key]; !ok {
+		tx.order = append(tx.order, key)
+	}
+	tx.writes[key] = w
+}
+
+// release снимает WATCH с прочитанных ключей.
+func (tx *Tx) release() {
+	watches := make([]Watch, 0, len(tx.reads))
+	for _, w := range tx.reads {
+		watches = append(watches, w)
+	}
+	tx.c.Unwatch(watches)
+}
+
+// readString читает строковое значение ключа и его TTL
+// (ErrWrongType — ключ другого типа).
+func (c *Cache) readString(key string) (txWrite, bool, error) {
+	s := c.getShard(key)
+	s.RLock()
+	defer s.RUnlock()
+
+	item, ok := s.liveRLocked(key)
+	if !ok {
+		return txWrite{}, false, nil
+	}
+	if item.Kind != KindString {
+		return txWrite{}, false, ErrWrongType
+	}
+	return txWrite{value: item.Value, expireAt: item.ExpireAt}, true, nil
+}
+
+// commit проверяет, что прочитанные ключи не изменились, и применяет
+// буфер записей. false — конфликт, транзакцию нужно повторить; ошибка
+// (ErrOOM) — транзакция не применена; true с ошибкой — применена, но
+// запись AOF не удалась. Durability группы ждём один раз, на записи EXEC,
+// уже отпустив шарды и gate.
+func (c *Cache) commit(tx *Tx) (bool, error) {
+	keys := make([]string, 0, len(tx.reads)+len(tx.order))
+	for key := range tx.reads {
+		keys = append(keys, key)
+	}
+	keys = append(keys, tx.order...)
+
+	// Только чтения: достаточно проверить версии под read lock
+	if len(tx.order) == 0 {
+		unlock := c.rlockShards(keys...)
+		defer unlock()
+		return !c.touchedLocked(tx), nil
+	}
+
+	for _, key := range tx.order {
+		if tx.writes[key].del {
+			continue
+		}
+		if err := c.reserve(c.getShard(key), key); err != nil {
+			return false, err
+		}
+	}
+
+	c.gate.Lock()
+	unlock := c.lockShards(keys...)
+	if c.touchedLocked(tx) {
+		unlock()
+		c.gate.Unlock()
+		return false, nil
+	}
+
+	var delta int64
+	c.persister.Write("MULTI", "", "", 0)
+	for _, key := range tx.order {
+		s, w := c.getShard(key), tx.writes[key]
+		if w.del {
+			if item, exists := s.items[key]; exists {
+				s.removeLocked(item)
+				delta--
+			}
+			c.persister.Write("DEL", key, "", 0)
+			continue
+		}
+		if s.setLocked(key, w.value, w.expireAt) {
+			delta++
+		}
+		var ttl time.Duration
+		if w.expireAt > 0 {
+			// Не меньше 1ns: нулевой TTL в журнале означает «без TTL»
+			ttl = max(time.Duration(w.expireAt-time.Now().UnixNano()), 1)
+		}
+		c.persister.Write("SET", key, w.value, ttl)
+	}
+	wait := c.persister.Write("EXEC", "", "", 0)
+	unlock()
+
+	c.totalKeys.Add(delta)
+	if c.cold != nil {
+		for _, key := range tx.order {
+			c.cold.Delete(key)
+		}
+	}
+	c.gate.Unlock()
+
+	return true, c.durable(nil, wait)
+}
+
+// touchedLocked — изменился ли хоть один прочитанный ключ (шарды захвачены).
+func (c *Cache) touchedLocked(tx *Tx) bool {
+	for key, watch := range tx.reads {
+		if c.getShard(key).touchedLocked(watch) {
+			return true
+		}
+	}
+	return false
+}
@@ -2,7 +2,7 @@ package storage
 
 import (
 	"runtime"
-
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -47,21 +47,45 @@ func (m *SpinRWMutex) Unlock() {
 }
 
 
-// Persistence — интерфейс для персистенции данных
+// Persistence — интерфейс для персистенции данных.
+// Write ставит запись в журнал и не ждёт её durability: кеш вызывает его
+// под блокировкой шарда, а возвращённое ожидание (nil — ждать нечего)
+// вызывает уже после снятия блокировок.
 type Persistence interface {
-	Write(cmd, key, value string, duration time.Duration) error
+	Write(cmd, key, value string, duration time.Duration) func() error
+	// WriteAt — то же с абсолютным временем истечения (нс, 0 = без TTL):
+	// EXPIREAT и перенос TTL не должны «плыть» на задержку записи.
+	WriteAt(cmd, key, value string, expireAt int64) func() error
 }
 
 
+// Kind — тип значения, хранящегося в элементе кеша.
+type Kind uint8
+
+const (
+	KindString Kind = iota
+	KindHash
+	KindList
+	KindSet
+	KindZSet
+)
 
 
 // Item — элемент кеша
 type Item struct {
 	Key        string
-	Value      string
+	Kind       Kind
+	Value      string              // KindString
+	Hash       map[string]string   // KindHash
+	List       *deque              // KindList
+	Set        map[string]struct{} // KindSet
+	ZSet       *zset               // KindZSet
 	ExpireAt   int64
 	LastAccess int64
+	Freq       uint32 // LFU: счётчик и минута обращения (см. lfu.go)
+	Mem        int64  // приблизительный размер в байтах (см. memory.go)
 	HeapIndex  int
+	SlotIndex  int // позиция в shard.slots (для SCAN)
 }
 
 // priorityQueue — очередь с приоритетом для TTL
@@ -74,8 +98,12 @@ type priorityQueue []*Item
 // shard — один шард кеша.
 type shard struct {
 	SpinRWMutex
-	items map[string]*Item
-	pq    priorityQueue
+	items   map[string]*Item
+	slots   []*Item // те же элементы плотным массивом — курсор SCAN
+	pq      priorityQueue
+	watched map[string]*watchedKey // ключи под WATCH (см. transaction.go)
+	mem     atomic.Int64           // сумма Item.Mem
+	lfu     *lfuParams             // Cache.lfu
 }
 
 type ItemSnapshot struct {
@@ -86,24 +114,45 @@ type ItemSnapshot struct {
 
 
 
-// coldItem — элемент для передачи в cold storage через канал.
-type coldItem struct {
-	key      string
-	value    string
-	expireAt int64
+// listWaiters — клиенты, заблокированные в BLPOP/BRPOP/BLMOVE, по ключам.
+type listWaiters struct {
+	mu      sync.Mutex
+	count   atomic.Int32 // быстрый путь для push без ожидающих
+	waiters map[string]map[chan struct{}]struct{}
 }
 
 
-
-
-
-// Cache — шардированное in-memory хранилище.
+// Cache — шардированное in-memory хранилище. Состояние общее у всех
+// копий Cache, своё у копии только журнал: fn внутри Exec получает копию,
+// записи которой не ждут fsync по одной (см. Exec).
 type Cache struct {
-	shards    [shardCount]*shard
+	*core
 	persister Persistence
+}
+
+// core — общее состояние кеша.
+type core struct {
+	shards    [shardCount]*shard
 	cold      *cold.Store  
-	flushCh   chan coldItem
 	maxKeys   int64
 	totalKeys atomic.Int64
 	stopCh    chan struct{}
+	blocked   listWaiters
+	gate      sync.RWMutex // Shared/Exec для MULTI/EXEC
+	groups    sync.Mutex   // группы MULTI/EXEC под Shared (см. writeGroup)
+
+	execWriteErrors atomic.Int64 // Exec, применённые без durability
+
+	// maxmemory (см. memory.go), пул вытеснения (см. evictpool.go) и LFU (см. lfu.go)
+	maxMemory   atomic.Int64 // байт, 0 — без лимита
+	policy      atomic.Int32 // EvictionPolicy
+	evictedKeys atomic.Int64
+	pool        evictionPool
+	evicting    atomic.Bool // идёт фоновое вытеснение
+	lfu         lfuParams
+
+	// cold storage: политика и счётчики (см. coldpolicy.go)
+	coldPolicy   atomic.Pointer[ColdPolicy]
+	coldDemoted  atomic.Int64
+	coldPromoted atomic.Int64
 }
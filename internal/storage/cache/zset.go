@@ -0,0 +1,212 @@
+package storage
+
+import "math"
+
+// === Sorted set: операции уровня шарда ===
+// Функции *Locked вызываются под write lock шарда (см. list.go).
+
+// ZAddOptions — флаги ZADD.
+type ZAddOptions struct {
+	NX, XX bool // только добавлять новые / только обновлять существующие
+	GT, LT bool // обновлять, только если новый score больше / меньше текущего
+	CH     bool // считать в результате и изменённые элементы, а не только новые
+}
+
+// Aggregate — способ сложения score в ZUNIONSTORE/ZINTERSTORE.
+type Aggregate uint8
+
+const (
+	AggregateSum Aggregate = iota
+	AggregateMin
+	AggregateMax
+)
+
+// zaddLocked добавляет элементы или меняет их score с учётом opts.
+// incr = true — Score прибавляется к текущему (ZINCRBY, ZADD INCR).
+// applied — элементы с итоговым score (для AOF и ответа INCR),
+// changed — число новых и реально изменённых элементов.
+func (s *shard) zaddLocked(key string, opts ZAddOptions, incr bool, members []ZMember) (applied []ZMember, added, changed int, delta int64, err error) {
+	item, delta, err := s.typedLocked(key, KindZSet, !opts.XX)
+	if err != nil || item == nil {
+		return nil, 0, 0, delta, err
+	}
+
+	for _, m := range members {
+		cur, exists := item.ZSet.Score(m.Member)
+		if opts.NX && exists || opts.XX && !exists {
+			continue
+		}
+
+		score := m.Score
+		if incr {
+			score += cur
+			if math.IsNaN(score) {
+				err = ErrScoreNaN
+				break
+			}
+		}
+		if exists && (opts.GT && score <= cur || opts.LT && score >= cur) {
+			continue
+		}
+
+		if item.ZSet.Put(m.Member, score) {
+			s.growLocked(item, zsetMemberSize(m.Member))
+			added++
+			changed++
+		} else if score != cur {
+			changed++
+		}
+		applied = append(applied, ZMember{m.Member, score})
+	}
+
+	// NX/GT/LT могли отсеять всё — пустой ключ не оставляем
+	if item.ZSet.Len() == 0 {
+		s.removeLocked(item)
+		delta--
+	}
+	return applied, added, changed, delta, err
+}
+
+// zremLocked удаляет элементы. Пустой sorted set удаляется.
+func (s *shard) zremLocked(key string, members []string) (removed int, delta int64, err error) {
+	item, delta, err := s.typedLocked(key, KindZSet, false)
+	if err != nil || item == nil {
+		return 0, delta, err
+	}
+
+	for _, m := range members {
+		if item.ZSet.Remove(m) {
+			s.growLocked(item, -zsetMemberSize(m))
+			removed++
+		}
+	}
+
+	if item.ZSet.Len() == 0 {
+		s.removeLocked(item)
+		delta--
+	}
+	return removed, delta, nil
+}
+
+// zremRangeLocked удаляет все элементы из диапазона r.
+// Возвращает удалённые элементы (для AOF).
+func (s *shard) zremRangeLocked(key string, r zrange) (removed []string, delta int64, err error) {
+	item, delta, err := s.typedLocked(key, KindZSet, false)
+	if err != nil || item == nil {
+		return nil, delta, err
+	}
+
+	for _, m := range item.ZSet.Range(r, false, 0, -1) {
+		item.ZSet.Remove(m.Member)
+		s.growLocked(item, -zsetMemberSize(m.Member))
+		removed = append(removed, m.Member)
+	}
+
+	if item.ZSet.Len() == 0 {
+		s.removeLocked(item)
+		delta--
+	}
+	return removed, delta, nil
+}
+
+// zpopLocked извлекает до count элементов с наименьшим (max — наибольшим) score.
+func (s *shard) zpopLocked(key string, count int, max bool) (members []ZMember, delta int64, err error) {
+	item, delta, err := s.typedLocked(key, KindZSet, false)
+	if err != nil || item == nil {
+		return []ZMember{}, delta, err
+	}
+
+	members = item.ZSet.Pop(count, max)
+	for _, m := range members {
+		s.growLocked(item, -zsetMemberSize(m.Member))
+	}
+
+	if item.ZSet.Len() == 0 {
+		s.removeLocked(item)
+		delta--
+	}
+	return members, delta, nil
+}
+
+// zsetRLocked возвращает sorted set под read lock (nil, если ключа нет).
+func (s *shard) zsetRLocked(key string) (*zset, error) {
+	item, err := s.typedRLocked(key, KindZSet)
+	if err != nil || item == nil {
+		return nil, err
+	}
+	return item.ZSet, nil
+}
+
+// zsourceRLocked читает источник ZUNIONSTORE/ZINTERSTORE: sorted set
+// или обычное множество (score каждого элемента — 1). nil — ключа нет.
+func (s *shard) zsourceRLocked(key string) (map[string]float64, error) {
+	item, ok := s.liveRLocked(key)
+	if !ok {
+		return nil, nil
+	}
+
+	switch item.Kind {
+	case KindZSet:
+		return item.ZSet.dict, nil
+	case KindSet:
+		scores := make(map[string]float64, len(item.Set))
+		for m := range item.Set {
+			scores[m] = 1
+		}
+		return scores, nil
+	}
+	return nil, ErrWrongType
+}
+
+// zcombine объединяет (inter = false) или пересекает источники
+// с весами weights (nil — все веса 1) и способом сложения agg.
+func zcombine(sources []map[string]float64, weights []float64, agg Aggregate, inter bool) map[string]float64 {
+	weight := func(i int) float64 {
+		if weights == nil {
+			return 1
+		}
+		return weights[i]
+	}
+
+	result := make(map[string]float64)
+	for i, src := range sources {
+		for m, score := range src {
+			score = zweigh(score, weight(i))
+			if cur, ok := result[m]; ok {
+				result[m] = zaggregate(cur, score, agg)
+			} else if !inter || i == 0 {
+				result[m] = score
+			}
+		}
+		if inter {
+			for m := range result {
+				if _, ok := src[m]; !ok {
+					delete(result, m)
+				}
+			}
+		}
+	}
+	return result
+}
+
+// zweigh умножает score на вес; 0 * inf, как в Redis, даёт 0.
+func zweigh(score, weight float64) float64 {
+	if v := score * weight; !math.IsNaN(v) {
+		return v
+	}
+	return 0
+}
+
+func zaggregate(a, b float64, agg Aggregate) float64 {
+	switch agg {
+	case AggregateMin:
+		return math.Min(a, b)
+	case AggregateMax:
+		return math.Max(a, b)
+	}
+	// inf + -inf — NaN, Redis в этом случае сохраняет 0
+	if v := a + b; !math.IsNaN(v) {
+		return v
+	}
+	return 0
+}
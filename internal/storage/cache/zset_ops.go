@@ -0,0 +1,287 @@
+package storage
+
+// === Sorted set: Redis-совместимые операции ===
+// Изменения пишутся в AOF под блокировкой шарда, как у списков.
+// В журнал попадают итоговые score, поэтому replay детерминирован
+// независимо от флагов ZADD и инкрементов.
+
+// ZAdd добавляет элементы или обновляет их score с учётом opts.
+// Возвращает число новых элементов (с CH — новых и изменённых).
+func (c *Cache) ZAdd(key string, opts ZAddOptions, members ...ZMember) (int, error) {
+	s := c.getShard(key)
+	c.promote(s, key)
+	if err := c.reserve(s, key); err != nil {
+		return 0, err
+	}
+
+	s.Lock()
+	applied, added, changed, delta, err := s.zaddLocked(key, opts, false, members)
+	var wait func() error
+	if err == nil && changed > 0 {
+		wait = c.persister.Write("ZADD", key, encodeScores(applied), 0)
+	}
+	s.Unlock()
+
+	c.totalKeys.Add(delta)
+	if opts.CH {
+		return changed, err
+	}
+	return added, c.durable(err, wait)
+}
+
+// ZIncrBy прибавляет incr к score элемента (ZINCRBY, ZADD INCR).
+// ok = false — обновление отклонено флагами NX/XX/GT/LT.
+func (c *Cache) ZIncrBy(key string, opts ZAddOptions, member string, incr float64) (score float64, ok bool, err error) {
+	s := c.getShard(key)
+	c.promote(s, key)
+	if err = c.reserve(s, key); err != nil {
+		return 0, false, err
+	}
+
+	s.Lock()
+	applied, _, changed, delta, err := s.zaddLocked(key, opts, true, []ZMember{{member, incr}})
+	var wait func() error
+	if err == nil && changed > 0 {
+		wait = c.persister.Write("ZADD", key, encodeScores(applied), 0)
+	}
+	s.Unlock()
+
+	c.totalKeys.Add(delta)
+	if len(applied) == 0 {
+		return 0, false, err
+	}
+	return applied[0].Score, true, c.durable(err, wait)
+}
+
+// ZRem удаляет элементы. Возвращает число удалённых.
+func (c *Cache) ZRem(key string, members ...string) (int, error) {
+	s := c.getShard(key)
+	c.promote(s, key)
+
+	s.Lock()
+	removed, delta, err := s.zremLocked(key, members)
+	var wait func() error
+	if err == nil && removed > 0 {
+		wait = c.persister.Write("ZREM", key, encodeArgs(members), 0)
+	}
+	s.Unlock()
+
+	c.totalKeys.Add(delta)
+	return removed, c.durable(err, wait)
+}
+
+// ZScore возвращает score элемента.
+func (c *Cache) ZScore(key, member string) (float64, bool, error) {
+	s := c.getShard(key)
+	c.promote(s, key)
+
+	s.RLock()
+	defer s.RUnlock()
+
+	z, err := s.zsetRLocked(key)
+	if err != nil || z == nil {
+		return 0, false, err
+	}
+	score, found := z.Score(member)
+	return score, found, nil
+}
+
+// ZCard возвращает число элементов sorted set.
+func (c *Cache) ZCard(key string) (int, error) {
+	s := c.getShard(key)
+	c.promote(s, key)
+
+	s.RLock()
+	defer s.RUnlock()
+
+	z, err := s.zsetRLocked(key)
+	if err != nil || z == nil {
+		return 0, err
+	}
+	return z.Len(), nil
+}
+
+// ZRank возвращает позицию элемента по возрастанию score (rev — по убыванию)
+// вместе с его score.
+func (c *Cache) ZRank(key, member string, rev bool) (rank int, score float64, found bool, err error) {
+	s := c.getShard(key)
+	c.promote(s, key)
+
+	s.RLock()
+	defer s.RUnlock()
+
+	z, err := s.zsetRLocked(key)
+	if err != nil || z == nil {
+		return 0, 0, false, err
+	}
+	rank, found = z.Rank(member, rev)
+	score, _ = z.Score(member)
+	return rank, score, found, nil
+}
+
+// ZRange возвращает элементы с позиций [start, stop] (индексы как в LRANGE).
+// rev — позиции считаются от наибольшего score.
+func (c *Cache) ZRange(key string, start, stop int, rev bool) ([]ZMember, error) {
+	s := c.getShard(key)
+	c.promote(s, key)
+
+	s.RLock()
+	defer s.RUnlock()
+
+	z, err := s.zsetRLocked(key)
+	if err != nil || z == nil {
+		return []ZMember{}, err
+	}
+	from, to, ok := normRange(start, stop, z.Len())
+	if !ok {
+		return []ZMember{}, nil
+	}
+	return z.Slice(from, to, rev), nil
+}
+
+// ZRangeByScore возвращает элементы с score из r: пропускает offset
+// и берёт не больше count (count < 0 — все). rev — от наибольшего score.
+func (c *Cache) ZRangeByScore(key string, r ScoreRange, rev bool, offset, count int) ([]ZMember, error) {
+	return c.zrangeIn(key, r, rev, offset, count)
+}
+
+// ZRangeByLex — как ZRangeByScore, но по member в лексикографическом порядке.
+func (c *Cache) ZRangeByLex(key string, r LexRange, rev bool, offset, count int) ([]ZMember, error) {
+	return c.zrangeIn(key, r, rev, offset, count)
+}
+
+func (c *Cache) zrangeIn(key string, r zrange, rev bool, offset, count int) ([]ZMember, error) {
+	s := c.getShard(key)
+	c.promote(s, key)
+
+	s.RLock()
+	defer s.RUnlock()
+
+	z, err := s.zsetRLocked(key)
+	if err != nil || z == nil || offset < 0 {
+		return []ZMember{}, err
+	}
+	return z.Range(r, rev, offset, count), nil
+}
+
+// ZCount возвращает число элементов с score из r.
+func (c *Cache) ZCount(key string, r ScoreRange) (int, error) {
+	s := c.getShard(key)
+	c.promote(s, key)
+
+	s.RLock()
+	defer s.RUnlock()
+
+	z, err := s.zsetRLocked(key)
+	if err != nil || z == nil {
+		return 0, err
+	}
+	return z.Count(r), nil
+}
+
+// ZRemRangeByScore удаляет элементы с score из r. Возвращает число удалённых.
+func (c *Cache) ZRemRangeByScore(key string, r ScoreRange) (int, error) {
+	s := c.getShard(key)
+	c.promote(s, key)
+
+	s.Lock()
+	removed, delta, err := s.zremRangeLocked(key, r)
+	var wait func() error
+	if err == nil && len(removed) > 0 {
+		// Диапазон в журнал не пишем — только конкретные элементы
+		wait = c.persister.Write("ZREM", key, encodeArgs(removed), 0)
+	}
+	s.Unlock()
+
+	c.totalKeys.Add(delta)
+	return len(removed), c.durable(err, wait)
+}
+
+// ZPopMin извлекает до count элементов с наименьшим score.
+func (c *Cache) ZPopMin(key string, count int) ([]ZMember, error) {
+	return c.zpop(key, count, false)
+}
+
+// ZPopMax извлекает до count элементов с наибольшим score.
+func (c *Cache) ZPopMax(key string, count int) ([]ZMember, error) {
+	return c.zpop(key, count, true)
+}
+
+func (c *Cache) zpop(key string, count int, max bool) ([]ZMember, error) {
+	s := c.getShard(key)
+	c.promote(s, key)
+
+	s.Lock()
+	members, delta, err := s.zpopLocked(key, count, max)
+	var wait func() error
+	if err == nil && len(members) > 0 {
+		names := make([]string, len(members))
+		for i, m := range members {
+			names[i] = m.Member
+		}
+		wait = c.persister.Write("ZREM", key, encodeArgs(names), 0)
+	}
+	s.Unlock()
+
+	c.totalKeys.Add(delta)
+	return members, c.durable(err, wait)
+}
+
+// ZUnionStore сохраняет в dst объединение sorted sets (и обычных множеств).
+// weights — множители score по источникам (nil — все 1).
+// Возвращает число элементов результата; пустой результат удаляет dst.
+func (c *Cache) ZUnionStore(dst string, keys []string, weights []float64, agg Aggregate) (int, error) {
+	return c.zstore(dst, keys, weights, agg, false)
+}
+
+// ZInterStore сохраняет в dst пересечение sorted sets (см. ZUnionStore).
+func (c *Cache) ZInterStore(dst string, keys []string, weights []float64, agg Aggregate) (int, error) {
+	return c.zstore(dst, keys, weights, agg, true)
+}
+
+// zstore вычисляет результат и заменяет dst под write lock всех
+// задействованных шардов — как combineStore у множеств.
+func (c *Cache) zstore(dst string, keys []string, weights []float64, agg Aggregate, inter bool) (int, error) {
+	sDst := c.getShard(dst)
+	for _, key := range keys {
+		c.promote(c.getShard(key), key)
+	}
+	c.promote(sDst, dst)
+	if err := c.reserve(sDst, dst); err != nil {
+		return 0, err
+	}
+
+	unlock := c.lockShards(append([]string{dst}, keys...)...)
+
+	sources := make([]map[string]float64, len(keys))
+	for i, key := range keys {
+		src, err := c.getShard(key).zsourceRLocked(key)
+		if err != nil {
+			unlock()
+			return 0, err
+		}
+		sources[i] = src
+	}
+	result := zcombine(sources, weights, agg, inter)
+
+	var delta int64
+	if old, exists := sDst.items[dst]; exists {
+		sDst.removeLocked(old)
+		delta--
+	}
+	wait := c.persister.Write("DEL", dst, "", 0)
+
+	if len(result) > 0 {
+		item := sDst.newItemLocked(dst, KindZSet)
+		for m, score := range result {
+			item.ZSet.Put(m, score)
+		}
+		sDst.resizeLocked(item)
+		delta++
+		wait = c.persister.Write("ZADD", dst, encodeScores(item.ZSet.Members()), 0)
+	}
+	unlock()
+
+	c.totalKeys.Add(delta)
+	return len(result), c.durable(nil, wait)
+}
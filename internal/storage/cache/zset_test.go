@@ -0,0 +1,266 @@
+package storage
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+func names(members []ZMember) []string {
+	out := make([]string, len(members))
+	for i, m := range members {
+		out[i] = m.Member
+	}
+	return out
+}
+
+func TestZSetBasic(t *testing.T) {
+	c := New(&mockPersistence{})
+	defer c.Close()
+
+	n, err := c.ZAdd("lb", ZAddOptions{}, ZMember{"alice", 30}, ZMember{"bob", 10}, ZMember{"carol", 20})
+	if err != nil || n != 3 {
+		t.Fatalf("ZAdd = %d, %v", n, err)
+	}
+	if score, _, _ := c.ZIncrBy("lb", ZAddOptions{}, "bob", 25); score != 35 {
+		t.Fatalf("ZIncrBy = %v, want 35", score)
+	}
+	if rank, _, _, _ := c.ZRank("lb", "bob", true); rank != 0 {
+		t.Fatalf("ZRevRank(bob) = %d, want 0", rank)
+	}
+	if got, _ := c.ZRange("lb", 0, -1, false); !reflect.DeepEqual(names(got), []string{"carol", "alice", "bob"}) {
+		t.Fatalf("ZRange = %v", got)
+	}
+	if got, _ := c.ZRange("lb", 0, 1, true); !reflect.DeepEqual(names(got), []string{"bob", "alice"}) {
+		t.Fatalf("ZRange rev = %v", got)
+	}
+
+	popped, _ := c.ZPopMin("lb", 1)
+	if len(popped) != 1 || popped[0] != (ZMember{"carol", 20}) {
+		t.Fatalf("ZPopMin = %v", popped)
+	}
+	if n, _ := c.ZRem("lb", "alice", "bob", "nobody"); n != 2 {
+		t.Fatalf("ZRem = %d, want 2", n)
+	}
+	if c.Exists("lb") != 0 || c.CountKeys() != 0 {
+		t.Fatal("empty sorted set must be removed")
+	}
+
+	c.Set("str", "v", 0, false)
+	if _, err := c.ZAdd("str", ZAddOptions{}, ZMember{"x", 1}); err != ErrWrongType {
+		t.Fatalf("ZAdd on string: err=%v", err)
+	}
+}
+
+func TestZAddFlags(t *testing.T) {
+	c := New(&mockPersistence{})
+	defer c.Close()
+
+	c.ZAdd("z", ZAddOptions{}, ZMember{"a", 5})
+
+	tests := []struct {
+		name  string
+		opts  ZAddOptions
+		score float64
+		want  float64
+	}{
+		{"NX keeps existing", ZAddOptions{NX: true}, 1, 5},
+		{"GT rejects lower", ZAddOptions{GT: true}, 3, 5},
+		{"GT accepts higher", ZAddOptions{GT: true}, 7, 7},
+		{"LT rejects higher", ZAddOptions{LT: true}, 9, 7},
+		{"LT accepts lower", ZAddOptions{LT: true}, 2, 2},
+		{"XX updates", ZAddOptions{XX: true}, 4, 4},
+	}
+	for _, tt := range tests {
+		c.ZAdd("z", tt.opts, ZMember{"a", tt.score})
+		if got, _, _ := c.ZScore("z", "a"); got != tt.want {
+			t.Errorf("%s: score = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	if n, _ := c.ZAdd("z", ZAddOptions{CH: true}, ZMember{"a", 1}, ZMember{"b", 1}); n != 2 {
+		t.Fatalf("ZAdd CH = %d, want 2", n)
+	}
+	if n, _ := c.ZAdd("none", ZAddOptions{XX: true}, ZMember{"a", 1}); n != 0 || c.Exists("none") != 0 {
+		t.Fatal("ZAdd XX must not create a key")
+	}
+	if _, ok, _ := c.ZIncrBy("z", ZAddOptions{NX: true}, "a", 1); ok {
+		t.Fatal("ZIncrBy NX on existing member must be rejected")
+	}
+
+	c.ZAdd("inf", ZAddOptions{}, ZMember{"a", math.Inf(1)})
+	if _, _, err := c.ZIncrBy("inf", ZAddOptions{}, "a", math.Inf(-1)); err != ErrScoreNaN {
+		t.Fatalf("inf + -inf: err=%v", err)
+	}
+}
+
+func TestZSetRanges(t *testing.T) {
+	c := New(&mockPersistence{})
+	defer c.Close()
+
+	for i := 1; i <= 5; i++ {
+		c.ZAdd("s", ZAddOptions{}, ZMember{"m" + strconv.Itoa(i), float64(i)})
+	}
+	for _, m := range []string{"a", "b", "c", "d"} {
+		c.ZAdd("lex", ZAddOptions{}, ZMember{m, 0})
+	}
+
+	score := func(min, max string) ScoreRange {
+		r, err := ParseScoreRange(min, max)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+	lex := func(min, max string) LexRange {
+		r, err := ParseLexRange(min, max)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+
+	tests := []struct {
+		name string
+		got  func() ([]ZMember, error)
+		want []string
+	}{
+		{"closed", func() ([]ZMember, error) { return c.ZRangeByScore("s", score("2", "4"), false, 0, -1) }, []string{"m2", "m3", "m4"}},
+		{"open", func() ([]ZMember, error) { return c.ZRangeByScore("s", score("(2", "(4"), false, 0, -1) }, []string{"m3"}},
+		{"inf", func() ([]ZMember, error) { return c.ZRangeByScore("s", score("-inf", "+inf"), false, 3, -1) }, []string{"m4", "m5"}},
+		{"rev limit", func() ([]ZMember, error) { return c.ZRangeByScore("s", score("1", "5"), true, 1, 2) }, []string{"m4", "m3"}},
+		{"empty", func() ([]ZMember, error) { return c.ZRangeByScore("s", score("6", "9"), false, 0, -1) }, []string{}},
+		{"lex", func() ([]ZMember, error) { return c.ZRangeByLex("lex", lex("[b", "(d"), false, 0, -1) }, []string{"b", "c"}},
+		{"lex unbounded", func() ([]ZMember, error) { return c.ZRangeByLex("lex", lex("-", "+"), true, 0, 2) }, []string{"d", "c"}},
+		{"lex inverted", func() ([]ZMember, error) { return c.ZRangeByLex("lex", lex("+", "-"), false, 0, -1) }, []string{}},
+	}
+	for _, tt := range tests {
+		got, err := tt.got()
+		if err != nil || !reflect.DeepEqual(names(got), tt.want) {
+			t.Errorf("%s = %v, %v; want %v", tt.name, names(got), err, tt.want)
+		}
+	}
+
+	if n, _ := c.ZCount("s", score("(1", "3")); n != 2 {
+		t.Fatalf("ZCount = %d, want 2", n)
+	}
+	if n, _ := c.ZRemRangeByScore("s", score("-inf", "2")); n != 2 {
+		t.Fatalf("ZRemRangeByScore = %d, want 2", n)
+	}
+	if n, _ := c.ZCard("s"); n != 3 {
+		t.Fatalf("ZCard = %d, want 3", n)
+	}
+	if _, err := ParseScoreRange("x", "1"); err != ErrScoreRange {
+		t.Fatalf("ParseScoreRange(x): err=%v", err)
+	}
+	if _, err := ParseLexRange("b", "+"); err != ErrLexRange {
+		t.Fatalf("ParseLexRange(b): err=%v", err)
+	}
+}
+
+func TestZSetStore(t *testing.T) {
+	c := New(&mockPersistence{})
+	defer c.Close()
+
+	c.ZAdd("a", ZAddOptions{}, ZMember{"x", 1}, ZMember{"y", 2})
+	c.ZAdd("b", ZAddOptions{}, ZMember{"y", 10}, ZMember{"z", 20})
+	c.SAdd("tags", "y", "w")
+
+	if n, _ := c.ZUnionStore("u", []string{"a", "b"}, []float64{1, 2}, AggregateSum); n != 3 {
+		t.Fatalf("ZUnionStore = %d, want 3", n)
+	}
+	if score, _, _ := c.ZScore("u", "y"); score != 22 {
+		t.Fatalf("weighted y = %v, want 22", score)
+	}
+	if n, _ := c.ZInterStore("i", []string{"a", "b", "tags"}, nil, AggregateMax); n != 1 {
+		t.Fatalf("ZInterStore = %d, want 1", n)
+	}
+	if score, _, _ := c.ZScore("i", "y"); score != 10 {
+		t.Fatalf("max y = %v, want 10", score)
+	}
+	// dst среди источников, пустой результат удаляет dst
+	if n, _ := c.ZInterStore("u", []string{"u", "none"}, nil, AggregateSum); n != 0 || c.Exists("u") != 0 {
+		t.Fatalf("ZInterStore with missing key = %d, exists=%d", n, c.Exists("u"))
+	}
+
+	c.Set("str", "v", 0, false)
+	if _, err := c.ZUnionStore("d", []string{"a", "str"}, nil, AggregateSum); err != ErrWrongType {
+		t.Fatalf("ZUnionStore with string source: err=%v", err)
+	}
+}
+
+func TestZSetReplay(t *testing.T) {
+	rec := &recordPersistence{}
+	c := New(rec)
+	defer c.Close()
+
+	c.ZAdd("z", ZAddOptions{}, ZMember{"a", 1}, ZMember{"b", 2}, ZMember{"c", 3}, ZMember{"d", 4})
+	c.ZIncrBy("z", ZAddOptions{}, "a", 10)
+	c.ZAdd("z", ZAddOptions{GT: true}, ZMember{"b", 1}, ZMember{"c", 0.5})
+	c.ZRem("z", "d")
+	c.ZPopMax("z", 1)
+	c.ZAdd("w", ZAddOptions{}, ZMember{"b", math.Inf(-1)}, ZMember{"e", 5})
+	c.ZRemRangeByScore("w", ScoreRange{Min: 5, Max: 5})
+	c.ZUnionStore("u", []string{"z", "w"}, nil, AggregateMin)
+
+	restored := New(&mockPersistence{})
+	defer restored.Close()
+	rec.replayInto(restored)
+
+	for _, key := range []string{"z", "w", "u"} {
+		want, _ := c.ZRange(key, 0, -1, false)
+		got, _ := restored.ZRange(key, 0, -1, false)
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("replayed %s = %v, want %v", key, got, want)
+		}
+	}
+	if restored.CountKeys() != c.CountKeys() {
+		t.Fatalf("CountKeys = %d, want %d", restored.CountKeys(), c.CountKeys())
+	}
+}
+
+// TestSkiplistRank сверяет ранги и выборки skiplist с отсортированным срезом
+// после случайных вставок, обновлений и удалений.
+func TestSkiplistRank(t *testing.T) {
+	z := newZSet()
+	ref := make(map[string]float64)
+	rng := rand.New(rand.NewSource(1))
+
+	for i := 0; i < 5000; i++ {
+		member := "m" + strconv.Itoa(rng.Intn(500))
+		if rng.Intn(4) == 0 {
+			z.Remove(member)
+			delete(ref, member)
+		} else {
+			score := float64(rng.Intn(100))
+			z.Put(member, score)
+			ref[member] = score
+		}
+	}
+
+	want := make([]ZMember, 0, len(ref))
+	for m, score := range ref {
+		want = append(want, ZMember{m, score})
+	}
+	sort.Slice(want, func(i, j int) bool {
+		if want[i].Score != want[j].Score {
+			return want[i].Score < want[j].Score
+		}
+		return want[i].Member < want[j].Member
+	})
+
+	if got := z.Members(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("order mismatch: %d members, want %d", len(got), len(want))
+	}
+	for i, m := range want {
+		if rank, _ := z.Rank(m.Member, false); rank != i {
+			t.Fatalf("Rank(%s) = %d, want %d", m.Member, rank, i)
+		}
+	}
+	if n := z.Count(ScoreRange{Min: 10, Max: 20}); n != len(z.Range(ScoreRange{Min: 10, Max: 20}, false, 0, -1)) {
+		t.Fatalf("Count = %d disagrees with Range", n)
+	}
+}
@@ -0,0 +1,182 @@
+package cold
+
+import (
+	"os"
+	"slices"
+)
+
+/*
+
+	Компактизация.
+
+	Перезапись или удаление ключа оставляет его прежнюю запись мёртвой.
+	Compact берёт сегменты, где мёртвых байт не меньше половины (или все,
+	но сегмент мал), переносит живые записи в активный сегмент и удаляет
+	файл. Активный сегмент перед этим закрывается. Сегмент читается без
+	блокировки — закрытый сегмент неизменен; блокировка берётся только на
+	перенос пачки записей. Запись переносится, если индекс всё ещё
+	указывает на неё: ключ мог быть перезаписан или удалён по ходу.
+
+	Tombstone нужен, пока в более старом сегменте может лежать удалённое
+	им значение. В самом старом сегменте tombstone выбрасываются, в
+	остальных — переносятся, если ключ так и не появился снова.
+
+*/
+
+const (
+	compactMinSize = 1 << 20 // сегменты меньше сжимаются, только если мертвы целиком
+	compactBatch   = 4 << 20 // байт записей на один захват блокировки
+)
+
+// Compact сжимает сегменты, в которых мёртвых записей от половины.
+// Если компактизация уже идёт, сразу возвращается.
+func (s *Store) Compact() error {
+	if !s.compactMu.TryLock() {
+		return nil
+	}
+	defer s.compactMu.Unlock()
+
+	ids, err := s.compactable()
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := s.compactSegment(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compactable — номера сегментов к сжатию по возрастанию. Если среди них
+// активный, он закрывается.
+func (s *Store) compactable() ([]uint32, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var ids []uint32
+	for id, g := range s.segments {
+		if g.size == 0 {
+			continue
+		}
+		if g.dead >= g.size && g != s.active || g.size >= compactMinSize && g.dead*2 >= g.size {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+
+	if len(ids) > 0 && ids[len(ids)-1] == s.active.id {
+		if err := s.rotateLocked(); err != nil {
+			return nil, err
+		}
+	}
+	return ids, nil
+}
+
+// pending — запись сжимаемого сегмента, ждущая переноса.
+type pending struct {
+	rec record
+	off int64
+}
+
+// compactSegment переносит живые записи сегмента в активный и удаляет его.
+func (s *Store) compactSegment(id uint32) error {
+	s.mu.RLock()
+	g := s.segments[id]
+	oldest := true
+	for other := range s.segments {
+		if other < id {
+			oldest = false
+			break
+		}
+	}
+	s.mu.RUnlock()
+	if g == nil {
+		return nil
+	}
+
+	var (
+		batch []pending
+		bytes int64
+	)
+	_, err := readRecords(g, g.size, func(rec record, off, size int64) error {
+		if rec.kind == recordDelete && oldest {
+			return nil
+		}
+		batch = append(batch, pending{rec: rec, off: off})
+		bytes += size
+		if bytes < compactBatch {
+			return nil
+		}
+		err := s.moveBatch(g, batch)
+		batch, bytes = batch[:0], 0
+		return err
+	})
+	if err == nil {
+		err = s.moveBatch(g, batch)
+	}
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.segments[id] != g {
+		return nil // FlushAll по ходу
+	}
+	// Перенесённое должно быть на диске раньше, чем исчезнет оригинал
+	if err := s.active.f.Sync(); err != nil {
+		return err
+	}
+	delete(s.segments, id)
+	g.f.Close()
+	return os.Remove(segmentPath(s.dir, id))
+}
+
+// moveBatch дописывает в активный сегмент ещё нужные записи пачки.
+func (s *Store) moveBatch(g *segment, batch []pending) error {
+	if len(batch) == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.segments[g.id] != g {
+		return nil
+	}
+
+	var (
+		buf   []byte
+		moved []pending
+	)
+	for _, p := range batch {
+		e, indexed := s.index[p.rec.key]
+		live := p.rec.kind == recordPut && indexed && e.seg == g.id && e.off == p.off
+		if !live && (p.rec.kind != recordDelete || indexed) {
+			continue
+		}
+		moved = append(moved, p)
+		buf = appendRecord(buf, p.rec.kind, p.rec.key, p.rec.value, p.rec.expireAt)
+	}
+	if len(buf) == 0 {
+		return nil
+	}
+
+	dst, err := s.writeLocked(buf)
+	if err != nil {
+		return err
+	}
+	off := dst.size - int64(len(buf))
+	for _, p := range moved {
+		n := int64(recordLen(p.rec.key, p.rec.value))
+		if p.rec.kind == recordDelete {
+			dst.dead += n
+		} else {
+			e := s.index[p.rec.key]
+			e.seg, e.off = dst.id, off
+			s.index[p.rec.key] = e
+		}
+		off += n
+	}
+	return nil
+}
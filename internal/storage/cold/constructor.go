@@ -12,7 +12,6 @@ import (
 
 */
 
-
 /*
 
 	Странно называть это cold'ом,
@@ -20,7 +19,9 @@ import (
 	________________________________________________
 	________________________________________________
 
-	New создаёт "cold store" в указанной дирректории
+	New создаёт "cold store" в указанной дирректории:
+	открывает сегменты, восстанавливает по ним индекс и
+	переносит в сегменты cold.gob прежнего формата, если он есть.
 
 */
 func New(dir string) (*Store, error) {
@@ -30,15 +31,19 @@ func New(dir string) (*Store, error) {
 	}
 
 	s := &Store{
-		dir:	dir,
-		index: 	make(map[string]entry),
-
+		dir:      dir,
+		index:    make(map[string]entry),
+		segments: make(map[uint32]*segment),
 	}
 
-
 	if err := s.load(); err != nil {
-		// просто начинаем с пустого
+		s.closeSegments()
+		return nil, err
+	}
+	if err := s.migrateGob(); err != nil {
+		s.closeSegments()
+		return nil, err
 	}
 
 	return s, nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,93 @@
+package cold
+
+import (
+	"container/heap"
+	"log"
+)
+
+/*
+
+	TTL в cold storage.
+
+	Истёкший ключ невидим для Get, Has, Stat, Keys и Scan сразу, а из
+	индекса его убирает Expire (зовётся janitor'ом) — так же, как RAM
+	чистит ExpireByTTL. Ключи с TTL лежат в min-heap по времени
+	истечения. Перезапись и удаление ключа heap не трогают: устаревший
+	элемент отбрасывается, когда доходит до вершины.
+
+	Expire пишет tombstone, как Delete: иначе после компактизации
+	сегмента с истёкшей записью при рестарте ожило бы прежнее значение
+	ключа из более старого сегмента. При загрузке истёкшие записи
+	в индекс не попадают.
+
+*/
+
+// expiry — элемент heap: ключ и время истечения его записи.
+type expiry struct {
+	key      string
+	expireAt int64
+}
+
+type expiryHeap []expiry
+
+func (h expiryHeap) Len() int           { return len(h) }
+func (h expiryHeap) Less(i, j int) bool { return h[i].expireAt < h[j].expireAt }
+func (h expiryHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *expiryHeap) Push(x any)        { *h = append(*h, x.(expiry)) }
+func (h *expiryHeap) Pop() any {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
+
+// Expire убирает из индекса до limit ключей, истёкших к now (нс).
+// Возвращает, сколько убрано.
+func (s *Store) Expire(now int64, limit int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var buf []byte
+	removed := 0
+	for len(s.ttl) > 0 && removed < limit && s.ttl[0].expireAt <= now {
+		top := heap.Pop(&s.ttl).(expiry)
+		if e, ok := s.index[top.key]; !ok || e.expireAt != top.expireAt {
+			continue // ключ перезаписан или удалён
+		}
+		s.unindex(top.key)
+		buf = appendRecord(buf, recordDelete, top.key, "", 0)
+		removed++
+	}
+	if len(buf) == 0 {
+		return removed
+	}
+
+	g, err := s.writeLocked(buf)
+	if err != nil {
+		log.Println("cold write error:", err)
+		return removed
+	}
+	g.dead += int64(len(buf))
+	return removed
+}
+
+// pushExpiry добавляет ключ в heap. Когда устаревших элементов становится
+// больше, чем живых ключей, heap строится заново по индексу.
+func (s *Store) pushExpiry(key string, expireAt int64) {
+	if len(s.ttl) >= 2*len(s.index)+1024 {
+		s.ttl = s.ttl[:0]
+		for k, e := range s.index {
+			if e.expireAt > 0 && k != key {
+				s.ttl = append(s.ttl, expiry{key: k, expireAt: e.expireAt})
+			}
+		}
+		heap.Init(&s.ttl)
+	}
+	heap.Push(&s.ttl, expiry{key: key, expireAt: expireAt})
+}
+
+// expired — истёк ли TTL записи.
+func (e entry) expired(now int64) bool {
+	return e.expireAt > 0 && e.expireAt <= now
+}
@@ -0,0 +1,298 @@
+package cold
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+
+	Формат сегмента.
+
+	Сегмент — файл <номер>.seg из записей подряд:
+
+		crc32   u32   — Castagnoli, по всему, что после него
+		kind    u8    — recordPut или recordDelete (tombstone)
+		expire  i64   — нс, 0 — без TTL
+		klen    u32
+		vlen    u32
+		key, value
+
+	Числа little-endian. Записи только дописываются в активный (последний)
+	сегмент; дорастая до segmentMaxSize, он закрывается и начинается
+	следующий. При старте сегменты читаются по порядку номеров: последняя
+	запись ключа побеждает, tombstone удаляет ключ. Недописанный или
+	повреждённый хвост (падение посреди записи) обрезается.
+
+*/
+
+const (
+	recordPut    = 1
+	recordDelete = 2
+
+	headerSize     = 4 + 1 + 8 + 4 + 4
+	segmentMaxSize = 64 << 20
+	segmentExt     = ".seg"
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+var errCorrupt = errors.New("cold: corrupt record")
+
+// record — разобранная запись сегмента.
+type record struct {
+	kind     byte
+	expireAt int64
+	key      string
+	value    string
+}
+
+// appendRecord дописывает запись в b.
+func appendRecord(b []byte, kind byte, key, value string, expireAt int64) []byte {
+	start := len(b)
+	b = append(b, 0, 0, 0, 0, kind)
+	b = binary.LittleEndian.AppendUint64(b, uint64(expireAt))
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(key)))
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(value)))
+	b = append(b, key...)
+	b = append(b, value...)
+	binary.LittleEndian.PutUint32(b[start:], crc32.Checksum(b[start+4:], crcTable))
+	return b
+}
+
+func recordLen(key, value string) int {
+	return headerSize + len(key) + len(value)
+}
+
+// RecordLen — сколько байт на диске займёт значение ключа.
+func RecordLen(key, value string) int64 {
+	return int64(recordLen(key, value))
+}
+
+// recordSize — длина записи по её заголовку.
+func recordSize(header []byte) int64 {
+	return headerSize + int64(binary.LittleEndian.Uint32(header[13:])) +
+		int64(binary.LittleEndian.Uint32(header[17:]))
+}
+
+// parseRecord разбирает запись, занимающую b целиком.
+func parseRecord(b []byte) (record, error) {
+	if len(b) < headerSize || recordSize(b) != int64(len(b)) ||
+		binary.LittleEndian.Uint32(b) != crc32.Checksum(b[4:], crcTable) {
+		return record{}, errCorrupt
+	}
+	kind := b[4]
+	if kind != recordPut && kind != recordDelete {
+		return record{}, errCorrupt
+	}
+	klen := int(binary.LittleEndian.Uint32(b[13:]))
+	return record{
+		kind:     kind,
+		expireAt: int64(binary.LittleEndian.Uint64(b[5:])),
+		key:      string(b[headerSize : headerSize+klen]),
+		value:    string(b[headerSize+klen:]),
+	}, nil
+}
+
+// readRecords читает записи сегмента с начала до limit байт и вызывает
+// fn с каждой и её смещением. Возвращает, сколько байт прочитано
+// целыми записями; err — первая битая или недописанная запись.
+func readRecords(g *segment, limit int64, fn func(rec record, off, size int64) error) (int64, error) {
+	r := bufio.NewReaderSize(io.NewSectionReader(g.f, 0, limit), 256<<10)
+	header := make([]byte, headerSize)
+
+	var off int64
+	for off < limit {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return off, errCorrupt
+		}
+		size := recordSize(header)
+		if off+size > limit {
+			return off, errCorrupt
+		}
+		buf := make([]byte, size)
+		copy(buf, header)
+		if _, err := io.ReadFull(r, buf[headerSize:]); err != nil {
+			return off, errCorrupt
+		}
+		rec, err := parseRecord(buf)
+		if err != nil {
+			return off, err
+		}
+		if err := fn(rec, off, size); err != nil {
+			return off, err
+		}
+		off += size
+	}
+	return off, nil
+}
+
+func segmentPath(dir string, id uint32) string {
+	return filepath.Join(dir, fmt.Sprintf("%08d%s", id, segmentExt))
+}
+
+// openSegment открывает (или создаёт) сегмент.
+func openSegment(dir string, id uint32) (*segment, error) {
+	f, err := os.OpenFile(segmentPath(dir, id), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &segment{id: id, f: f, size: info.Size()}, nil
+}
+
+// write дописывает b в конец сегмента. При ошибке размер не меняется —
+// следующая запись ляжет поверх недописанной.
+func (g *segment) write(b []byte) error {
+	if _, err := g.f.WriteAt(b, g.size); err != nil {
+		return err
+	}
+	g.size += int64(len(b))
+	return nil
+}
+
+// load открывает сегменты каталога и строит по ним индекс.
+func (s *Store) load() error {
+	names, err := filepath.Glob(filepath.Join(s.dir, "*"+segmentExt))
+	if err != nil {
+		return err
+	}
+	var ids []uint32
+	for _, name := range names {
+		id, err := strconv.ParseUint(strings.TrimSuffix(filepath.Base(name), segmentExt), 10, 32)
+		if err == nil {
+			ids = append(ids, uint32(id))
+		}
+	}
+	slices.Sort(ids)
+
+	now := time.Now().UnixNano()
+	for _, id := range ids {
+		g, err := openSegment(s.dir, id)
+		if err != nil {
+			return err
+		}
+		s.segments[id] = g
+		s.active = g
+
+		valid, err := readRecords(g, g.size, func(rec record, off, size int64) error {
+			s.apply(g, rec, off, size, now)
+			return nil
+		})
+		if err != nil {
+			log.Printf("cold: segment %d: corrupt record at offset %d, truncating", id, valid)
+			if err := g.f.Truncate(valid); err != nil {
+				return err
+			}
+			g.size = valid
+		}
+	}
+
+	if s.active == nil {
+		g, err := openSegment(s.dir, 1)
+		if err != nil {
+			return err
+		}
+		s.segments[g.id] = g
+		s.active = g
+	}
+	return nil
+}
+
+// apply учитывает в индексе запись сегмента g по смещению off. Запись,
+// истёкшая к now, сразу мертва.
+func (s *Store) apply(g *segment, rec record, off, size, now int64) {
+	s.unindex(rec.key)
+	e := entry{seg: g.id, size: uint32(size), off: off, expireAt: rec.expireAt}
+	if rec.kind == recordDelete || e.expired(now) {
+		g.dead += size
+		return
+	}
+	s.indexLocked(rec.key, e)
+}
+
+// indexLocked добавляет в индекс ключ, которого там нет.
+func (s *Store) indexLocked(key string, e entry) {
+	e.slot = len(s.slots)
+	s.slots = append(s.slots, key)
+	s.index[key] = e
+	if e.expireAt > 0 {
+		s.pushExpiry(key, e.expireAt)
+	}
+}
+
+// unindex убирает ключ из индекса; его запись в сегменте становится
+// мёртвой. Последний слот переносится на место освободившегося, как в
+// шардах кеша. false — ключа не было.
+func (s *Store) unindex(key string) bool {
+	e, ok := s.index[key]
+	if !ok {
+		return false
+	}
+	last := len(s.slots) - 1
+	if e.slot != last {
+		moved := s.slots[last]
+		s.slots[e.slot] = moved
+		m := s.index[moved]
+		m.slot = e.slot
+		s.index[moved] = m
+	}
+	s.slots = s.slots[:last]
+	delete(s.index, key)
+	s.segments[e.seg].dead += int64(e.size)
+	return true
+}
+
+// legacyEntry — запись cold.gob, в котором cold storage раньше держал
+// все значения в памяти.
+type legacyEntry struct {
+	Key      string
+	Value    string
+	ExpireAt int64
+}
+
+// migrateGob переносит cold.gob прежнего формата в сегменты и удаляет его.
+func (s *Store) migrateGob() error {
+	path := filepath.Join(s.dir, "cold.gob")
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	legacy := make(map[string]legacyEntry)
+	err = gob.NewDecoder(f).Decode(&legacy)
+	f.Close()
+	if err != nil {
+		log.Println("cold: skipping unreadable cold.gob:", err)
+	}
+
+	items := make([]Item, 0, len(legacy))
+	for key, e := range legacy {
+		items = append(items, Item{Key: key, Value: e.Value, ExpireAt: e.ExpireAt})
+	}
+	if err := s.PutBatch(items); err != nil {
+		return err
+	}
+	if err := s.Flush(); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
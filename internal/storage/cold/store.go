@@ -1,60 +1,170 @@
 package cold
 
 import (
-	"encoding/gob"
+	"log"
 	"os"
-	"path/filepath"
+	"time"
 )
 
 /*
 
 	Тут методы:
 		Put,
-		Get,
 		PutBatch,
+		Get,
+		Has,
+		Stat,
+		Keys,
+		Scan,
 		Delete,
 		Len,
-		Load
+		Size,
 		Flush,
-		FlushAll
+		FlushAll,
+		Close
 
-*/
+	Компактизация — compact.go, формат сегментов — segment.go,
+	TTL — expire.go.
 
+*/
 
 // Put сохраняет ключ в cold storage.
-func (s *Store) Put(key, value string, expireAt int64) {
-	s.mu.Lock()
-	s.index[key] = entry{Key: key, Value: value, ExpireAt: expireAt}
-	s.mu.Unlock()
+func (s *Store) Put(key, value string, expireAt int64) error {
+	return s.PutBatch([]Item{{Key: key, Value: value, ExpireAt: expireAt}})
 }
 
-// PutBatch сохраняет пачку ключей атомарно.
-func (s *Store) PutBatch(items []Item) {
+// PutBatch сохраняет пачку ключей одной записью в сегмент. При ошибке
+// записи ни один ключ пачки не попадает в индекс.
+func (s *Store) PutBatch(items []Item) error {
+	if len(items) == 0 {
+		return nil
+	}
+	size := 0
+	for _, it := range items {
+		size += recordLen(it.Key, it.Value)
+	}
+	buf := make([]byte, 0, size)
+	for _, it := range items {
+		buf = appendRecord(buf, recordPut, it.Key, it.Value, it.ExpireAt)
+	}
+
 	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g, err := s.writeLocked(buf)
+	if err != nil {
+		return err
+	}
+	off := g.size - int64(len(buf))
 	for _, it := range items {
-		s.index[it.Key] = entry{Key: it.Key, Value: it.Value, ExpireAt: it.ExpireAt}
+		n := int64(recordLen(it.Key, it.Value))
+		s.unindex(it.Key)
+		s.indexLocked(it.Key, entry{seg: g.id, size: uint32(n), off: off, expireAt: it.ExpireAt})
+		off += n
+	}
+	return nil
+}
+
+// Get читает значение ключа с диска. Ключ с истёкшим TTL не найден.
+func (s *Store) Get(key string) (value string, expireAt int64, ok bool) {
+	s.mu.RLock()
+	e, ok := s.index[key]
+	if !ok || e.expired(time.Now().UnixNano()) {
+		s.mu.RUnlock()
+		return "", 0, false
+	}
+	buf := make([]byte, e.size)
+	_, err := s.segments[e.seg].f.ReadAt(buf, e.off)
+	s.mu.RUnlock()
+
+	var rec record
+	if err == nil {
+		rec, err = parseRecord(buf)
 	}
-	s.mu.Unlock()
+	if err == nil && rec.key != key {
+		err = errCorrupt
+	}
+	if err != nil {
+		log.Printf("cold read error: key %q: %v", key, err)
+		return "", 0, false
+	}
+	return rec.value, e.expireAt, true
+}
+
+// Has проверяет наличие живого ключа, не читая значение.
+func (s *Store) Has(key string) bool {
+	_, _, ok := s.Stat(key)
+	return ok
 }
 
-// Get ищет ключ в cold storage.
-func (s *Store) Get(key string) (string, bool) {
+// Stat возвращает длину значения и время истечения (нс, 0 — без TTL)
+// живого ключа, не читая значение с диска.
+func (s *Store) Stat(key string) (valueLen int, expireAt int64, ok bool) {
 	s.mu.RLock()
 	e, ok := s.index[key]
 	s.mu.RUnlock()
+	if !ok || e.expired(time.Now().UnixNano()) {
+		return 0, 0, false
+	}
+	return int(e.size) - headerSize - len(key), e.expireAt, true
+}
 
-	if !ok {
-		return "", false
+// Keys возвращает живые ключи, для которых match вернул true.
+func (s *Store) Keys(match func(key string) bool) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now().UnixNano()
+	var result []string
+	for key, e := range s.index {
+		if !e.expired(now) && match(key) {
+			result = append(result, key)
+		}
 	}
+	return result
+}
+
+// Scan просматривает до count слотов ниже remaining и передаёт fn живые
+// ключи. Слоты обходятся с конца, как shard.scan в кеше. Возвращает
+// новое remaining и число просмотренных слотов.
+func (s *Store) Scan(remaining uint64, count int, fn func(key string)) (uint64, int) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
-	return e.Value, true
+	now := time.Now().UnixNano()
+	remaining = min(remaining, uint64(len(s.slots)))
+	examined := 0
+	for remaining > 0 && examined < count {
+		remaining--
+		examined++
+		key := s.slots[remaining]
+		if !s.index[key].expired(now) {
+			fn(key)
+		}
+	}
+	return remaining, examined
 }
 
-// Delete удаляет ключ из cold storage.
+// Delete удаляет ключ из cold storage: tombstone в сегменте, чтобы ключ
+// не ожил после рестарта.
 func (s *Store) Delete(key string) {
+	// Быстрый путь — Delete зовётся на каждую запись в кеш
+	if !s.Has(key) {
+		return
+	}
+
 	s.mu.Lock()
-	delete(s.index, key)
-	s.mu.Unlock()
+	defer s.mu.Unlock()
+	if !s.unindex(key) {
+		return
+	}
+	buf := appendRecord(nil, recordDelete, key, "", 0)
+	g, err := s.writeLocked(buf)
+	if err != nil {
+		log.Println("cold write error:", err)
+		return
+	}
+	g.dead += int64(len(buf))
 }
 
 // Len возвращает количество ключей в cold storage.
@@ -64,51 +174,89 @@ func (s *Store) Len() int {
 	return len(s.index)
 }
 
+// Size возвращает объём живых записей в байтах — сколько останется на
+// диске после компактизации.
+func (s *Store) Size() int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var size int64
+	for _, g := range s.segments {
+		size += g.size - g.dead
+	}
+	return size
+}
 
-// Flush сбрасывает index на диск (gob).
+// Flush сбрасывает активный сегмент на диск (fsync). Закрытые сегменты
+// синхронизированы при закрытии.
 func (s *Store) Flush() error {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
+	return s.active.f.Sync()
+}
 
-	path := filepath.Join(s.dir, "cold.gob")
-	tmp := path + ".tmp"
+// FlushAll очищает весь cold store (индекс и сегменты).
+func (s *Store) FlushAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	f, err := os.Create(tmp)
-	if err != nil {
-		return err
+	next := s.active.id + 1
+	for id, g := range s.segments {
+		g.f.Close()
+		os.Remove(segmentPath(s.dir, id))
 	}
+	s.segments = make(map[uint32]*segment)
+	s.index = make(map[string]entry)
+	s.slots = nil
+	s.ttl = nil
 
-	if err := gob.NewEncoder(f).Encode(s.index); err != nil {
-		f.Close()
-		os.Remove(tmp)
-		return err
+	g, err := openSegment(s.dir, next)
+	if err != nil {
+		log.Println("cold flush error:", err)
+		return
 	}
-	f.Close()
-
-	return os.Rename(tmp, path)
+	s.segments[g.id] = g
+	s.active = g
 }
 
+// Close сбрасывает активный сегмент на диск и закрывает файлы.
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-// load загружает index с диска.
-func (s *Store) load() error {
-	path := filepath.Join(s.dir, "cold.gob")
+	err := s.active.f.Sync()
+	s.closeSegments()
+	return err
+}
 
-	f, err := os.Open(path)
-	if err != nil {
-		return err
+func (s *Store) closeSegments() {
+	for _, g := range s.segments {
+		g.f.Close()
 	}
-	defer f.Close()
-
-	return gob.NewDecoder(f).Decode(&s.index)
 }
 
+// writeLocked дописывает записи в активный сегмент; если он переполнится,
+// сначала начинает следующий. Возвращает сегмент, куда легли записи.
+func (s *Store) writeLocked(b []byte) (*segment, error) {
+	if s.active.size > 0 && s.active.size+int64(len(b)) > segmentMaxSize {
+		if err := s.rotateLocked(); err != nil {
+			return nil, err
+		}
+	}
+	g := s.active
+	return g, g.write(b)
+}
 
-// FlushAll очищает весь cold store (RAM + disk).
-func (s *Store) FlushAll() {
-	s.mu.Lock()
-	s.index = make(map[string]entry)
-	s.mu.Unlock()
-
-	path := filepath.Join(s.dir, "cold.gob")
-	os.Remove(path)
+// rotateLocked закрывает активный сегмент для записи (fsync) и начинает
+// следующий.
+func (s *Store) rotateLocked() error {
+	if err := s.active.f.Sync(); err != nil {
+		return err
+	}
+	g, err := openSegment(s.dir, s.active.id+1)
+	if err != nil {
+		return err
+	}
+	s.segments[g.id] = g
+	s.active = g
+	return nil
 }
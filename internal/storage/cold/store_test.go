@@ -0,0 +1,226 @@
+package cold
+
+import (
+	"encoding/gob"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func checkValues(t *testing.T, s *Store, want map[string]string) {
+	t.Helper()
+	if s.Len() != len(want) {
+		t.Fatalf("Len = %d, want %d", s.Len(), len(want))
+	}
+	for key, value := range want {
+		if got, _, ok := s.Get(key); !ok || got != value {
+			t.Fatalf("Get(%q) = %q, %v; want %q", key, got, ok, value)
+		}
+	}
+}
+
+func TestStoreReopen(t *testing.T) {
+	dir := t.TempDir()
+	s, err := New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expireAt := time.Now().Add(time.Hour).UnixNano()
+	s.Put("a", "1", 0)
+	s.PutBatch([]Item{{Key: "b", Value: "2"}, {Key: "c", Value: "3", ExpireAt: expireAt}})
+	s.Put("a", "overwritten", 0)
+	s.Delete("b")
+	s.Delete("missing")
+	want := map[string]string{"a": "overwritten", "c": "3"}
+	checkValues(t, s, want)
+	if s.Has("b") || !s.Has("c") {
+		t.Fatal("Has after Delete")
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	checkValues(t, s, want)
+	if e := s.index["c"]; e.expireAt != expireAt {
+		t.Fatalf("expireAt after reopen = %d", e.expireAt)
+	}
+
+	s.FlushAll()
+	checkValues(t, s, map[string]string{})
+	s.Put("d", "4", 0)
+	checkValues(t, s, map[string]string{"d": "4"})
+}
+
+// TestStoreCompaction — сжатие убирает мёртвые записи и удалённые ключи
+// не оживают после рестарта.
+func TestStoreCompaction(t *testing.T) {
+	dir := t.TempDir()
+	s, err := New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	value := strings.Repeat("v", 1024)
+	want := make(map[string]string)
+	for round := 0; round < 3; round++ {
+		for i := 0; i < 1000; i++ {
+			key := "key:" + strconv.Itoa(i)
+			s.Put(key, value+strconv.Itoa(round), 0)
+			want[key] = value + strconv.Itoa(round)
+		}
+	}
+	for i := 0; i < 1000; i += 2 {
+		key := "key:" + strconv.Itoa(i)
+		s.Delete(key)
+		delete(want, key)
+	}
+	before := s.active.size
+
+	if err := s.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	checkValues(t, s, want)
+	var disk, dead int64
+	for _, g := range s.segments {
+		disk += g.size
+		dead += g.dead
+	}
+	if disk >= before/4 || dead != 0 {
+		t.Fatalf("after compaction: %d bytes on disk (%d dead), %d before", disk, dead, before)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "cold", "*"+segmentExt))
+	if len(files) != len(s.segments) {
+		t.Fatalf("%d segment files, %d segments", len(files), len(s.segments))
+	}
+	s.Close()
+
+	s, err = New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	checkValues(t, s, want)
+}
+
+// TestStoreTornTail — недописанная запись в конце сегмента обрезается.
+func TestStoreTornTail(t *testing.T) {
+	dir := t.TempDir()
+	s, err := New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Put("a", "1", 0)
+	path := segmentPath(s.dir, s.active.id)
+	s.Close()
+
+	torn := appendRecord(nil, recordPut, "b", "2", 0)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(torn[:len(torn)-1])
+	f.Close()
+
+	s, err = New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	checkValues(t, s, map[string]string{"a": "1"})
+	s.Put("c", "3", 0)
+	checkValues(t, s, map[string]string{"a": "1", "c": "3"})
+}
+
+// TestStoreMigrateGob — cold.gob прежнего формата переносится в сегменты.
+func TestStoreMigrateGob(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cold", "cold.gob")
+	os.MkdirAll(filepath.Dir(path), 0755)
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gob.NewEncoder(f).Encode(map[string]legacyEntry{
+		"a": {Key: "a", Value: "1"},
+		"b": {Key: "b", Value: "2", ExpireAt: time.Now().Add(time.Hour).UnixNano()},
+	})
+	f.Close()
+
+	s, err := New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	checkValues(t, s, map[string]string{"a": "1", "b": "2"})
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("cold.gob left after migration: %v", err)
+	}
+}
+
+// TestStoreExpire — истёкший ключ не виден сразу, Expire убирает его из
+// индекса, и ни Compact, ни рестарт не возвращают прежнее значение.
+func TestStoreExpire(t *testing.T) {
+	dir := t.TempDir()
+	s, err := New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UnixNano()
+	s.Put("old", "v1", 0)
+	s.Put("later", "x", now+int64(time.Hour))
+	s.Put("kept", "y", 0)
+	s.rotateLocked()
+	expiring := s.active.id
+	s.Put("old", "v2", now+int64(50*time.Millisecond)) // перекрывает v1
+	for i := 0; i < 100; i++ {
+		s.Put("gone:"+strconv.Itoa(i), "z", now+int64(50*time.Millisecond))
+	}
+
+	if n, exp, ok := s.Stat("later"); !ok || n != 1 || exp != now+int64(time.Hour) {
+		t.Fatalf("Stat(later) = %d, %d, %v", n, exp, ok)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if _, _, ok := s.Get("old"); ok || s.Has("gone:0") {
+		t.Fatal("expired key still visible")
+	}
+	if keys := s.Keys(func(string) bool { return true }); len(keys) != 2 {
+		t.Fatalf("Keys = %v", keys)
+	}
+
+	if n := s.Expire(time.Now().UnixNano(), 10); n != 10 {
+		t.Fatalf("Expire with limit removed %d", n)
+	}
+	s.Expire(time.Now().UnixNano(), 1000)
+	checkValues(t, s, map[string]string{"later": "x", "kept": "y"})
+	if len(s.slots) != 2 {
+		t.Fatalf("%d slots for 2 keys", len(s.slots))
+	}
+
+	// Сегмент с v2 мёртв целиком и сжимается, v1 остаётся в старом —
+	// tombstone от Expire не даёт ему ожить
+	s.rotateLocked()
+	if err := s.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.segments[expiring]; ok {
+		t.Fatal("expired segment not compacted")
+	}
+	s.Close()
+
+	s, err = New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	checkValues(t, s, map[string]string{"later": "x", "kept": "y"})
+}
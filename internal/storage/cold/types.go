@@ -1,6 +1,9 @@
 package cold
 
-import "sync"
+import (
+	"os"
+	"sync"
+)
 
 /*
 
@@ -8,18 +11,36 @@ import "sync"
 
 */
 
+// entry — где на диске лежит значение ключа. В RAM остаются только
+// ключ и этот адрес, само значение читается из сегмента по запросу.
 type entry struct {
-	Key 	string
-	Value	string
-	ExpireAt int64
+	seg      uint32 // номер сегмента
+	size     uint32 // длина записи целиком
+	off      int64  // смещение записи в сегменте
+	expireAt int64
+	slot     int // позиция в Store.slots
 }
 
+// segment — файл сегмента. Пишется только активный (последний), прочие
+// неизменны до компактизации.
+type segment struct {
+	id   uint32
+	f    *os.File
+	size int64 // байт записано
+	dead int64 // байт в перезаписанных, удалённых значениях и tombstone
+}
 
-// Store - файловое хранилище для холодных данных (старые имеется ввиду)
+// Store - файловое хранилище для холодных данных (старые имеется ввиду):
+// append-only сегменты на диске и индекс ключ → смещение в RAM.
 type Store struct {
-	mu		sync.RWMutex	//Я думаю над тем, чтобы поменять это на атомарные, если не стоит, то пишите
-	dir 	string			
-	index	map[string]entry // ключ значение
+	mu        sync.RWMutex
+	dir       string
+	index     map[string]entry // ключ → адрес значения
+	slots     []string         // ключи индекса подряд, для SCAN
+	ttl       expiryHeap       // ключи с TTL по времени истечения
+	segments  map[uint32]*segment
+	active    *segment
+	compactMu sync.Mutex // одна компактизация за раз
 }
 
 // Item — элемент для batch операций.
@@ -27,4 +48,4 @@ type Item struct {
 	Key      string
 	Value    string
 	ExpireAt int64
-}
\ No newline at end of file
+}
@@ -7,9 +7,11 @@ import (
 /*
  	Start запускает фоновые тикеры.
  	TTL expiry: каждую секунду (O(1) через heap).
- 	Cold eviction: каждые 10 секунд (sample 16 ключей/шард).
- 	Cold flush: каждые 30 секунд (gob на диск).
-	
+ 	Cold eviction: раз в ColdPolicy.Interval (по умолчанию 10 секунд).
+ 	Cold flush: раз в ColdPolicy.FlushInterval (по умолчанию 30 секунд;
+ 	fsync сегментов, компактизация в фоне).
+	Интервалы перечитываются после каждого срабатывания — CONFIG SET
+	действует со следующего.
 */
 
 func (j *Janitor) Start() {
@@ -25,27 +27,30 @@ func (j *Janitor) run() {
 	ttlTicker := time.NewTicker(1 * time.Second)
 	defer ttlTicker.Stop()
 
-	coldTicker := time.NewTicker(10 * time.Second)
-	defer coldTicker.Stop()
+	coldTimer := time.NewTimer(j.cache.ColdPolicy().Interval)
+	defer coldTimer.Stop()
 
-	var flushTicker *time.Ticker
+	var flushTimer *time.Timer
 	var flushCh <-chan time.Time
 
 	for {
-		// Динамическая инициализация flush ticker при появлении cold 
-		if j.cache.HasCold() && flushTicker == nil {
-			flushTicker = time.NewTicker(30 * time.Second)
-			flushCh = flushTicker.C
-			defer flushTicker.Stop()
+		// Динамическая инициализация flush timer при появлении cold 
+		if j.cache.HasCold() && flushTimer == nil {
+			flushTimer = time.NewTimer(j.cache.ColdPolicy().FlushInterval)
+			flushCh = flushTimer.C
+			defer flushTimer.Stop()
 		}
 
 		select {
 		case <-ttlTicker.C:
 			j.cache.ExpireByTTL()
-		case <-coldTicker.C:
+		case <-coldTimer.C:
 			j.cache.EvictCold()
+			coldTimer.Reset(j.cache.ColdPolicy().Interval)
 		case <-flushCh:
 			j.cache.FlushCold()
+			go j.cache.CompactCold()
+			flushTimer.Reset(j.cache.ColdPolicy().FlushInterval)
 		case <-j.stopCh:
 			return
 		}